@@ -13,6 +13,9 @@ type Config struct {
 	Database DatabaseConfig
 	Redis    RedisConfig
 	WhatsApp WhatsAppConfig
+	Telegram TelegramConfig
+	Storage  StorageConfig
+	Outbound OutboundConfig
 	JWT      JWTConfig
 	Security SecurityConfig
 	Features FeaturesConfig
@@ -50,6 +53,44 @@ type WhatsAppConfig struct {
 	APIVersion    string
 	BaseURL       string
 	WebhookSecret string
+	// How long processed inbound message IDs are remembered. Deliveries older
+	// than this are rejected as replays.
+	WebhookMaxAge time.Duration
+	// Template sent instead of a free-form message when the contact's 24-hour
+	// service window is closed. Empty means such sends are refused.
+	WindowFallbackTemplate string
+}
+
+type TelegramConfig struct {
+	BotToken string
+	// Updates are delivered to this URL when set, otherwise the bot polls.
+	WebhookURL string
+	// How long each long-poll request waits for new updates.
+	PollTimeout time.Duration
+	// Payment provider token from BotFather. "stub" simulates payments
+	// locally; empty disables Telegram Payments.
+	PaymentProviderToken string
+	// Bot API server; empty uses api.telegram.org.
+	APIURL string
+}
+
+type StorageConfig struct {
+	Driver    string
+	LocalPath string
+	PublicURL string
+	// Key used to sign media URLs; files are only served with a valid
+	// signature
+	SigningKey string
+	// How long a signed media URL stays valid
+	URLTTL time.Duration
+}
+
+type OutboundConfig struct {
+	Workers       int
+	MaxAttempts   int
+	RatePerSecond int
+	BaseBackoff   time.Duration
+	MaxBackoff    time.Duration
 }
 
 type JWTConfig struct {
@@ -62,6 +103,7 @@ type SecurityConfig struct {
 	RateLimitPerMinute int
 	BcryptCost         int
 	EnableCORS         bool
+	EncryptionKey      string // used to encrypt stored credentials
 }
 
 type FeaturesConfig struct {
@@ -105,6 +147,29 @@ func LoadConfig() *Config {
 			APIVersion:    getEnv("WHATSAPP_API_VERSION", "v18.0"),
 			BaseURL:       getEnv("WHATSAPP_BASE_URL", "https://graph.facebook.com"),
 			WebhookSecret: getEnv("WHATSAPP_WEBHOOK_SECRET", ""),
+			WebhookMaxAge: getDuration("WHATSAPP_WEBHOOK_MAX_AGE", 7*24*time.Hour),
+			WindowFallbackTemplate: getEnv("WHATSAPP_WINDOW_FALLBACK_TEMPLATE", ""),
+		},
+		Telegram: TelegramConfig{
+			BotToken:    getEnv("TELEGRAM_BOT_TOKEN", ""),
+			WebhookURL:  getEnv("TELEGRAM_WEBHOOK_URL", ""),
+			PollTimeout: getDuration("TELEGRAM_POLL_TIMEOUT", 30*time.Second),
+			PaymentProviderToken: getEnv("TELEGRAM_PAYMENT_PROVIDER_TOKEN", ""),
+			APIURL:               getEnv("TELEGRAM_API_URL", ""),
+		},
+		Storage: StorageConfig{
+			Driver:     getEnv("STORAGE_DRIVER", "local"),
+			LocalPath:  getEnv("STORAGE_LOCAL_PATH", "./uploads"),
+			PublicURL:  getEnv("STORAGE_PUBLIC_URL", "http://localhost:8080/media"),
+			SigningKey: getEnv("STORAGE_SIGNING_KEY", ""),
+			URLTTL:     getDuration("STORAGE_URL_TTL", 30*24*time.Hour),
+		},
+		Outbound: OutboundConfig{
+			Workers:       getInt("OUTBOUND_WORKERS", 4),
+			MaxAttempts:   getInt("OUTBOUND_MAX_ATTEMPTS", 5),
+			RatePerSecond: getInt("OUTBOUND_RATE_PER_SECOND", 20),
+			BaseBackoff:   getDuration("OUTBOUND_BASE_BACKOFF", 2*time.Second),
+			MaxBackoff:    getDuration("OUTBOUND_MAX_BACKOFF", 10*time.Minute),
 		},
 		JWT: JWTConfig{
 			Secret:        getEnv("JWT_SECRET", "your-secret-key"),
@@ -115,6 +180,7 @@ func LoadConfig() *Config {
 			RateLimitPerMinute: getInt("RATE_LIMIT_PER_MINUTE", 60),
 			BcryptCost:         getInt("BCRYPT_COST", 10),
 			EnableCORS:         getBool("ENABLE_CORS", true),
+			EncryptionKey:      getEnv("ENCRYPTION_KEY", ""),
 		},
 		Features: FeaturesConfig{
 			EnableGames:      getBool("ENABLE_GAMES", true),
@@ -66,6 +66,7 @@ func migrate(db *gorm.DB) error {
 		&models.User{},
 		&models.UserPreferences{},
 		&models.Contact{},
+		&models.WhatsAppAccount{},
 		&models.Message{},
 		&models.AutoReply{},
 		&models.Broadcast{},
@@ -87,6 +88,16 @@ func migrate(db *gorm.DB) error {
 		&models.CustomCommand{},
 		&models.Template{},
 		&models.SystemLog{},
+		&models.TelegramUser{},
+		&models.TelegramMessage{},
+		&models.TelegramIntegration{},
+		&models.TelegramWebhook{},
+		&models.TelegramSession{},
+		&models.TelegramNotification{},
+		&models.TelegramGroup{},
+		&models.TelegramCommand{},
+		&models.TelegramBot{},
+		&models.TelegramAnalytics{},
 	}
 
 	for _, model := range models {
@@ -1,8 +1,10 @@
 package handlers
 
 import (
+	"errors"
 	"net/http"
 	"strconv"
+	"time"
 
 	"whatsapp-bot/internal/services"
 	"whatsapp-bot/pkg/logger"
@@ -551,4 +553,198 @@ func (h *AdminHandler) UpdateSystemSettings(c *gin.Context) {
 	logger.Log.Info("System settings updated by admin")
 
 	c.JSON(http.StatusOK, gin.H{"message": "System settings updated successfully"})
-}
\ No newline at end of file
+}
+func (h *AdminHandler) GetOutboundQueueStats(c *gin.Context) {
+	userID := c.MustGet("user_id").(uuid.UUID)
+
+	// Check if user is admin
+	user, err := h.serviceManager.UserService.GetUserByID(userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get user"})
+		return
+	}
+
+	if !user.IsAdmin {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Admin access required"})
+		return
+	}
+
+	stats, err := h.serviceManager.OutboundQueue.GetQueueStats()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get outbound queue stats"})
+		return
+	}
+
+	c.JSON(http.StatusOK, stats)
+}
+
+func (h *AdminHandler) GetDeadLetters(c *gin.Context) {
+	userID := c.MustGet("user_id").(uuid.UUID)
+
+	// Check if user is admin
+	user, err := h.serviceManager.UserService.GetUserByID(userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get user"})
+		return
+	}
+
+	if !user.IsAdmin {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Admin access required"})
+		return
+	}
+
+	limit := 50
+	if limitStr := c.Query("limit"); limitStr != "" {
+		if l, err := strconv.Atoi(limitStr); err == nil && l > 0 && l <= 500 {
+			limit = l
+		}
+	}
+
+	jobs, err := h.serviceManager.OutboundQueue.GetDeadLetters(limit)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get dead letters"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"jobs":  jobs,
+		"count": len(jobs),
+	})
+}
+
+func (h *AdminHandler) ReplayDeadLetter(c *gin.Context) {
+	userID := c.MustGet("user_id").(uuid.UUID)
+
+	// Check if user is admin
+	user, err := h.serviceManager.UserService.GetUserByID(userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get user"})
+		return
+	}
+
+	if !user.IsAdmin {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Admin access required"})
+		return
+	}
+
+	jobID := c.Param("job_id")
+	if err := h.serviceManager.OutboundQueue.ReplayDeadLetter(jobID); err != nil {
+		if err == services.ErrOutboundJobNotFound {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Dead letter not found"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to replay dead letter"})
+		return
+	}
+
+	logger.Log.WithField("job_id", jobID).Info("Dead letter replayed by admin")
+
+	c.JSON(http.StatusOK, gin.H{"message": "Dead letter replayed successfully"})
+}
+
+func (h *AdminHandler) ReplayAllDeadLetters(c *gin.Context) {
+	userID := c.MustGet("user_id").(uuid.UUID)
+
+	// Check if user is admin
+	user, err := h.serviceManager.UserService.GetUserByID(userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get user"})
+		return
+	}
+
+	if !user.IsAdmin {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Admin access required"})
+		return
+	}
+
+	replayed, err := h.serviceManager.OutboundQueue.ReplayAllDeadLetters()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to replay dead letters"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message":  "Dead letters replayed successfully",
+		"replayed": replayed,
+	})
+}
+
+func (h *AdminHandler) DeleteDeadLetter(c *gin.Context) {
+	userID := c.MustGet("user_id").(uuid.UUID)
+
+	// Check if user is admin
+	user, err := h.serviceManager.UserService.GetUserByID(userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get user"})
+		return
+	}
+
+	if !user.IsAdmin {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Admin access required"})
+		return
+	}
+
+	if err := h.serviceManager.OutboundQueue.DeleteDeadLetter(c.Param("job_id")); err != nil {
+		if err == services.ErrOutboundJobNotFound {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Dead letter not found"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete dead letter"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Dead letter deleted successfully"})
+}
+
+// BackfillTelegramAnalytics recomputes the daily Telegram analytics of past days
+func (h *AdminHandler) BackfillTelegramAnalytics(c *gin.Context) {
+	userID := c.MustGet("user_id").(uuid.UUID)
+
+	// Check if user is admin
+	user, err := h.serviceManager.UserService.GetUserByID(userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get user"})
+		return
+	}
+
+	if !user.IsAdmin {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Admin access required"})
+		return
+	}
+
+	var req struct {
+		StartDate string `json:"start_date" binding:"required"`
+		EndDate   string `json:"end_date" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	start, err := time.ParseInLocation("2006-01-02", req.StartDate, time.Local)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid start_date, use YYYY-MM-DD"})
+		return
+	}
+	end, err := time.ParseInLocation("2006-01-02", req.EndDate, time.Local)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid end_date, use YYYY-MM-DD"})
+		return
+	}
+
+	days, err := h.serviceManager.TelegramAnalyticsService.Backfill(start, end)
+	if err != nil {
+		if errors.Is(err, services.ErrInvalidAnalyticsRange) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid date range"})
+			return
+		}
+		logger.Log.WithError(err).Error("Failed to backfill Telegram analytics")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to backfill Telegram analytics"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "Telegram analytics backfilled successfully",
+		"days":    days,
+	})
+}
@@ -1,10 +1,12 @@
 package handlers
 
 import (
+	"errors"
 	"net/http"
 
 	"github.com/gin-gonic/gin"
 	"github.com/google/uuid"
+	"kilocode.dev/whatsapp-bot/internal/models"
 	"kilocode.dev/whatsapp-bot/internal/services"
 	"kilocode.dev/whatsapp-bot/pkg/utils"
 )
@@ -181,4 +183,41 @@ func (h *AutoReplyHandler) ToggleAutoReply(c *gin.Context) {
 	}
 
 	utils.ResponseSuccess(c, autoReply)
-}
\ No newline at end of file
+}
+
+// SetAutoReplyRule sets an auto-reply's priority, stop/continue behaviour
+// and conditions
+func (h *AutoReplyHandler) SetAutoReplyRule(c *gin.Context) {
+	userID := c.MustGet("user_id").(uuid.UUID)
+
+	replyID, err := uuid.Parse(c.Param("reply_id"))
+	if err != nil {
+		utils.ResponseError(c, http.StatusBadRequest, "Invalid reply ID")
+		return
+	}
+
+	var req struct {
+		Priority         int                        `json:"priority"`
+		ContinueMatching bool                       `json:"continue_matching"`
+		Conditions       models.AutoReplyConditions `json:"conditions"`
+	}
+
+	if err := utils.BindAndValidate(c, &req); err != nil {
+		return
+	}
+
+	autoReply, err := h.autoReplyService.SetAutoReplyRule(userID, replyID, req.Priority, req.ContinueMatching, req.Conditions)
+	switch {
+	case errors.Is(err, services.ErrAutoReplyNotFound):
+		utils.ResponseError(c, http.StatusNotFound, "Auto-reply not found")
+		return
+	case errors.Is(err, services.ErrInvalidAutoReplyConditions):
+		utils.ResponseError(c, http.StatusBadRequest, err.Error())
+		return
+	case err != nil:
+		utils.ResponseError(c, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	utils.ResponseSuccess(c, autoReply)
+}
@@ -0,0 +1,88 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"kilocode.dev/whatsapp-bot/internal/services"
+	"kilocode.dev/whatsapp-bot/pkg/utils"
+)
+
+type BridgeHandler struct {
+	bridgeService *services.BridgeService
+}
+
+func NewBridgeHandler(bridgeService *services.BridgeService) *BridgeHandler {
+	return &BridgeHandler{
+		bridgeService: bridgeService,
+	}
+}
+
+// GetBridges gets the user's WhatsApp ↔ Telegram links
+func (h *BridgeHandler) GetBridges(c *gin.Context) {
+	userID := c.MustGet("user_id").(uuid.UUID)
+
+	bridges, err := h.bridgeService.GetBridges(userID)
+	if err != nil {
+		utils.ResponseError(c, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	utils.ResponseSuccess(c, bridges)
+}
+
+// UpdateBridge pauses, resumes or changes the direction of a link
+func (h *BridgeHandler) UpdateBridge(c *gin.Context) {
+	userID := c.MustGet("user_id").(uuid.UUID)
+
+	bridgeID, err := uuid.Parse(c.Param("bridge_id"))
+	if err != nil {
+		utils.ResponseError(c, http.StatusBadRequest, "Invalid bridge ID")
+		return
+	}
+
+	var req struct {
+		IsSyncEnabled *bool  `json:"is_sync_enabled"`
+		SyncDirection string `json:"sync_direction" binding:"omitempty,oneof=telegram_to_whatsapp whatsapp_to_telegram both"`
+	}
+
+	if err := utils.BindAndValidate(c, &req); err != nil {
+		return
+	}
+
+	bridge, err := h.bridgeService.UpdateBridge(userID, bridgeID, req.IsSyncEnabled, req.SyncDirection)
+	if err != nil {
+		respondBridgeError(c, err)
+		return
+	}
+
+	utils.ResponseSuccess(c, bridge)
+}
+
+// DeleteBridge removes a link
+func (h *BridgeHandler) DeleteBridge(c *gin.Context) {
+	userID := c.MustGet("user_id").(uuid.UUID)
+
+	bridgeID, err := uuid.Parse(c.Param("bridge_id"))
+	if err != nil {
+		utils.ResponseError(c, http.StatusBadRequest, "Invalid bridge ID")
+		return
+	}
+
+	if err := h.bridgeService.DeleteBridge(userID, bridgeID); err != nil {
+		respondBridgeError(c, err)
+		return
+	}
+
+	utils.ResponseSuccess(c, gin.H{"message": "Bridge deleted successfully"})
+}
+
+func respondBridgeError(c *gin.Context, err error) {
+	if errors.Is(err, services.ErrBridgeNotFound) {
+		utils.ResponseError(c, http.StatusNotFound, "Bridge not found")
+		return
+	}
+	utils.ResponseError(c, http.StatusInternalServerError, err.Error())
+}
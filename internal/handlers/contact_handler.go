@@ -0,0 +1,52 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"kilocode.dev/whatsapp-bot/internal/services"
+	"kilocode.dev/whatsapp-bot/pkg/utils"
+)
+
+type ContactHandler struct {
+	contactService *services.ContactService
+}
+
+func NewContactHandler(contactService *services.ContactService) *ContactHandler {
+	return &ContactHandler{
+		contactService: contactService,
+	}
+}
+
+// SetTags replaces a contact's tags
+func (h *ContactHandler) SetTags(c *gin.Context) {
+	userID := c.MustGet("user_id").(uuid.UUID)
+
+	contactID, err := uuid.Parse(c.Param("contact_id"))
+	if err != nil {
+		utils.ResponseError(c, http.StatusBadRequest, "Invalid contact ID")
+		return
+	}
+
+	var req struct {
+		Tags []string `json:"tags"`
+	}
+
+	if err := utils.BindAndValidate(c, &req); err != nil {
+		return
+	}
+
+	contact, err := h.contactService.SetTags(userID, contactID, req.Tags)
+	if errors.Is(err, services.ErrContactNotFound) {
+		utils.ResponseError(c, http.StatusNotFound, "Contact not found")
+		return
+	}
+	if err != nil {
+		utils.ResponseError(c, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	utils.ResponseSuccess(c, contact)
+}
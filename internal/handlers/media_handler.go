@@ -0,0 +1,54 @@
+package handlers
+
+import (
+	"fmt"
+	"mime"
+	"net/http"
+	"os"
+	"path"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"kilocode.dev/whatsapp-bot/pkg/storage"
+	"kilocode.dev/whatsapp-bot/pkg/utils"
+)
+
+type MediaHandler struct {
+	storage storage.Storage
+}
+
+func NewMediaHandler(storage storage.Storage) *MediaHandler {
+	return &MediaHandler{
+		storage: storage,
+	}
+}
+
+// ServeMedia serves a stored file to holders of its signed, unexpired URL.
+// Files are always sent as attachments so uploaded content is never
+// rendered inline.
+func (h *MediaHandler) ServeMedia(c *gin.Context) {
+	key := strings.TrimLeft(c.Param("filepath"), "/")
+	if key == "" || !h.storage.Verify(key, c.Query(storage.SignatureParam), c.Query(storage.ExpiresParam)) {
+		utils.ResponseError(c, http.StatusForbidden, "Invalid or expired media signature")
+		return
+	}
+
+	data, err := h.storage.Get(key)
+	if err != nil {
+		if os.IsNotExist(err) {
+			utils.ResponseError(c, http.StatusNotFound, "Media not found")
+			return
+		}
+		utils.ResponseError(c, http.StatusInternalServerError, "Failed to read media")
+		return
+	}
+
+	contentType := mime.TypeByExtension(path.Ext(key))
+	if contentType == "" {
+		contentType = "application/octet-stream"
+	}
+
+	c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=%q", path.Base(key)))
+	c.Header("X-Content-Type-Options", "nosniff")
+	c.Data(http.StatusOK, contentType, data)
+}
@@ -1,206 +1,196 @@
 package handlers
 
 import (
-	"time"
-
 	"kilocode.dev/whatsapp-bot/internal/middleware"
 	"kilocode.dev/whatsapp-bot/internal/services"
 
 	"github.com/gin-gonic/gin"
 )
 
-// SetupRoutes configures all API routes
+// SetupRoutes registers every endpoint of the bot. main.go adds the global
+// middleware; the tests serve the same routes.
 func SetupRoutes(router *gin.Engine, serviceManager *services.ServiceManager) {
-	// Public routes
-	public := router.Group("/api/v1")
-	{
-		// Auth routes
-		authHandler := NewAuthHandler(serviceManager.UserService)
-		public.POST("/auth/register", authHandler.Register)
-		public.POST("/auth/login", authHandler.Login)
-		public.POST("/auth/refresh", authHandler.RefreshToken)
-		public.POST("/auth/forgot-password", authHandler.ForgotPassword)
-		public.POST("/auth/reset-password", authHandler.ResetPassword)
-	}
+	// Stored media files, served only through their signed URLs
+	router.GET("/media/*filepath", NewMediaHandler(serviceManager.Storage).ServeMedia)
 
-	// Protected routes
-	protected := router.Group("/api/v1")
-	protected.Use(middleware.AuthMiddleware())
-	protected.Use(middleware.RateLimitMiddleware())
+	// Health check
+	router.GET("/health", func(c *gin.Context) {
+		c.JSON(200, gin.H{"status": "healthy"})
+	})
+
+	// API routes
+	api := router.Group("/api/v1")
 	{
-		// User routes
-		userHandler := NewUserHandler(serviceManager.UserService)
-		protected.GET("/users/profile", userHandler.GetProfile)
-		protected.PUT("/users/profile", userHandler.UpdateProfile)
-		protected.DELETE("/users/profile", userHandler.DeleteProfile)
-		protected.POST("/users/change-password", userHandler.ChangePassword)
-		protected.GET("/users/settings", userHandler.GetSettings)
-		protected.PUT("/users/settings", userHandler.UpdateSettings)
+		// Auth routes
+		auth := api.Group("/auth")
+		{
+			authHandler := NewAuthHandler(serviceManager)
+			auth.POST("/login", authHandler.Login)
+			auth.POST("/register", authHandler.Register)
+			auth.POST("/refresh", authHandler.RefreshToken)
+		}
 
 		// WhatsApp routes
-		whatsappHandler := NewWhatsAppHandler(serviceManager.WhatsAppService)
-		protected.POST("/whatsapp/send-message", whatsappHandler.SendMessage)
-		protected.POST("/whatsapp/send-media", whatsappHandler.SendMedia)
-		protected.POST("/whatsapp/send-template", whatsappHandler.SendTemplate)
-		protected.GET("/whatsapp/contacts", whatsappHandler.GetContacts)
-		protected.GET("/whatsapp/chats", whatsappHandler.GetChats)
-		protected.GET("/whatsapp/chat/:chat_id", whatsappHandler.GetChatMessages)
-		protected.POST("/whatsapp/mark-read", whatsappHandler.MarkAsRead)
-		protected.GET("/whatsapp/status", whatsappHandler.GetStatus)
+		whatsapp := api.Group("/whatsapp")
+		whatsapp.Use(middleware.AuthJWT())
+		{
+			whatsappHandler := NewWhatsAppHandler(serviceManager)
+			whatsapp.POST("/send", whatsappHandler.SendMessage)
+			whatsapp.POST("/broadcast", whatsappHandler.BroadcastMessage)
+			whatsapp.GET("/contacts", whatsappHandler.GetContacts)
+			whatsapp.POST("/groups", whatsappHandler.CreateGroup)
+			whatsapp.GET("/groups", whatsappHandler.GetGroups)
+
+			accountHandler := NewWhatsAppAccountHandler(serviceManager.WhatsAppAccountService)
+			whatsapp.GET("/accounts", accountHandler.GetAccounts)
+			whatsapp.POST("/accounts", accountHandler.CreateAccount)
+			whatsapp.PUT("/accounts/:account_id/token", accountHandler.UpdateAccessToken)
+			whatsapp.DELETE("/accounts/:account_id", accountHandler.DeleteAccount)
+		}
+
+		// Message template routes
+		templates := api.Group("/templates")
+		templates.Use(middleware.AuthJWT())
+		{
+			templateHandler := NewTemplateHandler(serviceManager.TemplateService, serviceManager.WhatsAppService)
+			templates.GET("", templateHandler.GetTemplates)
+			templates.POST("", templateHandler.CreateTemplate)
+			templates.GET("/:template_id", templateHandler.GetTemplate)
+			templates.PUT("/:template_id", templateHandler.UpdateTemplate)
+			templates.DELETE("/:template_id", templateHandler.DeleteTemplate)
+			templates.POST("/:template_id/send", templateHandler.SendTemplate)
+			templates.POST("/:template_id/broadcast", templateHandler.BroadcastTemplate)
+		}
 
 		// Auto-reply routes
-		autoReplyHandler := NewAutoReplyHandler(serviceManager.AutoReplyService)
-		protected.GET("/auto-replies", autoReplyHandler.GetAutoReplies)
-		protected.POST("/auto-replies", autoReplyHandler.CreateAutoReply)
-		protected.GET("/auto-replies/:reply_id", autoReplyHandler.GetAutoReply)
-		protected.PUT("/auto-replies/:reply_id", autoReplyHandler.UpdateAutoReply)
-		protected.DELETE("/auto-replies/:reply_id", autoReplyHandler.DeleteAutoReply)
-		protected.POST("/auto-replies/:reply_id/toggle", autoReplyHandler.ToggleAutoReply)
-
-		// Broadcast routes
-		broadcastHandler := NewBroadcastHandler(serviceManager.BroadcastService)
-		protected.GET("/broadcasts", broadcastHandler.GetBroadcasts)
-		protected.POST("/broadcasts", broadcastHandler.CreateBroadcast)
-		protected.GET("/broadcasts/:broadcast_id", broadcastHandler.GetBroadcast)
-		protected.PUT("/broadcasts/:broadcast_id", broadcastHandler.UpdateBroadcast)
-		protected.DELETE("/broadcasts/:broadcast_id", broadcastHandler.DeleteBroadcast)
-		protected.POST("/broadcasts/:broadcast_id/send", broadcastHandler.SendBroadcast)
-		protected.GET("/broadcasts/:broadcast_id/stats", broadcastHandler.GetBroadcastStats)
+		autoReplies := api.Group("/auto-replies")
+		autoReplies.Use(middleware.AuthJWT())
+		{
+			autoReplyHandler := NewAutoReplyHandler(serviceManager.AutoReplyService)
+			autoReplies.GET("", autoReplyHandler.GetAutoReplies)
+			autoReplies.POST("", autoReplyHandler.CreateAutoReply)
+			autoReplies.GET("/:reply_id", autoReplyHandler.GetAutoReply)
+			autoReplies.PUT("/:reply_id", autoReplyHandler.UpdateAutoReply)
+			autoReplies.DELETE("/:reply_id", autoReplyHandler.DeleteAutoReply)
+			autoReplies.POST("/:reply_id/toggle", autoReplyHandler.ToggleAutoReply)
+			autoReplies.PUT("/:reply_id/rule", autoReplyHandler.SetAutoReplyRule)
+		}
+
+		// Contact routes
+		contacts := api.Group("/contacts")
+		contacts.Use(middleware.AuthJWT())
+		{
+			contactHandler := NewContactHandler(serviceManager.ContactService)
+			contacts.PUT("/:contact_id/tags", contactHandler.SetTags)
+		}
+
+		// Bot features routes
+		bot := api.Group("/bot")
+		bot.Use(middleware.AuthJWT())
+		{
+			botHandler := NewBotHandler(serviceManager)
+			bot.GET("/features", botHandler.GetFeatures)
+			bot.POST("/features/:feature/enable", botHandler.EnableFeature)
+			bot.POST("/features/:feature/disable", botHandler.DisableFeature)
+			bot.GET("/analytics", botHandler.GetAnalytics)
+		}
 
 		// Game routes
-		gameHandler := NewGameHandler(serviceManager.GameService)
-		protected.GET("/games", gameHandler.GetGames)
-		protected.POST("/games/start", gameHandler.StartGame)
-		protected.POST("/games/:game_id/play", gameHandler.PlayGame)
-		protected.GET("/games/:game_id/leaderboard", gameHandler.GetLeaderboard)
-		protected.GET("/games/:game_id/stats", gameHandler.GetGameStats)
-		protected.POST("/games/trivia/start", gameHandler.StartTrivia)
-		protected.POST("/games/trivia/answer", gameHandler.AnswerTrivia)
-
-		// Utility routes
-		utilityHandler := NewUtilityHandler(serviceManager.UtilityService)
-		protected.POST("/utils/qr-code", utilityHandler.CreateQRCode)
-		protected.POST("/utils/short-link", utilityHandler.CreateShortLink)
-		protected.GET("/utils/short-link/:alias", utilityHandler.GetShortLink)
-		protected.POST("/utils/currency-convert", utilityHandler.ConvertCurrency)
-		protected.GET("/utils/weather", utilityHandler.GetWeather)
-		protected.POST("/utils/translate", utilityHandler.TranslateText)
-		protected.POST("/utils/location-info", utilityHandler.GetLocationInfo)
-		protected.POST("/utils/polls", utilityHandler.CreatePoll)
-		protected.POST("/utils/polls/:poll_id/vote", utilityHandler.VotePoll)
-		protected.GET("/utils/polls/:poll_id/results", utilityHandler.GetPollResults)
-		protected.POST("/utils/reminders", utilityHandler.CreateReminder)
-		protected.GET("/utils/reminders", utilityHandler.GetReminders)
-		protected.DELETE("/utils/reminders/:reminder_id", utilityHandler.DeleteReminder)
-		protected.POST("/utils/notes", utilityHandler.CreateNote)
-		protected.GET("/utils/notes", utilityHandler.GetNotes)
-		protected.PUT("/utils/notes/:note_id", utilityHandler.UpdateNote)
-		protected.DELETE("/utils/notes/:note_id", utilityHandler.DeleteNote)
-		protected.GET("/utils/notes/search", utilityHandler.SearchNotes)
-		protected.POST("/utils/timers", utilityHandler.CreateTimer)
-		protected.GET("/utils/timers/:timer_id", utilityHandler.GetTimer)
-		protected.DELETE("/utils/timers/:timer_id", utilityHandler.StopTimer)
-		protected.POST("/utils/file-upload", utilityHandler.CreateFileUpload)
-		protected.GET("/utils/file-upload/:upload_id", utilityHandler.GetFileUpload)
-		protected.DELETE("/utils/file-upload/:upload_id", utilityHandler.DeleteFileUpload)
+		game := api.Group("/game")
+		game.Use(middleware.AuthJWT())
+		{
+			gameHandler := NewGameHandler(serviceManager)
+			game.GET("/leaderboard", gameHandler.GetLeaderboard)
+			game.POST("/quiz/start", gameHandler.StartQuiz)
+			game.POST("/quiz/answer", gameHandler.SubmitAnswer)
+			game.GET("/khodam/:name", gameHandler.CheckKhodam)
+		}
 
 		// Business routes
-		businessHandler := NewBusinessHandler(serviceManager.BusinessService)
-		protected.POST("/business/products", businessHandler.CreateProduct)
-		protected.GET("/business/products", businessHandler.GetProducts)
-		protected.GET("/business/products/:product_id", businessHandler.GetProduct)
-		protected.PUT("/business/products/:product_id", businessHandler.UpdateProduct)
-		protected.DELETE("/business/products/:product_id", businessHandler.DeleteProduct)
-		protected.POST("/business/orders", businessHandler.CreateOrder)
-		protected.GET("/business/orders", businessHandler.GetOrders)
-		protected.GET("/business/orders/:order_id", businessHandler.GetOrder)
-		protected.PUT("/business/orders/:order_id/status", businessHandler.UpdateOrderStatus)
-		protected.POST("/business/invoices", businessHandler.CreateInvoice)
-		protected.GET("/business/invoices", businessHandler.GetInvoices)
-		protected.GET("/business/invoices/:invoice_id", businessHandler.GetInvoice)
-		protected.PUT("/business/invoices/:invoice_id/status", businessHandler.UpdateInvoiceStatus)
-		protected.POST("/business/customers", businessHandler.CreateCustomer)
-		protected.GET("/business/customers", businessHandler.GetCustomers)
-		protected.GET("/business/customers/:customer_id", businessHandler.GetCustomer)
-		protected.PUT("/business/customers/:customer_id", businessHandler.UpdateCustomer)
-		protected.DELETE("/business/customers/:customer_id", businessHandler.DeleteCustomer)
-		protected.POST("/business/payments", businessHandler.CreatePayment)
-		protected.GET("/business/payments", businessHandler.GetPayments)
-		protected.GET("/business/payments/:payment_id", businessHandler.GetPayment)
-		protected.GET("/business/stats", businessHandler.GetBusinessStats)
-		protected.GET("/business/sales-report", businessHandler.GetSalesReport)
-
-		// Moderation routes
-		moderationHandler := NewModerationHandler(serviceManager.ModerationService)
-		protected.GET("/moderation/blocked-users", moderationHandler.GetBlockedUsers)
-		protected.POST("/moderation/block-user", moderationHandler.BlockUser)
-		protected.DELETE("/moderation/unblock-user/:user_id", moderationHandler.UnblockUser)
-		protected.GET("/moderation/reported-messages", moderationHandler.GetReportedMessages)
-		protected.POST("/moderation/report-message", moderationHandler.ReportMessage)
-		protected.PUT("/moderation/reported-messages/:report_id", moderationHandler.UpdateReportStatus)
-		protected.GET("/moderation/spam-detections", moderationHandler.GetSpamDetections)
-		protected.POST("/moderation/mark-spam", moderationHandler.MarkAsSpam)
-		protected.GET("/moderation/content-filters", moderationHandler.GetContentFilters)
-		protected.POST("/moderation/content-filters", moderationHandler.CreateContentFilter)
-		protected.PUT("/moderation/content-filters/:filter_id", moderationHandler.UpdateContentFilter)
-		protected.DELETE("/moderation/content-filters/:filter_id", moderationHandler.DeleteContentFilter)
-
-		// Analytics routes
-		analyticsHandler := NewAnalyticsHandler(serviceManager.AnalyticsService)
-		protected.GET("/analytics/dashboard", analyticsHandler.GetDashboard)
-		protected.GET("/analytics/messages", analyticsHandler.GetMessageAnalytics)
-		protected.GET("/analytics/users", analyticsHandler.GetUserAnalytics)
-		protected.GET("/analytics/games", analyticsHandler.GetGameAnalytics)
-		protected.GET("/analytics/business", analyticsHandler.GetBusinessAnalytics)
-		protected.GET("/analytics/export", analyticsHandler.ExportAnalytics)
-	}
+		business := api.Group("/business")
+		business.Use(middleware.AuthJWT())
+		{
+			businessHandler := NewBusinessHandler(serviceManager)
+			business.GET("/products", businessHandler.GetProducts)
+			business.POST("/products", businessHandler.CreateProduct)
+			business.GET("/orders", businessHandler.GetOrders)
+			business.POST("/orders", businessHandler.CreateOrder)
+			business.GET("/customers", businessHandler.GetCustomers)
+		}
 
-	// Admin routes (requires admin role)
-	admin := router.Group("/api/v1/admin")
-	admin.Use(middleware.AuthMiddleware())
-	admin.Use(middleware.AdminMiddleware())
-	{
-		adminHandler := NewAdminHandler(serviceManager)
-		admin.GET("/dashboard", adminHandler.GetDashboard)
-		admin.GET("/users", adminHandler.GetUsers)
-		admin.GET("/users/:user_id", adminHandler.GetUser)
-		admin.PUT("/users/:user_id", adminHandler.UpdateUser)
-		admin.DELETE("/users/:user_id", adminHandler.DeleteUser)
-		admin.POST("/users/:user_id/ban", adminHandler.BanUser)
-		admin.POST("/users/:user_id/unban", adminHandler.UnbanUser)
-		admin.GET("/system-stats", adminHandler.GetSystemStats)
-		admin.GET("/logs", adminHandler.GetLogs)
-		admin.DELETE("/logs", adminHandler.ClearLogs)
-		admin.GET("/settings", adminHandler.GetSettings)
-		admin.PUT("/settings", adminHandler.UpdateSettings)
-		admin.POST("/backup", adminHandler.CreateBackup)
-		admin.GET("/backups", adminHandler.GetBackups)
-		admin.POST("/backups/:backup_id/restore", adminHandler.RestoreBackup)
-		admin.DELETE("/backups/:backup_id", adminHandler.DeleteBackup)
-		admin.GET("/system-health", adminHandler.GetSystemHealth)
-		admin.POST("/system-maintenance", adminHandler.SetMaintenanceMode)
-		admin.GET("/broadcast-messages", adminHandler.GetBroadcastMessages)
-		admin.POST("/broadcast-messages", adminHandler.CreateBroadcastMessage)
-		admin.DELETE("/broadcast-messages/:message_id", adminHandler.DeleteBroadcastMessage)
-		admin.GET("/spam-reports", adminHandler.GetSpamReports)
-		admin.PUT("/spam-reports/:report_id", adminHandler.UpdateSpamReport)
-		admin.GET("/content-reports", adminHandler.GetContentReports)
-		admin.PUT("/content-reports/:report_id", adminHandler.UpdateContentReport)
+		// Utility routes
+		utils := api.Group("/utils")
+		utils.Use(middleware.AuthJWT())
+		{
+			utilsHandler := NewUtilsHandler(serviceManager)
+			utils.GET("/weather/:city", utilsHandler.GetWeather)
+			utils.GET("/currency", utilsHandler.ConvertCurrency)
+			utils.POST("/translate", utilsHandler.Translate)
+			utils.GET("/qrcode", utilsHandler.GenerateQRCode)
+		}
+
+		// Telegram routes
+		telegram := api.Group("/telegram")
+		telegram.Use(middleware.AuthJWT())
+		{
+			telegramHandler := NewTelegramHandler(serviceManager.TelegramService)
+			telegram.GET("/groups", telegramHandler.GetTelegramGroups)
+			telegram.PUT("/groups/:chat_id", telegramHandler.UpdateTelegramGroup)
+			telegram.GET("/commands", telegramHandler.GetTelegramCommands)
+			telegram.POST("/commands", telegramHandler.CreateTelegramCommand)
+			telegram.PUT("/commands/:id", telegramHandler.UpdateTelegramCommand)
+			telegram.DELETE("/commands/:id", telegramHandler.DeleteTelegramCommand)
+			telegram.POST("/orders/:order_id/invoice", telegramHandler.SendOrderInvoice)
+			telegram.GET("/analytics", telegramHandler.GetTelegramAnalytics)
+
+			telegramBotHandler := NewTelegramBotHandler(serviceManager.TelegramBotService)
+			telegram.GET("/bots", telegramBotHandler.GetBots)
+			telegram.POST("/bots", telegramBotHandler.CreateBot)
+			telegram.PUT("/bots/:bot_id", telegramBotHandler.UpdateBot)
+			telegram.DELETE("/bots/:bot_id", telegramBotHandler.DeleteBot)
+		}
+
+		// WhatsApp ↔ Telegram bridge routes
+		bridges := api.Group("/bridges")
+		bridges.Use(middleware.AuthJWT())
+		{
+			bridgeHandler := NewBridgeHandler(serviceManager.BridgeService)
+			bridges.GET("", bridgeHandler.GetBridges)
+			bridges.PUT("/:bridge_id", bridgeHandler.UpdateBridge)
+			bridges.DELETE("/:bridge_id", bridgeHandler.DeleteBridge)
+		}
+
+		// Admin routes
+		admin := api.Group("/admin")
+		admin.Use(middleware.AuthJWT())
+		admin.Use(middleware.RequireAdmin())
+		{
+			adminHandler := NewAdminHandler(serviceManager)
+			admin.GET("/users", adminHandler.GetUsers)
+			admin.GET("/stats", adminHandler.GetStats)
+			admin.POST("/broadcast", adminHandler.AdminBroadcast)
+			admin.GET("/logs", adminHandler.GetLogs)
+			admin.GET("/outbound/stats", adminHandler.GetOutboundQueueStats)
+			admin.GET("/outbound/dead-letters", adminHandler.GetDeadLetters)
+			admin.POST("/outbound/dead-letters/:job_id/replay", adminHandler.ReplayDeadLetter)
+			admin.DELETE("/outbound/dead-letters/:job_id", adminHandler.DeleteDeadLetter)
+			admin.POST("/outbound/replay", adminHandler.ReplayAllDeadLetters)
+			admin.POST("/telegram/analytics/backfill", adminHandler.BackfillTelegramAnalytics)
+
+			telegramHandler := NewTelegramHandler(serviceManager.TelegramService)
+			admin.POST("/telegram/polling/start", telegramHandler.StartPolling)
+			admin.POST("/telegram/polling/stop", telegramHandler.StopPolling)
+			admin.POST("/telegram/commands/sync", telegramHandler.SyncTelegramCommands)
+		}
 	}
 
-	// Health check route (no auth required)
-	router.GET("/health", func(c *gin.Context) {
-		c.JSON(200, gin.H{
-			"status": "healthy",
-			"timestamp": time.Now().Unix(),
-		})
-	})
+	// Webhook for WhatsApp
+	router.POST("/webhook/whatsapp", NewWhatsAppHandler(serviceManager).HandleWebhook)
 
-	// Webhook routes for WhatsApp
-	webhook := router.Group("/webhooks")
-	{
-		whatsappHandler := NewWhatsAppHandler(serviceManager.WhatsAppService)
-		webhook.POST("/whatsapp", whatsappHandler.HandleWebhook)
-		webhook.GET("/whatsapp", whatsappHandler.VerifyWebhook)
-	}
-}
\ No newline at end of file
+	// Webhook for Telegram
+	router.POST("/webhook/telegram", NewTelegramHandler(serviceManager.TelegramService).HandleWebhook)
+
+	// Webhooks of hosted Telegram bots. Bots without their own webhook URL
+	// get /webhooks/telegram/<bot id> on the TELEGRAM_WEBHOOK_URL host.
+	router.POST("/webhooks/telegram/:bot_id", NewTelegramBotHandler(serviceManager.TelegramBotService).HandleWebhook)
+}
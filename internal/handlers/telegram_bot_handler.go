@@ -0,0 +1,160 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"kilocode.dev/whatsapp-bot/internal/services"
+	"kilocode.dev/whatsapp-bot/pkg/utils"
+)
+
+type TelegramBotHandler struct {
+	botService *services.TelegramBotService
+}
+
+func NewTelegramBotHandler(botService *services.TelegramBotService) *TelegramBotHandler {
+	return &TelegramBotHandler{
+		botService: botService,
+	}
+}
+
+// GetBots gets the Telegram bots connected by the user
+func (h *TelegramBotHandler) GetBots(c *gin.Context) {
+	userID := c.MustGet("user_id").(uuid.UUID)
+
+	bots, err := h.botService.GetBots(userID)
+	if err != nil {
+		utils.ResponseError(c, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	utils.ResponseSuccess(c, bots)
+}
+
+// CreateBot connects a Telegram bot and starts it
+func (h *TelegramBotHandler) CreateBot(c *gin.Context) {
+	userID := c.MustGet("user_id").(uuid.UUID)
+
+	var req struct {
+		Name       string `json:"name"`
+		APIKey     string `json:"api_key" binding:"required"`
+		WebhookURL string `json:"webhook_url" binding:"omitempty,url"`
+	}
+
+	if err := utils.BindAndValidate(c, &req); err != nil {
+		return
+	}
+
+	bot, err := h.botService.CreateBot(userID, req.Name, req.APIKey, req.WebhookURL)
+	if err != nil {
+		respondTelegramBotError(c, err)
+		return
+	}
+
+	utils.ResponseSuccess(c, bot)
+}
+
+// UpdateBot changes a bot's name, webhook URL or active state
+func (h *TelegramBotHandler) UpdateBot(c *gin.Context) {
+	userID := c.MustGet("user_id").(uuid.UUID)
+
+	botID, err := uuid.Parse(c.Param("bot_id"))
+	if err != nil {
+		utils.ResponseError(c, http.StatusBadRequest, "Invalid bot ID")
+		return
+	}
+
+	var req struct {
+		Name       *string `json:"name"`
+		WebhookURL *string `json:"webhook_url" binding:"omitempty,url"`
+		IsActive   *bool   `json:"is_active"`
+	}
+
+	if err := utils.BindAndValidate(c, &req); err != nil {
+		return
+	}
+
+	updates := map[string]interface{}{}
+	if req.Name != nil {
+		updates["name"] = *req.Name
+	}
+	if req.WebhookURL != nil {
+		updates["webhook_url"] = *req.WebhookURL
+	}
+	if req.IsActive != nil {
+		updates["is_active"] = *req.IsActive
+	}
+
+	bot, err := h.botService.UpdateBot(userID, botID, updates)
+	if err != nil {
+		respondTelegramBotError(c, err)
+		return
+	}
+
+	utils.ResponseSuccess(c, bot)
+}
+
+// DeleteBot stops and disconnects a Telegram bot
+func (h *TelegramBotHandler) DeleteBot(c *gin.Context) {
+	userID := c.MustGet("user_id").(uuid.UUID)
+
+	botID, err := uuid.Parse(c.Param("bot_id"))
+	if err != nil {
+		utils.ResponseError(c, http.StatusBadRequest, "Invalid bot ID")
+		return
+	}
+
+	if err := h.botService.DeleteBot(userID, botID); err != nil {
+		respondTelegramBotError(c, err)
+		return
+	}
+
+	utils.ResponseSuccess(c, gin.H{"message": "Telegram bot deleted successfully"})
+}
+
+// HandleWebhook receives updates for a hosted bot
+func (h *TelegramBotHandler) HandleWebhook(c *gin.Context) {
+	botID, err := uuid.Parse(c.Param("bot_id"))
+	if err != nil {
+		utils.ResponseError(c, http.StatusNotFound, "Telegram bot not found")
+		return
+	}
+
+	service := h.botService.Bot(botID)
+	if service == nil {
+		utils.ResponseError(c, http.StatusNotFound, "Telegram bot not found")
+		return
+	}
+
+	NewTelegramHandler(service).HandleWebhook(c)
+}
+
+func respondTelegramBotError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, services.ErrTelegramBotNotFound):
+		utils.ResponseError(c, http.StatusNotFound, "Telegram bot not found")
+	case errors.Is(err, services.ErrTelegramBotExists):
+		utils.ResponseError(c, http.StatusConflict, err.Error())
+	case errors.Is(err, services.ErrInvalidTelegramToken):
+		utils.ResponseError(c, http.StatusBadRequest, err.Error())
+	case errors.Is(err, services.ErrEncryptionKeyMissing):
+		utils.ResponseError(c, http.StatusServiceUnavailable, "ENCRYPTION_KEY is not configured on the server")
+	default:
+		utils.ResponseError(c, http.StatusInternalServerError, err.Error())
+	}
+}
+
+// parseTelegramBotID parses an optional bot ID. An empty string means the
+// configured bot.
+func parseTelegramBotID(value string) (*uuid.UUID, error) {
+	if value == "" {
+		return nil, nil
+	}
+	botID, err := uuid.Parse(value)
+	if err != nil {
+		return nil, err
+	}
+	return &botID, nil
+}
@@ -1,11 +1,14 @@
 package handlers
 
 import (
+	"errors"
 	"net/http"
 	"strconv"
+	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/google/uuid"
+	"kilocode.dev/whatsapp-bot/internal/models"
 	"kilocode.dev/whatsapp-bot/internal/services"
 	"kilocode.dev/whatsapp-bot/pkg/utils"
 )
@@ -150,13 +153,23 @@ func (h *TelegramHandler) SendBroadcast(c *gin.Context) {
 	var req struct {
 		Recipients []int64 `json:"recipients" binding:"required"`
 		Message    string  `json:"message" binding:"required"`
+		BotID      string  `json:"bot_id"`
 	}
 
 	if err := utils.BindAndValidate(c, &req); err != nil {
 		return
 	}
 
-	err := h.telegramService.SendBroadcast(req.Recipients, req.Message)
+	botID, err := parseTelegramBotID(req.BotID)
+	if err != nil {
+		utils.ResponseError(c, http.StatusBadRequest, "Invalid bot ID")
+		return
+	}
+	if !h.checkBotOwner(c, botID) {
+		return
+	}
+
+	err = h.telegramService.ForBot(botID).SendBroadcast(req.Recipients, req.Message)
 	if err != nil {
 		utils.ResponseError(c, http.StatusInternalServerError, err.Error())
 		return
@@ -165,8 +178,29 @@ func (h *TelegramHandler) SendBroadcast(c *gin.Context) {
 	utils.ResponseSuccess(c, gin.H{"message": "Broadcast sent successfully"})
 }
 
+// checkBotOwner responds with 404 unless the user owns the bot, so one
+// user can't reach another user's bot by its ID.
+func (h *TelegramHandler) checkBotOwner(c *gin.Context, botID *uuid.UUID) bool {
+	err := h.telegramService.CheckBotOwner(c.MustGet("user_id").(uuid.UUID), botID)
+	switch {
+	case errors.Is(err, services.ErrTelegramBotNotFound):
+		utils.ResponseError(c, http.StatusNotFound, "Telegram bot not found")
+		return false
+	case err != nil:
+		utils.ResponseError(c, http.StatusInternalServerError, err.Error())
+		return false
+	}
+	return true
+}
+
 // HandleWebhook handles incoming Telegram webhook
 func (h *TelegramHandler) HandleWebhook(c *gin.Context) {
+	secret := c.GetHeader("X-Telegram-Bot-Api-Secret-Token")
+	if !h.telegramService.VerifyWebhookSecret(secret, utils.GetClientIP(c), c.Request.UserAgent()) {
+		utils.ResponseError(c, http.StatusUnauthorized, "Invalid webhook secret token")
+		return
+	}
+
 	var updateData map[string]interface{}
 	if err := c.ShouldBindJSON(&updateData); err != nil {
 		utils.ResponseError(c, http.StatusBadRequest, "Invalid webhook data")
@@ -390,7 +424,16 @@ func (h *TelegramHandler) GetTelegramMessages(c *gin.Context) {
 
 // GetTelegramStats gets Telegram statistics
 func (h *TelegramHandler) GetTelegramStats(c *gin.Context) {
-	stats, err := h.telegramService.GetTelegramStats()
+	botID, err := parseTelegramBotID(c.Query("bot_id"))
+	if err != nil {
+		utils.ResponseError(c, http.StatusBadRequest, "Invalid bot ID")
+		return
+	}
+	if !h.checkBotOwner(c, botID) {
+		return
+	}
+
+	stats, err := h.telegramService.GetTelegramStats(botID)
 	if err != nil {
 		utils.ResponseError(c, http.StatusInternalServerError, err.Error())
 		return
@@ -399,21 +442,313 @@ func (h *TelegramHandler) GetTelegramStats(c *gin.Context) {
 	utils.ResponseSuccess(c, stats)
 }
 
-// StartPolling starts Telegram polling mode
+// GetTelegramGroups lists the groups the user's bots are in
+func (h *TelegramHandler) GetTelegramGroups(c *gin.Context) {
+	groups, err := h.telegramService.GetTelegramGroups(c.MustGet("user_id").(uuid.UUID))
+	if err != nil {
+		utils.ResponseError(c, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	utils.ResponseSuccess(c, groups)
+}
+
+// UpdateTelegramGroup changes a group's moderation and welcome settings
+func (h *TelegramHandler) UpdateTelegramGroup(c *gin.Context) {
+	chatID, err := strconv.ParseInt(c.Param("chat_id"), 10, 64)
+	if err != nil {
+		utils.ResponseError(c, http.StatusBadRequest, "Invalid chat ID")
+		return
+	}
+
+	botID, err := parseTelegramBotID(c.Query("bot_id"))
+	if err != nil {
+		utils.ResponseError(c, http.StatusBadRequest, "Invalid bot ID")
+		return
+	}
+
+	var req struct {
+		ModerationEnabled *bool   `json:"moderation_enabled"`
+		BlockLinks        *bool   `json:"block_links"`
+		FloodLimit        *int    `json:"flood_limit" binding:"omitempty,min=0,max=1440"`
+		MaxWarnings       *int    `json:"max_warnings" binding:"omitempty,min=0,max=1440"`
+		MuteMinutes       *int    `json:"mute_minutes" binding:"omitempty,min=0,max=1440"`
+		WelcomeEnabled    *bool   `json:"welcome_enabled"`
+		WelcomeMessage    *string `json:"welcome_message"`
+	}
+
+	if err := utils.BindAndValidate(c, &req); err != nil {
+		return
+	}
+
+	updates := map[string]interface{}{}
+	if req.ModerationEnabled != nil {
+		updates["moderation_enabled"] = *req.ModerationEnabled
+	}
+	if req.BlockLinks != nil {
+		updates["block_links"] = *req.BlockLinks
+	}
+	if req.FloodLimit != nil {
+		updates["flood_limit"] = *req.FloodLimit
+	}
+	if req.MaxWarnings != nil {
+		updates["max_warnings"] = *req.MaxWarnings
+	}
+	if req.MuteMinutes != nil {
+		updates["mute_minutes"] = *req.MuteMinutes
+	}
+	if req.WelcomeEnabled != nil {
+		updates["welcome_enabled"] = *req.WelcomeEnabled
+	}
+	if req.WelcomeMessage != nil {
+		updates["welcome_message"] = *req.WelcomeMessage
+	}
+
+	group, err := h.telegramService.UpdateTelegramGroup(c.MustGet("user_id").(uuid.UUID), botID, chatID, updates)
+	if err != nil {
+		if errors.Is(err, services.ErrTelegramGroupNotFound) {
+			utils.ResponseError(c, http.StatusNotFound, "Group not found")
+			return
+		}
+		utils.ResponseError(c, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	utils.ResponseSuccess(c, group)
+}
+
+// GetTelegramCommands lists the user's stored bot commands
+func (h *TelegramHandler) GetTelegramCommands(c *gin.Context) {
+	commands, err := h.telegramService.GetTelegramCommands(c.MustGet("user_id").(uuid.UUID))
+	if err != nil {
+		utils.ResponseError(c, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	utils.ResponseSuccess(c, commands)
+}
+
+type telegramCommandRequest struct {
+	Command      *string `json:"command"`
+	Description  *string `json:"description"`
+	Response     *string `json:"response"`
+	Scope        *string `json:"scope"`
+	LanguageCode *string `json:"language_code"`
+	IsActive     *bool   `json:"is_active"`
+}
+
+func (req *telegramCommandRequest) apply(command *models.TelegramCommand) {
+	if req.Command != nil {
+		command.Command = *req.Command
+	}
+	if req.Description != nil {
+		command.Description = *req.Description
+	}
+	if req.Response != nil {
+		command.Response = *req.Response
+	}
+	if req.Scope != nil {
+		command.Scope = *req.Scope
+	}
+	if req.LanguageCode != nil {
+		command.LanguageCode = *req.LanguageCode
+	}
+	if req.IsActive != nil {
+		command.IsActive = *req.IsActive
+	}
+}
+
+// CreateTelegramCommand stores a bot command and publishes the command menu
+func (h *TelegramHandler) CreateTelegramCommand(c *gin.Context) {
+	var req struct {
+		telegramCommandRequest
+		BotID string `json:"bot_id"`
+	}
+	if err := utils.BindAndValidate(c, &req); err != nil {
+		return
+	}
+
+	botID, err := parseTelegramBotID(req.BotID)
+	if err != nil {
+		utils.ResponseError(c, http.StatusBadRequest, "Invalid bot ID")
+		return
+	}
+
+	command := &models.TelegramCommand{
+		UserID:   c.MustGet("user_id").(uuid.UUID),
+		BotID:    botID,
+		IsActive: true,
+	}
+	req.apply(command)
+
+	if err := h.telegramService.SaveTelegramCommand(command); err != nil {
+		respondTelegramCommandError(c, err)
+		return
+	}
+
+	utils.ResponseSuccess(c, command)
+}
+
+// UpdateTelegramCommand changes a bot command and publishes the command menu
+func (h *TelegramHandler) UpdateTelegramCommand(c *gin.Context) {
+	commandID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		utils.ResponseError(c, http.StatusBadRequest, "Invalid command ID")
+		return
+	}
+
+	var req telegramCommandRequest
+	if err := utils.BindAndValidate(c, &req); err != nil {
+		return
+	}
+
+	command, err := h.telegramService.GetTelegramCommand(c.MustGet("user_id").(uuid.UUID), commandID)
+	if err != nil {
+		respondTelegramCommandError(c, err)
+		return
+	}
+	req.apply(command)
+
+	if err := h.telegramService.SaveTelegramCommand(command); err != nil {
+		respondTelegramCommandError(c, err)
+		return
+	}
+
+	utils.ResponseSuccess(c, command)
+}
+
+// DeleteTelegramCommand removes a bot command and publishes the command menu
+func (h *TelegramHandler) DeleteTelegramCommand(c *gin.Context) {
+	commandID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		utils.ResponseError(c, http.StatusBadRequest, "Invalid command ID")
+		return
+	}
+
+	if err := h.telegramService.DeleteTelegramCommand(c.MustGet("user_id").(uuid.UUID), commandID); err != nil {
+		respondTelegramCommandError(c, err)
+		return
+	}
+
+	utils.ResponseSuccess(c, gin.H{"message": "Command deleted successfully"})
+}
+
+// SyncTelegramCommands publishes the command menu to Telegram again
+func (h *TelegramHandler) SyncTelegramCommands(c *gin.Context) {
+	if err := h.telegramService.SyncAllCommands(); err != nil {
+		utils.ResponseError(c, http.StatusBadGateway, err.Error())
+		return
+	}
+
+	utils.ResponseSuccess(c, gin.H{"message": "Commands synced successfully"})
+}
+
+func respondTelegramCommandError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, services.ErrTelegramCommandNotFound):
+		utils.ResponseError(c, http.StatusNotFound, "Command not found")
+	case errors.Is(err, services.ErrTelegramBotNotFound):
+		utils.ResponseError(c, http.StatusNotFound, "Telegram bot not found")
+	case errors.Is(err, services.ErrTelegramCommandExists):
+		utils.ResponseError(c, http.StatusConflict, err.Error())
+	case errors.Is(err, services.ErrInvalidTelegramCommand):
+		utils.ResponseError(c, http.StatusBadRequest, err.Error())
+	default:
+		utils.ResponseError(c, http.StatusInternalServerError, err.Error())
+	}
+}
+
+// GetTelegramAnalytics gets the user's daily Telegram counters for charts
+func (h *TelegramHandler) GetTelegramAnalytics(c *gin.Context) {
+	userID := c.MustGet("user_id").(uuid.UUID)
+
+	botID, err := parseTelegramBotID(c.Query("bot_id"))
+	if err != nil {
+		utils.ResponseError(c, http.StatusBadRequest, "Invalid bot ID")
+		return
+	}
+
+	// The last 30 days by default
+	end := time.Now()
+	start := end.AddDate(0, 0, -29)
+	if value := c.Query("start_date"); value != "" {
+		if start, err = time.ParseInLocation("2006-01-02", value, time.Local); err != nil {
+			utils.ResponseError(c, http.StatusBadRequest, "Invalid start_date, use YYYY-MM-DD")
+			return
+		}
+	}
+	if value := c.Query("end_date"); value != "" {
+		if end, err = time.ParseInLocation("2006-01-02", value, time.Local); err != nil {
+			utils.ResponseError(c, http.StatusBadRequest, "Invalid end_date, use YYYY-MM-DD")
+			return
+		}
+	}
+
+	series, err := h.telegramService.GetTelegramAnalytics(userID, botID, start, end)
+	if err != nil {
+		if errors.Is(err, services.ErrInvalidAnalyticsRange) {
+			utils.ResponseError(c, http.StatusBadRequest, "Invalid date range")
+			return
+		}
+		utils.ResponseError(c, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	utils.ResponseSuccess(c, series)
+}
+
+// SendOrderInvoice sends an invoice for a pending order to the customer's Telegram chat
+func (h *TelegramHandler) SendOrderInvoice(c *gin.Context) {
+	userID := c.MustGet("user_id").(uuid.UUID)
+
+	orderID, err := uuid.Parse(c.Param("order_id"))
+	if err != nil {
+		utils.ResponseError(c, http.StatusBadRequest, "Invalid order ID")
+		return
+	}
+
+	if err := h.telegramService.SendOrderInvoice(userID, orderID); err != nil {
+		switch {
+		case errors.Is(err, services.ErrOrderNotFound):
+			utils.ResponseError(c, http.StatusNotFound, "Order not found")
+		case errors.Is(err, services.ErrOrderNotPayable):
+			utils.ResponseError(c, http.StatusConflict, err.Error())
+		case errors.Is(err, services.ErrNotTelegramContact), errors.Is(err, services.ErrTelegramPaymentsDisabled):
+			utils.ResponseError(c, http.StatusBadRequest, err.Error())
+		default:
+			utils.ResponseError(c, http.StatusInternalServerError, err.Error())
+		}
+		return
+	}
+
+	utils.ResponseSuccess(c, gin.H{"message": "Invoice sent successfully"})
+}
+
+// StartPolling switches Telegram to polling mode
 func (h *TelegramHandler) StartPolling(c *gin.Context) {
-	go func() {
-		if err := h.telegramService.StartPolling(); err != nil {
-			logger.Error("Telegram polling error", err)
+	if err := h.telegramService.StartPolling(); err != nil {
+		if errors.Is(err, services.ErrTelegramPollingActive) {
+			utils.ResponseError(c, http.StatusConflict, err.Error())
+			return
 		}
-	}()
+		utils.ResponseError(c, http.StatusInternalServerError, err.Error())
+		return
+	}
 
 	utils.ResponseSuccess(c, gin.H{"message": "Telegram polling started"})
 }
 
 // StopPolling stops Telegram polling mode
 func (h *TelegramHandler) StopPolling(c *gin.Context) {
-	// In a real implementation, you would have a way to stop polling
-	// For now, we'll just return success
+	if err := h.telegramService.StopPolling(); err != nil {
+		if errors.Is(err, services.ErrTelegramPollingInactive) {
+			utils.ResponseError(c, http.StatusConflict, err.Error())
+			return
+		}
+		utils.ResponseError(c, http.StatusInternalServerError, err.Error())
+		return
+	}
+
 	utils.ResponseSuccess(c, gin.H{"message": "Telegram polling stopped"})
 }
 
@@ -452,6 +787,7 @@ func (h *TelegramHandler) CreateTelegramBroadcast(c *gin.Context) {
 		Message    string  `json:"message" binding:"required"`
 		Recipients []int64 `json:"recipients" binding:"required"`
 		UserID     string  `json:"user_id" binding:"required"`
+		BotID      string  `json:"bot_id"`
 	}
 
 	if err := utils.BindAndValidate(c, &req); err != nil {
@@ -464,7 +800,13 @@ func (h *TelegramHandler) CreateTelegramBroadcast(c *gin.Context) {
 		return
 	}
 
-	broadcast, err := h.telegramService.CreateTelegramBroadcast(req.Name, req.Message, req.Recipients, userUUID)
+	botID, err := parseTelegramBotID(req.BotID)
+	if err != nil {
+		utils.ResponseError(c, http.StatusBadRequest, "Invalid bot ID")
+		return
+	}
+
+	broadcast, err := h.telegramService.CreateTelegramBroadcast(req.Name, req.Message, req.Recipients, userUUID, botID)
 	if err != nil {
 		utils.ResponseError(c, http.StatusInternalServerError, err.Error())
 		return
@@ -0,0 +1,181 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"kilocode.dev/whatsapp-bot/internal/services"
+	"kilocode.dev/whatsapp-bot/pkg/utils"
+)
+
+type TemplateHandler struct {
+	templateService *services.TemplateService
+	whatsappService *services.WhatsAppService
+}
+
+func NewTemplateHandler(templateService *services.TemplateService, whatsappService *services.WhatsAppService) *TemplateHandler {
+	return &TemplateHandler{
+		templateService: templateService,
+		whatsappService: whatsappService,
+	}
+}
+
+// GetTemplates gets all registered message templates
+func (h *TemplateHandler) GetTemplates(c *gin.Context) {
+	userID := c.MustGet("user_id").(uuid.UUID)
+
+	templates, err := h.templateService.GetTemplates(userID)
+	if err != nil {
+		utils.ResponseError(c, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	utils.ResponseSuccess(c, templates)
+}
+
+// CreateTemplate registers an approved message template
+func (h *TemplateHandler) CreateTemplate(c *gin.Context) {
+	userID := c.MustGet("user_id").(uuid.UUID)
+
+	var req services.TemplateDefinition
+	if err := utils.BindAndValidate(c, &req); err != nil {
+		return
+	}
+
+	template, err := h.templateService.CreateTemplate(userID, req)
+	if err != nil {
+		respondTemplateError(c, err)
+		return
+	}
+
+	utils.ResponseSuccess(c, template)
+}
+
+// GetTemplate gets a message template
+func (h *TemplateHandler) GetTemplate(c *gin.Context) {
+	userID := c.MustGet("user_id").(uuid.UUID)
+
+	templateID, err := uuid.Parse(c.Param("template_id"))
+	if err != nil {
+		utils.ResponseError(c, http.StatusBadRequest, "Invalid template ID")
+		return
+	}
+
+	template, err := h.templateService.GetTemplate(userID, templateID)
+	if err != nil {
+		respondTemplateError(c, err)
+		return
+	}
+
+	utils.ResponseSuccess(c, template)
+}
+
+// UpdateTemplate replaces a message template definition
+func (h *TemplateHandler) UpdateTemplate(c *gin.Context) {
+	userID := c.MustGet("user_id").(uuid.UUID)
+
+	templateID, err := uuid.Parse(c.Param("template_id"))
+	if err != nil {
+		utils.ResponseError(c, http.StatusBadRequest, "Invalid template ID")
+		return
+	}
+
+	var req services.TemplateDefinition
+	if err := utils.BindAndValidate(c, &req); err != nil {
+		return
+	}
+
+	template, err := h.templateService.UpdateTemplate(userID, templateID, req)
+	if err != nil {
+		respondTemplateError(c, err)
+		return
+	}
+
+	utils.ResponseSuccess(c, template)
+}
+
+// DeleteTemplate deletes a message template
+func (h *TemplateHandler) DeleteTemplate(c *gin.Context) {
+	userID := c.MustGet("user_id").(uuid.UUID)
+
+	templateID, err := uuid.Parse(c.Param("template_id"))
+	if err != nil {
+		utils.ResponseError(c, http.StatusBadRequest, "Invalid template ID")
+		return
+	}
+
+	if err := h.templateService.DeleteTemplate(userID, templateID); err != nil {
+		respondTemplateError(c, err)
+		return
+	}
+
+	utils.ResponseSuccess(c, gin.H{"message": "Template deleted successfully"})
+}
+
+// SendTemplate sends a message template to a single recipient
+func (h *TemplateHandler) SendTemplate(c *gin.Context) {
+	userID := c.MustGet("user_id").(uuid.UUID)
+
+	templateID, err := uuid.Parse(c.Param("template_id"))
+	if err != nil {
+		utils.ResponseError(c, http.StatusBadRequest, "Invalid template ID")
+		return
+	}
+
+	var req struct {
+		To     string            `json:"to" binding:"required"`
+		Values map[string]string `json:"values"`
+	}
+
+	if err := utils.BindAndValidate(c, &req); err != nil {
+		return
+	}
+
+	message, err := h.templateService.SendTemplate(userID, req.To, templateID, req.Values)
+	if err != nil {
+		respondTemplateError(c, err)
+		return
+	}
+
+	utils.ResponseSuccess(c, message)
+}
+
+// BroadcastTemplate sends a message template to many recipients
+func (h *TemplateHandler) BroadcastTemplate(c *gin.Context) {
+	userID := c.MustGet("user_id").(uuid.UUID)
+
+	templateID, err := uuid.Parse(c.Param("template_id"))
+	if err != nil {
+		utils.ResponseError(c, http.StatusBadRequest, "Invalid template ID")
+		return
+	}
+
+	var req struct {
+		Recipients []string          `json:"recipients" binding:"required,min=1"`
+		Values     map[string]string `json:"values"`
+	}
+
+	if err := utils.BindAndValidate(c, &req); err != nil {
+		return
+	}
+
+	if err := h.whatsappService.BroadcastTemplate(userID, req.Recipients, templateID, req.Values); err != nil {
+		respondTemplateError(c, err)
+		return
+	}
+
+	utils.ResponseSuccess(c, gin.H{"message": "Template broadcast queued successfully"})
+}
+
+func respondTemplateError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, services.ErrTemplateNotFound):
+		utils.ResponseError(c, http.StatusNotFound, "Template not found")
+	case errors.Is(err, services.ErrInvalidTemplate), errors.Is(err, services.ErrMissingTemplateVariables):
+		utils.ResponseError(c, http.StatusBadRequest, err.Error())
+	default:
+		utils.ResponseError(c, http.StatusInternalServerError, err.Error())
+	}
+}
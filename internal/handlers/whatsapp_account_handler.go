@@ -0,0 +1,117 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"kilocode.dev/whatsapp-bot/internal/services"
+	"kilocode.dev/whatsapp-bot/pkg/utils"
+)
+
+type WhatsAppAccountHandler struct {
+	accountService *services.WhatsAppAccountService
+}
+
+func NewWhatsAppAccountHandler(accountService *services.WhatsAppAccountService) *WhatsAppAccountHandler {
+	return &WhatsAppAccountHandler{
+		accountService: accountService,
+	}
+}
+
+// GetAccounts gets the business numbers connected by the user
+func (h *WhatsAppAccountHandler) GetAccounts(c *gin.Context) {
+	userID := c.MustGet("user_id").(uuid.UUID)
+
+	accounts, err := h.accountService.GetAccounts(userID)
+	if err != nil {
+		utils.ResponseError(c, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	utils.ResponseSuccess(c, accounts)
+}
+
+// CreateAccount connects a business number
+func (h *WhatsAppAccountHandler) CreateAccount(c *gin.Context) {
+	userID := c.MustGet("user_id").(uuid.UUID)
+
+	var req struct {
+		PhoneNumberID      string `json:"phone_number_id" binding:"required"`
+		DisplayPhoneNumber string `json:"display_phone_number"`
+		BusinessAccountID  string `json:"business_account_id"`
+		AccessToken        string `json:"access_token" binding:"required"`
+	}
+
+	if err := utils.BindAndValidate(c, &req); err != nil {
+		return
+	}
+
+	account, err := h.accountService.CreateAccount(userID, req.PhoneNumberID, req.DisplayPhoneNumber, req.BusinessAccountID, req.AccessToken)
+	if err != nil {
+		respondAccountError(c, err)
+		return
+	}
+
+	utils.ResponseSuccess(c, account)
+}
+
+// UpdateAccessToken replaces the access token of a connected number
+func (h *WhatsAppAccountHandler) UpdateAccessToken(c *gin.Context) {
+	userID := c.MustGet("user_id").(uuid.UUID)
+
+	accountID, err := uuid.Parse(c.Param("account_id"))
+	if err != nil {
+		utils.ResponseError(c, http.StatusBadRequest, "Invalid account ID")
+		return
+	}
+
+	var req struct {
+		AccessToken string `json:"access_token" binding:"required"`
+	}
+
+	if err := utils.BindAndValidate(c, &req); err != nil {
+		return
+	}
+
+	if err := h.accountService.UpdateAccessToken(userID, accountID, req.AccessToken); err != nil {
+		respondAccountError(c, err)
+		return
+	}
+
+	utils.ResponseSuccess(c, gin.H{"message": "Access token updated successfully"})
+}
+
+// DeleteAccount disconnects a business number
+func (h *WhatsAppAccountHandler) DeleteAccount(c *gin.Context) {
+	userID := c.MustGet("user_id").(uuid.UUID)
+
+	accountID, err := uuid.Parse(c.Param("account_id"))
+	if err != nil {
+		utils.ResponseError(c, http.StatusBadRequest, "Invalid account ID")
+		return
+	}
+
+	if err := h.accountService.DeleteAccount(userID, accountID); err != nil {
+		respondAccountError(c, err)
+		return
+	}
+
+	utils.ResponseSuccess(c, gin.H{"message": "WhatsApp account deleted successfully"})
+}
+
+func respondAccountError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, services.ErrWhatsAppAccountNotFound):
+		utils.ResponseError(c, http.StatusNotFound, "WhatsApp account not found")
+	case errors.Is(err, services.ErrWhatsAppAccountExists):
+		utils.ResponseError(c, http.StatusConflict, err.Error())
+	case errors.Is(err, services.ErrInvalidWhatsAppCredentials):
+		utils.ResponseError(c, http.StatusBadRequest, err.Error())
+	case errors.Is(err, services.ErrEncryptionKeyMissing):
+		utils.ResponseError(c, http.StatusServiceUnavailable, "ENCRYPTION_KEY is not configured on the server")
+	default:
+		utils.ResponseError(c, http.StatusInternalServerError, err.Error())
+	}
+}
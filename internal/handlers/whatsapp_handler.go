@@ -1,11 +1,14 @@
 package handlers
 
 import (
+	"encoding/json"
+	"errors"
 	"net/http"
 
 	"github.com/gin-gonic/gin"
 	"kilocode.dev/whatsapp-bot/internal/services"
 	"kilocode.dev/whatsapp-bot/pkg/utils"
+	"kilocode.dev/whatsapp-bot/pkg/whatsapp"
 )
 
 type WhatsAppHandler struct {
@@ -30,6 +33,10 @@ func (h *WhatsAppHandler) SendMessage(c *gin.Context) {
 	}
 
 	err := h.whatsappService.SendMessage(req.To, req.Message)
+	if errors.Is(err, services.ErrServiceWindowClosed) {
+		utils.ResponseError(c, http.StatusUnprocessableEntity, err.Error())
+		return
+	}
 	if err != nil {
 		utils.ResponseError(c, http.StatusInternalServerError, err.Error())
 		return
@@ -160,13 +167,25 @@ func (h *WhatsAppHandler) GetStatus(c *gin.Context) {
 
 // HandleWebhook handles WhatsApp webhook
 func (h *WhatsAppHandler) HandleWebhook(c *gin.Context) {
-	var webhookData map[string]interface{}
-	if err := c.ShouldBindJSON(&webhookData); err != nil {
+	// The signature covers the raw body, so verify before decoding
+	body, err := c.GetRawData()
+	if err != nil {
+		utils.ResponseError(c, http.StatusBadRequest, "Invalid webhook data")
+		return
+	}
+
+	if !h.whatsappService.VerifyWebhookSignature(body, c.GetHeader("X-Hub-Signature-256")) {
+		utils.ResponseError(c, http.StatusUnauthorized, "Invalid webhook signature")
+		return
+	}
+
+	var payload whatsapp.WebhookPayload
+	if err := json.Unmarshal(body, &payload); err != nil {
 		utils.ResponseError(c, http.StatusBadRequest, "Invalid webhook data")
 		return
 	}
 
-	err := h.whatsappService.ProcessWebhook(webhookData)
+	err = h.whatsappService.HandleIncomingMessage(&payload)
 	if err != nil {
 		utils.ResponseError(c, http.StatusInternalServerError, err.Error())
 		return
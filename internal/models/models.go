@@ -1,6 +1,9 @@
 package models
 
 import (
+	"database/sql/driver"
+	"encoding/json"
+	"fmt"
 	"time"
 
 	"github.com/google/uuid"
@@ -47,8 +50,12 @@ type UserPreferences struct {
 type Contact struct {
 	BaseModel
 	UserID      uuid.UUID `gorm:"type:uuid;not null"`
+	Platform    string    `gorm:"default:'whatsapp'"` // whatsapp, telegram
 	PhoneNumber string    `gorm:"not null"`
+	TelegramChatID int64  `gorm:"index"`
+	TelegramBotID  *uuid.UUID `gorm:"type:uuid;index"` // bot the chat talks to, nil for the configured bot
 	DisplayName string
+	Tags        string    // comma-separated labels, e.g. "vip,reseller"
 	ProfilePic  string
 	IsBlocked   bool `gorm:"default:false"`
 	IsGroup     bool `gorm:"default:false"`
@@ -56,6 +63,18 @@ type Contact struct {
 	LastMessage time.Time
 }
 
+// WhatsAppAccount is a WhatsApp Business phone number connected by a user.
+// The access token is stored encrypted.
+type WhatsAppAccount struct {
+	BaseModel
+	UserID             uuid.UUID `gorm:"type:uuid;not null;index"`
+	PhoneNumberID      string    `gorm:"unique;not null"`
+	DisplayPhoneNumber string
+	BusinessAccountID  string
+	AccessToken        string `gorm:"type:text;not null" json:"-"`
+	IsActive           bool   `gorm:"default:true"`
+}
+
 // Message model
 type Message struct {
 	BaseModel
@@ -65,13 +84,21 @@ type Message struct {
 	Content      string     `gorm:"type:text"`
 	MessageType  string     `gorm:"not null"` // text, image, audio, video, document
 	Direction    string     `gorm:"not null"` // incoming, outgoing
-	Status       string     `gorm:"default:'sent'"` // sent, delivered, read, failed
+	Status       string     `gorm:"default:'sent'"` // queued, sent, delivered, read, failed
 	MediaURL     string
 	MediaMimeType string
 	Timestamp    time.Time
 	IsForwarded  bool `gorm:"default:false"`
 	IsReply      bool `gorm:"default:false"`
 	ReplyToID    string
+	ErrorCode    int
+	ErrorMessage string
+	ConversationID       string
+	ConversationCategory string
+	PricingCategory      string
+	Billable             bool
+	DeliveredAt  *time.Time
+	ReadAt       *time.Time
 }
 
 // AutoReply model
@@ -85,6 +112,39 @@ type AutoReply struct {
 	ReplyType   string    `gorm:"default:'text'"`  // text, image, template
 	MediaURL    string
 	TemplateID  string
+	TelegramBotID *uuid.UUID `gorm:"type:uuid"` // only answer chats of this bot; nil answers everywhere
+	Priority    int       `gorm:"default:0;index"` // higher priorities are matched first
+	ContinueMatching bool // let lower-priority rules fire after this one
+	Conditions  AutoReplyConditions `gorm:"type:jsonb"`
+}
+
+// AutoReplyConditions limit when an auto-reply fires on top of its keyword.
+// Empty fields don't restrict anything.
+type AutoReplyConditions struct {
+	ContactTags      []string `json:"contact_tags,omitempty"`       // contact has at least one of them
+	FirstMessageOnly bool     `json:"first_message_only,omitempty"` // only the contact's first message
+	TimeWindow       string   `json:"time_window,omitempty"`        // "HH:MM-HH:MM" in the owner's timezone, may span midnight
+	Weekdays         []string `json:"weekdays,omitempty"`           // mon, tue, wed, thu, fri, sat, sun
+	MessageTypes     []string `json:"message_types,omitempty"`      // text, image, document, interactive, ...
+}
+
+func (c AutoReplyConditions) Value() (driver.Value, error) {
+	data, err := json.Marshal(c)
+	return string(data), err
+}
+
+func (c *AutoReplyConditions) Scan(value interface{}) error {
+	switch v := value.(type) {
+	case nil:
+		*c = AutoReplyConditions{}
+		return nil
+	case []byte:
+		return json.Unmarshal(v, c)
+	case string:
+		return json.Unmarshal([]byte(v), c)
+	default:
+		return fmt.Errorf("cannot scan %T into AutoReplyConditions", value)
+	}
 }
 
 // Broadcast model
@@ -101,14 +161,19 @@ type Broadcast struct {
 	SentAt      *time.Time
 	TotalSent   int       `gorm:"default:0"`
 	TotalFailed int       `gorm:"default:0"`
+	TemplateID  *uuid.UUID `gorm:"type:uuid"`
+	TemplateValues string  `gorm:"type:text"` // JSON object of template variable values
 }
 
 type BroadcastRecipient struct {
 	BaseModel
 	BroadcastID uuid.UUID `gorm:"type:uuid;not null"`
 	ContactID   uuid.UUID `gorm:"type:uuid;not null"`
-	Status      string    `gorm:"default:'pending'"` // pending, sent, failed
+	Status      string    `gorm:"default:'pending'"` // pending, queued, sent, delivered, read, failed
+	MessageID   string    `gorm:"index"`             // WhatsApp message ID once sent
 	SentAt      *time.Time
+	DeliveredAt *time.Time
+	ReadAt      *time.Time
 	Error       string
 }
 
@@ -190,6 +255,8 @@ type Order struct {
 	Items        []OrderItem
 	ShippingAddress string      `gorm:"type:text"`
 	Notes        string         `gorm:"type:text"`
+	PaymentProofURL string      // receipt sent by the customer
+	PaymentChargeID string      // Telegram payment charge ID, needed for refunds
 	PaidAt       *time.Time
 	ShippedAt    *time.Time
 	DeliveredAt  *time.Time
@@ -216,6 +283,8 @@ type Reminder struct {
 	RecurringType string   `gorm:"default:'none'"` // none, daily, weekly, monthly
 	Status      string     `gorm:"default:'active'"` // active, completed, cancelled
 	CompletedAt *time.Time
+	TemplateID  *uuid.UUID `gorm:"type:uuid"`
+	TemplateValues string  `gorm:"type:text"` // JSON object of template variable values
 }
 
 // Moderation models
@@ -282,13 +351,27 @@ type CustomCommand struct {
 type Template struct {
 	BaseModel
 	UserID      uuid.UUID `gorm:"type:uuid;not null"`
-	Name        string    `gorm:"not null"`
-	Content     string    `gorm:"not null"`
+	Name        string    `gorm:"not null"` // name of the approved template in WhatsApp Manager
+	Language    string    `gorm:"default:'id'"`
+	Content     string    `gorm:"not null"` // body text with {{1}}, {{2}}, ... placeholders
 	Variables   string    `gorm:"type:text"` // JSON array of variable names
+	HeaderType  string    // text, image, video, document
+	HeaderText  string
+	HeaderVariables string `gorm:"type:text"` // JSON array of variable names
+	Buttons     string    `gorm:"type:text"` // JSON array of TemplateButton
 	Category    string
 	IsActive    bool `gorm:"default:true"`
 }
 
+// TemplateButton describes a button of a message template. URL buttons may
+// take a variable for the dynamic URL suffix and quick reply buttons a
+// variable for their payload.
+type TemplateButton struct {
+	Type     string `json:"type"` // quick_reply, url
+	Text     string `json:"text"`
+	Variable string `json:"variable,omitempty"`
+}
+
 // System log model
 type SystemLog struct {
 	BaseModel
@@ -1,11 +1,39 @@
 package models
 
 import (
+	"database/sql/driver"
+	"encoding/json"
+	"fmt"
 	"time"
 
 	"github.com/google/uuid"
 )
 
+// JSONMap is a map stored in a jsonb column.
+type JSONMap map[string]interface{}
+
+func (m JSONMap) Value() (driver.Value, error) {
+	if m == nil {
+		return nil, nil
+	}
+	data, err := json.Marshal(m)
+	return string(data), err
+}
+
+func (m *JSONMap) Scan(value interface{}) error {
+	switch v := value.(type) {
+	case nil:
+		*m = nil
+		return nil
+	case []byte:
+		return json.Unmarshal(v, m)
+	case string:
+		return json.Unmarshal([]byte(v), m)
+	default:
+		return fmt.Errorf("cannot scan %T into JSONMap", value)
+	}
+}
+
 // TelegramUser represents a Telegram user
 type TelegramUser struct {
 	ID         uuid.UUID  `json:"id" gorm:"type:uuid;primary_key"`
@@ -22,14 +50,20 @@ type TelegramUser struct {
 type TelegramMessage struct {
 	ID          uuid.UUID  `json:"id" gorm:"type:uuid;primary_key"`
 	UpdateID    int        `json:"update_id"`
+	BotID       *uuid.UUID `json:"bot_id,omitempty" gorm:"type:uuid;index"` // nil for the configured bot
 	ChatID      int64      `json:"chat_id"`
 	MessageID   int        `json:"message_id"`
 	Text        string     `json:"text" gorm:"type:text"`
-	MessageType string     `json:"message_type"` // message, callback_query, inline_query
+	MessageType string     `json:"message_type"` // incoming: message, callback_query, inline_query, pre_checkout_query; outgoing: message, photo, document, location, invoice
 	FromUserID  int64      `json:"from_user_id"`
 	FromUsername string    `json:"from_username"`
 	Direction   string     `json:"direction"` // incoming, outgoing
-	Status      string     `json:"status"`    // sent, delivered, read
+	Status      string     `json:"status"`    // outgoing only: sent, failed
+	// Attached photo, document or voice note, copied into storage
+	FileID      string     `json:"file_id,omitempty"`
+	MediaType   string     `json:"media_type,omitempty"` // image, document, audio
+	MediaURL    string     `json:"media_url,omitempty"`
+	MediaMimeType string   `json:"media_mime_type,omitempty"`
 	CreatedAt   time.Time  `json:"created_at"`
 	UpdatedAt   time.Time  `json:"updated_at"`
 }
@@ -40,6 +74,7 @@ type TelegramBroadcast struct {
 	Name       string      `json:"name"`
 	Message    string      `json:"message" gorm:"type:text"`
 	Recipients []int64     `json:"recipients" gorm:"type:jsonb"`
+	BotID      *uuid.UUID  `json:"bot_id,omitempty" gorm:"type:uuid"` // bot that sends it, nil for the configured bot
 	Status     string      `json:"status"` // pending, sending, completed, failed
 	SuccessCount int       `json:"success_count"`
 	FailureCount int       `json:"failure_count"`
@@ -67,23 +102,35 @@ type TelegramAutoReply struct {
 // TelegramGroup represents a Telegram group/chat
 type TelegramGroup struct {
 	ID          uuid.UUID  `json:"id" gorm:"type:uuid;primary_key"`
-	ChatID      int64      `json:"chat_id" gorm:"uniqueIndex"`
+	BotID       *uuid.UUID `json:"bot_id,omitempty" gorm:"type:uuid;uniqueIndex:idx_telegram_group_chat"` // bot in the group, nil for the configured bot
+	UserID      uuid.UUID  `json:"user_id" gorm:"type:uuid;index"` // owner of the bot
+	ChatID      int64      `json:"chat_id" gorm:"uniqueIndex:idx_telegram_group_chat"`
 	Title       string     `json:"title"`
 	Type        string     `json:"type"` // private, group, supergroup, channel
 	Description string     `json:"description"`
 	MemberCount int        `json:"member_count"`
 	IsActive    bool       `json:"is_active" gorm:"default:true"`
+	// Moderation settings, managed with /mod in the group
+	ModerationEnabled bool   `json:"moderation_enabled" gorm:"default:true"`
+	BlockLinks        bool   `json:"block_links"`
+	FloodLimit        int    `json:"flood_limit" gorm:"default:5"` // messages per 10 seconds, 0 disables
+	MaxWarnings       int    `json:"max_warnings" gorm:"default:3"`
+	MuteMinutes       int    `json:"mute_minutes" gorm:"default:60"`
+	WelcomeEnabled    bool   `json:"welcome_enabled" gorm:"default:true"`
+	WelcomeMessage    string `json:"welcome_message" gorm:"type:text"`
 	CreatedAt   time.Time  `json:"created_at"`
 	UpdatedAt   time.Time  `json:"updated_at"`
 }
 
-// TelegramBot represents bot configuration for Telegram
+// TelegramBot is an additional bot hosted next to the configured one. Its
+// chats become contacts of UserID. The API key is stored encrypted.
 type TelegramBot struct {
 	ID           uuid.UUID  `json:"id" gorm:"type:uuid;primary_key"`
+	UserID       uuid.UUID  `json:"user_id" gorm:"type:uuid;index"`
 	Name         string     `json:"name"`
 	Username     string     `json:"username"`
-	APIKey       string     `json:"api_key"`
-	WebhookURL   string     `json:"webhook_url"`
+	APIKey       string     `json:"-"`
+	WebhookURL   string     `json:"webhook_url"` // empty to poll, or to derive it from TELEGRAM_WEBHOOK_URL
 	IsActive     bool       `json:"is_active" gorm:"default:true"`
 	LastError    string     `json:"last_error"`
 	LastErrorAt  *time.Time `json:"last_error_at"`
@@ -92,14 +139,18 @@ type TelegramBot struct {
 	UpdatedAt    time.Time  `json:"updated_at"`
 }
 
-// TelegramCommand represents custom commands for Telegram bot
+// TelegramCommand represents custom commands for Telegram bot. A command
+// belongs to its owner's bot and is only published and answered by it.
 type TelegramCommand struct {
 	ID          uuid.UUID  `json:"id" gorm:"type:uuid;primary_key"`
-	Command     string     `json:"command" gorm:"uniqueIndex"`
+	Command     string     `json:"command" gorm:"uniqueIndex:idx_telegram_command"`
 	Description string     `json:"description"`
-	Response    string     `json:"response" gorm:"type:text"`
+	Response    string     `json:"response" gorm:"type:text"` // empty runs the built-in handler
+	Scope       string     `json:"scope" gorm:"uniqueIndex:idx_telegram_command;default:'all'"` // all, private, group, admin
+	LanguageCode string    `json:"language_code" gorm:"uniqueIndex:idx_telegram_command"`      // empty for every language
 	IsActive    bool       `json:"is_active" gorm:"default:true"`
-	UserID      uuid.UUID  `json:"user_id" gorm:"type:uuid"`
+	UserID      uuid.UUID  `json:"user_id" gorm:"type:uuid;uniqueIndex:idx_telegram_command"`
+	BotID       *uuid.UUID `json:"bot_id,omitempty" gorm:"type:uuid;uniqueIndex:idx_telegram_command"` // bot that serves it, nil for the configured bot
 	CreatedAt   time.Time  `json:"created_at"`
 	UpdatedAt   time.Time  `json:"updated_at"`
 }
@@ -126,25 +177,28 @@ type Button struct {
 // TelegramWebhook represents webhook configuration
 type TelegramWebhook struct {
 	ID           uuid.UUID  `json:"id" gorm:"type:uuid;primary_key"`
+	BotID        *uuid.UUID `json:"bot_id,omitempty" gorm:"type:uuid;uniqueIndex"` // nil for the configured bot
 	URL          string     `json:"url"`
-	SecretToken  string     `json:"secret_token"`
+	SecretToken  string     `json:"-"`
 	IsActive     bool       `json:"is_active" gorm:"default:true"`
 	LastUpdateID int        `json:"last_update_id"`
 	CreatedAt    time.Time  `json:"created_at"`
 	UpdatedAt    time.Time  `json:"updated_at"`
 }
 
-// TelegramAnalytics represents analytics data for Telegram
+// TelegramAnalytics holds one bot's counters for one day, rolled up from
+// TelegramMessage and the system log by TelegramAnalyticsService
 type TelegramAnalytics struct {
 	ID              uuid.UUID  `json:"id" gorm:"type:uuid;primary_key"`
-	Date            time.Time  `json:"date"`
+	Date            time.Time  `json:"date" gorm:"index"`
+	BotID           *uuid.UUID `json:"bot_id,omitempty" gorm:"type:uuid;index"` // nil for the configured bot
 	MessagesSent    int64      `json:"messages_sent"`
 	MessagesReceived int64     `json:"messages_received"`
 	UsersInteracted int64      `json:"users_interacted"`
 	GroupsInteracted int64     `json:"groups_interacted"`
 	CommandsUsed    int64      `json:"commands_used"`
 	ErrorsCount     int64      `json:"errors_count"`
-	UserID          uuid.UUID  `json:"user_id" gorm:"type:uuid"`
+	UserID          uuid.UUID  `json:"user_id" gorm:"type:uuid;index"` // owner of the bot
 	CreatedAt       time.Time  `json:"created_at"`
 	UpdatedAt       time.Time  `json:"updated_at"`
 }
@@ -153,8 +207,9 @@ type TelegramAnalytics struct {
 type TelegramSession struct {
 	ID           uuid.UUID              `json:"id" gorm:"type:uuid;primary_key"`
 	UserID       int64                  `json:"user_id"`
-	ChatID       int64                  `json:"chat_id"`
-	SessionData  map[string]interface{} `json:"session_data" gorm:"type:jsonb"`
+	ChatID       int64                  `json:"chat_id" gorm:"index"`
+	BotID        *uuid.UUID             `json:"bot_id,omitempty" gorm:"type:uuid"` // nil for the configured bot
+	SessionData  JSONMap                `json:"session_data" gorm:"type:jsonb"`
 	LastActivity time.Time             `json:"last_activity"`
 	IsActive     bool                   `json:"is_active" gorm:"default:true"`
 	CreatedAt    time.Time              `json:"created_at"`
@@ -165,11 +220,13 @@ type TelegramSession struct {
 type TelegramNotification struct {
 	ID           uuid.UUID  `json:"id" gorm:"type:uuid;primary_key"`
 	UserID       int64      `json:"user_id"`
-	ChatID       int64      `json:"chat_id"`
+	ChatID       int64      `json:"chat_id" gorm:"index"`
+	BotID        *uuid.UUID `json:"bot_id,omitempty" gorm:"type:uuid"` // nil for the configured bot
 	Type         string     `json:"type"` // message, broadcast, reminder, etc.
 	IsEnabled    bool       `json:"is_enabled" gorm:"default:true"`
 	QuietHours   string     `json:"quiet_hours"` // e.g., "22:00-08:00"
 	Language     string     `json:"language" gorm:"default:'en'"`
+	Timezone     string     `json:"timezone" gorm:"default:'Asia/Jakarta'"`
 	CreatedAt    time.Time  `json:"created_at"`
 	UpdatedAt    time.Time  `json:"updated_at"`
 }
@@ -179,6 +236,7 @@ type TelegramIntegration struct {
 	ID               uuid.UUID  `json:"id" gorm:"type:uuid;primary_key"`
 	UserID           uuid.UUID  `json:"user_id" gorm:"type:uuid"`
 	TelegramUserID   int64      `json:"telegram_user_id"`
+	TelegramBotID    *uuid.UUID `json:"telegram_bot_id,omitempty" gorm:"type:uuid"` // bot the Telegram chat talks to, nil for the configured bot
 	WhatsAppUserID   string     `json:"whatsapp_user_id"`
 	IsSyncEnabled    bool       `json:"is_sync_enabled" gorm:"default:true"`
 	SyncDirection    string     `json:"sync_direction"` // telegram_to_whatsapp, whatsapp_to_telegram, both
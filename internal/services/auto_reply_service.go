@@ -1,86 +1,247 @@
 package services
 
 import (
+	"errors"
 	"fmt"
 	"regexp"
+	"sort"
+	"strconv"
 	"strings"
 	"time"
 
 	"whatsapp-bot/internal/models"
 	"whatsapp-bot/pkg/logger"
+	"whatsapp-bot/pkg/whatsapp"
 
 	"github.com/google/uuid"
 	"github.com/jinzhu/gorm"
 )
 
+var (
+	ErrAutoReplyNotFound          = errors.New("auto-reply not found")
+	ErrInvalidAutoReplyConditions = errors.New("invalid auto-reply conditions")
+)
+
+var autoReplyWeekdays = map[string]time.Weekday{
+	"sun": time.Sunday, "mon": time.Monday, "tue": time.Tuesday, "wed": time.Wednesday,
+	"thu": time.Thursday, "fri": time.Friday, "sat": time.Saturday,
+}
+
 type AutoReplyService struct {
 	sm *ServiceManager
 }
 
+// autoReplyMatch is the message the rules are matched against. The owner's
+// timezone and whether this is the contact's first message are looked up
+// once, and only if a rule needs them.
+type autoReplyMatch struct {
+	contact *models.Contact
+	message *models.Message
+	now     time.Time
+
+	location     *time.Location
+	firstMessage *bool
+}
+
+// ProcessAutoReply runs the message through the user's active rules, highest
+// priority first. A rule that fires stops the rules after it unless it has
+// ContinueMatching set.
 func (s *AutoReplyService) ProcessAutoReply(contact *models.Contact, message *models.Message) error {
 	// Get active auto-replies for user
 	var autoReplies []models.AutoReply
-	err := s.sm.DB.Where("user_id = ? AND is_active = ?", contact.UserID, true).Find(&autoReplies).Error
+	query := s.sm.DB.Where("user_id = ? AND is_active = ?", contact.UserID, true)
+	// Rules limited to one Telegram bot only answer that bot's chats
+	if contact.TelegramBotID != nil {
+		query = query.Where("telegram_bot_id IS NULL OR telegram_bot_id = ?", *contact.TelegramBotID)
+	} else {
+		query = query.Where("telegram_bot_id IS NULL")
+	}
+	err := query.Order("created_at").Find(&autoReplies).Error
 	if err != nil {
 		return err
 	}
 
-	for _, autoReply := range autoReplies {
-		if s.shouldTriggerAutoReply(message.Content, autoReply) {
-			// Send auto-reply
-			if err := s.sendAutoReply(contact, autoReply); err != nil {
-				logger.Log.WithError(err).Error("Failed to send auto-reply")
-				continue
-			}
-
-			// Log analytics
-			s.sm.AnalyticsService.LogEvent(contact.UserID, "auto_reply_sent", 1, map[string]interface{}{
-				"keyword": autoReply.Keyword,
-			})
-
-			return nil // Only trigger first matching auto-reply
+	match := &autoReplyMatch{contact: contact, message: message, now: time.Now()}
+	for _, autoReply := range s.matchingAutoReplies(match, autoReplies) {
+		// Send auto-reply
+		if err := s.sendAutoReply(contact, autoReply); err != nil {
+			logger.Log.WithError(err).Error("Failed to send auto-reply")
+			continue
 		}
+
+		// Log analytics
+		s.sm.AnalyticsService.LogEvent(contact.UserID, "auto_reply_sent", 1, map[string]interface{}{
+			"keyword":  autoReply.Keyword,
+			"priority": autoReply.Priority,
+		})
 	}
 
 	return nil
 }
 
-func (s *AutoReplyService) shouldTriggerAutoReply(message string, autoReply models.AutoReply) bool {
-	message = strings.ToLower(strings.TrimSpace(message))
+// matchingAutoReplies returns the rules that fire for the message, highest
+// priority first and oldest first within a priority. Matching stops after
+// the first rule without ContinueMatching.
+func (s *AutoReplyService) matchingAutoReplies(match *autoReplyMatch, autoReplies []models.AutoReply) []models.AutoReply {
+	sort.SliceStable(autoReplies, func(i, j int) bool {
+		return autoReplies[i].Priority > autoReplies[j].Priority
+	})
+
+	var matched []models.AutoReply
+	for _, autoReply := range autoReplies {
+		if !s.shouldTriggerAutoReply(match, autoReply) {
+			continue
+		}
+		matched = append(matched, autoReply)
+		if !autoReply.ContinueMatching {
+			break
+		}
+	}
+	return matched
+}
+
+// shouldTriggerAutoReply reports whether the message matches the rule's
+// keyword and all of its conditions. Checks that need the database run last.
+func (s *AutoReplyService) shouldTriggerAutoReply(match *autoReplyMatch, autoReply models.AutoReply) bool {
+	message := strings.ToLower(strings.TrimSpace(match.message.Content))
 	keyword := strings.ToLower(strings.TrimSpace(autoReply.Keyword))
 
+	var matched bool
 	switch autoReply.MatchType {
 	case "exact":
-		return message == keyword
+		matched = message == keyword
 	case "contains":
-		return strings.Contains(message, keyword)
+		matched = strings.Contains(message, keyword)
 	case "regex":
-		matched, err := regexp.MatchString(keyword, message)
-		return err == nil && matched
-	default:
+		ok, err := regexp.MatchString(keyword, message)
+		matched = err == nil && ok
+	}
+	if !matched {
+		return false
+	}
+
+	conditions := autoReply.Conditions
+	if len(conditions.MessageTypes) > 0 && !containsString(conditions.MessageTypes, strings.ToLower(match.message.MessageType)) {
+		return false
+	}
+	if len(conditions.ContactTags) > 0 && !hasAnyTag(contactTags(match.contact), conditions.ContactTags) {
+		return false
+	}
+
+	if len(conditions.Weekdays) > 0 || conditions.TimeWindow != "" {
+		local := match.now.In(s.ownerLocation(match))
+		if len(conditions.Weekdays) > 0 && !onWeekday(conditions.Weekdays, local.Weekday()) {
+			return false
+		}
+		if conditions.TimeWindow != "" && !inTimeWindow(conditions.TimeWindow, local) {
+			return false
+		}
+	}
+
+	if conditions.FirstMessageOnly && !s.isFirstMessage(match) {
+		return false
+	}
+	return true
+}
+
+// ownerLocation returns the timezone in the contact owner's preferences,
+// or the server's if it can't be loaded.
+func (s *AutoReplyService) ownerLocation(match *autoReplyMatch) *time.Location {
+	if match.location != nil {
+		return match.location
+	}
+
+	match.location = time.Local
+	preferences, err := s.sm.UserService.GetUserPreferences(match.contact.UserID)
+	if err != nil || preferences.Timezone == "" {
+		return match.location
+	}
+	if location, err := time.LoadLocation(preferences.Timezone); err == nil {
+		match.location = location
+	} else {
+		logger.Log.WithError(err).WithField("user_id", match.contact.UserID).Warn("Invalid timezone in user preferences")
+	}
+	return match.location
+}
+
+// isFirstMessage reports whether the contact never wrote before the message.
+func (s *AutoReplyService) isFirstMessage(match *autoReplyMatch) bool {
+	if match.firstMessage != nil {
+		return *match.firstMessage
+	}
+
+	var count int
+	err := s.sm.DB.Model(&models.Message{}).
+		Where("contact_id = ? AND direction = ? AND id <> ?", match.contact.ID, "incoming", match.message.ID).
+		Count(&count).Error
+	if err != nil {
+		logger.Log.WithError(err).WithField("contact_id", match.contact.ID).Error("Failed to count contact messages")
+	}
+
+	first := err == nil && count == 0
+	match.firstMessage = &first
+	return first
+}
+
+func onWeekday(weekdays []string, weekday time.Weekday) bool {
+	for _, day := range weekdays {
+		if autoReplyWeekdays[day] == weekday {
+			return true
+		}
+	}
+	return false
+}
+
+// inTimeWindow reports whether t's clock time is in an "HH:MM-HH:MM" window,
+// which may span midnight. The end is not part of the window.
+func inTimeWindow(window string, t time.Time) bool {
+	start, end, ok := parseTimeWindow(window)
+	if !ok {
 		return false
 	}
+	minute := t.Hour()*60 + t.Minute()
+	if start <= end {
+		return minute >= start && minute < end
+	}
+	return minute >= start || minute < end
+}
+
+func hasAnyTag(tags, wanted []string) bool {
+	for _, tag := range wanted {
+		if containsString(tags, tag) {
+			return true
+		}
+	}
+	return false
+}
+
+func containsString(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
 }
 
 func (s *AutoReplyService) sendAutoReply(contact *models.Contact, autoReply models.AutoReply) error {
 	switch autoReply.ReplyType {
 	case "text":
-		_, err := s.sm.WhatsApp.SendTextMessage(contact.PhoneNumber, autoReply.Response, false)
-		return err
+		return s.sm.SendContactText(contact, autoReply.Response)
 	case "image":
 		if autoReply.MediaURL != "" {
-			_, err := s.sm.WhatsApp.SendImageMessage(contact.PhoneNumber, autoReply.MediaURL, autoReply.Response)
-			return err
+			return s.sm.Channel(contact).SendImage(autoReply.MediaURL, autoReply.Response)
 		}
 		// Fallback to text if no image URL
-		_, err := s.sm.WhatsApp.SendTextMessage(contact.PhoneNumber, autoReply.Response, false)
-		return err
+		return s.sm.SendContactText(contact, autoReply.Response)
 	case "template":
-		// Implement template message
-		return fmt.Errorf("template messages not implemented yet")
+		templateID, err := uuid.Parse(autoReply.TemplateID)
+		if err != nil {
+			return fmt.Errorf("invalid template ID for auto-reply %s: %v", autoReply.ID, err)
+		}
+		return s.sm.SendContactTemplate(contact, templateID, ContactTemplateValues(contact))
 	default:
-		_, err := s.sm.WhatsApp.SendTextMessage(contact.PhoneNumber, autoReply.Response, false)
-		return err
+		return s.sm.SendContactText(contact, autoReply.Response)
 	}
 }
 
@@ -104,7 +265,7 @@ func (s *AutoReplyService) CreateAutoReply(userID uuid.UUID, keyword, response,
 
 func (s *AutoReplyService) GetAutoReplies(userID uuid.UUID) ([]models.AutoReply, error) {
 	var autoReplies []models.AutoReply
-	err := s.sm.DB.Where("user_id = ?", userID).Find(&autoReplies).Error
+	err := s.sm.DB.Where("user_id = ?", userID).Order("priority desc, created_at").Find(&autoReplies).Error
 	return autoReplies, err
 }
 
@@ -203,44 +364,203 @@ func (s *AutoReplyService) CreateQuickReplyButtons(userID uuid.UUID, keyword str
 	return s.sm.DB.Create(autoReply).Error
 }
 
-func (s *AutoReplyService) ProcessInteractiveResponse(userID uuid.UUID, messageID, buttonID string) error {
-	// Handle button responses
-	buttonIndex := 0
-	if strings.HasPrefix(buttonID, "button_") {
-		indexStr := strings.TrimPrefix(buttonID, "button_")
-		if index, err := fmt.Sscanf(indexStr, "%d", &buttonIndex); err == nil && index == 1 {
-			// Process button response
-			response := fmt.Sprintf("Anda memilih opsi %d", buttonIndex+1)
-			_, err := s.sm.WhatsApp.SendTextMessage("recipient_phone", response, false)
-			return err
+// ProcessInteractiveResponse handles a tapped reply button or list row and
+// reports whether it was fully handled. "cmd:" replies are not handled here;
+// they rewrite the message content so the regular command handlers run them.
+func (s *AutoReplyService) ProcessInteractiveResponse(contact *models.Contact, message *models.Message, replyID string) (bool, error) {
+	switch {
+	case strings.HasPrefix(replyID, replyIDCommandPrefix):
+		message.Content = strings.TrimPrefix(replyID, replyIDCommandPrefix)
+		return false, nil
+	case strings.HasPrefix(replyID, replyIDMenuPrefix):
+		return true, s.sm.WhatsAppService.SendMenu(contact, strings.TrimPrefix(replyID, replyIDMenuPrefix))
+	case strings.HasPrefix(replyID, replyIDQuizAnswerPrefix):
+		answer, err := strconv.Atoi(strings.TrimPrefix(replyID, replyIDQuizAnswerPrefix))
+		if err != nil {
+			return true, fmt.Errorf("invalid quiz answer: %s", replyID)
 		}
+		return true, s.sm.GameService.ProcessQuizAnswer(contact, answer)
+	case strings.HasPrefix(replyID, "button_"):
+		// Quick reply buttons created with CreateQuickReplyButtons
+		buttonIndex, err := strconv.Atoi(strings.TrimPrefix(replyID, "button_"))
+		if err != nil {
+			return false, nil
+		}
+		response := fmt.Sprintf("Anda memilih opsi %d", buttonIndex+1)
+		err = s.sm.Channel(contact).SendText(response)
+		return true, err
 	}
 
-	return nil
+	return false, nil
 }
 
+// CreateTimeBasedAutoReply creates a rule that only answers between the
+// clock times of startTime and endTime, every day in the owner's timezone.
 func (s *AutoReplyService) CreateTimeBasedAutoReply(userID uuid.UUID, keyword, response string, startTime, endTime time.Time) (*models.AutoReply, error) {
-	// Check if current time is within the specified time range
-	now := time.Now()
-	if now.After(startTime) && now.Before(endTime) {
-		return s.CreateAutoReply(userID, keyword, response, "exact", "text", "")
+	conditions := models.AutoReplyConditions{
+		TimeWindow: startTime.Format("15:04") + "-" + endTime.Format("15:04"),
+	}
+	if err := normalizeAutoReplyConditions(&conditions); err != nil {
+		return nil, err
+	}
+
+	autoReply := &models.AutoReply{
+		UserID:     userID,
+		Keyword:    keyword,
+		Response:   response,
+		MatchType:  "exact",
+		ReplyType:  "text",
+		IsActive:   true,
+		Conditions: conditions,
+	}
+	if err := s.sm.DB.Create(autoReply).Error; err != nil {
+		return nil, err
 	}
 
-	return nil, fmt.Errorf("outside specified time range")
+	return autoReply, nil
 }
 
+// CreateConditionalAutoReply creates one rule for the keyword per response.
+// conditions holds the conditions of a response by its name, written as
+// "tags=vip,reseller; time=08:00-17:00; days=sat,sun; types=text; first".
+// Responses with conditions are matched before the ones without, which
+// answer everything else.
 func (s *AutoReplyService) CreateConditionalAutoReply(userID uuid.UUID, keyword string, conditions map[string]string, responses map[string]string) error {
-	// Create conditional auto-reply based on multiple criteria
-	// This is a placeholder for more complex conditional logic
-	for condition, response := range responses {
-		if _, err := s.CreateAutoReply(userID, fmt.Sprintf("%s_%s", keyword, condition), response, "contains", "text", ""); err != nil {
-			return err
+	names := make([]string, 0, len(responses))
+	for name := range responses {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	autoReplies := make([]models.AutoReply, 0, len(names))
+	for _, name := range names {
+		autoReply := models.AutoReply{
+			Keyword:   keyword,
+			Response:  responses[name],
+			MatchType: "contains",
+			ReplyType: "text",
+			IsActive:  true,
+		}
+		if spec := strings.TrimSpace(conditions[name]); spec != "" {
+			parsed, err := ParseAutoReplyConditions(spec)
+			if err != nil {
+				return fmt.Errorf("response %q: %w", name, err)
+			}
+			autoReply.Conditions = parsed
+			autoReply.Priority = 1
+		}
+		autoReplies = append(autoReplies, autoReply)
+	}
+
+	return s.BulkCreateAutoReplies(userID, autoReplies)
+}
+
+// SetAutoReplyRule sets when a rule fires: its priority, whether the rules
+// after it still run and its conditions.
+func (s *AutoReplyService) SetAutoReplyRule(userID, id uuid.UUID, priority int, continueMatching bool, conditions models.AutoReplyConditions) (*models.AutoReply, error) {
+	if err := normalizeAutoReplyConditions(&conditions); err != nil {
+		return nil, err
+	}
+
+	var autoReply models.AutoReply
+	err := s.sm.DB.Where("id = ? AND user_id = ?", id, userID).First(&autoReply).Error
+	if gorm.IsRecordNotFoundError(err) {
+		return nil, ErrAutoReplyNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	err = s.sm.DB.Model(&autoReply).Updates(map[string]interface{}{
+		"priority":          priority,
+		"continue_matching": continueMatching,
+		"conditions":        conditions,
+	}).Error
+	if err != nil {
+		logger.Log.WithError(err).WithField("auto_reply_id", id).Error("Failed to update auto-reply rule")
+		return nil, err
+	}
+
+	autoReply.Priority = priority
+	autoReply.ContinueMatching = continueMatching
+	autoReply.Conditions = conditions
+	return &autoReply, nil
+}
+
+// ParseAutoReplyConditions parses conditions written as semicolon-separated
+// "key=value" pairs: tags, time, days and types, plus first for the
+// contact's first message only. Lists are comma-separated.
+func ParseAutoReplyConditions(spec string) (models.AutoReplyConditions, error) {
+	var conditions models.AutoReplyConditions
+	for _, part := range strings.Split(spec, ";") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+		key, value := part, ""
+		if i := strings.Index(part, "="); i >= 0 {
+			key, value = strings.TrimSpace(part[:i]), strings.TrimSpace(part[i+1:])
+		}
+
+		switch strings.ToLower(key) {
+		case "tags":
+			conditions.ContactTags = strings.Split(value, ",")
+		case "time":
+			conditions.TimeWindow = value
+		case "days":
+			conditions.Weekdays = strings.Split(value, ",")
+		case "types":
+			conditions.MessageTypes = strings.Split(value, ",")
+		case "first":
+			first := true
+			if value != "" {
+				var err error
+				if first, err = strconv.ParseBool(value); err != nil {
+					return conditions, fmt.Errorf("%w: first must be true or false", ErrInvalidAutoReplyConditions)
+				}
+			}
+			conditions.FirstMessageOnly = first
+		default:
+			return conditions, fmt.Errorf("%w: unknown condition %q", ErrInvalidAutoReplyConditions, key)
 		}
 	}
 
+	err := normalizeAutoReplyConditions(&conditions)
+	return conditions, err
+}
+
+// normalizeAutoReplyConditions lowercases and trims the lists the way they
+// are matched, and checks the weekdays and time window.
+func normalizeAutoReplyConditions(conditions *models.AutoReplyConditions) error {
+	conditions.ContactTags = normalizeList(conditions.ContactTags)
+	conditions.Weekdays = normalizeList(conditions.Weekdays)
+	conditions.MessageTypes = normalizeList(conditions.MessageTypes)
+	conditions.TimeWindow = strings.TrimSpace(conditions.TimeWindow)
+
+	for _, day := range conditions.Weekdays {
+		if _, ok := autoReplyWeekdays[day]; !ok {
+			return fmt.Errorf("%w: unknown weekday %q, use mon, tue, wed, thu, fri, sat or sun", ErrInvalidAutoReplyConditions, day)
+		}
+	}
+	if conditions.TimeWindow != "" {
+		start, end, ok := parseTimeWindow(conditions.TimeWindow)
+		if !ok || start == end {
+			return fmt.Errorf("%w: time window must look like 08:00-17:00", ErrInvalidAutoReplyConditions)
+		}
+	}
 	return nil
 }
 
+func normalizeList(values []string) []string {
+	var normalized []string
+	for _, value := range values {
+		if value = strings.ToLower(strings.TrimSpace(value)); value != "" && !containsString(normalized, value) {
+			normalized = append(normalized, value)
+		}
+	}
+	return normalized
+}
+
 func (s *AutoReplyService) GetAutoReplyByID(id uuid.UUID) (*models.AutoReply, error) {
 	var autoReply models.AutoReply
 	err := s.sm.DB.Where("id = ?", id).First(&autoReply).Error
@@ -0,0 +1,241 @@
+package services
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"whatsapp-bot/internal/models"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// wib is UTC+7, the owner's timezone in these tests.
+var wib = time.FixedZone("WIB", 7*60*60)
+
+func newAutoReplyMatch(content, messageType, tags string, now time.Time, first bool) *autoReplyMatch {
+	return &autoReplyMatch{
+		contact:      &models.Contact{Tags: tags},
+		message:      &models.Message{Content: content, MessageType: messageType},
+		now:          now,
+		location:     wib,
+		firstMessage: &first,
+	}
+}
+
+func TestShouldTriggerAutoReply(t *testing.T) {
+	s := &AutoReplyService{}
+	// Monday 2024-03-04 23:30 in WIB
+	monday := time.Date(2024, 3, 4, 16, 30, 0, 0, time.UTC)
+
+	testCases := []struct {
+		name      string
+		match     *autoReplyMatch
+		autoReply models.AutoReply
+		expected  bool
+	}{
+		{
+			name:      "ExactKeyword",
+			match:     newAutoReplyMatch(" Halo ", "text", "", monday, false),
+			autoReply: models.AutoReply{Keyword: "halo", MatchType: "exact"},
+			expected:  true,
+		},
+		{
+			name:      "ContainsKeyword",
+			match:     newAutoReplyMatch("berapa harganya?", "text", "", monday, false),
+			autoReply: models.AutoReply{Keyword: "harga", MatchType: "contains"},
+			expected:  true,
+		},
+		{
+			name:      "KeywordMismatch",
+			match:     newAutoReplyMatch("halo kak", "text", "", monday, false),
+			autoReply: models.AutoReply{Keyword: "halo", MatchType: "exact"},
+			expected:  false,
+		},
+		{
+			name:      "InvalidRegex",
+			match:     newAutoReplyMatch("halo", "text", "", monday, false),
+			autoReply: models.AutoReply{Keyword: "(", MatchType: "regex"},
+			expected:  false,
+		},
+		{
+			name:      "TimeWindowAcrossMidnightInOwnerTimezone",
+			match:     newAutoReplyMatch("halo", "text", "", monday, false),
+			autoReply: models.AutoReply{Keyword: "halo", MatchType: "exact", Conditions: models.AutoReplyConditions{TimeWindow: "22:00-06:00"}},
+			expected:  true,
+		},
+		{
+			name:      "TimeWindowAfterMidnight",
+			match:     newAutoReplyMatch("halo", "text", "", monday.Add(2*time.Hour), false),
+			autoReply: models.AutoReply{Keyword: "halo", MatchType: "exact", Conditions: models.AutoReplyConditions{TimeWindow: "22:00-06:00"}},
+			expected:  true,
+		},
+		{
+			name:      "OutsideTimeWindow",
+			match:     newAutoReplyMatch("halo", "text", "", monday, false),
+			autoReply: models.AutoReply{Keyword: "halo", MatchType: "exact", Conditions: models.AutoReplyConditions{TimeWindow: "08:00-17:00"}},
+			expected:  false,
+		},
+		{
+			// 17:30 UTC on Monday is already Tuesday in WIB
+			name:      "WeekdayInOwnerTimezone",
+			match:     newAutoReplyMatch("halo", "text", "", monday.Add(time.Hour), false),
+			autoReply: models.AutoReply{Keyword: "halo", MatchType: "exact", Conditions: models.AutoReplyConditions{Weekdays: []string{"tue"}}},
+			expected:  true,
+		},
+		{
+			name:      "OtherWeekday",
+			match:     newAutoReplyMatch("halo", "text", "", monday, false),
+			autoReply: models.AutoReply{Keyword: "halo", MatchType: "exact", Conditions: models.AutoReplyConditions{Weekdays: []string{"sat", "sun"}}},
+			expected:  false,
+		},
+		{
+			name:      "ContactHasTag",
+			match:     newAutoReplyMatch("halo", "text", "Reseller, vip", monday, false),
+			autoReply: models.AutoReply{Keyword: "halo", MatchType: "exact", Conditions: models.AutoReplyConditions{ContactTags: []string{"vip"}}},
+			expected:  true,
+		},
+		{
+			name:      "ContactWithoutTag",
+			match:     newAutoReplyMatch("halo", "text", "reseller", monday, false),
+			autoReply: models.AutoReply{Keyword: "halo", MatchType: "exact", Conditions: models.AutoReplyConditions{ContactTags: []string{"vip"}}},
+			expected:  false,
+		},
+		{
+			name:      "MessageTypeAllowed",
+			match:     newAutoReplyMatch("halo", "Image", "", monday, false),
+			autoReply: models.AutoReply{Keyword: "halo", MatchType: "exact", Conditions: models.AutoReplyConditions{MessageTypes: []string{"image"}}},
+			expected:  true,
+		},
+		{
+			name:      "MessageTypeFiltered",
+			match:     newAutoReplyMatch("halo", "text", "", monday, false),
+			autoReply: models.AutoReply{Keyword: "halo", MatchType: "exact", Conditions: models.AutoReplyConditions{MessageTypes: []string{"image"}}},
+			expected:  false,
+		},
+		{
+			name:      "FirstMessageOnly",
+			match:     newAutoReplyMatch("halo", "text", "", monday, true),
+			autoReply: models.AutoReply{Keyword: "halo", MatchType: "exact", Conditions: models.AutoReplyConditions{FirstMessageOnly: true}},
+			expected:  true,
+		},
+		{
+			name:      "NotFirstMessage",
+			match:     newAutoReplyMatch("halo", "text", "", monday, false),
+			autoReply: models.AutoReply{Keyword: "halo", MatchType: "exact", Conditions: models.AutoReplyConditions{FirstMessageOnly: true}},
+			expected:  false,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			assert.Equal(t, tc.expected, s.shouldTriggerAutoReply(tc.match, tc.autoReply))
+		})
+	}
+}
+
+func TestMatchingAutoReplies(t *testing.T) {
+	s := &AutoReplyService{}
+	monday := time.Date(2024, 3, 4, 3, 0, 0, 0, time.UTC)
+
+	keywords := func(autoReplies []models.AutoReply) []string {
+		var result []string
+		for _, autoReply := range autoReplies {
+			result = append(result, autoReply.Keyword)
+		}
+		return result
+	}
+
+	t.Run("HighestPriorityFirst", func(t *testing.T) {
+		autoReplies := []models.AutoReply{
+			{Keyword: "halo", MatchType: "exact", Priority: 0},
+			{Keyword: "hal", MatchType: "contains", Priority: 5},
+		}
+		matched := s.matchingAutoReplies(newAutoReplyMatch("halo", "text", "", monday, false), autoReplies)
+		assert.Equal(t, []string{"hal"}, keywords(matched))
+	})
+
+	t.Run("OldestFirstWithinPriority", func(t *testing.T) {
+		autoReplies := []models.AutoReply{
+			{Keyword: "ha", MatchType: "contains", Priority: 1},
+			{Keyword: "halo", MatchType: "exact", Priority: 1},
+		}
+		matched := s.matchingAutoReplies(newAutoReplyMatch("halo", "text", "", monday, false), autoReplies)
+		assert.Equal(t, []string{"ha"}, keywords(matched))
+	})
+
+	t.Run("ContinueMatching", func(t *testing.T) {
+		autoReplies := []models.AutoReply{
+			{Keyword: "halo", MatchType: "exact", Priority: 0},
+			{Keyword: "lo", MatchType: "contains", Priority: 1},
+			{Keyword: "ha", MatchType: "contains", Priority: 2, ContinueMatching: true},
+			{Keyword: "bye", MatchType: "exact", Priority: 3},
+		}
+		matched := s.matchingAutoReplies(newAutoReplyMatch("halo", "text", "", monday, false), autoReplies)
+		assert.Equal(t, []string{"ha", "lo"}, keywords(matched))
+	})
+
+	t.Run("ConditionsSkipRule", func(t *testing.T) {
+		autoReplies := []models.AutoReply{
+			{Keyword: "halo", MatchType: "exact", Priority: 1, Conditions: models.AutoReplyConditions{ContactTags: []string{"vip"}}},
+			{Keyword: "halo", MatchType: "exact", Priority: 0, Response: "fallback"},
+		}
+		matched := s.matchingAutoReplies(newAutoReplyMatch("halo", "text", "", monday, false), autoReplies)
+		if assert.Len(t, matched, 1) {
+			assert.Equal(t, "fallback", matched[0].Response)
+		}
+	})
+}
+
+func TestParseAutoReplyConditions(t *testing.T) {
+	testCases := []struct {
+		name     string
+		spec     string
+		expected models.AutoReplyConditions
+		invalid  bool
+	}{
+		{
+			name:     "Empty",
+			spec:     "",
+			expected: models.AutoReplyConditions{},
+		},
+		{
+			name: "AllConditions",
+			spec: "tags=VIP, reseller;time=22:00-06:00;days=Sat,sun;types=text,image;first",
+			expected: models.AutoReplyConditions{
+				ContactTags:      []string{"vip", "reseller"},
+				TimeWindow:       "22:00-06:00",
+				Weekdays:         []string{"sat", "sun"},
+				MessageTypes:     []string{"text", "image"},
+				FirstMessageOnly: true,
+			},
+		},
+		{
+			name:     "DuplicateAndEmptyItems",
+			spec:     " tags = vip,,VIP ; ",
+			expected: models.AutoReplyConditions{ContactTags: []string{"vip"}},
+		},
+		{
+			name:     "FirstFalse",
+			spec:     "first=false",
+			expected: models.AutoReplyConditions{},
+		},
+		{name: "InvalidFirst", spec: "first=maybe", invalid: true},
+		{name: "UnknownKey", spec: "mood=happy", invalid: true},
+		{name: "UnknownWeekday", spec: "days=funday", invalid: true},
+		{name: "MalformedTimeWindow", spec: "time=8-17", invalid: true},
+		{name: "EmptyTimeWindow", spec: "time=08:00-08:00", invalid: true},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			conditions, err := ParseAutoReplyConditions(tc.spec)
+			if tc.invalid {
+				assert.True(t, errors.Is(err, ErrInvalidAutoReplyConditions))
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tc.expected, conditions)
+		})
+	}
+}
@@ -0,0 +1,461 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+
+	"whatsapp-bot/internal/models"
+	"whatsapp-bot/pkg/logger"
+	"whatsapp-bot/pkg/storage"
+	"whatsapp-bot/pkg/telegram"
+	"whatsapp-bot/pkg/utils"
+
+	"github.com/go-redis/redis/v8"
+	"github.com/google/uuid"
+	"github.com/jinzhu/gorm"
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	SyncTelegramToWhatsApp = "telegram_to_whatsapp"
+	SyncWhatsAppToTelegram = "whatsapp_to_telegram"
+	SyncBoth               = "both"
+
+	bridgeCodeKeyPrefix     = "bridge:code:"
+	bridgeCodesKeyPrefix    = "bridge:codes:"    // pending codes per owner
+	bridgeMissesKeyPrefix   = "bridge:misses:"   // failed codes per owner
+	bridgeAttemptsKeyPrefix = "bridge:attempts:" // failed codes per contact
+	bridgeRelayedKeyPrefix  = "bridge:relayed:"
+	bridgeCodeTTL           = 10 * time.Minute
+	bridgeRelayedTTL        = 24 * time.Hour
+
+	// bridgeMaxMisses failed codes lock a contact out until the code TTL
+	// passes, and revoke every pending code of the owner, so each code can
+	// only be guessed a few times.
+	bridgeMaxMisses = 5
+
+	// bridgeMarker starts every relayed text. Messages that carry it are
+	// never relayed again, so two bridges can't echo each other.
+	bridgeMarker = "🔁"
+)
+
+var ErrBridgeNotFound = errors.New("bridge not found")
+
+// BridgeService relays messages between a WhatsApp contact and a Telegram
+// chat linked through a models.TelegramIntegration.
+//
+// A link is made with a one-time code: "link" on one side returns the code,
+// "link <code>" on the other side confirms it. "unlink" on either side
+// removes the link.
+type BridgeService struct {
+	sm *ServiceManager
+}
+
+// ProcessBridgeCommand handles the link and unlink commands. It reports
+// whether the message was a bridge command.
+func (s *BridgeService) ProcessBridgeCommand(contact *models.Contact, message *models.Message) (bool, error) {
+	if !isBridgeCommand(message.Content) {
+		return false, nil
+	}
+
+	fields := strings.Fields(strings.ToLower(message.Content))
+	switch {
+	case fields[0] == "unlink":
+		return true, s.unlink(contact)
+	case len(fields) == 1:
+		return true, s.startLink(contact)
+	default:
+		return true, s.confirmLink(contact, fields[1])
+	}
+}
+
+func isBridgeCommand(content string) bool {
+	fields := strings.Fields(strings.ToLower(content))
+	if len(fields) == 0 {
+		return false
+	}
+	switch {
+	case fields[0] == "unlink" || fields[0] == "link":
+		return len(fields) == 1 || (fields[0] == "link" && len(fields) == 2 && isLinkCode(fields[1]))
+	default:
+		return false
+	}
+}
+
+func isLinkCode(code string) bool {
+	_, err := strconv.Atoi(code)
+	return len(code) == 6 && err == nil
+}
+
+func (s *BridgeService) startLink(contact *models.Contact) error {
+	code := utils.GenerateOTP()
+	ctx := s.sm.Redis.Context()
+	if err := s.sm.Redis.Set(ctx, bridgeCodeKeyPrefix+code, contact.ID.String(), bridgeCodeTTL).Err(); err != nil {
+		return err
+	}
+	codesKey := bridgeCodesKeyPrefix + contact.UserID.String()
+	s.sm.Redis.SAdd(ctx, codesKey, code)
+	s.sm.Redis.Expire(ctx, codesKey, bridgeCodeTTL)
+
+	other := "Telegram"
+	if contact.Platform == PlatformTelegram {
+		other = "WhatsApp"
+	}
+
+	return s.sm.SendContactText(contact, fmt.Sprintf(
+		"🔗 Kode penghubung: *%s*\n\nKirim \"link %s\" dari %s dalam %d menit untuk menghubungkan kedua chat.",
+		code, code, other, int(bridgeCodeTTL.Minutes())))
+}
+
+// recordMiss counts a wrong code against the contact and its owner. When
+// the owner's contacts have missed too often, all of the owner's pending
+// codes are revoked and have to be requested again.
+func (s *BridgeService) recordMiss(contact *models.Contact) {
+	ctx := s.sm.Redis.Context()
+	attemptsKey := bridgeAttemptsKeyPrefix + contact.ID.String()
+	s.sm.Redis.Incr(ctx, attemptsKey)
+	s.sm.Redis.Expire(ctx, attemptsKey, bridgeCodeTTL)
+
+	owner := contact.UserID.String()
+	missesKey := bridgeMissesKeyPrefix + owner
+	misses, err := s.sm.Redis.Incr(ctx, missesKey).Result()
+	if err != nil {
+		logger.Log.WithError(err).Error("Failed to count bridge code misses")
+		return
+	}
+	s.sm.Redis.Expire(ctx, missesKey, bridgeCodeTTL)
+	if misses < bridgeMaxMisses {
+		return
+	}
+
+	codesKey := bridgeCodesKeyPrefix + owner
+	codes, err := s.sm.Redis.SMembers(ctx, codesKey).Result()
+	if err != nil {
+		logger.Log.WithError(err).Error("Failed to load pending bridge codes")
+		return
+	}
+	keys := []string{codesKey, missesKey}
+	for _, code := range codes {
+		keys = append(keys, bridgeCodeKeyPrefix+code)
+	}
+	s.sm.Redis.Del(ctx, keys...)
+
+	logger.Log.WithFields(logrus.Fields{
+		"user_id": contact.UserID,
+		"revoked": len(codes),
+	}).Warn("Revoked pending bridge codes after repeated wrong codes")
+}
+
+func (s *BridgeService) confirmLink(contact *models.Contact, code string) error {
+	ctx := s.sm.Redis.Context()
+	attempts, err := s.sm.Redis.Get(ctx, bridgeAttemptsKeyPrefix+contact.ID.String()).Int()
+	if err != nil && err != redis.Nil {
+		return err
+	}
+	if attempts >= bridgeMaxMisses {
+		return s.sm.SendContactText(contact, fmt.Sprintf("❌ Terlalu banyak kode salah. Coba lagi dalam %d menit.", int(bridgeCodeTTL.Minutes())))
+	}
+
+	key := bridgeCodeKeyPrefix + code
+	value, err := s.sm.Redis.Get(ctx, key).Result()
+	if err == redis.Nil {
+		s.recordMiss(contact)
+		return s.sm.SendContactText(contact, "❌ Kode tidak valid atau sudah kedaluwarsa.")
+	}
+	if err != nil {
+		return err
+	}
+
+	contactID, err := uuid.Parse(value)
+	if err != nil {
+		return err
+	}
+
+	other := &models.Contact{}
+	if err := s.sm.DB.Where("id = ?", contactID).First(other).Error; err != nil {
+		return err
+	}
+
+	if other.UserID != contact.UserID {
+		s.recordMiss(contact)
+		return s.sm.SendContactText(contact, "❌ Kode tidak valid atau sudah kedaluwarsa.")
+	}
+	if isWhatsAppContact(other) == isWhatsAppContact(contact) {
+		return s.sm.SendContactText(contact, "❌ Kode harus dikirim dari chat di platform lain.")
+	}
+	s.sm.Redis.Del(ctx, key, bridgeAttemptsKeyPrefix+contact.ID.String())
+	s.sm.Redis.SRem(ctx, bridgeCodesKeyPrefix+contact.UserID.String(), code)
+
+	waContact, tgContact := contact, other
+	if !isWhatsAppContact(contact) {
+		waContact, tgContact = other, contact
+	}
+
+	// A contact is bridged to at most one chat
+	if err := s.deleteIntegrations(waContact); err != nil {
+		return err
+	}
+	if err := s.deleteIntegrations(tgContact); err != nil {
+		return err
+	}
+
+	integration := &models.TelegramIntegration{
+		ID:             uuid.New(),
+		UserID:         contact.UserID,
+		TelegramUserID: tgContact.TelegramChatID,
+		TelegramBotID:  tgContact.TelegramBotID,
+		WhatsAppUserID: waContact.PhoneNumber,
+		IsSyncEnabled:  true,
+		SyncDirection:  SyncBoth,
+	}
+	if err := s.sm.DB.Create(integration).Error; err != nil {
+		return err
+	}
+
+	text := "✅ Chat WhatsApp dan Telegram sudah terhubung. Pesan akan diteruskan ke kedua arah. Kirim \"unlink\" untuk memutuskan."
+	for _, c := range []*models.Contact{waContact, tgContact} {
+		if err := s.sm.SendContactText(c, text); err != nil {
+			logger.Log.WithError(err).Error("Failed to confirm bridge link")
+		}
+	}
+	return nil
+}
+
+func (s *BridgeService) unlink(contact *models.Contact) error {
+	if err := s.deleteIntegrations(contact); err != nil {
+		return err
+	}
+	return s.sm.SendContactText(contact, "🔌 Chat tidak lagi terhubung.")
+}
+
+func (s *BridgeService) deleteIntegrations(contact *models.Contact) error {
+	return s.contactIntegrations(s.sm.DB.Where("user_id = ?", contact.UserID), contact).
+		Delete(&models.TelegramIntegration{}).Error
+}
+
+// contactIntegrations limits a query to the bridges of a contact. A Telegram
+// chat is identified by its chat ID and the bot it talks to.
+func (s *BridgeService) contactIntegrations(query *gorm.DB, contact *models.Contact) *gorm.DB {
+	if isWhatsAppContact(contact) {
+		return query.Where("whatsapp_user_id = ?", contact.PhoneNumber)
+	}
+	query = query.Where("telegram_user_id = ?", contact.TelegramChatID)
+	return whereBot(query, "telegram_bot_id", contact.TelegramBotID)
+}
+
+// findIntegration returns the enabled bridge for a contact, or nil.
+func (s *BridgeService) findIntegration(contact *models.Contact) *models.TelegramIntegration {
+	query := s.contactIntegrations(s.sm.DB.Where("user_id = ? AND is_sync_enabled = ?", contact.UserID, true), contact)
+
+	integration := &models.TelegramIntegration{}
+	if err := query.First(integration).Error; err != nil {
+		if !gorm.IsRecordNotFoundError(err) {
+			logger.Log.WithError(err).Error("Failed to load bridge")
+		}
+		return nil
+	}
+	return integration
+}
+
+func syncsTo(integration *models.TelegramIntegration, direction string) bool {
+	return integration.SyncDirection == SyncBoth || integration.SyncDirection == direction
+}
+
+// claimRelay makes sure an inbound message is relayed at most once and that
+// relayed copies are never relayed back.
+func (s *BridgeService) claimRelay(message *models.Message) bool {
+	if message.Direction != "incoming" || message.IsForwarded {
+		return false
+	}
+	if strings.HasPrefix(message.Content, bridgeMarker) || isBridgeCommand(message.Content) {
+		return false
+	}
+
+	ok, err := s.sm.Redis.SetNX(s.sm.Redis.Context(), bridgeRelayedKeyPrefix+message.MessageID, 1, bridgeRelayedTTL).Result()
+	if err != nil {
+		logger.Log.WithError(err).Warn("Failed to claim bridged message, relaying anyway")
+		return true
+	}
+	return ok
+}
+
+// RelayFromWhatsApp forwards an inbound WhatsApp message to the linked
+// Telegram chat.
+func (s *BridgeService) RelayFromWhatsApp(contact *models.Contact, message *models.Message) {
+	integration := s.findIntegration(contact)
+	if integration == nil || !syncsTo(integration, SyncWhatsAppToTelegram) || !s.claimRelay(message) {
+		return
+	}
+
+	// Replies quote the message they answer
+	quoted := ""
+	if message.ReplyToID != "" {
+		original := &models.Message{}
+		if err := s.sm.DB.Where("message_id = ?", message.ReplyToID).First(original).Error; err == nil {
+			quoted = original.Content
+		}
+	}
+
+	// Relays go out through the bot the Telegram chat talks to
+	bot := s.sm.TelegramFor(integration.TelegramBotID)
+	text := bridgeText(contactName(contact), message.Content, quoted)
+	channel := &telegramChannel{client: bot.client, chatID: integration.TelegramUserID}
+
+	var err error
+	switch {
+	case message.MediaURL != "" && message.MessageType == "image":
+		err = channel.SendImage(message.MediaURL, text)
+	case message.MediaURL != "":
+		err = bot.SendDocument(integration.TelegramUserID, message.MediaURL, text)
+	default:
+		err = channel.SendText(text)
+	}
+	s.finishRelay(integration, message, err)
+}
+
+// RelayFromTelegram forwards an inbound Telegram message to the linked
+// WhatsApp contact. Photos and documents are downloaded from Telegram and
+// uploaded to WhatsApp, since Telegram file URLs contain the bot token.
+func (s *BridgeService) RelayFromTelegram(contact *models.Contact, message *models.Message, update *telegram.Message) {
+	integration := s.findIntegration(contact)
+	if integration == nil || !syncsTo(integration, SyncTelegramToWhatsApp) || !s.claimRelay(message) {
+		return
+	}
+
+	quoted := ""
+	if reply := update.ReplyToMessage; reply != nil {
+		quoted = reply.Text
+		if quoted == "" {
+			quoted = reply.Caption
+		}
+	}
+
+	text := bridgeText(contactName(contact), message.Content, quoted)
+	to := integration.WhatsAppUserID
+	// File IDs are only valid for the bot that received them
+	client := s.sm.TelegramFor(contact.TelegramBotID).client
+
+	var sent *models.Message
+	var err error
+	switch {
+	case len(update.Photo) > 0:
+		// The last size is the largest
+		photo := update.Photo[len(update.Photo)-1]
+		sent, err = s.relayTelegramFile(client, integration.UserID, to, "image", photo.FileID, photo.FileUniqueID+".jpg", "image/jpeg", text)
+	case update.Document != nil:
+		sent, err = s.relayTelegramFile(client, integration.UserID, to, "document", update.Document.FileID, update.Document.FileName, update.Document.MimeType, text)
+	default:
+		sent, err = s.sm.WhatsAppService.SendMessage(integration.UserID, to, text, "text")
+	}
+
+	if sent != nil {
+		s.sm.DB.Model(sent).Update("is_forwarded", true)
+	}
+	s.finishRelay(integration, message, err)
+}
+
+func (s *BridgeService) relayTelegramFile(client *telegram.Client, userID uuid.UUID, to, mediaType, fileID, filename, mimeType, caption string) (*models.Message, error) {
+	file, err := client.GetFile(fileID)
+	if err != nil {
+		return nil, err
+	}
+
+	data, err := client.DownloadFile(file.FilePath)
+	if err != nil {
+		return nil, err
+	}
+
+	if filename == "" {
+		filename = path.Base(file.FilePath)
+	}
+	if mimeType == "" {
+		mimeType = "application/octet-stream"
+	}
+	if path.Ext(filename) == "" {
+		filename += storage.ExtensionForMimeType(mimeType)
+	}
+
+	return s.sm.WhatsAppService.SendMediaFile(userID, to, mediaType, filename, mimeType, data, caption)
+}
+
+func (s *BridgeService) finishRelay(integration *models.TelegramIntegration, message *models.Message, err error) {
+	if err != nil {
+		logger.Log.WithError(err).WithFields(logrus.Fields{
+			"integration_id": integration.ID,
+			"message_id":     message.MessageID,
+		}).Error("Failed to relay bridged message")
+		// Let a redelivery try again
+		s.sm.Redis.Del(s.sm.Redis.Context(), bridgeRelayedKeyPrefix+message.MessageID)
+		return
+	}
+
+	s.sm.DB.Model(integration).Update("last_sync_at", time.Now())
+}
+
+func bridgeText(sender, content, quoted string) string {
+	var b strings.Builder
+	b.WriteString(bridgeMarker + " " + sender + ":\n")
+	if quoted != "" {
+		b.WriteString("↩️ \"" + utils.TruncateString(quoted, 100) + "\"\n")
+	}
+	b.WriteString(content)
+	return b.String()
+}
+
+func contactName(contact *models.Contact) string {
+	if contact.DisplayName != "" {
+		return contact.DisplayName
+	}
+	if isWhatsAppContact(contact) {
+		return contact.PhoneNumber
+	}
+	return strconv.FormatInt(contact.TelegramChatID, 10)
+}
+
+// GetBridges lists the user's WhatsApp ↔ Telegram links.
+func (s *BridgeService) GetBridges(userID uuid.UUID) ([]models.TelegramIntegration, error) {
+	var integrations []models.TelegramIntegration
+	err := s.sm.DB.Where("user_id = ?", userID).Order("created_at desc").Find(&integrations).Error
+	return integrations, err
+}
+
+// UpdateBridge pauses or resumes a link, or changes which way it relays.
+func (s *BridgeService) UpdateBridge(userID, bridgeID uuid.UUID, isSyncEnabled *bool, syncDirection string) (*models.TelegramIntegration, error) {
+	integration, err := s.getUserBridge(userID, bridgeID)
+	if err != nil {
+		return nil, err
+	}
+
+	if isSyncEnabled != nil {
+		integration.IsSyncEnabled = *isSyncEnabled
+	}
+	if syncDirection != "" {
+		integration.SyncDirection = syncDirection
+	}
+
+	if err := s.sm.DB.Save(integration).Error; err != nil {
+		return nil, err
+	}
+	return integration, nil
+}
+
+func (s *BridgeService) DeleteBridge(userID, bridgeID uuid.UUID) error {
+	integration, err := s.getUserBridge(userID, bridgeID)
+	if err != nil {
+		return err
+	}
+	return s.sm.DB.Delete(integration).Error
+}
+
+func (s *BridgeService) getUserBridge(userID, bridgeID uuid.UUID) (*models.TelegramIntegration, error) {
+	integration := &models.TelegramIntegration{}
+	err := s.sm.DB.Where("id = ? AND user_id = ?", bridgeID, userID).First(integration).Error
+	if gorm.IsRecordNotFoundError(err) {
+		return nil, ErrBridgeNotFound
+	}
+	return integration, err
+}
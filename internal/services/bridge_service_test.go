@@ -0,0 +1,63 @@
+package services
+
+import (
+	"testing"
+
+	"whatsapp-bot/internal/models"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestClaimRelaySkipsLoops(t *testing.T) {
+	// None of these reach Redis, so the service needs no dependencies
+	s := &BridgeService{}
+
+	testCases := []struct {
+		name    string
+		message *models.Message
+	}{
+		{name: "Outgoing", message: &models.Message{Direction: "outgoing", Content: "halo"}},
+		{name: "Forwarded", message: &models.Message{Direction: "incoming", Content: "halo", IsForwarded: true}},
+		{name: "RelayedCopy", message: &models.Message{Direction: "incoming", Content: bridgeText("Budi", "halo", "")}},
+		{name: "RelayedReply", message: &models.Message{Direction: "incoming", Content: bridgeText("Budi", "iya", "halo")}},
+		{name: "LinkCommand", message: &models.Message{Direction: "incoming", Content: "link"}},
+		{name: "ConfirmCommand", message: &models.Message{Direction: "incoming", Content: "LINK 123456"}},
+		{name: "UnlinkCommand", message: &models.Message{Direction: "incoming", Content: " unlink "}},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			assert.False(t, s.claimRelay(tc.message))
+		})
+	}
+}
+
+func TestIsBridgeCommand(t *testing.T) {
+	testCases := []struct {
+		content  string
+		expected bool
+	}{
+		{content: "link", expected: true},
+		{content: "Link 123456", expected: true},
+		{content: "unlink", expected: true},
+		{content: "link 12345", expected: false},
+		{content: "link abcdef", expected: false},
+		{content: "unlink 123456", expected: false},
+		{content: "link me to the shop", expected: false},
+		{content: "", expected: false},
+	}
+
+	for _, tc := range testCases {
+		assert.Equal(t, tc.expected, isBridgeCommand(tc.content), "content %q", tc.content)
+	}
+}
+
+func TestSyncsTo(t *testing.T) {
+	both := &models.TelegramIntegration{SyncDirection: SyncBoth}
+	assert.True(t, syncsTo(both, SyncWhatsAppToTelegram))
+	assert.True(t, syncsTo(both, SyncTelegramToWhatsApp))
+
+	oneWay := &models.TelegramIntegration{SyncDirection: SyncWhatsAppToTelegram}
+	assert.True(t, syncsTo(oneWay, SyncWhatsAppToTelegram))
+	assert.False(t, syncsTo(oneWay, SyncTelegramToWhatsApp))
+}
@@ -190,5 +190,42 @@ func (s *BroadcastService) GetBroadcastStats(broadcastID uuid.UUID) (map[string]
 		"completed_at":  broadcast.CompletedAt,
 	}
 
+	// Delivery funnel from recipient status callbacks
+	var statusCounts []struct {
+		Status string
+		Count  int
+	}
+	if err := s.db.DB.Model(&models.BroadcastRecipient{}).
+		Where("broadcast_id = ?", broadcastID).
+		Select("status, count(*) as count").
+		Group("status").
+		Scan(&statusCounts).Error; err != nil {
+		logger.Error("Failed to get broadcast recipient stats", err)
+		return nil, err
+	}
+
+	counts := make(map[string]int)
+	for _, sc := range statusCounts {
+		counts[sc.Status] = sc.Count
+	}
+
+	// Each stage includes the recipients that went further
+	read := counts["read"]
+	delivered := counts["delivered"] + read
+	sent := counts["sent"] + delivered
+
+	funnel := map[string]interface{}{
+		"pending":   counts["pending"] + counts["queued"],
+		"sent":      sent,
+		"delivered": delivered,
+		"read":      read,
+		"failed":    counts["failed"],
+	}
+	if sent > 0 {
+		funnel["delivery_rate"] = float64(delivered) / float64(sent) * 100
+		funnel["read_rate"] = float64(read) / float64(sent) * 100
+	}
+	stats["funnel"] = funnel
+
 	return stats, nil
 }
\ No newline at end of file
@@ -0,0 +1,199 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"whatsapp-bot/internal/models"
+	"whatsapp-bot/pkg/logger"
+
+	"github.com/google/uuid"
+	"github.com/jinzhu/gorm"
+	"github.com/sirupsen/logrus"
+)
+
+var ErrOutOfStock = errors.New("not enough stock")
+
+const (
+	catalogCommand   = "katalog"
+	maxOrderQuantity = 100
+	// catalogSize caps the products listed by "katalog"; their numbers are
+	// the ones "pesan <nomor>" accepts.
+	catalogSize = 30
+)
+
+// ProcessBusinessCommand handles the catalog commands customers send:
+// "katalog" lists the active products and "pesan <nomor|nama> [jumlah]"
+// places an order. It reports whether an order was placed, so the caller
+// only acknowledges messages that actually created one.
+func (s *BusinessService) ProcessBusinessCommand(contact *models.Contact, message *models.Message) (bool, error) {
+	content := strings.ToLower(strings.TrimSpace(message.Content))
+	if content == catalogCommand {
+		return false, s.sendCatalog(contact)
+	}
+	if !isOrderCommand(content) {
+		return false, nil
+	}
+
+	target, quantity := parseOrderCommand(content)
+	if quantity < 1 || quantity > maxOrderQuantity {
+		return false, s.sm.SendContactText(contact, fmt.Sprintf("❌ Jumlah pesanan harus 1 - %d.", maxOrderQuantity))
+	}
+
+	product, err := s.findCatalogProduct(contact.UserID, target)
+	if gorm.IsRecordNotFoundError(err) {
+		return false, s.sm.SendContactText(contact, fmt.Sprintf("❌ Produk \"%s\" tidak ditemukan. Ketik \"katalog\" untuk melihat daftar produk.", target))
+	}
+	if err != nil {
+		return false, err
+	}
+
+	order, err := s.PlaceOrder(contact, product, quantity)
+	if errors.Is(err, ErrOutOfStock) {
+		return false, s.sm.SendContactText(contact, fmt.Sprintf("❌ Stok %s tidak cukup (tersisa %d).", product.Name, product.Stock))
+	}
+	if err != nil {
+		return false, err
+	}
+
+	reply := fmt.Sprintf("🧾 Pesanan %s dibuat\n\n%s x%d\nTotal: %s\n\nKami akan segera memprosesnya.",
+		order.OrderNumber, product.Name, quantity, formatAmount(order.TotalAmount, order.Currency))
+	if contact.Platform == PlatformTelegram {
+		reply += fmt.Sprintf("\nKetik \"bayar %s\" untuk membayar.", order.OrderNumber)
+	}
+	return true, s.sm.SendContactText(contact, reply)
+}
+
+// parseOrderCommand splits "pesan <nomor|nama> [jumlah]" into the product
+// and the quantity, which defaults to 1.
+func parseOrderCommand(content string) (string, int) {
+	fields := strings.Fields(content)[1:]
+	if len(fields) > 1 {
+		if quantity, err := strconv.Atoi(fields[len(fields)-1]); err == nil {
+			return strings.Join(fields[:len(fields)-1], " "), quantity
+		}
+	}
+	return strings.Join(fields, " "), 1
+}
+
+// catalogProducts lists the owner's active products in catalog order, the
+// order the menu and "katalog" number them in.
+func (s *BusinessService) catalogProducts(userID uuid.UUID) ([]models.Product, error) {
+	var products []models.Product
+	err := s.sm.DB.Where("user_id = ? AND is_active = ?", userID, true).
+		Order("created_at ASC").
+		Limit(catalogSize).
+		Find(&products).Error
+	return products, err
+}
+
+// findCatalogProduct resolves a catalog number or a product name.
+func (s *BusinessService) findCatalogProduct(userID uuid.UUID, target string) (*models.Product, error) {
+	if index, err := strconv.Atoi(target); err == nil {
+		products, err := s.catalogProducts(userID)
+		if err != nil {
+			return nil, err
+		}
+		if index < 1 || index > len(products) {
+			return nil, gorm.ErrRecordNotFound
+		}
+		return &products[index-1], nil
+	}
+
+	var product models.Product
+	err := s.sm.DB.Where("user_id = ? AND is_active = ? AND LOWER(name) = ?", userID, true, target).First(&product).Error
+	if err != nil {
+		return nil, err
+	}
+	return &product, nil
+}
+
+func (s *BusinessService) sendCatalog(contact *models.Contact) error {
+	products, err := s.catalogProducts(contact.UserID)
+	if err != nil {
+		return err
+	}
+	if len(products) == 0 {
+		return s.sm.SendContactText(contact, "📋 Belum ada produk di katalog.")
+	}
+
+	var b strings.Builder
+	b.WriteString("📋 KATALOG 📋\n")
+	for i, product := range products {
+		fmt.Fprintf(&b, "\n%d. %s - %s (stok %d)", i+1, product.Name, formatAmount(product.Price, product.Currency), product.Stock)
+	}
+	b.WriteString("\n\nKetik \"pesan <nomor> <jumlah>\" untuk memesan, contoh: pesan 1 2")
+
+	return s.sm.SendContactText(contact, b.String())
+}
+
+// PlaceOrder creates a pending order for a contact and takes the quantity
+// out of stock. The order belongs to the contact, so invoices and receipts
+// reach the customer on the platform they ordered from.
+func (s *BusinessService) PlaceOrder(contact *models.Contact, product *models.Product, quantity int) (*models.Order, error) {
+	subtotal := product.Price * float64(quantity)
+	order := &models.Order{
+		UserID:      contact.UserID,
+		ContactID:   contact.ID,
+		OrderNumber: newOrderNumber(),
+		Status:      "pending",
+		TotalAmount: subtotal,
+		Currency:    product.Currency,
+		Items: []models.OrderItem{{
+			ProductID: product.ID,
+			Quantity:  quantity,
+			Price:     product.Price,
+			Subtotal:  subtotal,
+		}},
+	}
+
+	tx := s.sm.DB.Begin()
+	defer func() {
+		if r := recover(); r != nil {
+			tx.Rollback()
+		}
+	}()
+
+	// Guard against concurrent orders taking the last items
+	result := tx.Model(&models.Product{}).
+		Where("id = ? AND stock >= ?", product.ID, quantity).
+		UpdateColumn("stock", gorm.Expr("stock - ?", quantity))
+	if result.Error != nil {
+		tx.Rollback()
+		return nil, result.Error
+	}
+	if result.RowsAffected == 0 {
+		tx.Rollback()
+		return nil, ErrOutOfStock
+	}
+
+	if err := tx.Create(order).Error; err != nil {
+		tx.Rollback()
+		logger.Log.WithError(err).WithField("product_id", product.ID).Error("Failed to create order")
+		return nil, err
+	}
+
+	if err := tx.Commit().Error; err != nil {
+		return nil, err
+	}
+
+	s.sm.AnalyticsService.LogEvent(contact.UserID, "order_created", 1, map[string]interface{}{
+		"order_id":   order.ID,
+		"contact_id": contact.ID,
+		"platform":   s.sm.Channel(contact).Platform(),
+	})
+	logger.Log.WithFields(logrus.Fields{
+		"order_id":     order.ID,
+		"order_number": order.OrderNumber,
+		"contact_id":   contact.ID,
+	}).Info("Order placed from chat")
+
+	return order, nil
+}
+
+func newOrderNumber() string {
+	return fmt.Sprintf("ORD-%s-%s", time.Now().Format("20060102"), strings.ToUpper(uuid.New().String()[:8]))
+}
@@ -0,0 +1,276 @@
+package services
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"whatsapp-bot/internal/models"
+	"whatsapp-bot/pkg/logger"
+	"whatsapp-bot/pkg/telegram"
+	"whatsapp-bot/pkg/whatsapp"
+
+	"github.com/google/uuid"
+)
+
+const (
+	PlatformWhatsApp = "whatsapp"
+	PlatformTelegram = "telegram"
+)
+
+// Channel sends messages to one conversation, whatever platform it is on.
+// Command handlers reply through the contact's channel so they run unchanged
+// on WhatsApp and Telegram.
+type Channel interface {
+	Platform() string
+	// ConversationID identifies the conversation on its platform: the phone
+	// number on WhatsApp, the chat ID on Telegram.
+	ConversationID() string
+	SendText(text string) error
+	SendImage(imageURL, caption string) error
+	SendButtons(body string, options []ChannelOption) error
+	SendList(header, body, buttonText string, sections []ChannelSection) error
+	SendReaction(messageID, emoji string) error
+}
+
+// ChannelOption is a button or list row. Its ID comes back as the reply ID
+// when the user picks it.
+type ChannelOption struct {
+	ID          string
+	Title       string
+	Description string
+}
+
+type ChannelSection struct {
+	Title   string
+	Options []ChannelOption
+}
+
+// Channel returns the channel for replying to a contact.
+func (sm *ServiceManager) Channel(contact *models.Contact) Channel {
+	if contact.Platform == PlatformTelegram {
+		return &telegramChannel{client: sm.TelegramFor(contact.TelegramBotID).client, chatID: contact.TelegramChatID}
+	}
+	return &whatsappChannel{service: sm.WhatsAppService, userID: contact.UserID, to: contact.PhoneNumber}
+}
+
+// isWhatsAppContact reports whether the contact is reached over WhatsApp.
+func isWhatsAppContact(contact *models.Contact) bool {
+	return contact.Platform == "" || contact.Platform == PlatformWhatsApp
+}
+
+// HandleConversationMessage runs a saved inbound message through the bot's
+// command handlers. replyID is set when the user tapped a button or list row.
+func (sm *ServiceManager) HandleConversationMessage(contact *models.Contact, message *models.Message, replyID string) error {
+	// Tapped buttons and list rows are routed by their reply ID
+	if replyID != "" {
+		handled, err := sm.AutoReplyService.ProcessInteractiveResponse(contact, message, replyID)
+		if err != nil {
+			logger.Log.WithError(err).Error("Failed to process interactive response")
+		}
+		if handled {
+			sm.AnalyticsService.LogEvent(contact.UserID, "interactive_reply", 1, map[string]interface{}{
+				"reply_id":   replyID,
+				"contact_id": contact.ID,
+				"platform":   sm.Channel(contact).Platform(),
+			})
+			return nil
+		}
+	}
+
+	// Link or unlink a WhatsApp ↔ Telegram bridge
+	if handled, err := sm.BridgeService.ProcessBridgeCommand(contact, message); handled {
+		return err
+	}
+
+	// Show the main menu
+	if isMenuCommand(message.Content) {
+		return sm.WhatsAppService.SendMenu(contact, "main")
+	}
+
+	// Process auto-reply
+	if err := sm.AutoReplyService.ProcessAutoReply(contact, message); err != nil {
+		logger.Log.WithError(err).Error("Failed to process auto-reply")
+	}
+
+	// Process custom commands
+	if err := sm.WhatsAppService.processCustomCommands(contact, message); err != nil {
+		logger.Log.WithError(err).Error("Failed to process custom commands")
+	}
+
+	// Process game commands
+	if err := sm.GameService.ProcessGameCommand(contact, message); err != nil {
+		logger.Log.WithError(err).Error("Failed to process game command")
+	}
+
+	// Process utility commands
+	if err := sm.UtilityService.ProcessUtilityCommand(contact, message); err != nil {
+		logger.Log.WithError(err).Error("Failed to process utility command")
+	}
+
+	// Process business commands
+	if ordered, err := sm.BusinessService.ProcessBusinessCommand(contact, message); err != nil {
+		logger.Log.WithError(err).Error("Failed to process business command")
+	} else if ordered {
+		// Acknowledge the placed order on the customer's own message
+		if err := sm.Channel(contact).SendReaction(message.MessageID, "✅"); err != nil {
+			logger.Log.WithError(err).Error("Failed to react to order message")
+		}
+	}
+
+	// Log analytics
+	metadata := map[string]interface{}{
+		"message_type": message.MessageType,
+		"contact_id":   contact.ID,
+		"platform":     sm.Channel(contact).Platform(),
+	}
+	if contact.TelegramBotID != nil {
+		metadata["telegram_bot_id"] = *contact.TelegramBotID
+	}
+	sm.AnalyticsService.LogEvent(contact.UserID, "message_received", 1, metadata)
+
+	return nil
+}
+
+// SendContactText sends a text message to a contact on its platform.
+func (sm *ServiceManager) SendContactText(contact *models.Contact, content string) error {
+	return sm.Channel(contact).SendText(content)
+}
+
+// SendContactTemplate sends a registered message template. Platforms without
+// WhatsApp templates get the rendered body as plain text.
+func (sm *ServiceManager) SendContactTemplate(contact *models.Contact, templateID uuid.UUID, values map[string]string) error {
+	if isWhatsAppContact(contact) {
+		_, err := sm.TemplateService.SendTemplate(contact.UserID, contact.PhoneNumber, templateID, values)
+		return err
+	}
+
+	template, err := sm.TemplateService.GetTemplate(contact.UserID, templateID)
+	if err != nil {
+		return err
+	}
+	return sm.Channel(contact).SendText(sm.TemplateService.RenderBody(template, values))
+}
+
+// whatsappChannel sends through WhatsAppService, so replies are queued and
+// checked against the contact's 24-hour service window.
+type whatsappChannel struct {
+	service *WhatsAppService
+	userID  uuid.UUID
+	to      string
+}
+
+func (c *whatsappChannel) Platform() string       { return PlatformWhatsApp }
+func (c *whatsappChannel) ConversationID() string { return c.to }
+
+// SendText falls back to the configured template once the window is closed.
+func (c *whatsappChannel) SendText(text string) error {
+	_, err := c.service.SendMessage(c.userID, c.to, text, "text")
+	return err
+}
+
+func (c *whatsappChannel) SendImage(imageURL, caption string) error {
+	_, err := c.service.SendImage(c.userID, c.to, imageURL, caption)
+	return err
+}
+
+func (c *whatsappChannel) SendButtons(body string, options []ChannelOption) error {
+	buttons := make([]whatsapp.ReplyButton, 0, len(options))
+	for _, option := range options {
+		buttons = append(buttons, whatsapp.ReplyButton{
+			Type:  "reply",
+			Reply: whatsapp.Reply{ID: option.ID, Title: option.Title},
+		})
+	}
+	_, err := c.service.SendButtons(c.userID, c.to, body, buttons)
+	return err
+}
+
+func (c *whatsappChannel) SendList(header, body, buttonText string, sections []ChannelSection) error {
+	waSections := make([]whatsapp.Section, 0, len(sections))
+	for _, section := range sections {
+		rows := make([]whatsapp.SectionRow, 0, len(section.Options))
+		for _, option := range section.Options {
+			rows = append(rows, whatsapp.SectionRow{
+				ID:          option.ID,
+				Title:       option.Title,
+				Description: option.Description,
+			})
+		}
+		waSections = append(waSections, whatsapp.Section{Title: section.Title, Rows: rows})
+	}
+	_, err := c.service.SendList(c.userID, c.to, header, body, buttonText, waSections)
+	return err
+}
+
+func (c *whatsappChannel) SendReaction(messageID, emoji string) error {
+	_, err := c.service.SendReaction(c.userID, c.to, messageID, emoji)
+	return err
+}
+
+type telegramChannel struct {
+	client *telegram.Client
+	chatID int64
+}
+
+func (c *telegramChannel) Platform() string       { return PlatformTelegram }
+func (c *telegramChannel) ConversationID() string { return strconv.FormatInt(c.chatID, 10) }
+
+func (c *telegramChannel) SendText(text string) error {
+	return c.client.SendFormatted(c.chatID, telegram.PlainText(text), nil)
+}
+
+func (c *telegramChannel) SendImage(imageURL, caption string) error {
+	return sendTelegramCaptioned(c.client, c.chatID, caption, func(caption string) error {
+		return c.client.SendPhoto(c.chatID, imageURL, caption)
+	})
+}
+
+// SendButtons shows the options as an inline keyboard, one button per row.
+func (c *telegramChannel) SendButtons(body string, options []ChannelOption) error {
+	return c.client.SendFormatted(c.chatID, telegram.PlainText(body), inlineKeyboard(options))
+}
+
+// SendList has no Telegram equivalent, so the header and body are sent as
+// text with every row as an inline keyboard button.
+func (c *telegramChannel) SendList(header, body, buttonText string, sections []ChannelSection) error {
+	var options []ChannelOption
+	for _, section := range sections {
+		options = append(options, section.Options...)
+	}
+
+	text := body
+	if header != "" {
+		text = header + "\n\n" + body
+	}
+	return c.client.SendFormatted(c.chatID, telegram.PlainText(text), inlineKeyboard(options))
+}
+
+// SendReaction reacts to a message. Telegram message IDs are stored as
+// "telegram:<chat>:<message>"; see telegramMessageID. Button presses are
+// stored as "telegram:<chat>:callback:<query>" and have no message of the
+// user's to react to, so they are skipped.
+func (c *telegramChannel) SendReaction(messageID, emoji string) error {
+	parts := strings.Split(messageID, ":")
+	if len(parts) == 4 && parts[0] == "telegram" && parts[2] == "callback" {
+		return nil
+	}
+	if len(parts) != 3 || parts[0] != "telegram" {
+		return fmt.Errorf("invalid Telegram message ID: %s", messageID)
+	}
+	id, err := strconv.Atoi(parts[2])
+	if err != nil {
+		return fmt.Errorf("invalid Telegram message ID: %s", messageID)
+	}
+	return c.client.SetMessageReaction(c.chatID, id, emoji)
+}
+
+func inlineKeyboard(options []ChannelOption) map[string]interface{} {
+	rows := make([][]map[string]interface{}, 0, len(options))
+	for _, option := range options {
+		rows = append(rows, []map[string]interface{}{
+			{"text": option.Title, "callback_data": option.ID},
+		})
+	}
+	return map[string]interface{}{"inline_keyboard": rows}
+}
@@ -0,0 +1,145 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"whatsapp-bot/internal/models"
+
+	"github.com/google/uuid"
+	"github.com/jinzhu/gorm"
+)
+
+var ErrContactNotFound = errors.New("contact not found")
+
+// ServiceWindow is how long after a contact's last message free-form
+// messages may be sent to them. Outside it only templates are delivered.
+const ServiceWindow = 24 * time.Hour
+
+// FindOrCreateContact returns the user's contact for a phone number. When
+// userID is nil the contact belongs to the first admin user, who operates the
+// default bot number.
+func (s *ContactService) FindOrCreateContact(userID uuid.UUID, phoneNumber string) (*models.Contact, error) {
+	if userID == uuid.Nil {
+		ownerID, err := s.defaultOwnerID()
+		if err != nil {
+			return nil, err
+		}
+		userID = ownerID
+	}
+
+	contact, err := s.GetContactByPhone(userID, phoneNumber)
+	if err == nil {
+		return contact, nil
+	}
+	if !gorm.IsRecordNotFoundError(err) {
+		return nil, err
+	}
+
+	contact = &models.Contact{
+		UserID:      userID,
+		PhoneNumber: phoneNumber,
+	}
+	if err := s.sm.DB.Create(contact).Error; err != nil {
+		return nil, err
+	}
+
+	return contact, nil
+}
+
+// FindOrCreateTelegramContact returns the contact for a chat with a bot.
+// Chats with the configured bot (nil botID) belong to the first admin user,
+// who operates it; chats with a hosted bot belong to the bot's owner.
+func (s *ContactService) FindOrCreateTelegramContact(botID *uuid.UUID, chatID int64, displayName string) (*models.Contact, error) {
+	query := s.sm.DB.Where("platform = ? AND telegram_chat_id = ?", PlatformTelegram, chatID)
+	if botID != nil {
+		query = query.Where("telegram_bot_id = ?", *botID)
+	} else {
+		query = query.Where("telegram_bot_id IS NULL")
+	}
+
+	contact := &models.Contact{}
+	err := query.First(contact).Error
+	if err == nil {
+		return contact, nil
+	}
+	if !gorm.IsRecordNotFoundError(err) {
+		return nil, err
+	}
+
+	ownerID, err := s.sm.TelegramFor(botID).ownerID()
+	if err != nil {
+		return nil, err
+	}
+
+	contact = &models.Contact{
+		UserID:         ownerID,
+		Platform:       PlatformTelegram,
+		TelegramChatID: chatID,
+		TelegramBotID:  botID,
+		DisplayName:    displayName,
+	}
+	if err := s.sm.DB.Create(contact).Error; err != nil {
+		return nil, err
+	}
+
+	return contact, nil
+}
+
+// defaultOwnerID returns the first admin user, who operates the default bot
+// number and the Telegram bot.
+func (s *ContactService) defaultOwnerID() (uuid.UUID, error) {
+	owner := &models.User{}
+	if err := s.sm.DB.Where("is_admin = ?", true).Order("created_at").First(owner).Error; err != nil {
+		return uuid.Nil, fmt.Errorf("failed to find contact owner: %v", err)
+	}
+	return owner.ID, nil
+}
+
+func (s *ContactService) GetContactByPhone(userID uuid.UUID, phoneNumber string) (*models.Contact, error) {
+	contact := &models.Contact{}
+	err := s.sm.DB.Where("user_id = ? AND platform = ? AND phone_number = ?", userID, PlatformWhatsApp, phoneNumber).First(contact).Error
+	if err != nil {
+		return nil, err
+	}
+	return contact, nil
+}
+
+// UpdateLastMessageTime records when the contact last wrote to us. Only
+// inbound messages open the customer service window.
+func (s *ContactService) UpdateLastMessageTime(contactID uuid.UUID, at time.Time) error {
+	return s.sm.DB.Model(&models.Contact{}).
+		Where("id = ? AND (last_message IS NULL OR last_message < ?)", contactID, at).
+		Update("last_message", at).Error
+}
+
+// IsWindowOpen reports whether free-form messages can be sent to the contact.
+func (s *ContactService) IsWindowOpen(contact *models.Contact) bool {
+	return !contact.LastMessage.IsZero() && time.Since(contact.LastMessage) < ServiceWindow
+}
+
+// SetTags replaces the contact's tags, which auto-reply rules can be limited
+// to. Tags are matched case-insensitively.
+func (s *ContactService) SetTags(userID, contactID uuid.UUID, tags []string) (*models.Contact, error) {
+	contact := &models.Contact{}
+	err := s.sm.DB.Where("id = ? AND user_id = ?", contactID, userID).First(contact).Error
+	if gorm.IsRecordNotFoundError(err) {
+		return nil, ErrContactNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	contact.Tags = strings.Join(normalizeList(tags), ",")
+	if err := s.sm.DB.Model(contact).Update("tags", contact.Tags).Error; err != nil {
+		return nil, err
+	}
+	return contact, nil
+}
+
+// contactTags returns the contact's tags as they are matched.
+func contactTags(contact *models.Contact) []string {
+	return normalizeList(strings.Split(contact.Tags, ","))
+}
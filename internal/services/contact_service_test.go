@@ -0,0 +1,43 @@
+package services
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"whatsapp-bot/internal/models"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestIsWindowOpen(t *testing.T) {
+	s := &ContactService{}
+
+	testCases := []struct {
+		name        string
+		lastMessage time.Time
+		expected    bool
+	}{
+		{name: "NeverMessaged", expected: false},
+		{name: "RecentMessage", lastMessage: time.Now().Add(-time.Minute), expected: true},
+		{name: "WithinWindow", lastMessage: time.Now().Add(-23 * time.Hour), expected: true},
+		{name: "WindowExpired", lastMessage: time.Now().Add(-25 * time.Hour), expected: false},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			contact := &models.Contact{LastMessage: tc.lastMessage}
+			assert.Equal(t, tc.expected, s.IsWindowOpen(contact))
+		})
+	}
+}
+
+func TestServiceWindowClosedError(t *testing.T) {
+	err := error(&ServiceWindowClosedError{PhoneNumber: "6281234567890"})
+	assert.True(t, errors.Is(err, ErrServiceWindowClosed))
+	assert.Contains(t, err.Error(), "never messaged us")
+
+	lastInbound := time.Date(2024, 3, 4, 10, 0, 0, 0, time.UTC)
+	err = &ServiceWindowClosedError{PhoneNumber: "6281234567890", LastInbound: lastInbound}
+	assert.Contains(t, err.Error(), "2024-03-04T10:00:00Z")
+}
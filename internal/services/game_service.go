@@ -107,7 +107,7 @@ func (s *GameService) handleKhodamCommand(contact *models.Contact) error {
 	message := fmt.Sprintf("✨ KHODAM ANDA ✨\n\nNama: %s\n\n%s\n\nKhodam ini akan melindungi dan membantu Anda dalam perjalanan hidup. Semangat! 🙏", khodam, getKhodamDescription(khodam))
 
 	// Send message
-	_, err := s.sm.WhatsApp.SendTextMessage(contact.PhoneNumber, message, false)
+	err := s.sm.Channel(contact).SendText(message)
 	if err != nil {
 		return err
 	}
@@ -144,7 +144,7 @@ func (s *GameService) handleZodiacCommand(contact *models.Contact, content strin
 		}
 		message += "\nContoh: \"zodiak aries\""
 
-		_, err := s.sm.WhatsApp.SendTextMessage(contact.PhoneNumber, message, false)
+		err := s.sm.Channel(contact).SendText(message)
 		return err
 	}
 
@@ -154,7 +154,7 @@ func (s *GameService) handleZodiacCommand(contact *models.Contact, content strin
 
 	message := fmt.Sprintf("🔮 RAMALAN %s HARI INI 🔮\n\n%s\n\n%s\n\nSemoga harimu menyenangkan! ✨", strings.Title(zodiacSign), zodiacInfo, horoscope)
 
-	_, err := s.sm.WhatsApp.SendTextMessage(contact.PhoneNumber, message, false)
+	err := s.sm.Channel(contact).SendText(message)
 	if err != nil {
 		return err
 	}
@@ -178,7 +178,7 @@ func (s *GameService) handleLoveCalculatorCommand(contact *models.Contact, conte
 
 	if len(names) < 2 {
 		message := "💕 KALKULATOR CINTA 💕\n\nGunakan format: \"love calculator nama1 nama2\"\n\nContoh: \"love calculator budi ani\""
-		_, err := s.sm.WhatsApp.SendTextMessage(contact.PhoneNumber, message, false)
+		err := s.sm.Channel(contact).SendText(message)
 		return err
 	}
 
@@ -188,7 +188,7 @@ func (s *GameService) handleLoveCalculatorCommand(contact *models.Contact, conte
 
 	message := fmt.Sprintf("💑 KECOCOKAN CINTA 💑\n\n%s ❤️ %s\n\nKecocokan: %d%%\n\n%s\n\nSemoga berbahagia! 💖", names[0], names[1], percentage, compatibility)
 
-	_, err := s.sm.WhatsApp.SendTextMessage(contact.PhoneNumber, message, false)
+	err := s.sm.Channel(contact).SendText(message)
 	if err != nil {
 		return err
 	}
@@ -240,7 +240,7 @@ func (s *GameService) handleTebakGambarCommand(contact *models.Contact) error {
 
 	// Send image with question
 	message := fmt.Sprintf("🖼️ TEBAK GAMBAR 🖼️\n\nApa nama benda/hewan ini?\nHint: %s", game.hint)
-	_, err := s.sm.WhatsApp.SendImageMessage(contact.PhoneNumber, game.imageURL, message)
+	err := s.sm.Channel(contact).SendImage(game.imageURL, message)
 	if err != nil {
 		return err
 	}
@@ -282,7 +282,7 @@ func (s *GameService) handleMathChallengeCommand(contact *models.Contact) error
 	}
 
 	message := fmt.Sprintf("🧮 TANTANGAN MATEMATIKA 🧮\n\n%s\n\nJawab dalam 60 detik!", question)
-	_, err := s.sm.WhatsApp.SendTextMessage(contact.PhoneNumber, message, false)
+	err := s.sm.Channel(contact).SendText(message)
 	if err != nil {
 		return err
 	}
@@ -306,7 +306,7 @@ func (s *GameService) handleJokesCommand(contact *models.Contact) error {
 	joke := jokes[rand.Intn(len(jokes))]
 
 	message := fmt.Sprintf("😂 JOKE HARI INI 😂\n\n%s\n\nSemoga harimu lebih ceria! 🌟", joke)
-	_, err := s.sm.WhatsApp.SendTextMessage(contact.PhoneNumber, message, false)
+	err := s.sm.Channel(contact).SendText(message)
 	
 	if err != nil {
 		return err
@@ -328,7 +328,7 @@ func (s *GameService) handleStoryCommand(contact *models.Contact) error {
 	rand.Seed(time.Now().UnixNano())
 	story := stories[rand.Intn(len(stories))]
 
-	_, err := s.sm.WhatsApp.SendTextMessage(contact.PhoneNumber, story, false)
+	err := s.sm.Channel(contact).SendText(story)
 	if err != nil {
 		return err
 	}
@@ -344,16 +344,22 @@ func (s *GameService) sendQuizQuestion(contact *models.Contact, session *models.
 	var options []string
 	json.Unmarshal([]byte(question.Options), &options)
 
-	message := fmt.Sprintf("🧠 KUIS NO. %d 🧠\n\n%s\n\n", session.CurrentQuestion+1, question.Question)
-	
+	header := fmt.Sprintf("🧠 KUIS NO. %d 🧠", session.CurrentQuestion+1)
+	message := fmt.Sprintf("%s\n\n", question.Question)
+
+	rows := make([]ChannelOption, 0, len(options))
 	for i, option := range options {
 		message += fmt.Sprintf("%d. %s\n", i+1, option)
+		rows = append(rows, ChannelOption{
+			ID:    fmt.Sprintf("%s%d", replyIDQuizAnswerPrefix, i+1),
+			Title: truncateRunes(fmt.Sprintf("%d. %s", i+1, option), 24),
+		})
 	}
 
-	message += "\nBalas dengan angka jawaban Anda!"
+	message += "\nPilih jawaban atau balas dengan angka jawaban Anda!"
 
-	_, err := s.sm.WhatsApp.SendTextMessage(contact.PhoneNumber, message, false)
-	return err
+	sections := []ChannelSection{{Title: "Jawaban", Options: rows}}
+	return s.sm.Channel(contact).SendList(header, message, "Jawab", sections)
 }
 
 func (s *GameService) ProcessQuizAnswer(contact *models.Contact, answer int) error {
@@ -377,11 +383,11 @@ func (s *GameService) ProcessQuizAnswer(contact *models.Contact, answer int) err
 		
 		// Send correct answer message
 		message := "✅ BENAR! ✅\n\nSelamat! Kamu mendapatkan %d poin!\n\nSkor sementara: %d poin"
-		s.sm.WhatsApp.SendTextMessage(contact.PhoneNumber, fmt.Sprintf(message, currentQuestion.Points, session.Score), false)
+		s.sm.Channel(contact).SendText(fmt.Sprintf(message, currentQuestion.Points, session.Score))
 	} else {
 		// Send wrong answer message
 		message := "❌ SALAH ❌\n\nJawaban yang benar adalah: %d\n\nSkor sementara: %d poin"
-		s.sm.WhatsApp.SendTextMessage(contact.PhoneNumber, fmt.Sprintf(message, currentQuestion.CorrectAnswer, session.Score), false)
+		s.sm.Channel(contact).SendText(fmt.Sprintf(message, currentQuestion.CorrectAnswer, session.Score))
 	}
 
 	// Move to next question
@@ -394,7 +400,7 @@ func (s *GameService) ProcessQuizAnswer(contact *models.Contact, answer int) err
 		
 		// Send final score
 		finalMessage := fmt.Sprintf("🎉 KUIS SELESAI! 🎉\n\nSkor akhir: %d/%d poin\n\nTerima kasih sudah bermain!", session.Score, session.TotalQuestions*10)
-		s.sm.WhatsApp.SendTextMessage(contact.PhoneNumber, finalMessage, false)
+		s.sm.Channel(contact).SendText(finalMessage)
 		
 		// Update game score
 		s.updateGameScore(contact.UserID, "quiz", session.Score)
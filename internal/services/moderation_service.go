@@ -1,6 +1,7 @@
 package services
 
 import (
+	"encoding/json"
 	"fmt"
 	"regexp"
 	"strings"
@@ -160,7 +161,7 @@ func (s *ModerationService) handleSpam(contact *models.Contact, message *models.
 
 	// Send warning to user
 	warningMessage := "⚠️ PERINGATAN ⚠️\n\nPesan Anda terdeteksi sebagai spam. Mohon kirim pesan yang relevan dan tidak mengandung promosi berlebihan."
-	_, err := s.sm.WhatsApp.SendTextMessage(contact.PhoneNumber, warningMessage, false)
+	err := s.sm.Channel(contact).SendText(warningMessage)
 	if err != nil {
 		return err
 	}
@@ -181,7 +182,7 @@ func (s *ModerationService) handleBlockedWords(contact *models.Contact, message
 
 	// Send warning to user
 	warningMessage := "⚠️ PERINGATAN ⚠️\n\nPesan Anda mengandung kata-kata yang tidak diizinkan. Mohon gunakan bahasa yang sopan dan tidak mengandung kata-kata sensitif."
-	_, err := s.sm.WhatsApp.SendTextMessage(contact.PhoneNumber, warningMessage, false)
+	err := s.sm.Channel(contact).SendText(warningMessage)
 	if err != nil {
 		return err
 	}
@@ -199,7 +200,7 @@ func (s *ModerationService) handleFlood(contact *models.Contact, message *models
 
 	// Send warning to user
 	warningMessage := "⚠️ PERINGATAN ⚠️\n\nAnda mengirim pesan terlalu cepat. Mohon tunggu beberapa saat sebelum mengirim pesan lagi."
-	_, err := s.sm.WhatsApp.SendTextMessage(contact.PhoneNumber, warningMessage, false)
+	err := s.sm.Channel(contact).SendText(warningMessage)
 	if err != nil {
 		return err
 	}
@@ -217,7 +218,7 @@ func (s *ModerationService) handleSuspiciousLinks(contact *models.Contact, messa
 
 	// Send warning to user
 	warningMessage := "⚠️ PERINGATAN KEAMANAN ⚠️\n\nPesan Anda mengandung link yang mencurigakan. Untuk keamanan, link tersebut telah diblokir."
-	_, err := s.sm.WhatsApp.SendTextMessage(contact.PhoneNumber, warningMessage, false)
+	err := s.sm.Channel(contact).SendText(warningMessage)
 	if err != nil {
 		return err
 	}
@@ -235,7 +236,7 @@ func (s *ModerationService) handleInappropriateContent(contact *models.Contact,
 
 	// Send warning to user
 	warningMessage := "⚠️ PERINGATAN ⚠️\n\nPesan Anda mengandung konten yang tidak pantas. Mohon gunakan platform ini dengan bijak."
-	_, err := s.sm.WhatsApp.SendTextMessage(contact.PhoneNumber, warningMessage, false)
+	err := s.sm.Channel(contact).SendText(warningMessage)
 	if err != nil {
 		return err
 	}
@@ -329,7 +330,7 @@ func (s *ModerationService) notifyAdminSpamReport(report *models.SpamReport) {
 		reporter.DisplayName, reported.DisplayName, report.Reason)
 
 	for _, admin := range adminContacts {
-		s.sm.WhatsApp.SendTextMessage(admin.PhoneNumber, message, false)
+		s.sm.Channel(admin).SendText(message)
 	}
 }
 
@@ -484,4 +485,69 @@ func (s *ModerationService) ImportModerationSettings(userID uuid.UUID, data []by
 	}
 
 	return nil
-}
\ No newline at end of file
+}
+
+const (
+	ViolationBlockedWords = "blocked_words"
+	ViolationFlood        = "flood"
+	ViolationLink         = "link"
+
+	telegramFloodWindow = 10 * time.Second
+)
+
+var linkPattern = regexp.MustCompile(`(?i)(https?://|www\.|t\.me/)`)
+
+// CheckTelegramGroupMessage applies the group's moderation rules to a
+// member's message and returns the violated rule, or "" if it is allowed.
+// Blocked words are the ones registered by ownerID.
+func (s *ModerationService) CheckTelegramGroupMessage(group *models.TelegramGroup, ownerID uuid.UUID, memberID int64, content string) string {
+	if s.isGroupFlood(group, memberID) {
+		return ViolationFlood
+	}
+	if content == "" {
+		return ""
+	}
+	if s.containsBlockedWords(content, ownerID) {
+		return ViolationBlockedWords
+	}
+	if s.containsSuspiciousLinks(content) || (group.BlockLinks && linkPattern.MatchString(content)) {
+		return ViolationLink
+	}
+	return ""
+}
+
+// isGroupFlood counts the member's messages in the current flood window.
+func (s *ModerationService) isGroupFlood(group *models.TelegramGroup, memberID int64) bool {
+	if group.FloodLimit <= 0 {
+		return false
+	}
+
+	ctx := s.sm.Redis.Context()
+	key := fmt.Sprintf("telegram:flood:%d:%d", group.ChatID, memberID)
+	count, err := s.sm.Redis.Incr(ctx, key).Result()
+	if err != nil {
+		return false
+	}
+	if count == 1 {
+		s.sm.Redis.Expire(ctx, key, telegramFloodWindow)
+	}
+
+	return count > int64(group.FloodLimit)
+}
+
+// LogTelegramGroupIncident records a moderation action taken in a group.
+func (s *ModerationService) LogTelegramGroupIncident(ownerID uuid.UUID, chatID, memberID int64, violation, action, content string) {
+	details, _ := json.Marshal(map[string]interface{}{
+		"chat_id":   chatID,
+		"member_id": memberID,
+		"action":    action,
+		"content":   content,
+	})
+
+	s.sm.DB.Create(&models.SystemLog{
+		UserID:  ownerID,
+		Level:   "warn",
+		Message: fmt.Sprintf("Moderation incident: telegram_group_%s", violation),
+		Context: string(details),
+	})
+}
@@ -0,0 +1,569 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/rand"
+	"strings"
+	"sync"
+	"time"
+
+	"whatsapp-bot/internal/models"
+	"whatsapp-bot/pkg/logger"
+	"whatsapp-bot/pkg/whatsapp"
+
+	"github.com/go-redis/redis/v8"
+	"github.com/google/uuid"
+	"github.com/jinzhu/gorm"
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	outboundPendingKey     = "outbound:pending"
+	outboundProcessingKey  = "outbound:processing"
+	outboundDelayedKey     = "outbound:delayed"
+	outboundDeadKey        = "outbound:dead"
+	outboundJobKeyPrefix   = "outbound:job:"
+	outboundRateKeyPrefix  = "outbound:rate:"
+	outboundLeaseKeyPrefix = "outbound:lease:"
+
+	// outboundLeaseTTL is how long a worker's processing list stays its own
+	// without a heartbeat. It outlasts a send, which the client bounds at 30s.
+	outboundLeaseTTL = time.Minute
+)
+
+var (
+	ErrOutboundJobNotFound = errors.New("outbound job not found")
+	ErrInvalidOutboundJob  = errors.New("invalid outbound job")
+)
+
+// OutboundJob is a WhatsApp message waiting to be delivered to the Cloud API.
+// The job ID is stored as the message ID of the queued message until the API
+// returns the real WhatsApp message ID.
+type OutboundJob struct {
+	ID            string                  `json:"id"`
+	UserID        uuid.UUID               `json:"user_id"`
+	Request       whatsapp.MessageRequest `json:"request"`
+	BroadcastID   *uuid.UUID              `json:"broadcast_id,omitempty"`
+	RecipientID   *uuid.UUID              `json:"recipient_id,omitempty"`
+	Attempts      int                     `json:"attempts"`
+	LastError     string                  `json:"last_error,omitempty"`
+	CreatedAt     time.Time               `json:"created_at"`
+	NextAttemptAt time.Time               `json:"next_attempt_at"`
+	FailedAt      *time.Time              `json:"failed_at,omitempty"`
+}
+
+type OutboundQueueService struct {
+	sm         *ServiceManager
+	instanceID string
+	cancel     context.CancelFunc
+	wg         sync.WaitGroup
+}
+
+// Enqueue stores the job in Redis and makes it available to the workers.
+func (s *OutboundQueueService) Enqueue(job *OutboundJob) error {
+	ctx := s.sm.Redis.Context()
+
+	if job.ID == "" {
+		job.ID = uuid.New().String()
+	}
+	if job.CreatedAt.IsZero() {
+		job.CreatedAt = time.Now()
+	}
+	job.NextAttemptAt = time.Now()
+
+	if err := s.saveJob(ctx, job); err != nil {
+		return err
+	}
+
+	return s.sm.Redis.LPush(ctx, outboundPendingKey, job.ID).Err()
+}
+
+// Start launches the queue workers. Each worker keeps its in-flight job in
+// its own processing list, held by a lease it renews while running, so a
+// starting instance only recovers the jobs of workers that are gone.
+func (s *OutboundQueueService) Start(ctx context.Context) {
+	ctx, s.cancel = context.WithCancel(ctx)
+	s.instanceID = uuid.New().String()
+
+	s.recoverOrphanedJobs(ctx)
+
+	workers := s.sm.Config.Outbound.Workers
+	if workers < 1 {
+		workers = 1
+	}
+
+	s.wg.Add(1)
+	go s.runScheduler(ctx)
+
+	for i := 0; i < workers; i++ {
+		s.wg.Add(1)
+		go s.runWorker(ctx, fmt.Sprintf("%s:%d", s.instanceID, i))
+	}
+
+	logger.Log.WithFields(logrus.Fields{
+		"workers":     workers,
+		"instance_id": s.instanceID,
+	}).Info("Outbound queue started")
+}
+
+// Stop signals the workers to exit and waits for in-flight jobs to finish.
+func (s *OutboundQueueService) Stop() {
+	if s.cancel != nil {
+		s.cancel()
+	}
+	s.wg.Wait()
+}
+
+// runScheduler moves delayed jobs whose retry time has passed back onto the
+// pending list.
+func (s *OutboundQueueService) runScheduler(ctx context.Context) {
+	defer s.wg.Done()
+
+	ticker := time.NewTicker(time.Second)
+	defer ticker.Stop()
+
+	// Workers of crashed instances are noticed once their lease runs out
+	recoverTicker := time.NewTicker(outboundLeaseTTL)
+	defer recoverTicker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-recoverTicker.C:
+			s.recoverOrphanedJobs(ctx)
+			continue
+		case <-ticker.C:
+		}
+
+		ids, err := s.sm.Redis.ZRangeByScore(ctx, outboundDelayedKey, &redis.ZRangeBy{
+			Min: "-inf",
+			Max: fmt.Sprintf("%d", time.Now().UnixNano()),
+		}).Result()
+		if err != nil {
+			if ctx.Err() == nil {
+				logger.Log.WithError(err).Error("Failed to read delayed outbound jobs")
+			}
+			continue
+		}
+
+		for _, id := range ids {
+			// Only the caller that removes the entry re-queues it
+			removed, err := s.sm.Redis.ZRem(ctx, outboundDelayedKey, id).Result()
+			if err != nil || removed == 0 {
+				continue
+			}
+			s.sm.Redis.LPush(ctx, outboundPendingKey, id)
+		}
+	}
+}
+
+func (s *OutboundQueueService) runWorker(ctx context.Context, workerID string) {
+	defer s.wg.Done()
+
+	processingKey := outboundProcessingKey + ":" + workerID
+	leaseKey := outboundLeaseKeyPrefix + workerID
+	defer s.sm.Redis.Del(s.sm.Redis.Context(), leaseKey)
+
+	for {
+		if err := s.sm.Redis.Set(ctx, leaseKey, s.instanceID, outboundLeaseTTL).Err(); err != nil && ctx.Err() == nil {
+			logger.Log.WithError(err).WithField("worker_id", workerID).Error("Failed to renew outbound worker lease")
+		}
+
+		id, err := s.sm.Redis.BRPopLPush(ctx, outboundPendingKey, processingKey, time.Second).Result()
+		if ctx.Err() != nil {
+			return
+		}
+		if err != nil {
+			if err != redis.Nil {
+				logger.Log.WithError(err).Error("Failed to pop outbound job")
+				time.Sleep(time.Second)
+			}
+			continue
+		}
+
+		// Finish the job even if shutdown starts while it is in flight. A job
+		// that couldn't be handed on stays on the processing list and is
+		// recovered with it.
+		if s.processJob(id) {
+			s.sm.Redis.LRem(s.sm.Redis.Context(), processingKey, 1, id)
+		}
+	}
+}
+
+// recoverOrphanedJobs puts the jobs of workers whose lease has expired back
+// on the pending list. The pattern also matches the single processing list
+// used before workers had their own, which never has a lease.
+func (s *OutboundQueueService) recoverOrphanedJobs(ctx context.Context) {
+	iter := s.sm.Redis.Scan(ctx, 0, outboundProcessingKey+"*", 0).Iterator()
+	for iter.Next(ctx) {
+		processingKey := iter.Val()
+		workerID := strings.TrimPrefix(strings.TrimPrefix(processingKey, outboundProcessingKey), ":")
+		if workerID != "" {
+			alive, err := s.sm.Redis.Exists(ctx, outboundLeaseKeyPrefix+workerID).Result()
+			if err != nil || alive > 0 {
+				continue
+			}
+		}
+
+		for {
+			id, err := s.sm.Redis.RPopLPush(ctx, processingKey, outboundPendingKey).Result()
+			if err != nil {
+				if err != redis.Nil {
+					logger.Log.WithError(err).Error("Failed to recover outbound jobs")
+				}
+				break
+			}
+			logger.Log.WithField("job_id", id).Info("Recovered outbound job")
+		}
+	}
+	if err := iter.Err(); err != nil && ctx.Err() == nil {
+		logger.Log.WithError(err).Error("Failed to scan outbound processing lists")
+	}
+}
+
+// processJob sends the job and reports whether it has been completed,
+// rescheduled or dead-lettered, so its ID can leave the processing list.
+func (s *OutboundQueueService) processJob(id string) bool {
+	ctx := s.sm.Redis.Context()
+
+	job, err := s.loadJob(ctx, id)
+	if err != nil {
+		return s.handleUnloadableJob(ctx, id, err)
+	}
+
+	// Send from the tenant's own number
+	client := s.sm.WhatsAppClient(job.UserID)
+
+	// Respect the per-number throughput limit without counting an attempt
+	if !s.acquireSendSlot(ctx, client.GetPhoneNumberID()) {
+		s.schedule(ctx, job, time.Now().Truncate(time.Second).Add(time.Second))
+		return true
+	}
+
+	job.Attempts++
+	resp, err := client.SendMessage(job.Request)
+	if err == nil && len(resp.Messages) == 0 {
+		// Without an ID the message can't be tracked; don't send it twice
+		err = &whatsapp.APIError{Message: "response did not contain a message ID"}
+	}
+	if err == nil {
+		s.completeJob(ctx, job, resp.Messages[0].ID)
+		return true
+	}
+
+	job.LastError = err.Error()
+
+	var apiErr *whatsapp.APIError
+	retryable := !errors.As(err, &apiErr) || apiErr.Retryable()
+	if !retryable || job.Attempts >= s.sm.Config.Outbound.MaxAttempts {
+		s.deadLetter(ctx, job)
+		return true
+	}
+
+	delay := s.backoff(job.Attempts)
+	if apiErr != nil && apiErr.RetryAfter > delay {
+		delay = apiErr.RetryAfter
+	}
+
+	logger.Log.WithFields(logrus.Fields{
+		"job_id":   job.ID,
+		"to":       job.Request.To,
+		"attempts": job.Attempts,
+		"delay":    delay.String(),
+	}).WithError(err).Warn("Outbound message failed, retrying")
+
+	s.schedule(ctx, job, time.Now().Add(delay))
+	return true
+}
+
+// handleUnloadableJob deals with a job whose payload couldn't be read. A
+// missing or corrupt payload will never load, so the ID is dead-lettered and
+// its message marked failed; any other error is likely Redis itself, so the
+// job is tried again later.
+func (s *OutboundQueueService) handleUnloadableJob(ctx context.Context, id string, err error) bool {
+	log := logger.Log.WithError(err).WithField("job_id", id)
+
+	if errors.Is(err, ErrOutboundJobNotFound) || errors.Is(err, ErrInvalidOutboundJob) {
+		if err := s.sm.Redis.LPush(ctx, outboundDeadKey, id).Err(); err != nil {
+			log.Error("Failed to dead-letter unreadable outbound job")
+			return false
+		}
+		log.Error("Outbound job can't be read, moved to dead-letter list")
+
+		s.sm.DB.Model(&models.Message{}).
+			Where("message_id = ?", id).
+			Update("status", "failed")
+		return true
+	}
+
+	at := time.Now().Add(s.backoff(1))
+	if err := s.sm.Redis.ZAdd(ctx, outboundDelayedKey, &redis.Z{
+		Score:  float64(at.UnixNano()),
+		Member: id,
+	}).Err(); err != nil {
+		log.Error("Failed to load outbound job, keeping it on the processing list")
+		return false
+	}
+	log.Warn("Failed to load outbound job, retrying")
+	return true
+}
+
+// acquireSendSlot counts the send against the current second for the
+// phone number and reports whether it is within the limit.
+func (s *OutboundQueueService) acquireSendSlot(ctx context.Context, phoneNumberID string) bool {
+	limit := s.sm.Config.Outbound.RatePerSecond
+	if limit <= 0 {
+		return true
+	}
+
+	key := fmt.Sprintf("%s%s:%d", outboundRateKeyPrefix, phoneNumberID, time.Now().Unix())
+	count, err := s.sm.Redis.Incr(ctx, key).Result()
+	if err != nil {
+		logger.Log.WithError(err).Error("Failed to check outbound rate limit")
+		return true
+	}
+	if count == 1 {
+		s.sm.Redis.Expire(ctx, key, 2*time.Second)
+	}
+
+	return count <= int64(limit)
+}
+
+// backoff returns an exponential delay with jitter for the given attempt.
+func (s *OutboundQueueService) backoff(attempts int) time.Duration {
+	base := s.sm.Config.Outbound.BaseBackoff
+	max := s.sm.Config.Outbound.MaxBackoff
+
+	delay := base
+	for i := 1; i < attempts && delay < max; i++ {
+		delay *= 2
+	}
+	if delay > max {
+		delay = max
+	}
+
+	// Up to 20% jitter so retries from a burst don't line up
+	if jitter := int64(delay) / 5; jitter > 0 {
+		delay += time.Duration(rand.Int63n(jitter))
+	}
+
+	return delay
+}
+
+func (s *OutboundQueueService) schedule(ctx context.Context, job *OutboundJob, at time.Time) {
+	job.NextAttemptAt = at
+	if err := s.saveJob(ctx, job); err != nil {
+		logger.Log.WithError(err).WithField("job_id", job.ID).Error("Failed to save outbound job")
+	}
+
+	s.sm.Redis.ZAdd(ctx, outboundDelayedKey, &redis.Z{
+		Score:  float64(at.UnixNano()),
+		Member: job.ID,
+	})
+}
+
+func (s *OutboundQueueService) completeJob(ctx context.Context, job *OutboundJob, waMessageID string) {
+	now := time.Now()
+
+	s.sm.DB.Model(&models.Message{}).
+		Where("message_id = ?", job.ID).
+		Updates(map[string]interface{}{"message_id": waMessageID, "status": "sent"})
+
+	if job.RecipientID != nil {
+		s.sm.DB.Model(&models.BroadcastRecipient{}).
+			Where("id = ?", *job.RecipientID).
+			Updates(map[string]interface{}{"status": "sent", "sent_at": now, "message_id": waMessageID, "error": ""})
+	}
+	if job.BroadcastID != nil {
+		s.sm.DB.Model(&models.Broadcast{}).
+			Where("id = ?", *job.BroadcastID).
+			UpdateColumn("total_sent", gorm.Expr("total_sent + ?", 1))
+	}
+
+	s.sm.Redis.Del(ctx, outboundJobKeyPrefix+job.ID)
+}
+
+func (s *OutboundQueueService) deadLetter(ctx context.Context, job *OutboundJob) {
+	now := time.Now()
+	job.FailedAt = &now
+
+	logger.Log.WithFields(logrus.Fields{
+		"job_id":   job.ID,
+		"to":       job.Request.To,
+		"attempts": job.Attempts,
+	}).Error("Outbound message moved to dead-letter list: " + job.LastError)
+
+	if err := s.saveJob(ctx, job); err != nil {
+		logger.Log.WithError(err).WithField("job_id", job.ID).Error("Failed to save outbound job")
+	}
+	s.sm.Redis.LPush(ctx, outboundDeadKey, job.ID)
+
+	s.sm.DB.Model(&models.Message{}).
+		Where("message_id = ?", job.ID).
+		Update("status", "failed")
+
+	if job.RecipientID != nil {
+		s.sm.DB.Model(&models.BroadcastRecipient{}).
+			Where("id = ?", *job.RecipientID).
+			Updates(map[string]interface{}{"status": "failed", "error": job.LastError})
+	}
+	if job.BroadcastID != nil {
+		s.sm.DB.Model(&models.Broadcast{}).
+			Where("id = ?", *job.BroadcastID).
+			UpdateColumn("total_failed", gorm.Expr("total_failed + ?", 1))
+	}
+}
+
+// GetDeadLetters returns the most recent dead-lettered jobs.
+func (s *OutboundQueueService) GetDeadLetters(limit int) ([]OutboundJob, error) {
+	ctx := s.sm.Redis.Context()
+
+	ids, err := s.sm.Redis.LRange(ctx, outboundDeadKey, 0, int64(limit-1)).Result()
+	if err != nil {
+		return nil, err
+	}
+
+	jobs := make([]OutboundJob, 0, len(ids))
+	for _, id := range ids {
+		job, err := s.loadJob(ctx, id)
+		if err != nil {
+			continue
+		}
+		jobs = append(jobs, *job)
+	}
+
+	return jobs, nil
+}
+
+// ReplayDeadLetter moves a dead-lettered job back onto the queue with a fresh
+// attempt budget.
+func (s *OutboundQueueService) ReplayDeadLetter(id string) error {
+	ctx := s.sm.Redis.Context()
+
+	// Load first so a job that can't be read stays in the dead-letter list
+	job, err := s.loadJob(ctx, id)
+	if err != nil {
+		return err
+	}
+
+	removed, err := s.sm.Redis.LRem(ctx, outboundDeadKey, 1, id).Result()
+	if err != nil {
+		return err
+	}
+	if removed == 0 {
+		return ErrOutboundJobNotFound
+	}
+
+	job.Attempts = 0
+	job.LastError = ""
+	job.FailedAt = nil
+
+	s.sm.DB.Model(&models.Message{}).
+		Where("message_id = ?", job.ID).
+		Update("status", "queued")
+
+	if job.RecipientID != nil {
+		s.sm.DB.Model(&models.BroadcastRecipient{}).
+			Where("id = ?", *job.RecipientID).
+			Updates(map[string]interface{}{"status": "queued", "error": ""})
+	}
+	if job.BroadcastID != nil {
+		s.sm.DB.Model(&models.Broadcast{}).
+			Where("id = ?", *job.BroadcastID).
+			UpdateColumn("total_failed", gorm.Expr("total_failed - ?", 1))
+	}
+
+	return s.Enqueue(job)
+}
+
+// ReplayAllDeadLetters re-queues every dead-lettered job and returns how many
+// were replayed.
+func (s *OutboundQueueService) ReplayAllDeadLetters() (int, error) {
+	ids, err := s.sm.Redis.LRange(s.sm.Redis.Context(), outboundDeadKey, 0, -1).Result()
+	if err != nil {
+		return 0, err
+	}
+
+	replayed := 0
+	for _, id := range ids {
+		if err := s.ReplayDeadLetter(id); err != nil {
+			logger.Log.WithError(err).WithField("job_id", id).Error("Failed to replay outbound job")
+			continue
+		}
+		replayed++
+	}
+
+	return replayed, nil
+}
+
+// DeleteDeadLetter discards a dead-lettered job.
+func (s *OutboundQueueService) DeleteDeadLetter(id string) error {
+	ctx := s.sm.Redis.Context()
+
+	removed, err := s.sm.Redis.LRem(ctx, outboundDeadKey, 1, id).Result()
+	if err != nil {
+		return err
+	}
+	if removed == 0 {
+		return ErrOutboundJobNotFound
+	}
+
+	return s.sm.Redis.Del(ctx, outboundJobKeyPrefix+id).Err()
+}
+
+func (s *OutboundQueueService) GetQueueStats() (map[string]interface{}, error) {
+	ctx := s.sm.Redis.Context()
+	stats := make(map[string]interface{})
+
+	pending, err := s.sm.Redis.LLen(ctx, outboundPendingKey).Result()
+	if err != nil {
+		return nil, err
+	}
+	stats["pending"] = pending
+
+	var processing int64
+	iter := s.sm.Redis.Scan(ctx, 0, outboundProcessingKey+"*", 0).Iterator()
+	for iter.Next(ctx) {
+		count, _ := s.sm.Redis.LLen(ctx, iter.Val()).Result()
+		processing += count
+	}
+	stats["processing"] = processing
+
+	delayed, _ := s.sm.Redis.ZCard(ctx, outboundDelayedKey).Result()
+	stats["delayed"] = delayed
+
+	dead, _ := s.sm.Redis.LLen(ctx, outboundDeadKey).Result()
+	stats["dead"] = dead
+
+	return stats, nil
+}
+
+func (s *OutboundQueueService) saveJob(ctx context.Context, job *OutboundJob) error {
+	data, err := json.Marshal(job)
+	if err != nil {
+		return fmt.Errorf("failed to marshal outbound job: %v", err)
+	}
+
+	return s.sm.Redis.Set(ctx, outboundJobKeyPrefix+job.ID, data, 0).Err()
+}
+
+func (s *OutboundQueueService) loadJob(ctx context.Context, id string) (*OutboundJob, error) {
+	data, err := s.sm.Redis.Get(ctx, outboundJobKeyPrefix+id).Bytes()
+	if err == redis.Nil {
+		return nil, ErrOutboundJobNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var job OutboundJob
+	if err := json.Unmarshal(data, &job); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidOutboundJob, err)
+	}
+
+	return &job, nil
+}
@@ -0,0 +1,35 @@
+package services
+
+import (
+	"testing"
+	"time"
+
+	"whatsapp-bot/internal/config"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestOutboundBackoff(t *testing.T) {
+	s := &OutboundQueueService{sm: &ServiceManager{Config: &config.Config{
+		Outbound: config.OutboundConfig{BaseBackoff: 2 * time.Second, MaxBackoff: time.Minute},
+	}}}
+
+	testCases := []struct {
+		attempts int
+		expected time.Duration
+	}{
+		{attempts: 1, expected: 2 * time.Second},
+		{attempts: 2, expected: 4 * time.Second},
+		{attempts: 3, expected: 8 * time.Second},
+		{attempts: 5, expected: 32 * time.Second},
+		{attempts: 6, expected: time.Minute},
+		{attempts: 20, expected: time.Minute},
+	}
+
+	for _, tc := range testCases {
+		delay := s.backoff(tc.attempts)
+		// Up to 20% jitter is added on top
+		assert.GreaterOrEqual(t, int64(delay), int64(tc.expected), "attempt %d", tc.attempts)
+		assert.Less(t, int64(delay), int64(tc.expected+tc.expected/5), "attempt %d", tc.attempts)
+	}
+}
@@ -1,6 +1,7 @@
 package services
 
 import (
+	"errors"
 	"fmt"
 	"strings"
 	"time"
@@ -28,11 +29,37 @@ func (s *ReminderService) ProcessReminders() error {
 	}
 
 	for _, reminder := range reminders {
-		if err := s.sendReminder(&reminder); err != nil {
-			logger.Log.WithError(err).Error("Failed to send reminder")
+		contact := &models.Contact{}
+		if err := s.sm.DB.Where("id = ?", reminder.ContactID).First(contact).Error; err != nil {
+			logger.Log.WithError(err).Error("Failed to get reminder contact")
 			continue
 		}
 
+		// Telegram chats can turn reminders off or hold them during quiet hours
+		var err error
+		deliverAt := now
+		if contact.Platform == PlatformTelegram {
+			deliverAt, err = s.sm.TelegramService.NotificationTime(contact.TelegramChatID, NotificationReminder, now)
+			if err != nil && !errors.Is(err, ErrNotificationDisabled) {
+				logger.Log.WithError(err).Warn("Failed to load Telegram notification settings")
+				deliverAt, err = now, nil
+			}
+		}
+
+		switch {
+		case errors.Is(err, ErrNotificationDisabled):
+			logger.Log.WithField("reminder_id", reminder.ID).Info("Reminder suppressed by Telegram notification settings")
+		case deliverAt.After(now):
+			reminder.RemindAt = deliverAt
+			s.sm.DB.Save(&reminder)
+			continue
+		default:
+			if err := s.sendReminder(&reminder, contact); err != nil {
+				logger.Log.WithError(err).Error("Failed to send reminder")
+				continue
+			}
+		}
+
 		// Update reminder status
 		if reminder.IsRecurring {
 			// Schedule next reminder
@@ -49,13 +76,7 @@ func (s *ReminderService) ProcessReminders() error {
 	return nil
 }
 
-func (s *ReminderService) sendReminder(reminder *models.Reminder) error {
-	// Get contact information
-	contact := &models.Contact{}
-	if err := s.sm.DB.Where("id = ?", reminder.ContactID).First(contact).Error; err != nil {
-		return err
-	}
-
+func (s *ReminderService) sendReminder(reminder *models.Reminder, contact *models.Contact) error {
 	// Format reminder message
 	message := fmt.Sprintf("🔔 PENGINGAT 🔔\n\n%s\n\n%s", reminder.Title, reminder.Description)
 	
@@ -64,7 +85,12 @@ func (s *ReminderService) sendReminder(reminder *models.Reminder) error {
 	}
 
 	// Send reminder
-	_, err := s.sm.WhatsApp.SendTextMessage(contact.PhoneNumber, message, false)
+	var err error
+	if reminder.TemplateID != nil {
+		err = s.sendTemplateReminder(reminder, contact)
+	} else {
+		err = s.sm.SendContactText(contact, message)
+	}
 	if err != nil {
 		return err
 	}
@@ -78,6 +104,22 @@ func (s *ReminderService) sendReminder(reminder *models.Reminder) error {
 	return nil
 }
 
+// sendTemplateReminder sends the reminder using its message template. The
+// title and description are available to the template as variables.
+func (s *ReminderService) sendTemplateReminder(reminder *models.Reminder, contact *models.Contact) error {
+	values, err := parseTemplateValues(reminder.TemplateValues)
+	if err != nil {
+		return err
+	}
+
+	values = mergeTemplateValues(ContactTemplateValues(contact), map[string]string{
+		"title":       reminder.Title,
+		"description": reminder.Description,
+	}, values)
+
+	return s.sm.SendContactTemplate(contact, *reminder.TemplateID, values)
+}
+
 func (s *ReminderService) calculateNextReminder(reminder models.Reminder) time.Time {
 	now := time.Now()
 	
@@ -226,7 +268,7 @@ func (s *ReminderService) handleCreateReminder(contact *models.Contact, text str
 		message += fmt.Sprintf("\nPengingat akan diulang: %s", recurringType)
 	}
 
-	_, err = s.sm.WhatsApp.SendTextMessage(contact.PhoneNumber, message, false)
+	err = s.sm.Channel(contact).SendText(message)
 	return err
 }
 
@@ -238,7 +280,7 @@ func (s *ReminderService) handleListReminders(contact *models.Contact) error {
 
 	if len(reminders) == 0 {
 		message := "📋 DAFTAR PENGINGAT 📋\n\nAnda belum memiliki pengingat aktif.\n\nUntuk membuat pengingat, ketik: 'reminder buat besok 08:00 meeting'"
-		_, err := s.sm.WhatsApp.SendTextMessage(contact.PhoneNumber, message, false)
+		err := s.sm.Channel(contact).SendText(message)
 		return err
 	}
 
@@ -254,7 +296,7 @@ func (s *ReminderService) handleListReminders(contact *models.Contact) error {
 
 	message += "Untuk menghapus pengingat, ketik: 'reminder hapus [nomor]'"
 
-	_, err = s.sm.WhatsApp.SendTextMessage(contact.PhoneNumber, message, false)
+	err = s.sm.Channel(contact).SendText(message)
 	return err
 }
 
@@ -272,7 +314,7 @@ func (s *ReminderService) handleDeleteReminder(contact *models.Contact, text str
 
 	if reminderNumber == 0 {
 		message := "❌ FORMAT SALAH ❌\n\nGunakan: 'reminder hapus [nomor_pengingat]'\n\nContoh: 'reminder hapus 1'"
-		_, err := s.sm.WhatsApp.SendTextMessage(contact.PhoneNumber, message, false)
+		err := s.sm.Channel(contact).SendText(message)
 		return err
 	}
 
@@ -284,7 +326,7 @@ func (s *ReminderService) handleDeleteReminder(contact *models.Contact, text str
 
 	if reminderNumber > len(reminders) {
 		message := "❌ PENGINGAT TIDAK DITEMUKAN ❌\n\nNomor pengingat tidak valid."
-		_, err := s.sm.WhatsApp.SendTextMessage(contact.PhoneNumber, message, false)
+		err := s.sm.Channel(contact).SendText(message)
 		return err
 	}
 
@@ -294,14 +336,14 @@ func (s *ReminderService) handleDeleteReminder(contact *models.Contact, text str
 	}
 
 	message := fmt.Sprintf("✅ PENGINGAT DIHAPUS ✅\n\nPengingat '%s' telah dihapus.", reminder.Title)
-	_, err = s.sm.WhatsApp.SendTextMessage(contact.PhoneNumber, message, false)
+	err = s.sm.Channel(contact).SendText(message)
 	return err
 }
 
 func (s *ReminderService) handleReminderHelp(contact *models.Contact) error {
 	message := "🔔 BANTUAN PENGINGAT 🔔\n\nPerintah yang tersedia:\n\n• 'reminder buat [teks]' - Buat pengingat\n• 'reminder list' - Lihat daftar pengingat\n• 'reminder hapus [nomor]' - Hapus pengingat\n\nContoh:\n• 'reminder buat besok 08:00 meeting dengan client'\n• 'reminder buat harian minum vitamin'\n• 'reminder list'\n• 'reminder hapus 1'"
 	
-	_, err := s.sm.WhatsApp.SendTextMessage(contact.PhoneNumber, message, false)
+	err := s.sm.Channel(contact).SendText(message)
 	return err
 }
 
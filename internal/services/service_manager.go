@@ -3,29 +3,44 @@ package services
 import (
 	"whatsapp-bot/internal/config"
 	"whatsapp-bot/internal/models"
+	"whatsapp-bot/pkg/encryption"
+	"whatsapp-bot/pkg/storage"
+	"whatsapp-bot/pkg/telegram"
 	"whatsapp-bot/pkg/whatsapp"
 
 	"github.com/go-redis/redis/v8"
+	"github.com/google/uuid"
 	"github.com/jinzhu/gorm"
 )
 
 type ServiceManager struct {
-	DB                *gorm.DB
-	Redis             *redis.Client
-	WhatsApp          *whatsapp.Client
-	Config            *config.Config
-	UserService       *UserService
-	ContactService    *ContactService
-	MessageService    *MessageService
-	AutoReplyService  *AutoReplyService
-	BroadcastService  *BroadcastService
-	GameService       *GameService
-	BusinessService   *BusinessService
-	ReminderService   *ReminderService
-	ModerationService *ModerationService
-	UtilityService    *UtilityService
-	AnalyticsService  *AnalyticsService
-	CleanupService    *CleanupService
+	DB                       *gorm.DB
+	Redis                    *redis.Client
+	WhatsApp                 *whatsapp.Client
+	Telegram                 *telegram.Client
+	Storage                  storage.Storage
+	Config                   *config.Config
+	WhatsAppService          *WhatsAppService
+	WhatsAppAccountService   *WhatsAppAccountService
+	OutboundQueue            *OutboundQueueService
+	TemplateService          *TemplateService
+	UserService              *UserService
+	ContactService           *ContactService
+	MessageService           *MessageService
+	AutoReplyService         *AutoReplyService
+	BroadcastService         *BroadcastService
+	GameService              *GameService
+	BusinessService          *BusinessService
+	ReminderService          *ReminderService
+	ModerationService        *ModerationService
+	UtilityService           *UtilityService
+	AnalyticsService         *AnalyticsService
+	CleanupService           *CleanupService
+	TelegramService          *TelegramService
+	TelegramBotService       *TelegramBotService
+	TelegramBroadcastService *TelegramBroadcastService
+	TelegramAnalyticsService *TelegramAnalyticsService
+	BridgeService            *BridgeService
 }
 
 func NewServiceManager(db *gorm.DB, redis *redis.Client, waClient *whatsapp.Client, cfg *config.Config) *ServiceManager {
@@ -33,10 +48,16 @@ func NewServiceManager(db *gorm.DB, redis *redis.Client, waClient *whatsapp.Clie
 		DB:       db,
 		Redis:    redis,
 		WhatsApp: waClient,
+		Storage:  storage.New(cfg.Storage),
 		Config:   cfg,
 	}
+	sm.Telegram = sm.newTelegramClient(cfg.Telegram.BotToken)
 
 	// Initialize all services
+	sm.WhatsAppService = NewWhatsAppService(sm)
+	sm.WhatsAppAccountService = NewWhatsAppAccountService(sm)
+	sm.OutboundQueue = NewOutboundQueueService(sm)
+	sm.TemplateService = NewTemplateService(sm)
 	sm.UserService = NewUserService(sm)
 	sm.ContactService = NewContactService(sm)
 	sm.MessageService = NewMessageService(sm)
@@ -49,10 +70,65 @@ func NewServiceManager(db *gorm.DB, redis *redis.Client, waClient *whatsapp.Clie
 	sm.UtilityService = NewUtilityService(sm)
 	sm.AnalyticsService = NewAnalyticsService(sm)
 	sm.CleanupService = NewCleanupService(sm)
+	sm.TelegramService = NewTelegramService(sm)
+	sm.TelegramBotService = NewTelegramBotService(sm)
+	sm.TelegramBroadcastService = NewTelegramBroadcastService(sm)
+	sm.TelegramAnalyticsService = NewTelegramAnalyticsService(sm)
+	sm.BridgeService = NewBridgeService(sm)
 
 	return sm
 }
 
+func NewWhatsAppService(sm *ServiceManager) *WhatsAppService {
+	return &WhatsAppService{sm: sm}
+}
+
+func NewWhatsAppAccountService(sm *ServiceManager) *WhatsAppAccountService {
+	return &WhatsAppAccountService{
+		sm:          sm,
+		clients:     make(map[string]*whatsapp.Client),
+		userNumbers: make(map[uuid.UUID]string),
+	}
+}
+
+// ErrEncryptionKeyMissing is returned when credentials would be stored
+// without ENCRYPTION_KEY to encrypt them.
+var ErrEncryptionKeyMissing = encryption.ErrMissingKey
+
+func (sm *ServiceManager) requireEncryptionKey() error {
+	if sm.Config.Security.EncryptionKey == "" {
+		return ErrEncryptionKeyMissing
+	}
+	return nil
+}
+
+// HasStoredCredentials reports whether any WhatsApp number or Telegram bot
+// has an encrypted token stored, which can't be used without the key.
+func (sm *ServiceManager) HasStoredCredentials() (bool, error) {
+	var accounts, bots int
+	if err := sm.DB.Model(&models.WhatsAppAccount{}).Count(&accounts).Error; err != nil {
+		return false, err
+	}
+	if err := sm.DB.Model(&models.TelegramBot{}).Count(&bots).Error; err != nil {
+		return false, err
+	}
+	return accounts+bots > 0, nil
+}
+
+// WhatsAppClient returns the client that sends from the user's own business
+// number, falling back to the global client.
+func (sm *ServiceManager) WhatsAppClient(userID uuid.UUID) *whatsapp.Client {
+	return sm.WhatsAppAccountService.ClientForUser(userID)
+}
+
+func NewOutboundQueueService(sm *ServiceManager) *OutboundQueueService {
+	return &OutboundQueueService{sm: sm}
+}
+
+func NewTemplateService(sm *ServiceManager) *TemplateService {
+	return &TemplateService{sm: sm}
+}
+
 type UserService struct {
 	sm *ServiceManager
 }
@@ -147,4 +223,50 @@ type CleanupService struct {
 
 func NewCleanupService(sm *ServiceManager) *CleanupService {
 	return &CleanupService{sm: sm}
-}
\ No newline at end of file
+}
+
+func NewTelegramService(sm *ServiceManager) *TelegramService {
+	return newTelegramService(sm, sm.Telegram, nil)
+}
+
+func newTelegramService(sm *ServiceManager, client *telegram.Client, bot *models.TelegramBot) *TelegramService {
+	s := &TelegramService{sm: sm, client: client, bot: bot}
+	s.registerBuiltinCommands()
+	client.OnSent(s.recordOutgoing)
+	return s
+}
+
+func NewTelegramBotService(sm *ServiceManager) *TelegramBotService {
+	return &TelegramBotService{
+		sm:   sm,
+		bots: make(map[uuid.UUID]*TelegramService),
+	}
+}
+
+// newTelegramClient returns a Bot API client for a bot token, talking to
+// the configured Bot API server.
+func (sm *ServiceManager) newTelegramClient(apiKey string) *telegram.Client {
+	client := telegram.NewClient(apiKey)
+	if sm.Config.Telegram.APIURL != "" {
+		client.SetAPIURL(sm.Config.Telegram.APIURL)
+	}
+	return client
+}
+
+// TelegramFor returns the service running a bot: a hosted TelegramBot, or
+// the configured bot for a nil ID.
+func (sm *ServiceManager) TelegramFor(botID *uuid.UUID) *TelegramService {
+	return sm.TelegramBotService.ForBot(botID)
+}
+
+func NewTelegramBroadcastService(sm *ServiceManager) *TelegramBroadcastService {
+	return &TelegramBroadcastService{sm: sm}
+}
+
+func NewTelegramAnalyticsService(sm *ServiceManager) *TelegramAnalyticsService {
+	return &TelegramAnalyticsService{sm: sm}
+}
+
+func NewBridgeService(sm *ServiceManager) *BridgeService {
+	return &BridgeService{sm: sm}
+}
@@ -0,0 +1,350 @@
+package services
+
+import (
+	"encoding/json"
+	"errors"
+	"time"
+
+	"whatsapp-bot/internal/models"
+	"whatsapp-bot/pkg/logger"
+
+	"github.com/google/uuid"
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	// telegramAnalyticsCatchUpDays limits how far back the scheduled rollup
+	// fills in days it missed. Older days need a backfill.
+	telegramAnalyticsCatchUpDays = 31
+	// maxTelegramAnalyticsRange is the longest backfill or series allowed.
+	maxTelegramAnalyticsRange = 366
+)
+
+var ErrInvalidAnalyticsRange = errors.New("invalid date range")
+
+// TelegramAnalyticsService rolls TelegramMessage rows and Telegram errors in
+// the system log up into one TelegramAnalytics row per bot and day.
+type TelegramAnalyticsService struct {
+	sm *ServiceManager
+}
+
+// TelegramAnalyticsPoint is one day of a time series.
+type TelegramAnalyticsPoint struct {
+	Date             string `json:"date"` // YYYY-MM-DD
+	MessagesSent     int64  `json:"messages_sent"`
+	MessagesReceived int64  `json:"messages_received"`
+	UsersInteracted  int64  `json:"users_interacted"`
+	GroupsInteracted int64  `json:"groups_interacted"`
+	CommandsUsed     int64  `json:"commands_used"`
+	ErrorsCount      int64  `json:"errors_count"`
+}
+
+// telegramDayCounts is one bot's counters for a day, as read from
+// TelegramMessage.
+type telegramDayCounts struct {
+	BotID            *uuid.UUID
+	MessagesSent     int64
+	MessagesReceived int64
+	FailedSends      int64
+	UsersInteracted  int64
+	GroupsInteracted int64
+	CommandsUsed     int64
+}
+
+// RunRollup is run by cron. It aggregates today so far and every day since
+// the latest rollup, which finishes the previous day after midnight and
+// fills in days missed while the server was down.
+func (s *TelegramAnalyticsService) RunRollup() error {
+	today := analyticsDay(time.Now())
+	from := today
+
+	var latest models.TelegramAnalytics
+	if err := s.sm.DB.Order("date desc").First(&latest).Error; err == nil {
+		from = analyticsDay(latest.Date)
+	}
+	if earliest := today.AddDate(0, 0, -telegramAnalyticsCatchUpDays); from.Before(earliest) {
+		from = earliest
+	}
+
+	_, err := s.Backfill(from, today)
+	return err
+}
+
+// Backfill aggregates every day from from through to, replacing existing
+// rows. It returns the number of days aggregated.
+func (s *TelegramAnalyticsService) Backfill(from, to time.Time) (int, error) {
+	from, to = analyticsDay(from), analyticsDay(to)
+	if to.Before(from) || to.Sub(from) > maxTelegramAnalyticsRange*24*time.Hour {
+		return 0, ErrInvalidAnalyticsRange
+	}
+
+	days := 0
+	for day := from; !day.After(to); day = day.AddDate(0, 0, 1) {
+		if err := s.AggregateDay(day); err != nil {
+			return days, err
+		}
+		days++
+	}
+	return days, nil
+}
+
+// AggregateDay computes the counters of every bot that was active on day
+// and saves them.
+func (s *TelegramAnalyticsService) AggregateDay(day time.Time) error {
+	start := analyticsDay(day)
+	end := start.AddDate(0, 0, 1)
+
+	var counts []telegramDayCounts
+	err := s.sm.DB.Model(&models.TelegramMessage{}).
+		Select(`bot_id,
+			SUM(CASE WHEN direction = 'outgoing' AND status = 'sent' THEN 1 ELSE 0 END) AS messages_sent,
+			SUM(CASE WHEN direction = 'incoming' AND message_type = 'message' THEN 1 ELSE 0 END) AS messages_received,
+			SUM(CASE WHEN direction = 'outgoing' AND status = 'failed' THEN 1 ELSE 0 END) AS failed_sends,
+			COUNT(DISTINCT CASE WHEN direction = 'incoming' AND from_user_id <> 0 THEN from_user_id END) AS users_interacted,
+			COUNT(DISTINCT CASE WHEN direction = 'incoming' AND chat_id < 0 THEN chat_id END) AS groups_interacted,
+			SUM(CASE WHEN direction = 'incoming' AND message_type = 'message' AND text LIKE '/%' THEN 1 ELSE 0 END) AS commands_used`).
+		Where("created_at >= ? AND created_at < ?", start, end).
+		Group("bot_id").
+		Scan(&counts).Error
+	if err != nil {
+		logger.Log.WithError(err).Error("Failed to aggregate Telegram messages")
+		return err
+	}
+
+	errorCounts, err := s.errorCounts(start, end)
+	if err != nil {
+		return err
+	}
+
+	for _, c := range counts {
+		key := analyticsBotKey(c.BotID)
+		errorsCount := c.FailedSends + errorCounts[key]
+		delete(errorCounts, key)
+
+		row := models.TelegramAnalytics{
+			BotID:            c.BotID,
+			MessagesSent:     c.MessagesSent,
+			MessagesReceived: c.MessagesReceived,
+			UsersInteracted:  c.UsersInteracted,
+			GroupsInteracted: c.GroupsInteracted,
+			CommandsUsed:     c.CommandsUsed,
+			ErrorsCount:      errorsCount,
+		}
+		if err := s.saveDay(start, &row); err != nil {
+			return err
+		}
+	}
+
+	// Bots that only failed that day
+	for key, errorsCount := range errorCounts {
+		row := models.TelegramAnalytics{ErrorsCount: errorsCount}
+		if key != "" {
+			botID := uuid.MustParse(key)
+			row.BotID = &botID
+		}
+		if err := s.saveDay(start, &row); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// errorCounts counts the Telegram errors in the system log by bot. The key
+// is the bot ID, or "" for the configured bot.
+func (s *TelegramAnalyticsService) errorCounts(start, end time.Time) (map[string]int64, error) {
+	var contexts []string
+	err := s.sm.DB.Model(&models.SystemLog{}).
+		Where("level = ? AND context LIKE ? AND created_at >= ? AND created_at < ?", "error", `%"platform":"telegram"%`, start, end).
+		Pluck("context", &contexts).Error
+	if err != nil {
+		logger.Log.WithError(err).Error("Failed to count Telegram errors")
+		return nil, err
+	}
+
+	counts := make(map[string]int64)
+	for _, context := range contexts {
+		var details struct {
+			BotID string `json:"bot_id"`
+		}
+		if err := json.Unmarshal([]byte(context), &details); err != nil {
+			continue
+		}
+		if details.BotID != "" {
+			if _, err := uuid.Parse(details.BotID); err != nil {
+				continue
+			}
+		}
+		counts[details.BotID]++
+	}
+	return counts, nil
+}
+
+// saveDay replaces the bot's row for day with row.
+func (s *TelegramAnalyticsService) saveDay(day time.Time, row *models.TelegramAnalytics) error {
+	ownerID, err := s.botOwnerID(row.BotID)
+	if err != nil {
+		logger.Log.WithError(err).WithField("bot_id", row.BotID).Warn("Skipping Telegram analytics of unknown bot")
+		return nil
+	}
+
+	query := s.sm.DB.Where("date = ?", day)
+	if row.BotID != nil {
+		query = query.Where("bot_id = ?", *row.BotID)
+	} else {
+		query = query.Where("bot_id IS NULL")
+	}
+
+	var existing models.TelegramAnalytics
+	if err := query.First(&existing).Error; err == nil {
+		row.ID = existing.ID
+		row.CreatedAt = existing.CreatedAt
+	} else {
+		row.ID = uuid.New()
+		row.CreatedAt = time.Now()
+	}
+	row.Date = day
+	row.UserID = ownerID
+	row.UpdatedAt = time.Now()
+
+	if err := s.sm.DB.Save(row).Error; err != nil {
+		logger.Log.WithError(err).WithFields(logrus.Fields{
+			"date":   day.Format("2006-01-02"),
+			"bot_id": row.BotID,
+		}).Error("Failed to save Telegram analytics")
+		return err
+	}
+	return nil
+}
+
+// botOwnerID returns the user a bot's analytics belong to, including bots
+// deleted since.
+func (s *TelegramAnalyticsService) botOwnerID(botID *uuid.UUID) (uuid.UUID, error) {
+	if botID == nil {
+		return s.sm.ContactService.defaultOwnerID()
+	}
+
+	var bot models.TelegramBot
+	if err := s.sm.DB.Unscoped().Where("id = ?", *botID).First(&bot).Error; err != nil {
+		return uuid.Nil, err
+	}
+	return bot.UserID, nil
+}
+
+// GetSeries returns the user's daily counters from from through to, with a
+// zero point for days without activity. Without a bot ID the user's bots
+// are added up, except users and groups, which are counted once per day
+// however many of the bots they talked to.
+func (s *TelegramAnalyticsService) GetSeries(userID uuid.UUID, botID *uuid.UUID, from, to time.Time) ([]TelegramAnalyticsPoint, error) {
+	from, to = analyticsDay(from), analyticsDay(to)
+	if to.Before(from) || to.Sub(from) > maxTelegramAnalyticsRange*24*time.Hour {
+		return nil, ErrInvalidAnalyticsRange
+	}
+
+	query := s.sm.DB.Where("user_id = ? AND date >= ? AND date <= ?", userID, from, to)
+	if botID != nil {
+		query = query.Where("bot_id = ?", *botID)
+	}
+
+	var rows []models.TelegramAnalytics
+	if err := query.Order("date").Find(&rows).Error; err != nil {
+		logger.Log.WithError(err).Error("Failed to get Telegram analytics")
+		return nil, err
+	}
+
+	byDate := make(map[string]*TelegramAnalyticsPoint)
+	var series []TelegramAnalyticsPoint
+	for day := from; !day.After(to); day = day.AddDate(0, 0, 1) {
+		series = append(series, TelegramAnalyticsPoint{Date: day.Format("2006-01-02")})
+	}
+	for i := range series {
+		byDate[series[i].Date] = &series[i]
+	}
+
+	botsByDate := make(map[string][]*uuid.UUID)
+	for _, row := range rows {
+		date := analyticsDay(row.Date).Format("2006-01-02")
+		point, ok := byDate[date]
+		if !ok {
+			continue
+		}
+		point.MessagesSent += row.MessagesSent
+		point.MessagesReceived += row.MessagesReceived
+		point.UsersInteracted += row.UsersInteracted
+		point.GroupsInteracted += row.GroupsInteracted
+		point.CommandsUsed += row.CommandsUsed
+		point.ErrorsCount += row.ErrorsCount
+		botsByDate[date] = append(botsByDate[date], row.BotID)
+	}
+
+	for date, bots := range botsByDate {
+		if len(bots) < 2 {
+			continue
+		}
+		if err := s.countDistinct(byDate[date], bots); err != nil {
+			return nil, err
+		}
+	}
+
+	return series, nil
+}
+
+// countDistinct recounts a day's users and groups across several bots from
+// the stored messages, as summing the bots' rows counts a user who wrote
+// to two of them twice.
+func (s *TelegramAnalyticsService) countDistinct(point *TelegramAnalyticsPoint, bots []*uuid.UUID) error {
+	start, err := time.ParseInLocation("2006-01-02", point.Date, time.Local)
+	if err != nil {
+		return err
+	}
+
+	var botIDs []uuid.UUID
+	configuredBot := false
+	for _, botID := range bots {
+		if botID == nil {
+			configuredBot = true
+		} else {
+			botIDs = append(botIDs, *botID)
+		}
+	}
+
+	botFilter, args := "bot_id IN (?)", []interface{}{botIDs}
+	if len(botIDs) == 0 {
+		botFilter, args = "bot_id IS NULL", nil
+	} else if configuredBot {
+		botFilter = "(bot_id IN (?) OR bot_id IS NULL)"
+	}
+
+	var distinct struct {
+		UsersInteracted  int64
+		GroupsInteracted int64
+	}
+	err = s.sm.DB.Model(&models.TelegramMessage{}).
+		Select(`COUNT(DISTINCT CASE WHEN from_user_id <> 0 THEN from_user_id END) AS users_interacted,
+			COUNT(DISTINCT CASE WHEN chat_id < 0 THEN chat_id END) AS groups_interacted`).
+		Where("direction = ? AND created_at >= ? AND created_at < ?", "incoming", start, start.AddDate(0, 0, 1)).
+		Where(botFilter, args...).
+		Scan(&distinct).Error
+	if err != nil {
+		logger.Log.WithError(err).WithField("date", point.Date).Error("Failed to count distinct Telegram users")
+		return err
+	}
+
+	point.UsersInteracted = distinct.UsersInteracted
+	point.GroupsInteracted = distinct.GroupsInteracted
+	return nil
+}
+
+// analyticsDay returns the start of t's day in server time, which is what
+// TelegramAnalytics.Date holds.
+func analyticsDay(t time.Time) time.Time {
+	t = t.In(time.Local)
+	return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.Local)
+}
+
+func analyticsBotKey(botID *uuid.UUID) string {
+	if botID == nil {
+		return ""
+	}
+	return botID.String()
+}
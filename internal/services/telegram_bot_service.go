@@ -0,0 +1,284 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"whatsapp-bot/internal/models"
+	"whatsapp-bot/pkg/encryption"
+	"whatsapp-bot/pkg/logger"
+
+	"github.com/google/uuid"
+	"github.com/jinzhu/gorm"
+	"github.com/sirupsen/logrus"
+)
+
+var (
+	ErrTelegramBotNotFound  = errors.New("Telegram bot not found")
+	ErrTelegramBotExists    = errors.New("Telegram bot is already connected")
+	ErrInvalidTelegramToken = errors.New("Telegram rejected the bot token")
+)
+
+// TelegramBotService hosts the TelegramBot records next to the configured
+// bot. Every active bot gets its own client and TelegramService, which
+// receives updates by webhook or polling just like the configured bot.
+type TelegramBotService struct {
+	sm *ServiceManager
+
+	mu   sync.RWMutex
+	bots map[uuid.UUID]*TelegramService // running bots by ID
+}
+
+// Start runs every active bot. A bot that fails to start is skipped and
+// its error recorded on the bot.
+func (s *TelegramBotService) Start() {
+	var bots []models.TelegramBot
+	if err := s.sm.DB.Where("is_active = ?", true).Find(&bots).Error; err != nil {
+		logger.Log.WithError(err).Error("Failed to load Telegram bots")
+		return
+	}
+
+	for i := range bots {
+		if err := s.start(&bots[i]); err != nil {
+			logger.Log.WithError(err).WithField("bot_id", bots[i].ID).Error("Failed to start Telegram bot")
+		}
+	}
+}
+
+// Stop stops every running bot's poller.
+func (s *TelegramBotService) Stop() {
+	s.mu.Lock()
+	bots := s.bots
+	s.bots = make(map[uuid.UUID]*TelegramService)
+	s.mu.Unlock()
+
+	for _, service := range bots {
+		if err := service.StopPolling(); err != nil && err != ErrTelegramPollingInactive {
+			logger.Log.WithError(err).WithField("bot_id", service.bot.ID).Error("Failed to stop Telegram bot")
+		}
+	}
+}
+
+// SyncCommands publishes the command menu of the configured bot and every
+// running bot, returning the first error.
+func (s *TelegramBotService) SyncCommands() error {
+	var services []*TelegramService
+	if s.sm.Config.Telegram.BotToken != "" {
+		services = append(services, s.sm.TelegramService)
+	}
+	s.mu.RLock()
+	for _, service := range s.bots {
+		services = append(services, service)
+	}
+	s.mu.RUnlock()
+
+	var firstErr error
+	for _, service := range services {
+		if err := service.SyncCommands(); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	return firstErr
+}
+
+// CreateBot connects a bot by its token and starts it. The bot is created
+// even if it can't start receiving; the error is kept in LastError.
+func (s *TelegramBotService) CreateBot(userID uuid.UUID, name, apiKey, webhookURL string) (*models.TelegramBot, error) {
+	if err := s.sm.requireEncryptionKey(); err != nil {
+		return nil, err
+	}
+	if apiKey == s.sm.Config.Telegram.BotToken {
+		return nil, ErrTelegramBotExists
+	}
+
+	me, err := s.sm.newTelegramClient(apiKey).GetMe()
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidTelegramToken, err)
+	}
+
+	// Two pollers on one token would steal each other's updates
+	var count int
+	if err := s.sm.DB.Model(&models.TelegramBot{}).Where("username = ?", me.Username).Count(&count).Error; err != nil {
+		return nil, err
+	}
+	if count > 0 {
+		return nil, ErrTelegramBotExists
+	}
+
+	encrypted, err := encryption.Encrypt(s.sm.Config.Security.EncryptionKey, apiKey)
+	if err != nil {
+		return nil, err
+	}
+
+	if name == "" {
+		name = me.FirstName
+	}
+	bot := &models.TelegramBot{
+		ID:         uuid.New(),
+		UserID:     userID,
+		Name:       name,
+		Username:   me.Username,
+		APIKey:     encrypted,
+		WebhookURL: webhookURL,
+		IsActive:   true,
+		CreatedAt:  time.Now(),
+		UpdatedAt:  time.Now(),
+	}
+	if err := s.sm.DB.Create(bot).Error; err != nil {
+		logger.Log.WithError(err).Error("Failed to create Telegram bot")
+		return nil, err
+	}
+
+	if err := s.start(bot); err != nil {
+		logger.Log.WithError(err).WithField("bot_id", bot.ID).Error("Failed to start Telegram bot")
+	}
+	return bot, nil
+}
+
+func (s *TelegramBotService) GetBots(userID uuid.UUID) ([]models.TelegramBot, error) {
+	var bots []models.TelegramBot
+	err := s.sm.DB.Where("user_id = ?", userID).Order("created_at").Find(&bots).Error
+	return bots, err
+}
+
+// UpdateBot changes a bot's name, webhook URL or active state and restarts
+// it, so the change takes effect at once.
+func (s *TelegramBotService) UpdateBot(userID, botID uuid.UUID, updates map[string]interface{}) (*models.TelegramBot, error) {
+	bot, err := s.getUserBot(userID, botID)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := s.sm.DB.Model(bot).Updates(updates).Error; err != nil {
+		logger.Log.WithError(err).Error("Failed to update Telegram bot")
+		return nil, err
+	}
+	if bot, err = s.getUserBot(userID, botID); err != nil {
+		return nil, err
+	}
+
+	s.stop(bot.ID)
+	if bot.IsActive {
+		if err := s.start(bot); err != nil {
+			logger.Log.WithError(err).WithField("bot_id", bot.ID).Error("Failed to restart Telegram bot")
+		}
+	}
+	return bot, nil
+}
+
+// DeleteBot stops a bot, removes its webhook and deletes it.
+func (s *TelegramBotService) DeleteBot(userID, botID uuid.UUID) error {
+	bot, err := s.getUserBot(userID, botID)
+	if err != nil {
+		return err
+	}
+
+	if service := s.stop(bot.ID); service != nil {
+		if err := service.client.DeleteWebhook(); err != nil {
+			logger.Log.WithError(err).WithField("bot_id", bot.ID).Warn("Failed to remove webhook of deleted Telegram bot")
+		}
+	}
+
+	if err := s.sm.DB.Delete(bot).Error; err != nil {
+		return err
+	}
+	return s.sm.DB.Where("bot_id = ?", bot.ID).Delete(&models.TelegramWebhook{}).Error
+}
+
+func (s *TelegramBotService) getUserBot(userID, botID uuid.UUID) (*models.TelegramBot, error) {
+	bot := &models.TelegramBot{}
+	err := s.sm.DB.Where("id = ? AND user_id = ?", botID, userID).First(bot).Error
+	if gorm.IsRecordNotFoundError(err) {
+		return nil, ErrTelegramBotNotFound
+	}
+	return bot, err
+}
+
+// Bot returns the service of a running bot, or nil.
+func (s *TelegramBotService) Bot(botID uuid.UUID) *TelegramService {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.bots[botID]
+}
+
+// ForBot returns the service that talks to a bot's chats: the configured
+// bot's for a nil ID. A bot that isn't running gets a service without a
+// token, so sends fail instead of going out through another bot.
+func (s *TelegramBotService) ForBot(botID *uuid.UUID) *TelegramService {
+	if botID == nil {
+		return s.sm.TelegramService
+	}
+	if service := s.Bot(*botID); service != nil {
+		return service
+	}
+
+	logger.Log.WithField("bot_id", *botID).Warn("Telegram bot is not running")
+	return newTelegramService(s.sm, s.sm.newTelegramClient(""), &models.TelegramBot{ID: *botID})
+}
+
+// start creates the bot's client and service and starts receiving. The
+// service is registered first so early webhook deliveries find it.
+func (s *TelegramBotService) start(bot *models.TelegramBot) error {
+	apiKey, err := encryption.Decrypt(s.sm.Config.Security.EncryptionKey, bot.APIKey)
+	if err != nil {
+		s.recordError(bot, err)
+		return err
+	}
+
+	service := newTelegramService(s.sm, s.sm.newTelegramClient(apiKey), bot)
+	s.mu.Lock()
+	s.bots[bot.ID] = service
+	s.mu.Unlock()
+
+	if err := service.StartReceiving(); err != nil {
+		s.stop(bot.ID)
+		s.recordError(bot, err)
+		return err
+	}
+	if err := service.SyncCommands(); err != nil {
+		logger.Log.WithError(err).WithField("bot_id", bot.ID).Warn("Failed to sync Telegram bot commands")
+	}
+
+	logger.Log.WithFields(logrus.Fields{
+		"bot_id":   bot.ID,
+		"username": bot.Username,
+		"polling":  service.IsPolling(),
+	}).Info("Telegram bot started")
+	return nil
+}
+
+// stop unregisters a running bot and stops its poller. It returns the
+// stopped service, or nil if the bot wasn't running.
+func (s *TelegramBotService) stop(botID uuid.UUID) *TelegramService {
+	s.mu.Lock()
+	service := s.bots[botID]
+	delete(s.bots, botID)
+	s.mu.Unlock()
+
+	if service == nil {
+		return nil
+	}
+	if err := service.StopPolling(); err != nil && err != ErrTelegramPollingInactive {
+		logger.Log.WithError(err).WithField("bot_id", botID).Error("Failed to stop Telegram bot")
+	}
+	return service
+}
+
+func (s *TelegramBotService) recordError(bot *models.TelegramBot, err error) {
+	now := time.Now()
+	s.sm.DB.Model(&models.TelegramBot{}).Where("id = ?", bot.ID).Updates(map[string]interface{}{
+		"last_error":    err.Error(),
+		"last_error_at": now,
+	})
+}
+
+// whereBot limits a query to the rows of one bot, where column holds the
+// bot ID: the configured bot's rows for a nil ID.
+func whereBot(query *gorm.DB, column string, botID *uuid.UUID) *gorm.DB {
+	if botID == nil {
+		return query.Where(column + " IS NULL")
+	}
+	return query.Where(column+" = ?", *botID)
+}
@@ -3,21 +3,15 @@ package services
 import (
 	"time"
 
+	"whatsapp-bot/internal/models"
+	"whatsapp-bot/pkg/logger"
+
 	"github.com/google/uuid"
-	"kilocode.dev/whatsapp-bot/internal/models"
-	"kilocode.dev/whatsapp-bot/pkg/logger"
+	"github.com/sirupsen/logrus"
 )
 
 type TelegramBroadcastService struct {
-	db             *Database
-	telegramService *TelegramService
-}
-
-func NewTelegramBroadcastService(db *Database, telegramService *TelegramService) *TelegramBroadcastService {
-	return &TelegramBroadcastService{
-		db:              db,
-		telegramService: telegramService,
-	}
+	sm *ServiceManager
 }
 
 // GetTelegramBroadcasts gets all Telegram broadcasts for a user
@@ -25,7 +19,7 @@ func (s *TelegramBroadcastService) GetTelegramBroadcasts(userID uuid.UUID, statu
 	var broadcasts []models.TelegramBroadcast
 	var total int64
 
-	query := s.db.DB.Where("user_id = ?", userID)
+	query := s.sm.DB.Where("user_id = ?", userID)
 	
 	if status != "" {
 		query = query.Where("status = ?", status)
@@ -33,14 +27,14 @@ func (s *TelegramBroadcastService) GetTelegramBroadcasts(userID uuid.UUID, statu
 
 	// Get total count
 	if err := query.Model(&models.TelegramBroadcast{}).Count(&total).Error; err != nil {
-		logger.Error("Failed to count Telegram broadcasts", err)
+		logger.Log.WithError(err).Error("Failed to count Telegram broadcasts")
 		return nil, 0, err
 	}
 
 	// Get paginated results
 	offset := (page - 1) * limit
 	if err := query.Order("created_at desc").Offset(offset).Limit(limit).Find(&broadcasts).Error; err != nil {
-		logger.Error("Failed to get Telegram broadcasts", err)
+		logger.Log.WithError(err).Error("Failed to get Telegram broadcasts")
 		return nil, 0, err
 	}
 
@@ -48,20 +42,21 @@ func (s *TelegramBroadcastService) GetTelegramBroadcasts(userID uuid.UUID, statu
 }
 
 // CreateTelegramBroadcast creates a new Telegram broadcast
-func (s *TelegramBroadcastService) CreateTelegramBroadcast(name string, message string, recipients []int64, userID uuid.UUID) (*models.TelegramBroadcast, error) {
+func (s *TelegramBroadcastService) CreateTelegramBroadcast(name string, message string, recipients []int64, userID uuid.UUID, botID *uuid.UUID) (*models.TelegramBroadcast, error) {
 	broadcast := &models.TelegramBroadcast{
 		ID:         uuid.New(),
 		Name:       name,
 		Message:    message,
 		Recipients: recipients,
+		BotID:      botID,
 		Status:     "pending",
 		UserID:     userID,
 		CreatedAt:  time.Now(),
 		UpdatedAt:  time.Now(),
 	}
 
-	if err := s.db.DB.Create(broadcast).Error; err != nil {
-		logger.Error("Failed to create Telegram broadcast", err)
+	if err := s.sm.DB.Create(broadcast).Error; err != nil {
+		logger.Log.WithError(err).Error("Failed to create Telegram broadcast")
 		return nil, err
 	}
 
@@ -71,8 +66,8 @@ func (s *TelegramBroadcastService) CreateTelegramBroadcast(name string, message
 // GetTelegramBroadcast gets a Telegram broadcast by ID
 func (s *TelegramBroadcastService) GetTelegramBroadcast(broadcastID uuid.UUID) (*models.TelegramBroadcast, error) {
 	var broadcast models.TelegramBroadcast
-	if err := s.db.DB.Where("id = ?", broadcastID).First(&broadcast).Error; err != nil {
-		logger.Error("Failed to get Telegram broadcast", err)
+	if err := s.sm.DB.Where("id = ?", broadcastID).First(&broadcast).Error; err != nil {
+		logger.Log.WithError(err).Error("Failed to get Telegram broadcast")
 		return nil, err
 	}
 
@@ -82,8 +77,8 @@ func (s *TelegramBroadcastService) GetTelegramBroadcast(broadcastID uuid.UUID) (
 // UpdateTelegramBroadcast updates a Telegram broadcast
 func (s *TelegramBroadcastService) UpdateTelegramBroadcast(broadcastID uuid.UUID, name string, message string, recipients []int64) (*models.TelegramBroadcast, error) {
 	var broadcast models.TelegramBroadcast
-	if err := s.db.DB.Where("id = ?", broadcastID).First(&broadcast).Error; err != nil {
-		logger.Error("Failed to get Telegram broadcast for update", err)
+	if err := s.sm.DB.Where("id = ?", broadcastID).First(&broadcast).Error; err != nil {
+		logger.Log.WithError(err).Error("Failed to get Telegram broadcast for update")
 		return nil, err
 	}
 
@@ -99,8 +94,8 @@ func (s *TelegramBroadcastService) UpdateTelegramBroadcast(broadcastID uuid.UUID
 	}
 	broadcast.UpdatedAt = time.Now()
 
-	if err := s.db.DB.Save(&broadcast).Error; err != nil {
-		logger.Error("Failed to update Telegram broadcast", err)
+	if err := s.sm.DB.Save(&broadcast).Error; err != nil {
+		logger.Log.WithError(err).Error("Failed to update Telegram broadcast")
 		return nil, err
 	}
 
@@ -109,8 +104,8 @@ func (s *TelegramBroadcastService) UpdateTelegramBroadcast(broadcastID uuid.UUID
 
 // DeleteTelegramBroadcast deletes a Telegram broadcast
 func (s *TelegramBroadcastService) DeleteTelegramBroadcast(broadcastID uuid.UUID) error {
-	if err := s.db.DB.Where("id = ?", broadcastID).Delete(&models.TelegramBroadcast{}).Error; err != nil {
-		logger.Error("Failed to delete Telegram broadcast", err)
+	if err := s.sm.DB.Where("id = ?", broadcastID).Delete(&models.TelegramBroadcast{}).Error; err != nil {
+		logger.Log.WithError(err).Error("Failed to delete Telegram broadcast")
 		return err
 	}
 
@@ -120,28 +115,32 @@ func (s *TelegramBroadcastService) DeleteTelegramBroadcast(broadcastID uuid.UUID
 // SendTelegramBroadcast sends a Telegram broadcast
 func (s *TelegramBroadcastService) SendTelegramBroadcast(broadcastID uuid.UUID) error {
 	var broadcast models.TelegramBroadcast
-	if err := s.db.DB.Where("id = ?", broadcastID).First(&broadcast).Error; err != nil {
-		logger.Error("Failed to get Telegram broadcast for sending", err)
+	if err := s.sm.DB.Where("id = ?", broadcastID).First(&broadcast).Error; err != nil {
+		logger.Log.WithError(err).Error("Failed to get Telegram broadcast for sending")
 		return err
 	}
 
 	// Update status to sending
 	broadcast.Status = "sending"
 	broadcast.SentAt = time.Now()
-	if err := s.db.DB.Save(&broadcast).Error; err != nil {
-		logger.Error("Failed to update Telegram broadcast status", err)
+	if err := s.sm.DB.Save(&broadcast).Error; err != nil {
+		logger.Log.WithError(err).Error("Failed to update Telegram broadcast status")
 		return err
 	}
 
-	// Send messages to recipients
+	// Send messages to recipients. Recipients in quiet hours get theirs
+	// later and are counted when it is sent.
 	successCount := 0
+	failureCount := 0
 	for _, recipient := range broadcast.Recipients {
-		if err := s.telegramService.SendMessage(recipient, broadcast.Message); err != nil {
-			logger.Error("Failed to send Telegram broadcast message", err, map[string]interface{}{
+		result, err := s.sm.TelegramFor(broadcast.BotID).notify(recipient, NotificationBroadcast, broadcast.Message, &broadcast.ID)
+		if err != nil {
+			logger.Log.WithError(err).WithFields(logrus.Fields{
 				"chat_id": recipient,
 				"broadcast_id": broadcastID,
-			})
-		} else {
+			}).Error("Failed to send Telegram broadcast message")
+			failureCount++
+		} else if result == deliverySent {
 			successCount++
 		}
 	}
@@ -149,10 +148,10 @@ func (s *TelegramBroadcastService) SendTelegramBroadcast(broadcastID uuid.UUID)
 	// Update broadcast with results
 	broadcast.Status = "completed"
 	broadcast.SuccessCount = successCount
-	broadcast.FailureCount = len(broadcast.Recipients) - successCount
+	broadcast.FailureCount = failureCount
 	broadcast.CompletedAt = time.Now()
-	if err := s.db.DB.Save(&broadcast).Error; err != nil {
-		logger.Error("Failed to update Telegram broadcast completion", err)
+	if err := s.sm.DB.Save(&broadcast).Error; err != nil {
+		logger.Log.WithError(err).Error("Failed to update Telegram broadcast completion")
 		return err
 	}
 
@@ -162,8 +161,8 @@ func (s *TelegramBroadcastService) SendTelegramBroadcast(broadcastID uuid.UUID)
 // GetTelegramBroadcastStats gets Telegram broadcast statistics
 func (s *TelegramBroadcastService) GetTelegramBroadcastStats(broadcastID uuid.UUID) (map[string]interface{}, error) {
 	var broadcast models.TelegramBroadcast
-	if err := s.db.DB.Where("id = ?", broadcastID).First(&broadcast).Error; err != nil {
-		logger.Error("Failed to get Telegram broadcast for stats", err)
+	if err := s.sm.DB.Where("id = ?", broadcastID).First(&broadcast).Error; err != nil {
+		logger.Log.WithError(err).Error("Failed to get Telegram broadcast for stats")
 		return nil, err
 	}
 
@@ -188,14 +187,14 @@ func (s *TelegramBroadcastService) GetTelegramBroadcastAnalytics(userID uuid.UUI
 
 	// Total broadcasts
 	var totalBroadcasts int64
-	s.db.DB.Model(&models.TelegramBroadcast{}).
+	s.sm.DB.Model(&models.TelegramBroadcast{}).
 		Where("user_id = ? AND created_at BETWEEN ? AND ?", userID, startDate, endDate).
 		Count(&totalBroadcasts)
 	analytics["total_broadcasts"] = totalBroadcasts
 
 	// Broadcasts by status
 	var statusBreakdown []map[string]interface{}
-	s.db.DB.Model(&models.TelegramBroadcast{}).
+	s.sm.DB.Model(&models.TelegramBroadcast{}).
 		Where("user_id = ? AND created_at BETWEEN ? AND ?", userID, startDate, endDate).
 		Select("status, COUNT(*) as count").
 		Group("status").
@@ -204,7 +203,7 @@ func (s *TelegramBroadcastService) GetTelegramBroadcastAnalytics(userID uuid.UUI
 
 	// Average success rate
 	var avgSuccessRate float64
-	s.db.DB.Model(&models.TelegramBroadcast{}).
+	s.sm.DB.Model(&models.TelegramBroadcast{}).
 		Where("user_id = ? AND status = ? AND created_at BETWEEN ? AND ?", userID, "completed", startDate, endDate).
 		Select("AVG(CASE WHEN total_recipients > 0 THEN (success_count * 100.0 / total_recipients) ELSE 0 END)").
 		Scan(&avgSuccessRate)
@@ -212,7 +211,7 @@ func (s *TelegramBroadcastService) GetTelegramBroadcastAnalytics(userID uuid.UUI
 
 	// Daily breakdown
 	var dailyBreakdown []map[string]interface{}
-	s.db.DB.Model(&models.TelegramBroadcast{}).
+	s.sm.DB.Model(&models.TelegramBroadcast{}).
 		Where("user_id = ? AND created_at BETWEEN ? AND ?", userID, startDate, endDate).
 		Select("DATE(created_at) as date, COUNT(*) as broadcasts, SUM(success_count) as total_success").
 		Group("DATE(created_at)").
@@ -222,7 +221,7 @@ func (s *TelegramBroadcastService) GetTelegramBroadcastAnalytics(userID uuid.UUI
 
 	// Top performing broadcasts
 	var topBroadcasts []models.TelegramBroadcast
-	s.db.DB.Where("user_id = ? AND status = ? AND created_at BETWEEN ? AND ?", userID, "completed", startDate, endDate).
+	s.sm.DB.Where("user_id = ? AND status = ? AND created_at BETWEEN ? AND ?", userID, "completed", startDate, endDate).
 		Order("success_count desc").
 		Limit(10).
 		Find(&topBroadcasts)
@@ -234,17 +233,17 @@ func (s *TelegramBroadcastService) GetTelegramBroadcastAnalytics(userID uuid.UUI
 // ScheduleTelegramBroadcast schedules a Telegram broadcast for future delivery
 func (s *TelegramBroadcastService) ScheduleTelegramBroadcast(broadcastID uuid.UUID, scheduleAt time.Time) error {
 	var broadcast models.TelegramBroadcast
-	if err := s.db.DB.Where("id = ?", broadcastID).First(&broadcast).Error; err != nil {
-		logger.Error("Failed to get Telegram broadcast for scheduling", err)
+	if err := s.sm.DB.Where("id = ?", broadcastID).First(&broadcast).Error; err != nil {
+		logger.Log.WithError(err).Error("Failed to get Telegram broadcast for scheduling")
 		return err
 	}
 
 	// In a real implementation, you would use a job scheduler like cron or a message queue
 	// For now, we'll just log it and return
-	logger.Info("Telegram broadcast scheduled", map[string]interface{}{
+	logger.Log.WithFields(logrus.Fields{
 		"broadcast_id": broadcastID,
 		"schedule_at":  scheduleAt,
-	})
+	}).Info("Telegram broadcast scheduled")
 
 	return nil
 }
@@ -252,8 +251,8 @@ func (s *TelegramBroadcastService) ScheduleTelegramBroadcast(broadcastID uuid.UU
 // CancelTelegramBroadcast cancels a scheduled Telegram broadcast
 func (s *TelegramBroadcastService) CancelTelegramBroadcast(broadcastID uuid.UUID) error {
 	var broadcast models.TelegramBroadcast
-	if err := s.db.DB.Where("id = ?", broadcastID).First(&broadcast).Error; err != nil {
-		logger.Error("Failed to get Telegram broadcast for cancellation", err)
+	if err := s.sm.DB.Where("id = ?", broadcastID).First(&broadcast).Error; err != nil {
+		logger.Log.WithError(err).Error("Failed to get Telegram broadcast for cancellation")
 		return err
 	}
 
@@ -264,8 +263,8 @@ func (s *TelegramBroadcastService) CancelTelegramBroadcast(broadcastID uuid.UUID
 	broadcast.Status = "cancelled"
 	broadcast.UpdatedAt = time.Now()
 
-	if err := s.db.DB.Save(&broadcast).Error; err != nil {
-		logger.Error("Failed to cancel Telegram broadcast", err)
+	if err := s.sm.DB.Save(&broadcast).Error; err != nil {
+		logger.Log.WithError(err).Error("Failed to cancel Telegram broadcast")
 		return err
 	}
 
@@ -275,8 +274,8 @@ func (s *TelegramBroadcastService) CancelTelegramBroadcast(broadcastID uuid.UUID
 // DuplicateTelegramBroadcast duplicates an existing broadcast
 func (s *TelegramBroadcastService) DuplicateTelegramBroadcast(broadcastID uuid.UUID, userID uuid.UUID) (*models.TelegramBroadcast, error) {
 	var original models.TelegramBroadcast
-	if err := s.db.DB.Where("id = ?", broadcastID).First(&original).Error; err != nil {
-		logger.Error("Failed to get original Telegram broadcast", err)
+	if err := s.sm.DB.Where("id = ?", broadcastID).First(&original).Error; err != nil {
+		logger.Log.WithError(err).Error("Failed to get original Telegram broadcast")
 		return nil, err
 	}
 
@@ -286,14 +285,15 @@ func (s *TelegramBroadcastService) DuplicateTelegramBroadcast(broadcastID uuid.U
 		Name:       original.Name + " (Copy)",
 		Message:    original.Message,
 		Recipients: original.Recipients,
+		BotID:      original.BotID,
 		Status:     "pending",
 		UserID:     userID,
 		CreatedAt:  time.Now(),
 		UpdatedAt:  time.Now(),
 	}
 
-	if err := s.db.DB.Create(newBroadcast).Error; err != nil {
-		logger.Error("Failed to duplicate Telegram broadcast", err)
+	if err := s.sm.DB.Create(newBroadcast).Error; err != nil {
+		logger.Log.WithError(err).Error("Failed to duplicate Telegram broadcast")
 		return nil, err
 	}
 
@@ -305,11 +305,11 @@ func (s *TelegramBroadcastService) GetTelegramBroadcastTemplates(userID uuid.UUI
 	var templates []models.TelegramBroadcast
 	
 	// Get broadcasts that can be used as templates (completed broadcasts)
-	if err := s.db.DB.Where("user_id = ? AND status = ?", userID, "completed").
+	if err := s.sm.DB.Where("user_id = ? AND status = ?", userID, "completed").
 		Order("created_at desc").
 		Limit(20).
 		Find(&templates).Error; err != nil {
-		logger.Error("Failed to get Telegram broadcast templates", err)
+		logger.Log.WithError(err).Error("Failed to get Telegram broadcast templates")
 		return nil, err
 	}
 
@@ -349,8 +349,8 @@ func (s *TelegramBroadcastService) PreviewTelegramBroadcast(message string, reci
 // ExportTelegramBroadcastRecipients exports recipients list
 func (s *TelegramBroadcastService) ExportTelegramBroadcastRecipients(broadcastID uuid.UUID) ([]int64, error) {
 	var broadcast models.TelegramBroadcast
-	if err := s.db.DB.Where("id = ?", broadcastID).First(&broadcast).Error; err != nil {
-		logger.Error("Failed to get Telegram broadcast for export", err)
+	if err := s.sm.DB.Where("id = ?", broadcastID).First(&broadcast).Error; err != nil {
+		logger.Log.WithError(err).Error("Failed to get Telegram broadcast for export")
 		return nil, err
 	}
 
@@ -360,24 +360,24 @@ func (s *TelegramBroadcastService) ExportTelegramBroadcastRecipients(broadcastID
 // ImportTelegramBroadcastRecipients imports recipients from file
 func (s *TelegramBroadcastService) ImportTelegramBroadcastRecipients(broadcastID uuid.UUID, recipients []int64) error {
 	var broadcast models.TelegramBroadcast
-	if err := s.db.DB.Where("id = ?", broadcastID).First(&broadcast).Error; err != nil {
-		logger.Error("Failed to get Telegram broadcast for import", err)
+	if err := s.sm.DB.Where("id = ?", broadcastID).First(&broadcast).Error; err != nil {
+		logger.Log.WithError(err).Error("Failed to get Telegram broadcast for import")
 		return err
 	}
 
 	// Validate recipients
 	validRecipients, errors := s.ValidateRecipients(recipients)
 	if len(errors) > 0 {
-		logger.Warn("Some recipients are invalid", map[string]interface{}{
+		logger.Log.WithFields(logrus.Fields{
 			"errors": errors,
-		})
+		}).Warn("Some recipients are invalid")
 	}
 
 	broadcast.Recipients = validRecipients
 	broadcast.UpdatedAt = time.Now()
 
-	if err := s.db.DB.Save(&broadcast).Error; err != nil {
-		logger.Error("Failed to update Telegram broadcast recipients", err)
+	if err := s.sm.DB.Save(&broadcast).Error; err != nil {
+		logger.Log.WithError(err).Error("Failed to update Telegram broadcast recipients")
 		return err
 	}
 
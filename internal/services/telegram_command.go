@@ -0,0 +1,577 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"whatsapp-bot/internal/models"
+	"whatsapp-bot/pkg/logger"
+	"whatsapp-bot/pkg/telegram"
+
+	"github.com/google/uuid"
+	"github.com/jinzhu/gorm"
+	"github.com/sirupsen/logrus"
+)
+
+var (
+	ErrTelegramCommandNotFound = errors.New("Telegram command not found")
+	ErrTelegramCommandExists   = errors.New("Telegram command already exists for this scope and language")
+	ErrInvalidTelegramCommand  = errors.New("invalid Telegram command")
+)
+
+// Scopes of a models.TelegramCommand
+const (
+	CommandScopeAll     = "all"
+	CommandScopePrivate = "private"
+	CommandScopeGroup   = "group"
+	CommandScopeAdmin   = "admin"
+)
+
+const (
+	// telegramCommandsSyncedKey remembers which scope and language lists
+	// were published, so lists for removed languages can be deleted. Hosted
+	// bots append their ID.
+	telegramCommandsSyncedKey = "telegram:commands:synced"
+	maxBotCommands            = 100
+	maxCommandDescription     = 256
+)
+
+// telegramCommandScopes pairs each stored scope with its Bot API scope.
+// Telegram only shows the most specific list that exists, so every list
+// also carries the commands of the broader scopes (see commandInScope).
+var telegramCommandScopes = []struct{ scope, apiScope string }{
+	{CommandScopeAll, telegram.CommandScopeDefault},
+	{CommandScopePrivate, telegram.CommandScopeAllPrivateChats},
+	{CommandScopeGroup, telegram.CommandScopeAllGroupChats},
+	{CommandScopeAdmin, telegram.CommandScopeAllChatAdministrators},
+}
+
+var (
+	telegramCommandPattern  = regexp.MustCompile(`^[a-z0-9_]{1,32}$`)
+	telegramLanguagePattern = regexp.MustCompile(`^[a-z]{2}$`)
+)
+
+// TelegramCommandHandler runs a built-in command. args is the text after
+// the command.
+type TelegramCommandHandler func(contact *models.Contact, message *telegram.Message, args string) error
+
+type telegramBuiltinCommand struct {
+	command     string
+	description string
+	scope       string
+	handler     TelegramCommandHandler // nil leaves the command to the regular message handlers
+}
+
+func (s *TelegramService) registerBuiltinCommands() {
+	s.RegisterCommand("start", "Mulai dan tampilkan menu", CommandScopePrivate, nil)
+	s.RegisterCommand("menu", "Tampilkan menu utama", CommandScopeAll, nil)
+	s.RegisterCommand("commands", "Daftar perintah bot", CommandScopeAll, s.listCommands)
+	s.RegisterCommand("settings", "Atur notifikasi dan jam tenang", CommandScopePrivate, nil)
+	s.RegisterCommand("mod", "Pengaturan moderasi grup", CommandScopeAdmin, nil)
+}
+
+// RegisterCommand adds a built-in command to the "/" menu. A nil handler
+// only describes the command; the message then goes through the regular
+// command handlers. A stored command with a response takes precedence.
+// Call SyncCommands afterwards to publish the change.
+func (s *TelegramService) RegisterCommand(command, description, scope string, handler TelegramCommandHandler) {
+	s.commandsMu.Lock()
+	defer s.commandsMu.Unlock()
+
+	builtin := telegramBuiltinCommand{command: command, description: description, scope: scope, handler: handler}
+	for i := range s.builtinCommands {
+		if s.builtinCommands[i].command == command {
+			s.builtinCommands[i] = builtin
+			return
+		}
+	}
+	s.builtinCommands = append(s.builtinCommands, builtin)
+}
+
+// SyncCommands publishes the built-in and stored commands to Telegram's "/"
+// menu, one list per scope and language. Lists published by an earlier sync
+// for languages no longer in use are deleted.
+func (s *TelegramService) SyncCommands() error {
+	query, err := s.activeCommands()
+	if err != nil {
+		return err
+	}
+	var stored []models.TelegramCommand
+	if err := query.Order("command").Find(&stored).Error; err != nil {
+		logger.Log.WithError(err).Error("Failed to get Telegram commands")
+		return err
+	}
+
+	languages := []string{""}
+	seen := map[string]bool{"": true}
+	for _, command := range stored {
+		if !seen[command.LanguageCode] {
+			seen[command.LanguageCode] = true
+			languages = append(languages, command.LanguageCode)
+		}
+	}
+
+	ctx := s.sm.Redis.Context()
+	syncedKey := telegramCommandsSyncedKey
+	if s.bot != nil {
+		syncedKey += ":" + s.bot.ID.String()
+	}
+	previous, _ := s.sm.Redis.SMembers(ctx, syncedKey).Result()
+
+	var firstErr error
+	var synced []interface{}
+	published := map[string]bool{}
+	for _, language := range languages {
+		for _, scope := range telegramCommandScopes {
+			commands := s.commandList(scope.scope, language, stored)
+			fields := logrus.Fields{"scope": scope.scope, "language": language}
+
+			var err error
+			if len(commands) == 0 {
+				err = s.client.DeleteMyCommands(scope.apiScope, language)
+			} else {
+				if len(commands) > maxBotCommands {
+					logger.Log.WithFields(fields).Warnf("Only the first %d of %d Telegram commands are shown", maxBotCommands, len(commands))
+					commands = commands[:maxBotCommands]
+				}
+				err = s.client.SetMyCommands(commands, scope.apiScope, language)
+				key := scope.apiScope + ":" + language
+				published[key] = true
+				synced = append(synced, key)
+			}
+			if err != nil {
+				logger.Log.WithError(err).WithFields(fields).Error("Failed to sync Telegram commands")
+				if firstErr == nil {
+					firstErr = err
+				}
+			}
+		}
+	}
+
+	for _, key := range previous {
+		if published[key] {
+			continue
+		}
+		parts := strings.SplitN(key, ":", 2)
+		if len(parts) != 2 {
+			continue
+		}
+		if err := s.client.DeleteMyCommands(parts[0], parts[1]); err != nil {
+			logger.Log.WithError(err).WithField("list", key).Error("Failed to delete Telegram command list")
+		}
+	}
+
+	pipe := s.sm.Redis.TxPipeline()
+	pipe.Del(ctx, syncedKey)
+	if len(synced) > 0 {
+		pipe.SAdd(ctx, syncedKey, synced...)
+	}
+	if _, err := pipe.Exec(ctx); err != nil {
+		logger.Log.WithError(err).Error("Failed to record synced Telegram commands")
+	}
+
+	return firstErr
+}
+
+// activeCommands limits a query to the active stored commands of this bot
+// and its owner.
+func (s *TelegramService) activeCommands() (*gorm.DB, error) {
+	ownerID, err := s.ownerID()
+	if err != nil {
+		return nil, err
+	}
+	query := s.sm.DB.Where("is_active = ? AND user_id = ?", true, ownerID)
+	return whereBot(query, "bot_id", s.BotID()), nil
+}
+
+// commandList builds the "/" menu for a scope and language: built-in
+// commands, then stored commands for every language, then stored commands
+// for the language itself. Later entries override the description of an
+// earlier command with the same name.
+func (s *TelegramService) commandList(scope, language string, stored []models.TelegramCommand) []telegram.BotCommand {
+	var list []telegram.BotCommand
+	index := map[string]int{}
+	add := func(command, description string) {
+		if i, ok := index[command]; ok {
+			list[i].Description = description
+			return
+		}
+		index[command] = len(list)
+		list = append(list, telegram.BotCommand{Command: command, Description: description})
+	}
+
+	s.commandsMu.RLock()
+	for _, builtin := range s.builtinCommands {
+		if commandInScope(scope, builtin.scope) {
+			add(builtin.command, builtin.description)
+		}
+	}
+	s.commandsMu.RUnlock()
+
+	languages := []string{""}
+	if language != "" {
+		languages = append(languages, language)
+	}
+	for _, lang := range languages {
+		for _, command := range stored {
+			if command.LanguageCode == lang && commandInScope(scope, command.Scope) {
+				add(command.Command, command.Description)
+			}
+		}
+	}
+
+	return list
+}
+
+// commandInScope reports whether a command of commandScope belongs in the
+// list for scope. Admins are always in a group, so they get group commands.
+func commandInScope(scope, commandScope string) bool {
+	switch commandScope {
+	case CommandScopeAll:
+		return true
+	case CommandScopeGroup:
+		return scope == CommandScopeGroup || scope == CommandScopeAdmin
+	}
+	return scope == commandScope
+}
+
+// dispatchCommand answers "/command@bot args" with a stored response or a
+// built-in handler. It reports false for commands it doesn't serve, which
+// then go through the regular message handlers.
+func (s *TelegramService) dispatchCommand(contact *models.Contact, message *telegram.Message) (bool, error) {
+	command, bot, args, ok := parseTelegramCommand(message.Text)
+	if !ok {
+		return false, nil
+	}
+
+	// Commands addressed to another bot in the same group are not ours
+	if bot != "" {
+		if username := s.username(); username != "" && !strings.EqualFold(bot, username) {
+			return true, nil
+		}
+	}
+
+	scope := s.chatCommandScope(message)
+	language := telegramLanguage(message.From)
+
+	stored, err := s.findCommand(command, scope, language)
+	if err != nil {
+		logger.Log.WithError(err).WithField("command", command).Error("Failed to find Telegram command")
+	}
+	if stored != nil && stored.Response != "" {
+		s.logCommand(contact, command)
+		return true, s.SendMessage(contact.TelegramChatID, renderCommandResponse(stored.Response, message.From, args))
+	}
+
+	builtin := s.builtinCommand(command)
+	if builtin == nil || builtin.handler == nil || !commandInScope(scope, builtin.scope) {
+		return false, nil
+	}
+	s.logCommand(contact, command)
+	return true, builtin.handler(contact, message, args)
+}
+
+// findCommand returns the active stored command best matching the chat:
+// one in the user's language before one for every language, and the
+// narrowest scope first. It returns nil if there is none.
+func (s *TelegramService) findCommand(command, scope, language string) (*models.TelegramCommand, error) {
+	query, err := s.activeCommands()
+	if err != nil {
+		return nil, err
+	}
+	var candidates []models.TelegramCommand
+	if err := query.Where("command = ? AND language_code IN (?)", command, []string{"", language}).
+		Find(&candidates).Error; err != nil {
+		return nil, err
+	}
+
+	var best *models.TelegramCommand
+	bestScore := -1
+	for i := range candidates {
+		candidate := &candidates[i]
+		if !commandInScope(scope, candidate.Scope) {
+			continue
+		}
+		score := commandScopeRank(candidate.Scope)
+		if candidate.LanguageCode != "" {
+			score += 10
+		}
+		if score > bestScore {
+			best, bestScore = candidate, score
+		}
+	}
+	return best, nil
+}
+
+func commandScopeRank(scope string) int {
+	switch scope {
+	case CommandScopePrivate, CommandScopeGroup:
+		return 1
+	case CommandScopeAdmin:
+		return 2
+	}
+	return 0
+}
+
+// chatCommandScope returns the scope of the "/" menu the sender sees.
+func (s *TelegramService) chatCommandScope(message *telegram.Message) string {
+	if !isGroupChat(message.Chat) {
+		return CommandScopePrivate
+	}
+	if message.From != nil && s.isGroupAdmin(message.GetChatID(), message.From.ID) {
+		return CommandScopeAdmin
+	}
+	return CommandScopeGroup
+}
+
+func (s *TelegramService) builtinCommand(command string) *telegramBuiltinCommand {
+	s.commandsMu.RLock()
+	defer s.commandsMu.RUnlock()
+
+	for i := range s.builtinCommands {
+		if s.builtinCommands[i].command == command {
+			builtin := s.builtinCommands[i]
+			return &builtin
+		}
+	}
+	return nil
+}
+
+// username returns the bot's username, fetched once. It returns an empty
+// string if the bot can't be reached.
+func (s *TelegramService) username() string {
+	s.commandsMu.RLock()
+	username := s.botUsername
+	s.commandsMu.RUnlock()
+	if username != "" {
+		return username
+	}
+
+	me, err := s.client.GetMe()
+	if err != nil {
+		logger.Log.WithError(err).Error("Failed to get Telegram bot info")
+		return ""
+	}
+
+	s.commandsMu.Lock()
+	s.botUsername = me.Username
+	s.commandsMu.Unlock()
+	return me.Username
+}
+
+func (s *TelegramService) logCommand(contact *models.Contact, command string) {
+	s.sm.AnalyticsService.LogEvent(contact.UserID, "telegram_command", 1, map[string]interface{}{
+		"command":    command,
+		"contact_id": contact.ID,
+		"bot_id":     s.BotID(),
+		"platform":   PlatformTelegram,
+	})
+}
+
+// listCommands answers /commands with the menu the sender sees.
+func (s *TelegramService) listCommands(contact *models.Contact, message *telegram.Message, args string) error {
+	query, err := s.activeCommands()
+	if err != nil {
+		return err
+	}
+	var stored []models.TelegramCommand
+	if err := query.Order("command").Find(&stored).Error; err != nil {
+		return err
+	}
+
+	commands := s.commandList(s.chatCommandScope(message), telegramLanguage(message.From), stored)
+
+	var b strings.Builder
+	b.WriteString("📋 DAFTAR PERINTAH 📋\n")
+	for _, command := range commands {
+		fmt.Fprintf(&b, "\n/%s - %s", command.Command, command.Description)
+	}
+	return s.SendMessage(contact.TelegramChatID, b.String())
+}
+
+// parseTelegramCommand splits "/command@bot args" into its parts. The
+// command is lowercased; bot is empty when the command isn't addressed.
+func parseTelegramCommand(text string) (command, bot, args string, ok bool) {
+	if !strings.HasPrefix(text, "/") {
+		return "", "", "", false
+	}
+
+	head := text[1:]
+	if i := strings.IndexAny(head, " \n"); i >= 0 {
+		head, args = head[:i], strings.TrimSpace(head[i+1:])
+	}
+	command = strings.ToLower(head)
+	if i := strings.Index(command, "@"); i >= 0 {
+		command, bot = command[:i], command[i+1:]
+	}
+	return command, bot, args, command != ""
+}
+
+// telegramLanguage returns the two-letter language of a user, as used for
+// command lists ("pt-br" becomes "pt").
+func telegramLanguage(user *telegram.User) string {
+	if user == nil {
+		return ""
+	}
+	language := strings.ToLower(user.LanguageCode)
+	if i := strings.Index(language, "-"); i >= 0 {
+		language = language[:i]
+	}
+	return language
+}
+
+func renderCommandResponse(response string, from *telegram.User, args string) string {
+	name := ""
+	if from != nil {
+		name = from.FirstName
+	}
+	return strings.NewReplacer("{name}", name, "{args}", args).Replace(response)
+}
+
+// GetTelegramCommands lists the user's stored commands of all bots.
+func (s *TelegramService) GetTelegramCommands(userID uuid.UUID) ([]models.TelegramCommand, error) {
+	var commands []models.TelegramCommand
+	if err := s.sm.DB.Where("user_id = ?", userID).Order("command, scope, language_code").Find(&commands).Error; err != nil {
+		logger.Log.WithError(err).Error("Failed to get Telegram commands")
+		return nil, err
+	}
+	return commands, nil
+}
+
+func (s *TelegramService) GetTelegramCommand(userID, id uuid.UUID) (*models.TelegramCommand, error) {
+	command := &models.TelegramCommand{}
+	if err := s.sm.DB.Where("id = ? AND user_id = ?", id, userID).First(command).Error; err != nil {
+		if gorm.IsRecordNotFoundError(err) {
+			return nil, ErrTelegramCommandNotFound
+		}
+		return nil, err
+	}
+	return command, nil
+}
+
+// SaveTelegramCommand validates and stores a new or changed command, then
+// republishes the "/" menu. The command's bot must belong to its user. A
+// failed sync is logged; the command is still served and the next sync
+// publishes it.
+func (s *TelegramService) SaveTelegramCommand(command *models.TelegramCommand) error {
+	if err := normalizeTelegramCommandModel(command); err != nil {
+		return err
+	}
+	if err := s.CheckBotOwner(command.UserID, command.BotID); err != nil {
+		return err
+	}
+
+	var count int
+	query := whereBot(s.sm.DB.Model(&models.TelegramCommand{}), "bot_id", command.BotID).
+		Where("user_id = ? AND command = ? AND scope = ? AND language_code = ?", command.UserID, command.Command, command.Scope, command.LanguageCode)
+	if command.ID != uuid.Nil {
+		query = query.Where("id <> ?", command.ID)
+	}
+	if err := query.Count(&count).Error; err != nil {
+		return err
+	}
+	if count > 0 {
+		return ErrTelegramCommandExists
+	}
+
+	command.UpdatedAt = time.Now()
+	if command.ID == uuid.Nil {
+		command.ID = uuid.New()
+		command.CreatedAt = command.UpdatedAt
+	}
+	if err := s.sm.DB.Save(command).Error; err != nil {
+		logger.Log.WithError(err).Error("Failed to save Telegram command")
+		return err
+	}
+
+	s.syncCommandsAfterChange(command.BotID)
+	return nil
+}
+
+func (s *TelegramService) DeleteTelegramCommand(userID, id uuid.UUID) error {
+	command, err := s.GetTelegramCommand(userID, id)
+	if err != nil {
+		return err
+	}
+
+	result := s.sm.DB.Where("id = ? AND user_id = ?", id, userID).Delete(&models.TelegramCommand{})
+	if result.Error != nil {
+		logger.Log.WithError(result.Error).Error("Failed to delete Telegram command")
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return ErrTelegramCommandNotFound
+	}
+
+	s.syncCommandsAfterChange(command.BotID)
+	return nil
+}
+
+// CheckBotOwner returns ErrTelegramBotNotFound unless the user owns the bot.
+// The configured bot belongs to the first admin.
+func (s *TelegramService) CheckBotOwner(userID uuid.UUID, botID *uuid.UUID) error {
+	if botID != nil {
+		_, err := s.sm.TelegramBotService.getUserBot(userID, *botID)
+		return err
+	}
+
+	ownerID, err := s.sm.ContactService.defaultOwnerID()
+	if err != nil {
+		return err
+	}
+	if ownerID != userID {
+		return ErrTelegramBotNotFound
+	}
+	return nil
+}
+
+// SyncAllCommands publishes the command menu of every running bot.
+func (s *TelegramService) SyncAllCommands() error {
+	return s.sm.TelegramBotService.SyncCommands()
+}
+
+// syncCommandsAfterChange republishes the menu of the bot whose commands
+// changed. A bot that isn't running publishes its menu when it starts.
+func (s *TelegramService) syncCommandsAfterChange(botID *uuid.UUID) {
+	if botID == nil && s.sm.Config.Telegram.BotToken == "" {
+		return
+	}
+	if botID != nil && s.sm.TelegramBotService.Bot(*botID) == nil {
+		return
+	}
+
+	if err := s.ForBot(botID).SyncCommands(); err != nil {
+		logger.Log.WithError(err).Warn("Telegram commands saved but not synced")
+	}
+}
+
+// normalizeTelegramCommandModel cleans up a command as entered ("/Help"
+// becomes "help") and checks it against Telegram's limits.
+func normalizeTelegramCommandModel(command *models.TelegramCommand) error {
+	command.Command = strings.ToLower(strings.TrimPrefix(strings.TrimSpace(command.Command), "/"))
+	command.Description = strings.TrimSpace(command.Description)
+	command.LanguageCode = strings.ToLower(strings.TrimSpace(command.LanguageCode))
+	if command.Scope == "" {
+		command.Scope = CommandScopeAll
+	}
+
+	if !telegramCommandPattern.MatchString(command.Command) {
+		return fmt.Errorf("%w: command must be 1-32 lowercase letters, digits or underscores", ErrInvalidTelegramCommand)
+	}
+	if command.Description == "" || utf8.RuneCountInString(command.Description) > maxCommandDescription {
+		return fmt.Errorf("%w: description must be 1-%d characters", ErrInvalidTelegramCommand, maxCommandDescription)
+	}
+	if command.LanguageCode != "" && !telegramLanguagePattern.MatchString(command.LanguageCode) {
+		return fmt.Errorf("%w: language code must be a two-letter ISO 639-1 code", ErrInvalidTelegramCommand)
+	}
+	switch command.Scope {
+	case CommandScopeAll, CommandScopePrivate, CommandScopeGroup, CommandScopeAdmin:
+	default:
+		return fmt.Errorf("%w: scope must be all, private, group or admin", ErrInvalidTelegramCommand)
+	}
+	return nil
+}
@@ -0,0 +1,52 @@
+package services
+
+import (
+	"testing"
+
+	"whatsapp-bot/pkg/telegram"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseTelegramCommand(t *testing.T) {
+	testCases := []struct {
+		text    string
+		command string
+		bot     string
+		args    string
+		ok      bool
+	}{
+		{text: "/start", command: "start", ok: true},
+		{text: "/Help", command: "help", ok: true},
+		{text: "/order 2 kopi", command: "order", args: "2 kopi", ok: true},
+		{text: "/order@ShopBot  2 kopi ", command: "order", bot: "shopbot", args: "2 kopi", ok: true},
+		{text: "/start@ShopBot", command: "start", bot: "shopbot", ok: true},
+		{text: "/note\nline one\nline two", command: "note", args: "line one\nline two", ok: true},
+		{text: "/promo Kode DISKON", command: "promo", args: "Kode DISKON", ok: true},
+		{text: "/", ok: false},
+		{text: "/@ShopBot", bot: "shopbot", ok: false},
+		{text: "start", ok: false},
+		{text: " /start", ok: false},
+		{text: "", ok: false},
+	}
+
+	for _, tc := range testCases {
+		command, bot, args, ok := parseTelegramCommand(tc.text)
+		assert.Equal(t, tc.ok, ok, "text %q", tc.text)
+		assert.Equal(t, tc.command, command, "text %q", tc.text)
+		assert.Equal(t, tc.bot, bot, "text %q", tc.text)
+		assert.Equal(t, tc.args, args, "text %q", tc.text)
+	}
+}
+
+func TestTelegramLanguage(t *testing.T) {
+	assert.Equal(t, "", telegramLanguage(nil))
+	assert.Equal(t, "id", telegramLanguage(&telegram.User{LanguageCode: "id"}))
+	assert.Equal(t, "pt", telegramLanguage(&telegram.User{LanguageCode: "pt-BR"}))
+}
+
+func TestRenderCommandResponse(t *testing.T) {
+	from := &telegram.User{FirstName: "Budi"}
+	assert.Equal(t, "Halo Budi, kamu cari kopi?", renderCommandResponse("Halo {name}, kamu cari {args}?", from, "kopi"))
+	assert.Equal(t, "Halo !", renderCommandResponse("Halo {name}!", nil, ""))
+}
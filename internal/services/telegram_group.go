@@ -0,0 +1,430 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"whatsapp-bot/internal/models"
+	"whatsapp-bot/pkg/logger"
+	"whatsapp-bot/pkg/telegram"
+
+	"github.com/google/uuid"
+	"github.com/jinzhu/gorm"
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	telegramWarningKeyPrefix = "telegram:warnings:"
+	telegramAdminKeyPrefix   = "telegram:admin:"
+	telegramWarningTTL       = 24 * time.Hour
+	telegramAdminTTL         = 10 * time.Minute
+
+	defaultWelcomeMessage = "👋 Selamat datang di {group}, {name}!"
+)
+
+var ErrTelegramGroupNotFound = errors.New("Telegram group not found")
+
+var violationReasons = map[string]string{
+	ViolationBlockedWords: "mengandung kata yang dilarang",
+	ViolationFlood:        "terlalu banyak pesan dalam waktu singkat",
+	ViolationLink:         "mengandung link yang tidak diizinkan",
+}
+
+func isGroupChat(chat *telegram.Chat) bool {
+	return chat != nil && (chat.Type == "group" || chat.Type == "supergroup")
+}
+
+// handleGroupMessage handles member changes, /mod commands and moderation
+// in groups. It reports whether the message was consumed; other group
+// messages go through the normal command handlers.
+func (s *TelegramService) handleGroupMessage(message *telegram.Message) (bool, error) {
+	group, err := s.findOrCreateGroup(message.Chat)
+	if err != nil {
+		logger.Log.WithError(err).WithField("chat_id", message.Chat.ID).Error("Failed to find Telegram group")
+		return false, err
+	}
+
+	switch {
+	case len(message.NewChatMembers) > 0:
+		return true, s.welcomeMembers(group, message.NewChatMembers)
+	case message.LeftChatMember != nil:
+		return true, s.sm.DB.Model(group).UpdateColumn("member_count", gorm.Expr("GREATEST(member_count - 1, 0)")).Error
+	}
+
+	if message.From == nil {
+		return false, nil
+	}
+
+	fields := strings.Fields(normalizeTelegramCommand(message.Text))
+	if strings.HasPrefix(message.Text, "/") && len(fields) > 0 && strings.ToLower(fields[0]) == "mod" {
+		return true, s.processModCommand(group, message, fields[1:])
+	}
+
+	// Admins are never moderated
+	if !group.ModerationEnabled || s.isGroupAdmin(group.ChatID, message.From.ID) {
+		return false, nil
+	}
+
+	ownerID, err := s.ownerID()
+	if err != nil {
+		return false, err
+	}
+
+	content := message.Text
+	if content == "" {
+		content = message.Caption
+	}
+	violation := s.sm.ModerationService.CheckTelegramGroupMessage(group, ownerID, message.From.ID, content)
+	if violation == "" {
+		return false, nil
+	}
+
+	return true, s.enforceViolation(group, ownerID, message, violation)
+}
+
+// enforceViolation deletes the message and escalates: members are warned,
+// muted once they reach the group's warning limit and banned at twice the
+// limit. Flooding mutes straight away.
+func (s *TelegramService) enforceViolation(group *models.TelegramGroup, ownerID uuid.UUID, message *telegram.Message, violation string) error {
+	member := message.From
+	if err := s.client.DeleteMessage(group.ChatID, message.MessageID); err != nil {
+		logger.Log.WithError(err).WithField("chat_id", group.ChatID).Error("Failed to delete Telegram group message")
+	}
+
+	warnings := s.addWarning(group.ChatID, member.ID)
+	name := telegramDisplayName(member)
+	reason := violationReasons[violation]
+
+	var action, notice string
+	var err error
+	switch {
+	case group.MaxWarnings > 0 && warnings >= 2*group.MaxWarnings:
+		action = "ban"
+		err = s.client.BanChatMember(group.ChatID, member.ID, time.Time{})
+		s.resetWarnings(group.ChatID, member.ID)
+		notice = fmt.Sprintf("⛔ %s dikeluarkan dari grup karena terus melanggar aturan.", name)
+	case violation == ViolationFlood || (group.MaxWarnings > 0 && warnings >= group.MaxWarnings):
+		action = "mute"
+		err = s.muteMember(group, member.ID, group.MuteMinutes)
+		notice = fmt.Sprintf("🔇 %s dibisukan %d menit karena pesannya %s.", name, group.MuteMinutes, reason)
+	default:
+		action = "warn"
+		notice = fmt.Sprintf("⚠️ %s, pesanmu dihapus karena %s. Peringatan %d/%d.", name, reason, warnings, group.MaxWarnings)
+	}
+	if err != nil {
+		logger.Log.WithError(err).WithFields(logrus.Fields{"chat_id": group.ChatID, "action": action}).Error("Failed to enforce Telegram group moderation")
+	}
+
+	s.sm.ModerationService.LogTelegramGroupIncident(ownerID, group.ChatID, member.ID, violation, action, message.Text)
+
+	return s.SendMessage(group.ChatID, notice)
+}
+
+// processModCommand runs an admin-only /mod command. Member actions apply
+// to the author of the replied-to message.
+func (s *TelegramService) processModCommand(group *models.TelegramGroup, message *telegram.Message, args []string) error {
+	if !s.isGroupAdmin(group.ChatID, message.From.ID) {
+		return s.SendMessage(group.ChatID, "❌ Perintah /mod hanya untuk admin grup.")
+	}
+
+	if len(args) == 0 {
+		return s.SendMessage(group.ChatID, formatGroupSettings(group))
+	}
+
+	command := strings.ToLower(args[0])
+	switch command {
+	case "on", "off":
+		return s.updateGroupSetting(group, "moderation_enabled", command == "on", "✅ Moderasi "+onOff(command == "on")+".")
+	case "links":
+		if len(args) != 2 || (args[1] != "on" && args[1] != "off") {
+			break
+		}
+		return s.updateGroupSetting(group, "block_links", args[1] == "on", "✅ Blokir semua link "+onOff(args[1] == "on")+".")
+	case "flood", "warnings", "mutetime":
+		if len(args) != 2 {
+			break
+		}
+		n, err := strconv.Atoi(args[1])
+		if err != nil || n < 0 || n > 1440 {
+			break
+		}
+		column := map[string]string{"flood": "flood_limit", "warnings": "max_warnings", "mutetime": "mute_minutes"}[command]
+		return s.updateGroupSetting(group, column, n, fmt.Sprintf("✅ %s diatur ke %d.", command, n))
+	case "welcome":
+		if len(args) == 2 && (args[1] == "on" || args[1] == "off") {
+			return s.updateGroupSetting(group, "welcome_enabled", args[1] == "on", "✅ Pesan sambutan "+onOff(args[1] == "on")+".")
+		}
+		if len(args) > 1 {
+			// Keep the admin's formatting rather than the split fields
+			text := strings.TrimSpace(message.Text[strings.Index(strings.ToLower(message.Text), "welcome")+len("welcome"):])
+			return s.updateGroupSetting(group, "welcome_message", text, "✅ Pesan sambutan disimpan.")
+		}
+	case "warn", "mute", "unmute", "ban", "unban", "del":
+		return s.moderateMember(group, message, command, args[1:])
+	}
+
+	return s.SendMessage(group.ChatID, modHelp)
+}
+
+// moderateMember applies a manual action to the author of the message the
+// admin replied to.
+func (s *TelegramService) moderateMember(group *models.TelegramGroup, message *telegram.Message, command string, args []string) error {
+	target := message.ReplyToMessage
+	if target == nil || target.From == nil {
+		return s.SendMessage(group.ChatID, "❌ Balas pesan anggota yang ingin ditindak.")
+	}
+
+	member := target.From
+	name := telegramDisplayName(member)
+
+	var err error
+	var notice string
+	switch command {
+	case "warn":
+		warnings := s.addWarning(group.ChatID, member.ID)
+		notice = fmt.Sprintf("⚠️ %s mendapat peringatan %d/%d.", name, warnings, group.MaxWarnings)
+	case "mute":
+		minutes := group.MuteMinutes
+		if len(args) > 0 {
+			if n, convErr := strconv.Atoi(args[0]); convErr == nil && n > 0 {
+				minutes = n
+			}
+		}
+		err = s.muteMember(group, member.ID, minutes)
+		notice = fmt.Sprintf("🔇 %s dibisukan %d menit.", name, minutes)
+	case "unmute":
+		err = s.client.RestrictChatMember(group.ChatID, member.ID, telegram.ChatPermissions{
+			CanSendMessages:       true,
+			CanSendMediaMessages:  true,
+			CanSendPolls:          true,
+			CanSendOtherMessages:  true,
+			CanAddWebPagePreviews: true,
+		}, time.Time{})
+		s.resetWarnings(group.ChatID, member.ID)
+		notice = fmt.Sprintf("🔊 %s bisa mengirim pesan lagi.", name)
+	case "ban":
+		err = s.client.BanChatMember(group.ChatID, member.ID, time.Time{})
+		notice = fmt.Sprintf("⛔ %s dikeluarkan dari grup.", name)
+	case "unban":
+		err = s.client.UnbanChatMember(group.ChatID, member.ID)
+		s.resetWarnings(group.ChatID, member.ID)
+		notice = fmt.Sprintf("✅ %s boleh bergabung lagi.", name)
+	case "del":
+		err = s.client.DeleteMessage(group.ChatID, target.MessageID)
+		if err == nil {
+			return s.client.DeleteMessage(group.ChatID, message.MessageID)
+		}
+	}
+	if err != nil {
+		logger.Log.WithError(err).WithFields(logrus.Fields{"chat_id": group.ChatID, "action": command}).Error("Failed to run /mod command")
+		return s.SendMessage(group.ChatID, "❌ Gagal. Pastikan bot adalah admin grup dengan izin yang cukup.")
+	}
+
+	return s.SendMessage(group.ChatID, notice)
+}
+
+func (s *TelegramService) muteMember(group *models.TelegramGroup, memberID int64, minutes int) error {
+	// Telegram treats restrictions shorter than 30 seconds as permanent
+	until := time.Now().Add(time.Duration(minutes) * time.Minute)
+	if minutes <= 0 {
+		until = time.Now().Add(time.Minute)
+	}
+	return s.client.RestrictChatMember(group.ChatID, memberID, telegram.ChatPermissions{}, until)
+}
+
+func (s *TelegramService) welcomeMembers(group *models.TelegramGroup, members []telegram.User) error {
+	s.sm.DB.Model(group).UpdateColumn("member_count", gorm.Expr("member_count + ?", len(members)))
+
+	if !group.WelcomeEnabled {
+		return nil
+	}
+
+	template := group.WelcomeMessage
+	if template == "" {
+		template = defaultWelcomeMessage
+	}
+
+	for i := range members {
+		if members[i].IsBot {
+			continue
+		}
+		text := strings.NewReplacer("{name}", telegramDisplayName(&members[i]), "{group}", group.Title).Replace(template)
+		if err := s.SendMessage(group.ChatID, text); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// handleMyChatMember tracks the groups the bot is added to or removed from.
+func (s *TelegramService) handleMyChatMember(update *telegram.ChatMemberUpdated) error {
+	if !isGroupChat(&update.Chat) {
+		return nil
+	}
+
+	group, err := s.findOrCreateGroup(&update.Chat)
+	if err != nil {
+		return err
+	}
+
+	switch update.NewChatMember.Status {
+	case "left", "kicked":
+		return s.sm.DB.Model(group).Update("is_active", false).Error
+	case "member":
+		if update.OldChatMember.Status == "left" || update.OldChatMember.Status == "kicked" {
+			return s.SendMessage(group.ChatID, "👋 Halo! Jadikan saya admin agar bisa menyambut anggota baru dan menjaga grup. Admin bisa mengetik /mod untuk pengaturan.")
+		}
+	}
+	return nil
+}
+
+// findOrCreateGroup returns the stored group for a chat, keeping its title
+// and type current and marking it active. Every bot in a group has its own
+// settings for it.
+func (s *TelegramService) findOrCreateGroup(chat *telegram.Chat) (*models.TelegramGroup, error) {
+	group := &models.TelegramGroup{}
+	ownerID, err := s.ownerID()
+	if err != nil {
+		return nil, err
+	}
+
+	err = whereBot(s.sm.DB.Where("chat_id = ?", chat.ID), "bot_id", s.BotID()).First(group).Error
+	if err == nil {
+		if group.Title != chat.Title || group.Type != chat.Type || !group.IsActive || group.UserID != ownerID {
+			group.Title, group.Type, group.IsActive, group.UserID = chat.Title, chat.Type, true, ownerID
+			err = s.sm.DB.Save(group).Error
+		}
+		return group, err
+	}
+	if !gorm.IsRecordNotFoundError(err) {
+		return nil, err
+	}
+
+	group = &models.TelegramGroup{
+		ID:                uuid.New(),
+		BotID:             s.BotID(),
+		UserID:            ownerID,
+		ChatID:            chat.ID,
+		Title:             chat.Title,
+		Type:              chat.Type,
+		IsActive:          true,
+		ModerationEnabled: true,
+		FloodLimit:        5,
+		MaxWarnings:       3,
+		MuteMinutes:       60,
+		WelcomeEnabled:    true,
+	}
+	if err := s.sm.DB.Create(group).Error; err != nil {
+		return nil, err
+	}
+	return group, nil
+}
+
+func (s *TelegramService) updateGroupSetting(group *models.TelegramGroup, column string, value interface{}, reply string) error {
+	if err := s.sm.DB.Model(group).Update(column, value).Error; err != nil {
+		return err
+	}
+	return s.SendMessage(group.ChatID, reply)
+}
+
+// isGroupAdmin reports whether the user administers the group. Answers are
+// cached briefly so moderation doesn't call getChatMember for every message.
+func (s *TelegramService) isGroupAdmin(chatID, userID int64) bool {
+	ctx := s.sm.Redis.Context()
+	key := fmt.Sprintf("%s%d:%d", telegramAdminKeyPrefix, chatID, userID)
+	if cached, err := s.sm.Redis.Get(ctx, key).Result(); err == nil {
+		return cached == "1"
+	}
+
+	member, err := s.client.GetChatMember(chatID, userID)
+	if err != nil {
+		logger.Log.WithError(err).WithFields(logrus.Fields{"chat_id": chatID, "user_id": userID}).Error("Failed to get Telegram chat member")
+		return false
+	}
+
+	value := "0"
+	if member.IsAdmin() {
+		value = "1"
+	}
+	s.sm.Redis.Set(ctx, key, value, telegramAdminTTL)
+	return member.IsAdmin()
+}
+
+func (s *TelegramService) addWarning(chatID, userID int64) int {
+	ctx := s.sm.Redis.Context()
+	key := fmt.Sprintf("%s%d:%d", telegramWarningKeyPrefix, chatID, userID)
+	count, err := s.sm.Redis.Incr(ctx, key).Result()
+	if err != nil {
+		logger.Log.WithError(err).Error("Failed to count Telegram group warning")
+		return 1
+	}
+	s.sm.Redis.Expire(ctx, key, telegramWarningTTL)
+	return int(count)
+}
+
+func (s *TelegramService) resetWarnings(chatID, userID int64) {
+	s.sm.Redis.Del(s.sm.Redis.Context(), fmt.Sprintf("%s%d:%d", telegramWarningKeyPrefix, chatID, userID))
+}
+
+// GetTelegramGroups lists the groups the user's bots have been added to.
+func (s *TelegramService) GetTelegramGroups(userID uuid.UUID) ([]models.TelegramGroup, error) {
+	var groups []models.TelegramGroup
+	if err := s.sm.DB.Where("user_id = ?", userID).Order("title").Find(&groups).Error; err != nil {
+		logger.Log.WithError(err).Error("Failed to get Telegram groups")
+		return nil, err
+	}
+	return groups, nil
+}
+
+// UpdateTelegramGroup changes the moderation and welcome settings a bot of
+// the user has for a group.
+func (s *TelegramService) UpdateTelegramGroup(userID uuid.UUID, botID *uuid.UUID, chatID int64, updates map[string]interface{}) (*models.TelegramGroup, error) {
+	group := &models.TelegramGroup{}
+	query := whereBot(s.sm.DB.Where("chat_id = ? AND user_id = ?", chatID, userID), "bot_id", botID)
+	if err := query.First(group).Error; err != nil {
+		if gorm.IsRecordNotFoundError(err) {
+			return nil, ErrTelegramGroupNotFound
+		}
+		return nil, err
+	}
+	if err := s.sm.DB.Model(group).Updates(updates).Error; err != nil {
+		logger.Log.WithError(err).Error("Failed to update Telegram group")
+		return nil, err
+	}
+	return group, nil
+}
+
+const modHelp = "🛡️ PERINTAH MODERASI 🛡️\n\n" +
+	"• /mod - Lihat pengaturan\n" +
+	"• /mod on|off - Moderasi otomatis\n" +
+	"• /mod links on|off - Blokir semua link\n" +
+	"• /mod flood [n] - Maks. pesan per 10 detik (0 = mati)\n" +
+	"• /mod warnings [n] - Peringatan sebelum dibisukan\n" +
+	"• /mod mutetime [menit] - Lama dibisukan\n" +
+	"• /mod welcome on|off|[teks] - Pesan sambutan ({name}, {group})\n\n" +
+	"Balas pesan anggota dengan:\n" +
+	"• /mod warn, /mod mute [menit], /mod unmute\n" +
+	"• /mod ban, /mod unban, /mod del"
+
+func formatGroupSettings(group *models.TelegramGroup) string {
+	welcome := defaultWelcomeMessage
+	if group.WelcomeMessage != "" {
+		welcome = group.WelcomeMessage
+	}
+	if !group.WelcomeEnabled {
+		welcome = "mati"
+	}
+
+	return fmt.Sprintf("🛡️ PENGATURAN GRUP 🛡️\n\nModerasi: %s\nBlokir link: %s\nBatas flood: %d pesan/10 detik\nPeringatan maks.: %d\nLama bisu: %d menit\nSambutan: %s\n\nKetik /mod help untuk daftar perintah.",
+		onOff(group.ModerationEnabled), onOff(group.BlockLinks), group.FloodLimit, group.MaxWarnings, group.MuteMinutes, welcome)
+}
+
+func onOff(enabled bool) string {
+	if enabled {
+		return "aktif"
+	}
+	return "mati"
+}
@@ -0,0 +1,225 @@
+package services
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"whatsapp-bot/internal/models"
+	"whatsapp-bot/pkg/logger"
+	"whatsapp-bot/pkg/telegram"
+
+	"github.com/google/uuid"
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	// inlineProductsPerPage is how many products an inline answer carries
+	// before the user has to scroll for more.
+	inlineProductsPerPage = 20
+	inlineCacheSeconds    = 60
+)
+
+// handleInlineQuery answers "@bot <query>" typed in any chat. Supported
+// queries are "kurs <jumlah> <dari> <ke>", "cuaca <kota>" and
+// "produk <kata kunci>"; anything else gets usage examples.
+func (s *TelegramService) handleInlineQuery(query *telegram.InlineQuery) error {
+	fields := strings.Fields(strings.ToLower(query.Query))
+
+	var results []telegram.InlineQueryResult
+	opts := telegram.InlineQueryOptions{CacheTime: inlineCacheSeconds}
+
+	switch {
+	case len(fields) > 0 && fields[0] == "kurs":
+		results = s.inlineCurrency(fields[1:])
+	case len(fields) > 1 && fields[0] == "cuaca":
+		results = s.inlineWeather(strings.Join(fields[1:], " "))
+	case len(fields) > 0 && fields[0] == "produk":
+		results, opts.NextOffset = s.inlineProducts(strings.Join(fields[1:], " "), query.Offset)
+	}
+
+	if len(results) == 0 {
+		results = inlineHelp()
+	}
+
+	return s.client.AnswerInlineQuery(query.ID, results, opts)
+}
+
+// inlineCurrency converts "<jumlah> <dari> <ke>" or "<dari> <ke>".
+func (s *TelegramService) inlineCurrency(args []string) []telegram.InlineQueryResult {
+	amount := 1.0
+	if len(args) == 3 {
+		parsed, err := strconv.ParseFloat(strings.Replace(args[0], ",", ".", 1), 64)
+		if err != nil {
+			return nil
+		}
+		amount, args = parsed, args[1:]
+	}
+	if len(args) != 2 {
+		return nil
+	}
+
+	from, to := strings.ToUpper(args[0]), strings.ToUpper(args[1])
+	converted, err := s.sm.UtilityService.ConvertCurrency(amount, from, to)
+	if err != nil {
+		logger.Log.WithError(err).WithFields(logrus.Fields{"from": from, "to": to}).Error("Failed to convert currency for inline query")
+		return []telegram.InlineQueryResult{inlineArticle("kurs-error", "❌ Kurs tidak tersedia", fmt.Sprintf("Tidak bisa mengonversi %s ke %s", from, to), "")}
+	}
+
+	title := fmt.Sprintf("%s = %s", formatAmount(amount, from), formatAmount(converted, to))
+	return []telegram.InlineQueryResult{
+		inlineArticle("kurs-"+from+"-"+to, "💱 "+title, "Kirim hasil konversi", "💱 "+title),
+	}
+}
+
+func (s *TelegramService) inlineWeather(city string) []telegram.InlineQueryResult {
+	weather, err := s.sm.UtilityService.GetWeather(city, "")
+	if err != nil {
+		logger.Log.WithError(err).WithField("city", city).Error("Failed to get weather for inline query")
+		return []telegram.InlineQueryResult{inlineArticle("cuaca-error", "❌ Cuaca tidak tersedia", "Coba kota lain", "")}
+	}
+
+	title := fmt.Sprintf("%s: %v°C, %v", strings.Title(city), weather["temperature"], weather["condition"])
+	text := fmt.Sprintf("🌤️ Cuaca %s\n\nSuhu: %v°C\nKondisi: %v\nKelembapan: %v%%\nAngin: %v km/j",
+		strings.Title(city), weather["temperature"], weather["condition"], weather["humidity"], weather["wind_speed"])
+
+	return []telegram.InlineQueryResult{
+		inlineArticle("cuaca-"+city, "🌤️ "+title, fmt.Sprintf("Kelembapan %v%%", weather["humidity"]), text),
+	}
+}
+
+// inlineProducts searches active products. offset is the page to show,
+// as returned in the previous answer's next offset.
+func (s *TelegramService) inlineProducts(search, offset string) ([]telegram.InlineQueryResult, string) {
+	page := 1
+	if n, err := strconv.Atoi(offset); err == nil && n > 1 {
+		page = n
+	}
+
+	products, total, err := s.searchProducts(search, page)
+	if err != nil {
+		logger.Log.WithError(err).WithField("search", search).Error("Failed to search products for inline query")
+		return nil, ""
+	}
+
+	results := make([]telegram.InlineQueryResult, 0, len(products))
+	for _, product := range products {
+		price := formatAmount(product.Price, product.Currency)
+		text := fmt.Sprintf("🛍️ %s\nHarga: %s\nStok: %d", product.Name, price, product.Stock)
+		if product.Description != "" {
+			text += "\n\n" + product.Description
+		}
+		text += fmt.Sprintf("\n\nKetik \"pesan %s 1\" ke bot untuk memesan.", product.Name)
+
+		result := inlineArticle("produk-"+product.ID.String(), product.Name, truncateRunes(price+" - "+product.Description, 100), text)
+		result.ThumbnailURL = productThumbnail(product.Images)
+		results = append(results, result)
+	}
+
+	nextOffset := ""
+	if page*inlineProductsPerPage < total {
+		nextOffset = strconv.Itoa(page + 1)
+	}
+	if len(results) == 0 && page == 1 {
+		results = append(results, inlineArticle("produk-kosong", "Produk tidak ditemukan", "Coba kata kunci lain", ""))
+	}
+	return results, nextOffset
+}
+
+// searchProducts returns a page of the bot owner's active products matching
+// search, and how many match in total. Other users' catalogs never show up.
+func (s *TelegramService) searchProducts(search string, page int) ([]models.Product, int, error) {
+	ownerID, err := s.ownerID()
+	if err != nil {
+		return nil, 0, err
+	}
+
+	query := s.sm.DB.Model(&models.Product{}).Where("user_id = ? AND is_active = ?", ownerID, true)
+	if search != "" {
+		query = query.Where("name LIKE ? OR description LIKE ?", "%"+search+"%", "%"+search+"%")
+	}
+
+	var total int
+	if err := query.Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+
+	var products []models.Product
+	err = query.Order("created_at desc").Offset((page - 1) * inlineProductsPerPage).Limit(inlineProductsPerPage).Find(&products).Error
+	return products, total, err
+}
+
+// handleChosenInlineResult records which inline answers get sent.
+func (s *TelegramService) handleChosenInlineResult(result *telegram.ChosenInlineResult) error {
+	ownerID, err := s.ownerID()
+	if err != nil {
+		return err
+	}
+
+	kind := result.ResultID
+	if i := strings.Index(kind, "-"); i >= 0 {
+		kind = kind[:i]
+	}
+
+	s.sm.AnalyticsService.LogEvent(ownerID, "inline_result_chosen", 1, map[string]interface{}{
+		"result_type": kind,
+		"query":       result.Query,
+		"platform":    PlatformTelegram,
+	})
+	return nil
+}
+
+func inlineHelp() []telegram.InlineQueryResult {
+	examples := []struct{ query, title, description string }{
+		{"kurs 100 usd idr", "💱 Kurs mata uang", "Contoh: kurs 100 usd idr"},
+		{"cuaca jakarta", "🌤️ Cuaca", "Contoh: cuaca jakarta"},
+		{"produk sepatu", "🛍️ Cari produk", "Contoh: produk sepatu"},
+	}
+
+	results := make([]telegram.InlineQueryResult, 0, len(examples))
+	for _, example := range examples {
+		result := inlineArticle("help-"+strings.Fields(example.query)[0], example.title, example.description, example.description)
+		result.ReplyMarkup = map[string]interface{}{
+			"inline_keyboard": [][]map[string]interface{}{
+				{{"text": "Coba", "switch_inline_query_current_chat": example.query}},
+			},
+		}
+		results = append(results, result)
+	}
+	return results
+}
+
+// inlineArticle builds an article result. An empty text sends the title.
+func inlineArticle(id, title, description, text string) telegram.InlineQueryResult {
+	if text == "" {
+		text = title
+	}
+	// Result IDs are limited to 64 bytes
+	if len(id) > 64 {
+		id = uuid.NewSHA1(uuid.NameSpaceOID, []byte(id)).String()
+	}
+	return telegram.InlineQueryResult{
+		Type:                "article",
+		ID:                  id,
+		Title:               title,
+		Description:         description,
+		InputMessageContent: telegram.InputMessageContent{MessageText: text},
+	}
+}
+
+func formatAmount(amount float64, currency string) string {
+	if amount >= 100 {
+		return fmt.Sprintf("%s %.0f", currency, amount)
+	}
+	return fmt.Sprintf("%s %.2f", currency, amount)
+}
+
+// productThumbnail returns the first image of a product's JSON image list.
+func productThumbnail(images string) string {
+	var urls []string
+	if err := json.Unmarshal([]byte(images), &urls); err != nil || len(urls) == 0 {
+		return ""
+	}
+	return urls[0]
+}
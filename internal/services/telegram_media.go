@@ -0,0 +1,181 @@
+package services
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"whatsapp-bot/internal/models"
+	"whatsapp-bot/pkg/logger"
+	"whatsapp-bot/pkg/storage"
+	"whatsapp-bot/pkg/telegram"
+
+	"github.com/jinzhu/gorm"
+	"github.com/sirupsen/logrus"
+)
+
+// telegramMedia is the file attached to an incoming message.
+type telegramMedia struct {
+	Type         string // image, document, audio
+	FileID       string
+	FileUniqueID string
+	FileName     string
+	MimeType     string
+	FileSize     int
+}
+
+func telegramMessageMedia(message *telegram.Message) *telegramMedia {
+	switch {
+	case len(message.Photo) > 0:
+		// The last size is the largest
+		photo := message.Photo[len(message.Photo)-1]
+		return &telegramMedia{Type: "image", FileID: photo.FileID, FileUniqueID: photo.FileUniqueID, MimeType: "image/jpeg", FileSize: photo.FileSize}
+	case message.Document != nil:
+		return &telegramMedia{Type: "document", FileID: message.Document.FileID, FileUniqueID: message.Document.FileUniqueID,
+			FileName: message.Document.FileName, MimeType: message.Document.MimeType, FileSize: message.Document.FileSize}
+	case message.Voice != nil:
+		mimeType := message.Voice.MimeType
+		if mimeType == "" {
+			mimeType = "audio/ogg"
+		}
+		return &telegramMedia{Type: "audio", FileID: message.Voice.FileID, FileUniqueID: message.Voice.FileUniqueID, MimeType: mimeType, FileSize: message.Voice.FileSize}
+	}
+	return nil
+}
+
+// ingestMedia copies an incoming file into storage and records the URL on
+// both the conversation message and the raw Telegram message. A failed
+// download is logged and leaves MediaURL empty.
+func (s *TelegramService) ingestMedia(message *telegram.Message, incomingMessage *models.Message, media *telegramMedia) {
+	fields := logrus.Fields{"chat_id": message.GetChatID(), "file_id": media.FileID}
+
+	mediaURL, err := s.storeTelegramFile(media)
+	if err != nil {
+		logger.Log.WithError(err).WithFields(fields).Error("Failed to store Telegram file")
+		return
+	}
+
+	incomingMessage.MediaURL = mediaURL
+	incomingMessage.MediaMimeType = media.MimeType
+	if err := s.sm.DB.Model(incomingMessage).Updates(map[string]interface{}{
+		"media_url":       mediaURL,
+		"media_mime_type": media.MimeType,
+	}).Error; err != nil {
+		logger.Log.WithError(err).WithFields(fields).Error("Failed to save media URL")
+	}
+
+	if err := s.sm.DB.Model(&models.TelegramMessage{}).
+		Where("chat_id = ? AND message_id = ? AND direction = ?", message.GetChatID(), message.MessageID, "incoming").
+		Updates(map[string]interface{}{
+			"media_url":       mediaURL,
+			"media_mime_type": media.MimeType,
+		}).Error; err != nil {
+		logger.Log.WithError(err).WithFields(fields).Error("Failed to record media on Telegram message")
+	}
+}
+
+// storeTelegramFile downloads a file through the Bot API and saves it to the
+// configured storage backend, returning the stored file URL.
+func (s *TelegramService) storeTelegramFile(media *telegramMedia) (string, error) {
+	if media.FileSize > telegram.MaxDownloadSize {
+		return "", fmt.Errorf("file is %d bytes, bots can only download up to %d", media.FileSize, telegram.MaxDownloadSize)
+	}
+
+	file, err := s.client.GetFile(media.FileID)
+	if err != nil {
+		return "", err
+	}
+
+	data, err := s.client.DownloadFile(file.FilePath)
+	if err != nil {
+		return "", err
+	}
+
+	// The file name comes from the customer, so only a known MIME type may
+	// pick the extension the file is later served with
+	key := fmt.Sprintf("telegram/%s/%s%s", time.Now().Format("2006/01/02"), media.FileUniqueID, storage.ExtensionForMimeType(media.MimeType))
+	return s.sm.Storage.Save(key, data, media.MimeType)
+}
+
+// processMediaCommand handles captions on files: "bukti [nomor pesanan]"
+// attaches a receipt to a pending order and "simpan [judul]" saves a
+// document as a note.
+func (s *TelegramService) processMediaCommand(contact *models.Contact, message *models.Message, media *telegramMedia) (bool, error) {
+	if media == nil {
+		return false, nil
+	}
+
+	fields := strings.Fields(message.Content)
+	if len(fields) == 0 {
+		return false, nil
+	}
+
+	keyword := strings.ToLower(fields[0])
+	switch {
+	case keyword == "bukti" && (media.Type == "image" || media.Type == "document"):
+	case (keyword == "simpan" || keyword == "catatan") && media.Type == "document":
+	default:
+		return false, nil
+	}
+
+	chatID := contact.TelegramChatID
+	if message.MediaURL == "" {
+		return true, s.SendMessage(chatID, "❌ File tidak bisa diunduh. Silakan kirim ulang.")
+	}
+
+	arg := strings.Join(fields[1:], " ")
+	if keyword == "bukti" {
+		return true, s.attachPaymentProof(contact, message, arg)
+	}
+	return true, s.saveDocumentNote(contact, message, media, arg)
+}
+
+// attachPaymentProof stores the receipt on the contact's pending order, the
+// newest one unless an order number is given.
+func (s *TelegramService) attachPaymentProof(contact *models.Contact, message *models.Message, orderNumber string) error {
+	query := s.sm.DB.Where("contact_id = ? AND status = ?", contact.ID, "pending")
+	if orderNumber != "" {
+		query = query.Where("order_number = ?", orderNumber)
+	}
+
+	var order models.Order
+	err := query.Order("created_at desc").First(&order).Error
+	if gorm.IsRecordNotFoundError(err) {
+		return s.SendMessage(contact.TelegramChatID, "❌ Tidak ada pesanan yang menunggu pembayaran. Kirim \"bukti <nomor pesanan>\" untuk pesanan tertentu.")
+	}
+	if err != nil {
+		return err
+	}
+
+	if err := s.sm.DB.Model(&order).Update("payment_proof_url", message.MediaURL).Error; err != nil {
+		logger.Log.WithError(err).WithField("order_id", order.ID).Error("Failed to attach payment proof")
+		return err
+	}
+
+	s.sm.AnalyticsService.LogEvent(contact.UserID, "payment_proof_received", 1, map[string]interface{}{
+		"order_id": order.ID,
+		"platform": PlatformTelegram,
+	})
+
+	return s.SendMessage(contact.TelegramChatID, fmt.Sprintf("✅ Bukti pembayaran untuk pesanan %s diterima. Kami akan segera memverifikasinya.", order.OrderNumber))
+}
+
+func (s *TelegramService) saveDocumentNote(contact *models.Contact, message *models.Message, media *telegramMedia, title string) error {
+	if title == "" {
+		title = media.FileName
+	}
+	if title == "" {
+		title = "Dokumen Telegram"
+	}
+
+	content := message.MediaURL
+	if media.FileName != "" {
+		content = media.FileName + "\n" + content
+	}
+
+	if _, err := s.sm.UtilityService.CreateNote(title, content, contact.UserID, "dokumen", []string{PlatformTelegram}); err != nil {
+		return err
+	}
+
+	return s.SendMessage(contact.TelegramChatID, fmt.Sprintf("📝 Dokumen disimpan sebagai catatan \"%s\".", title))
+}
@@ -0,0 +1,377 @@
+package services
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"whatsapp-bot/internal/models"
+	"whatsapp-bot/pkg/logger"
+
+	"github.com/go-redis/redis/v8"
+	"github.com/google/uuid"
+	"github.com/jinzhu/gorm"
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	NotificationReminder  = "reminder"
+	NotificationBroadcast = "broadcast"
+
+	deliverySent       = "sent"
+	deliveryDeferred   = "deferred"
+	deliverySuppressed = "suppressed"
+
+	telegramDeferredKey     = "telegram:deferred"
+	defaultNotificationZone = "Asia/Jakarta"
+
+	// A deferred notification that fails to send is retried after
+	// deferredRetryDelay, doubling each time, up to deferredMaxAttempts sends.
+	deferredRetryDelay  = 5 * time.Minute
+	deferredMaxAttempts = 5
+)
+
+// telegramNotificationTypes are the notification types a chat can turn on
+// and off with /settings.
+var telegramNotificationTypes = []string{NotificationReminder, NotificationBroadcast}
+
+var ErrNotificationDisabled = errors.New("notification type is disabled")
+
+// deferredNotification is a message held back until the end of the
+// recipient's quiet hours.
+type deferredNotification struct {
+	ID          string     `json:"id"`
+	ChatID      int64      `json:"chat_id"`
+	Type        string     `json:"type"`
+	Message     string     `json:"message"`
+	BroadcastID *uuid.UUID `json:"broadcast_id,omitempty"`
+	BotID       *uuid.UUID `json:"bot_id,omitempty"`
+	Attempts    int        `json:"attempts,omitempty"`
+}
+
+// NotificationTime returns when a notification of the given type may be
+// delivered to the chat: now, or the end of the chat's quiet hours in its
+// timezone. ErrNotificationDisabled means the chat turned the type off.
+func (s *TelegramService) NotificationTime(chatID int64, notificationType string, now time.Time) (time.Time, error) {
+	setting := &models.TelegramNotification{}
+	err := s.notificationSettingsOf(chatID).Where("type = ?", notificationType).First(setting).Error
+	if gorm.IsRecordNotFoundError(err) {
+		return now, nil
+	}
+	if err != nil {
+		return now, err
+	}
+
+	if !setting.IsEnabled {
+		return time.Time{}, ErrNotificationDisabled
+	}
+
+	return quietHoursEnd(setting.QuietHours, setting.Timezone, now), nil
+}
+
+// notify sends a notification to the chat unless its settings suppress or
+// defer it. It returns deliverySent, deliveryDeferred or deliverySuppressed.
+func (s *TelegramService) notify(chatID int64, notificationType, message string, broadcastID *uuid.UUID) (string, error) {
+	now := time.Now()
+	deliverAt, err := s.NotificationTime(chatID, notificationType, now)
+	switch {
+	case errors.Is(err, ErrNotificationDisabled):
+		return deliverySuppressed, nil
+	case err != nil:
+		// Settings are a courtesy; a lookup failure must not drop the message
+		logger.Log.WithError(err).WithField("chat_id", chatID).Warn("Failed to load Telegram notification settings")
+	case deliverAt.After(now):
+		notification := &deferredNotification{
+			ID:          uuid.New().String(),
+			ChatID:      chatID,
+			Type:        notificationType,
+			Message:     message,
+			BroadcastID: broadcastID,
+			BotID:       s.BotID(),
+		}
+		if err := s.deferNotification(notification, deliverAt); err != nil {
+			return "", err
+		}
+		return deliveryDeferred, nil
+	}
+
+	if err := s.SendMessage(chatID, message); err != nil {
+		return "", err
+	}
+	return deliverySent, nil
+}
+
+func (s *TelegramService) deferNotification(notification *deferredNotification, deliverAt time.Time) error {
+	data, err := json.Marshal(notification)
+	if err != nil {
+		return err
+	}
+
+	return s.sm.Redis.ZAdd(s.sm.Redis.Context(), telegramDeferredKey, &redis.Z{
+		Score:  float64(deliverAt.Unix()),
+		Member: string(data),
+	}).Err()
+}
+
+// ProcessDeferredNotifications delivers notifications whose quiet hours
+// have ended. A broadcast counts a notification as failed only once its
+// last retry fails.
+func (s *TelegramService) ProcessDeferredNotifications() error {
+	ctx := s.sm.Redis.Context()
+
+	members, err := s.sm.Redis.ZRangeByScore(ctx, telegramDeferredKey, &redis.ZRangeBy{
+		Min: "-inf",
+		Max: strconv.FormatInt(time.Now().Unix(), 10),
+	}).Result()
+	if err != nil {
+		return err
+	}
+
+	for _, member := range members {
+		// Whoever removes the member delivers it
+		removed, err := s.sm.Redis.ZRem(ctx, telegramDeferredKey, member).Result()
+		if err != nil || removed == 0 {
+			continue
+		}
+
+		notification := &deferredNotification{}
+		if err := json.Unmarshal([]byte(member), notification); err != nil {
+			logger.Log.WithError(err).Error("Failed to decode deferred Telegram notification")
+			continue
+		}
+
+		if notification.BroadcastID != nil {
+			var broadcast models.TelegramBroadcast
+			if err := s.sm.DB.Where("id = ?", *notification.BroadcastID).First(&broadcast).Error; err != nil || broadcast.Status == "cancelled" {
+				continue
+			}
+		}
+
+		// Settings may have changed since the message was deferred
+		result, err := s.sm.TelegramFor(notification.BotID).notify(notification.ChatID, notification.Type, notification.Message, notification.BroadcastID)
+		if err != nil {
+			logger.Log.WithError(err).WithField("chat_id", notification.ChatID).Error("Failed to send deferred Telegram notification")
+
+			// It was already taken off the set, so put it back for a retry
+			notification.Attempts++
+			if notification.Attempts < deferredMaxAttempts {
+				retryAt := time.Now().Add(deferredRetryDelay << (notification.Attempts - 1))
+				if err := s.deferNotification(notification, retryAt); err != nil {
+					logger.Log.WithError(err).WithField("chat_id", notification.ChatID).Error("Failed to reschedule deferred Telegram notification")
+				}
+				continue
+			}
+		}
+		if notification.BroadcastID == nil || (err == nil && result != deliverySent) {
+			continue
+		}
+		column := "success_count"
+		if err != nil {
+			column = "failure_count"
+		}
+		s.sm.DB.Model(&models.TelegramBroadcast{}).Where("id = ?", *notification.BroadcastID).
+			UpdateColumn(column, gorm.Expr(column+" + 1"))
+	}
+
+	return nil
+}
+
+// processSettingsCommand handles /settings, which manages the chat's
+// notification preferences. It reports whether the message was a settings
+// command.
+func (s *TelegramService) processSettingsCommand(contact *models.Contact, userID int64, message *models.Message) (bool, error) {
+	fields := strings.Fields(strings.ToLower(message.Content))
+	if len(fields) == 0 || (fields[0] != "settings" && fields[0] != "pengaturan") {
+		return false, nil
+	}
+
+	chatID := contact.TelegramChatID
+	settings, err := s.notificationSettings(chatID, userID)
+	if err != nil {
+		return true, err
+	}
+
+	var reply string
+	switch {
+	case len(fields) == 1:
+		reply = formatNotificationSettings(settings)
+	case (fields[1] == "on" || fields[1] == "off") && len(fields) == 3 && isNotificationType(fields[2]):
+		enabled := fields[1] == "on"
+		err = s.notificationSettingsOf(chatID).Model(&models.TelegramNotification{}).Where("type = ?", fields[2]).
+			Update("is_enabled", enabled).Error
+		reply = fmt.Sprintf("✅ Notifikasi %s %s.", fields[2], map[bool]string{true: "diaktifkan", false: "dimatikan"}[enabled])
+	case fields[1] == "quiet" && len(fields) == 3:
+		quietHours := fields[2]
+		if quietHours == "off" {
+			quietHours = ""
+		} else if _, _, ok := parseTimeWindow(quietHours); !ok {
+			return true, s.SendMessage(chatID, "❌ Format jam tenang salah. Contoh: settings quiet 22:00-08:00")
+		}
+		err = s.updateNotificationSettings(chatID, "quiet_hours", quietHours)
+		reply = "✅ Jam tenang dimatikan."
+		if quietHours != "" {
+			reply = fmt.Sprintf("✅ Jam tenang diatur ke %s. Pengingat dan broadcast akan dikirim setelahnya.", quietHours)
+		}
+	case fields[1] == "timezone" && len(fields) == 3:
+		// Location names are case sensitive, e.g. Asia/Jakarta
+		zone := strings.Fields(message.Content)[2]
+		if _, err := time.LoadLocation(zone); err != nil {
+			return true, s.SendMessage(chatID, "❌ Zona waktu tidak dikenali. Contoh: settings timezone Asia/Jakarta")
+		}
+		err = s.updateNotificationSettings(chatID, "timezone", zone)
+		reply = fmt.Sprintf("✅ Zona waktu diatur ke %s.", zone)
+	case fields[1] == "language" && len(fields) == 3 && (fields[2] == "id" || fields[2] == "en"):
+		err = s.updateNotificationSettings(chatID, "language", fields[2])
+		reply = fmt.Sprintf("✅ Bahasa diatur ke %s.", fields[2])
+	default:
+		reply = settingsHelp
+	}
+	if err != nil {
+		return true, err
+	}
+
+	return true, s.SendMessage(chatID, reply)
+}
+
+// notificationSettings returns the chat's settings for every notification
+// type, creating the missing ones with the defaults.
+func (s *TelegramService) notificationSettings(chatID, userID int64) ([]models.TelegramNotification, error) {
+	var settings []models.TelegramNotification
+	if err := s.notificationSettingsOf(chatID).Order("type").Find(&settings).Error; err != nil {
+		return nil, err
+	}
+
+	// Chat-wide values are kept on every row; copy them to new rows
+	template := models.TelegramNotification{Language: "id", Timezone: defaultNotificationZone}
+	if len(settings) > 0 {
+		template = settings[0]
+	}
+
+	for _, notificationType := range telegramNotificationTypes {
+		if findNotificationSetting(settings, notificationType) != nil {
+			continue
+		}
+		setting := models.TelegramNotification{
+			ID:         uuid.New(),
+			UserID:     userID,
+			ChatID:     chatID,
+			BotID:      s.BotID(),
+			Type:       notificationType,
+			IsEnabled:  true,
+			QuietHours: template.QuietHours,
+			Language:   template.Language,
+			Timezone:   template.Timezone,
+		}
+		if err := s.sm.DB.Create(&setting).Error; err != nil {
+			logger.Log.WithError(err).WithFields(logrus.Fields{"chat_id": chatID, "type": notificationType}).Error("Failed to create Telegram notification setting")
+			return nil, err
+		}
+		settings = append(settings, setting)
+	}
+
+	return settings, nil
+}
+
+// updateNotificationSettings sets a chat-wide value on all of the chat's
+// notification settings.
+func (s *TelegramService) updateNotificationSettings(chatID int64, column string, value interface{}) error {
+	return s.notificationSettingsOf(chatID).Model(&models.TelegramNotification{}).Update(column, value).Error
+}
+
+// notificationSettingsOf limits a query to the chat's settings for this bot.
+func (s *TelegramService) notificationSettingsOf(chatID int64) *gorm.DB {
+	return whereBot(s.sm.DB.Where("chat_id = ?", chatID), "bot_id", s.BotID())
+}
+
+const settingsHelp = "⚙️ PENGATURAN NOTIFIKASI ⚙️\n\n" +
+	"• /settings - Lihat pengaturan\n" +
+	"• /settings on|off reminder - Pengingat\n" +
+	"• /settings on|off broadcast - Broadcast\n" +
+	"• /settings quiet 22:00-08:00 - Jam tenang (off untuk mematikan)\n" +
+	"• /settings timezone Asia/Jakarta - Zona waktu\n" +
+	"• /settings language id|en - Bahasa"
+
+func formatNotificationSettings(settings []models.TelegramNotification) string {
+	var b strings.Builder
+	b.WriteString("⚙️ PENGATURAN NOTIFIKASI ⚙️\n\n")
+	for _, notificationType := range telegramNotificationTypes {
+		status := "❌ mati"
+		if setting := findNotificationSetting(settings, notificationType); setting != nil && setting.IsEnabled {
+			status = "✅ aktif"
+		}
+		fmt.Fprintf(&b, "%s: %s\n", strings.Title(notificationType), status)
+	}
+
+	quietHours := "tidak ada"
+	if settings[0].QuietHours != "" {
+		quietHours = settings[0].QuietHours
+	}
+	fmt.Fprintf(&b, "\nJam tenang: %s\nZona waktu: %s\nBahasa: %s\n\n", quietHours, settings[0].Timezone, settings[0].Language)
+	b.WriteString("Ketik /settings help untuk mengubah pengaturan.")
+	return b.String()
+}
+
+func findNotificationSetting(settings []models.TelegramNotification, notificationType string) *models.TelegramNotification {
+	for i := range settings {
+		if settings[i].Type == notificationType {
+			return &settings[i]
+		}
+	}
+	return nil
+}
+
+func isNotificationType(value string) bool {
+	for _, notificationType := range telegramNotificationTypes {
+		if value == notificationType {
+			return true
+		}
+	}
+	return false
+}
+
+// parseTimeWindow parses "HH:MM-HH:MM" into minutes after midnight.
+func parseTimeWindow(window string) (start, end int, ok bool) {
+	parts := strings.Split(window, "-")
+	if len(parts) != 2 {
+		return 0, 0, false
+	}
+	from, err := time.Parse("15:04", strings.TrimSpace(parts[0]))
+	if err != nil {
+		return 0, 0, false
+	}
+	to, err := time.Parse("15:04", strings.TrimSpace(parts[1]))
+	if err != nil {
+		return 0, 0, false
+	}
+	return from.Hour()*60 + from.Minute(), to.Hour()*60 + to.Minute(), true
+}
+
+// quietHoursEnd returns the end of the quiet hours window containing now,
+// or now if it is outside the window. Windows may span midnight.
+func quietHoursEnd(quietHours, zone string, now time.Time) time.Time {
+	start, end, ok := parseTimeWindow(quietHours)
+	if !ok || start == end {
+		return now
+	}
+
+	loc, err := time.LoadLocation(zone)
+	if err != nil {
+		loc = time.Local
+	}
+	local := now.In(loc)
+	minute := local.Hour()*60 + local.Minute()
+	endOfToday := time.Date(local.Year(), local.Month(), local.Day(), end/60, end%60, 0, 0, loc)
+
+	switch {
+	case start < end && minute >= start && minute < end:
+		return endOfToday
+	case start > end && minute >= start:
+		return endOfToday.AddDate(0, 0, 1)
+	case start > end && minute < end:
+		return endOfToday
+	}
+	return now
+}
@@ -0,0 +1,47 @@
+package services
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestQuietHoursEnd(t *testing.T) {
+	at := func(day, hour, minute int) time.Time {
+		return time.Date(2024, 3, day, hour, minute, 0, 0, time.UTC)
+	}
+
+	testCases := []struct {
+		name       string
+		quietHours string
+		now        time.Time
+		expected   time.Time
+	}{
+		{name: "InsideDaytimeWindow", quietHours: "12:00-14:00", now: at(4, 13, 0), expected: at(4, 14, 0)},
+		{name: "AtWindowStart", quietHours: "12:00-14:00", now: at(4, 12, 0), expected: at(4, 14, 0)},
+		{name: "AtWindowEnd", quietHours: "12:00-14:00", now: at(4, 14, 0), expected: at(4, 14, 0)},
+		{name: "OutsideDaytimeWindow", quietHours: "12:00-14:00", now: at(4, 9, 15), expected: at(4, 9, 15)},
+		{name: "BeforeMidnight", quietHours: "22:00-07:00", now: at(4, 23, 30), expected: at(5, 7, 0)},
+		{name: "AfterMidnight", quietHours: "22:00-07:00", now: at(5, 2, 0), expected: at(5, 7, 0)},
+		{name: "OutsideOvernightWindow", quietHours: "22:00-07:00", now: at(4, 12, 0), expected: at(4, 12, 0)},
+		{name: "NoQuietHours", quietHours: "", now: at(4, 23, 30), expected: at(4, 23, 30)},
+		{name: "InvalidWindow", quietHours: "22-07", now: at(4, 23, 30), expected: at(4, 23, 30)},
+		{name: "EmptyWindow", quietHours: "08:00-08:00", now: at(4, 8, 0), expected: at(4, 8, 0)},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			assert.True(t, tc.expected.Equal(quietHoursEnd(tc.quietHours, "UTC", tc.now)), "expected %s", tc.expected)
+		})
+	}
+
+	t.Run("OwnerTimezone", func(t *testing.T) {
+		if _, err := time.LoadLocation("Asia/Jakarta"); err != nil {
+			t.Skip("timezone database not available")
+		}
+		// 16:30 UTC is 23:30 in Jakarta, so quiet hours end at 07:00 WIB
+		end := quietHoursEnd("22:00-07:00", "Asia/Jakarta", at(4, 16, 30))
+		assert.True(t, at(5, 0, 0).Equal(end), "got %s", end)
+	})
+}
@@ -0,0 +1,260 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"whatsapp-bot/internal/models"
+	"whatsapp-bot/pkg/logger"
+	"whatsapp-bot/pkg/telegram"
+
+	"github.com/google/uuid"
+	"github.com/jinzhu/gorm"
+	"github.com/sirupsen/logrus"
+)
+
+var (
+	ErrTelegramPaymentsDisabled = errors.New("Telegram Payments are not configured")
+	ErrOrderNotFound            = errors.New("order not found")
+	ErrOrderNotPayable          = errors.New("order is not awaiting payment")
+	ErrNotTelegramContact       = errors.New("order contact is not a Telegram chat")
+)
+
+// SendOrderInvoice sends an invoice for a pending order to the customer's
+// Telegram chat, through the bot the chat talks to.
+func (s *TelegramService) SendOrderInvoice(userID, orderID uuid.UUID) error {
+	var order models.Order
+	err := s.sm.DB.Where("id = ? AND user_id = ?", orderID, userID).First(&order).Error
+	if gorm.IsRecordNotFoundError(err) {
+		return ErrOrderNotFound
+	}
+	if err != nil {
+		return err
+	}
+	if !isPayableOrder(&order) {
+		return ErrOrderNotPayable
+	}
+
+	var contact models.Contact
+	if err := s.sm.DB.Where("id = ?", order.ContactID).First(&contact).Error; err != nil {
+		return err
+	}
+	if contact.Platform != PlatformTelegram {
+		return ErrNotTelegramContact
+	}
+
+	return s.ForBot(contact.TelegramBotID).sendOrderInvoice(&contact, &order)
+}
+
+func (s *TelegramService) sendOrderInvoice(contact *models.Contact, order *models.Order) error {
+	token := s.sm.Config.Telegram.PaymentProviderToken
+	if token == "" {
+		return ErrTelegramPaymentsDisabled
+	}
+
+	invoice, err := s.orderInvoice(order)
+	if err != nil {
+		return err
+	}
+	invoice.ChatID = contact.TelegramChatID
+	invoice.ProviderToken = token
+
+	if err := s.client.SendInvoice(*invoice); err != nil {
+		logger.Log.WithError(err).WithField("order_id", order.ID).Error("Failed to send Telegram invoice")
+		return err
+	}
+
+	s.sm.AnalyticsService.LogEvent(order.UserID, "invoice_sent", 1, map[string]interface{}{
+		"order_id": order.ID,
+		"platform": PlatformTelegram,
+	})
+	return nil
+}
+
+// orderInvoice builds the invoice for an order with one price per item. The
+// payload is the order ID. If the items don't add up to the order total,
+// e.g. because of shipping costs, the invoice has a single line instead.
+func (s *TelegramService) orderInvoice(order *models.Order) (*telegram.Invoice, error) {
+	currency := strings.ToUpper(order.Currency)
+	if currency == "" {
+		currency = "IDR"
+	}
+	total := telegram.PriceAmount(order.TotalAmount, currency)
+
+	var items []models.OrderItem
+	if err := s.sm.DB.Where("order_id = ?", order.ID).Find(&items).Error; err != nil {
+		return nil, err
+	}
+
+	var prices []telegram.LabeledPrice
+	sum := 0
+	for _, item := range items {
+		name := "Produk"
+		var product models.Product
+		if err := s.sm.DB.Where("id = ?", item.ProductID).First(&product).Error; err == nil {
+			name = product.Name
+		}
+
+		amount := telegram.PriceAmount(item.Subtotal, currency)
+		prices = append(prices, telegram.LabeledPrice{Label: fmt.Sprintf("%s x%d", name, item.Quantity), Amount: amount})
+		sum += amount
+	}
+	if len(prices) == 0 || sum != total {
+		prices = []telegram.LabeledPrice{{Label: "Pesanan " + order.OrderNumber, Amount: total}}
+	}
+
+	return &telegram.Invoice{
+		Title:               "Pesanan " + order.OrderNumber,
+		Description:         fmt.Sprintf("Pembayaran untuk pesanan %s (%d item).", order.OrderNumber, len(items)),
+		Payload:             order.ID.String(),
+		Currency:            currency,
+		Prices:              prices,
+		NeedShippingAddress: order.ShippingAddress == "",
+	}, nil
+}
+
+func isPayableOrder(order *models.Order) bool {
+	return order.Status == "pending" && order.PaidAt == nil
+}
+
+// invoiceOrder returns the order an invoice payload refers to.
+func (s *TelegramService) invoiceOrder(payload string) (*models.Order, error) {
+	orderID, err := uuid.Parse(payload)
+	if err != nil {
+		return nil, ErrOrderNotFound
+	}
+
+	var order models.Order
+	err = s.sm.DB.Where("id = ?", orderID).First(&order).Error
+	if gorm.IsRecordNotFoundError(err) {
+		return nil, ErrOrderNotFound
+	}
+	return &order, err
+}
+
+// handlePreCheckoutQuery confirms the checkout if the order can still be
+// paid for the invoiced amount. Telegram only charges the user after this.
+func (s *TelegramService) handlePreCheckoutQuery(query *telegram.PreCheckoutQuery) error {
+	errorMessage := s.checkPreCheckout(query)
+	if err := s.client.AnswerPreCheckoutQuery(query.ID, errorMessage == "", errorMessage); err != nil {
+		logger.Log.WithError(err).WithField("payload", query.InvoicePayload).Error("Failed to answer pre-checkout query")
+		return err
+	}
+	return nil
+}
+
+// checkPreCheckout returns why the order can't be paid, or "" if it can.
+func (s *TelegramService) checkPreCheckout(query *telegram.PreCheckoutQuery) string {
+	order, err := s.invoiceOrder(query.InvoicePayload)
+	if err != nil {
+		if err != ErrOrderNotFound {
+			logger.Log.WithError(err).WithField("payload", query.InvoicePayload).Error("Failed to load invoiced order")
+		}
+		return "Pesanan tidak ditemukan."
+	}
+	if !isPayableOrder(order) {
+		return "Pesanan ini sudah dibayar atau dibatalkan."
+	}
+
+	currency := strings.ToUpper(order.Currency)
+	if currency == "" {
+		currency = "IDR"
+	}
+	if query.Currency != currency || query.TotalAmount != telegram.PriceAmount(order.TotalAmount, currency) {
+		return "Total pesanan sudah berubah. Silakan minta tagihan baru dengan \"bayar " + order.OrderNumber + "\"."
+	}
+	return ""
+}
+
+// handleSuccessfulPayment marks the paid order as confirmed. Telegram has
+// charged the user at this point, so the payment is recorded even if the
+// order changed since the checkout; a repeated delivery changes nothing.
+func (s *TelegramService) handleSuccessfulPayment(contact *models.Contact, payment *telegram.SuccessfulPayment) error {
+	fields := logrus.Fields{"payload": payment.InvoicePayload, "charge_id": payment.TelegramPaymentChargeID}
+
+	order, err := s.invoiceOrder(payment.InvoicePayload)
+	if err != nil {
+		logger.Log.WithError(err).WithFields(fields).Error("Received payment for unknown order")
+		return err
+	}
+
+	updates := map[string]interface{}{
+		"status":            "confirmed",
+		"paid_at":           time.Now(),
+		"payment_charge_id": payment.TelegramPaymentChargeID,
+	}
+	if info := payment.OrderInfo; info != nil && info.ShippingAddress != nil && order.ShippingAddress == "" {
+		updates["shipping_address"] = info.ShippingAddress.String()
+	}
+
+	result := s.sm.DB.Model(&models.Order{}).Where("id = ? AND paid_at IS NULL", order.ID).Updates(updates)
+	if result.Error != nil {
+		logger.Log.WithError(result.Error).WithFields(fields).Error("Failed to record Telegram payment")
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		logger.Log.WithFields(fields).Warn("Telegram payment for an order that is already paid")
+		return nil
+	}
+
+	s.sm.AnalyticsService.LogEvent(order.UserID, "payment_confirmed", 1, map[string]interface{}{
+		"order_id":     order.ID,
+		"platform":     PlatformTelegram,
+		"currency":     payment.Currency,
+		"total_amount": payment.TotalAmount,
+	})
+
+	return s.SendMessage(contact.TelegramChatID, fmt.Sprintf("✅ Pembayaran untuk pesanan %s diterima. Terima kasih, pesanan Anda segera kami proses.", order.OrderNumber))
+}
+
+// processPaymentCommand handles "bayar [nomor pesanan]", which sends an
+// invoice for the contact's pending order, the newest one unless an order
+// number is given.
+func (s *TelegramService) processPaymentCommand(contact *models.Contact, message *models.Message) (bool, error) {
+	fields := strings.Fields(message.Content)
+	if len(fields) == 0 || strings.ToLower(fields[0]) != "bayar" || s.sm.Config.Telegram.PaymentProviderToken == "" {
+		return false, nil
+	}
+
+	query := s.sm.DB.Where("contact_id = ? AND status = ? AND paid_at IS NULL", contact.ID, "pending")
+	if len(fields) > 1 {
+		query = query.Where("order_number = ?", fields[1])
+	}
+
+	var order models.Order
+	err := query.Order("created_at desc").First(&order).Error
+	if gorm.IsRecordNotFoundError(err) {
+		return true, s.SendMessage(contact.TelegramChatID, "❌ Tidak ada pesanan yang menunggu pembayaran. Kirim \"bayar <nomor pesanan>\" untuk pesanan tertentu.")
+	}
+	if err != nil {
+		return true, err
+	}
+
+	return true, s.sendOrderInvoice(contact, &order)
+}
+
+// payWithStub runs the checkout and payment Telegram would deliver when the
+// pay button of a stub invoice is tapped.
+func (s *TelegramService) payWithStub(contact *models.Contact, from telegram.User, payload string) error {
+	// Buttons of old stub invoices do nothing once real payments are set up
+	if s.sm.Config.Telegram.PaymentProviderToken != telegram.StubProviderToken {
+		return nil
+	}
+
+	order, err := s.invoiceOrder(payload)
+	if err != nil {
+		return s.SendMessage(contact.TelegramChatID, "❌ Pesanan tidak ditemukan.")
+	}
+	invoice, err := s.orderInvoice(order)
+	if err != nil {
+		return err
+	}
+
+	query, payment := telegram.StubPayment(from, *invoice)
+	if errorMessage := s.checkPreCheckout(query); errorMessage != "" {
+		return s.SendMessage(contact.TelegramChatID, "❌ "+errorMessage)
+	}
+	return s.handleSuccessfulPayment(contact, payment)
+}
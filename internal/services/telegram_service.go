@@ -1,47 +1,91 @@
 package services
 
 import (
+	"context"
+	"crypto/subtle"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"net/url"
 	"strings"
+	"sync"
 	"time"
 
+	"whatsapp-bot/internal/models"
+	"whatsapp-bot/pkg/logger"
+	"whatsapp-bot/pkg/telegram"
+	"whatsapp-bot/pkg/utils"
+
 	"github.com/google/uuid"
-	"kilocode.dev/whatsapp-bot/internal/models"
-	"kilocode.dev/whatsapp-bot/pkg/logger"
-	"kilocode.dev/whatsapp-bot/pkg/telegram"
+	"github.com/jinzhu/gorm"
+	"github.com/sirupsen/logrus"
+)
+
+var (
+	ErrTelegramPollingActive   = errors.New("Telegram polling is already running")
+	ErrTelegramPollingInactive = errors.New("Telegram polling is not running")
 )
 
+// telegramAllowedUpdates are the update types the bot handles, requested
+// both when polling and when registering the webhook.
+var telegramAllowedUpdates = []string{"message", "callback_query", "inline_query", "chosen_inline_result", "my_chat_member", "pre_checkout_query"}
+
+// TelegramService runs one bot. sm.TelegramService is the bot configured
+// with TELEGRAM_BOT_TOKEN; TelegramBotService runs one per TelegramBot.
 type TelegramService struct {
-	db     *Database
+	sm     *ServiceManager
 	client *telegram.Client
-}
+	bot    *models.TelegramBot // nil for the configured bot
 
-func NewTelegramService(db *Database, apiKey string) *TelegramService {
-	return &TelegramService{
-		db:     db,
-		client: telegram.NewClient(apiKey),
-	}
+	mu          sync.Mutex
+	stopPolling context.CancelFunc
+	pollingDone chan struct{}
+
+	commandsMu      sync.RWMutex
+	builtinCommands []telegramBuiltinCommand
+	botUsername     string
 }
 
-// SendMessage sends a text message to Telegram
+// SendMessage sends a text message to Telegram. The text is sent as plain
+// text, so it needs no escaping, and is split if it is too long.
 func (s *TelegramService) SendMessage(chatID int64, text string) error {
-	return s.client.SendMessage(chatID, text, "")
+	return s.client.SendFormatted(chatID, telegram.PlainText(text), nil)
 }
 
 // SendMessageWithMarkup sends a message with custom keyboard markup
 func (s *TelegramService) SendMessageWithMarkup(chatID int64, text string, markup interface{}) error {
-	return s.client.SendMessageWithMarkup(chatID, text, markup)
+	return s.client.SendFormatted(chatID, telegram.PlainText(text), markup)
+}
+
+// SendFormatted sends a message built with telegram.NewFormatter.
+func (s *TelegramService) SendFormatted(chatID int64, f *telegram.Formatter, markup interface{}) error {
+	return s.client.SendFormatted(chatID, f, markup)
 }
 
 // SendPhoto sends a photo to Telegram
 func (s *TelegramService) SendPhoto(chatID int64, photoURL string, caption string) error {
-	return s.client.SendPhoto(chatID, photoURL, caption)
+	return sendTelegramCaptioned(s.client, chatID, caption, func(caption string) error {
+		return s.client.SendPhoto(chatID, photoURL, caption)
+	})
 }
 
 // SendDocument sends a document to Telegram
 func (s *TelegramService) SendDocument(chatID int64, documentURL string, caption string) error {
-	return s.client.SendDocument(chatID, documentURL, caption)
+	return sendTelegramCaptioned(s.client, chatID, caption, func(caption string) error {
+		return s.client.SendDocument(chatID, documentURL, caption)
+	})
+}
+
+// sendTelegramCaptioned sends media with its caption. Captions longer than
+// Telegram allows follow the media as a separate message.
+func sendTelegramCaptioned(client *telegram.Client, chatID int64, caption string, send func(caption string) error) error {
+	if telegram.PlainText(caption).Len() <= telegram.MaxCaptionLength {
+		return send(caption)
+	}
+	if err := send(""); err != nil {
+		return err
+	}
+	return client.SendFormatted(chatID, telegram.PlainText(caption), nil)
 }
 
 // SendLocation sends a location to Telegram
@@ -54,18 +98,28 @@ func (s *TelegramService) ProcessWebhook(updateData map[string]interface{}) erro
 	// Convert map to Update struct
 	update, err := s.parseUpdate(updateData)
 	if err != nil {
-		logger.Error("Failed to parse Telegram update", err)
+		logger.Log.WithError(err).Error("Failed to parse Telegram update")
 		return err
 	}
 
+	return s.handleUpdate(update)
+}
+
+// handleUpdate records an update and processes it. Webhook and polling
+// deliveries both end up here.
+func (s *TelegramService) handleUpdate(update *telegram.Update) error {
 	// Save update to database
 	if err := s.saveUpdate(update); err != nil {
-		logger.Error("Failed to save Telegram update", err)
+		logger.Log.WithError(err).Error("Failed to save Telegram update")
 		return err
 	}
 
 	// Process the update
-	return s.processUpdate(update)
+	if err := s.processUpdate(update); err != nil {
+		s.recordError("Failed to process Telegram update", err, map[string]interface{}{"update_id": update.UpdateID})
+		return err
+	}
+	return nil
 }
 
 func (s *TelegramService) parseUpdate(data map[string]interface{}) (*telegram.Update, error) {
@@ -82,28 +136,128 @@ func (s *TelegramService) parseUpdate(data map[string]interface{}) (*telegram.Up
 	return &update, nil
 }
 
+// ForBot returns the service of a hosted bot, or the configured bot's for a
+// nil ID.
+func (s *TelegramService) ForBot(botID *uuid.UUID) *TelegramService {
+	return s.sm.TelegramFor(botID)
+}
+
+// BotID returns the ID of the TelegramBot this service runs, or nil for
+// the configured bot.
+func (s *TelegramService) BotID() *uuid.UUID {
+	if s.bot == nil {
+		return nil
+	}
+	id := s.bot.ID
+	return &id
+}
+
+// ownerID returns the user whose contacts and analytics this bot's chats
+// belong to.
+func (s *TelegramService) ownerID() (uuid.UUID, error) {
+	if s.bot != nil && s.bot.UserID != uuid.Nil {
+		return s.bot.UserID, nil
+	}
+	return s.sm.ContactService.defaultOwnerID()
+}
+
 func (s *TelegramService) saveUpdate(update *telegram.Update) error {
 	telegramMessage := &models.TelegramMessage{
 		ID:        uuid.New(),
+		BotID:     s.BotID(),
 		UpdateID:  update.UpdateID,
+		Direction: "incoming",
 		CreatedAt: time.Now(),
 	}
 
 	if update.Message != nil {
-		telegramMessage.ChatID = update.Message.ChatID
+		telegramMessage.ChatID = update.Message.GetChatID()
+		telegramMessage.MessageID = update.Message.MessageID
 		telegramMessage.Text = update.Message.Text
 		telegramMessage.MessageType = "message"
+		if update.Message.From != nil {
+			telegramMessage.FromUserID = update.Message.From.ID
+			telegramMessage.FromUsername = update.Message.From.Username
+		}
+		if media := telegramMessageMedia(update.Message); media != nil {
+			telegramMessage.FileID = media.FileID
+			telegramMessage.MediaType = media.Type
+			telegramMessage.MediaMimeType = media.MimeType
+		}
 	} else if update.CallbackQuery != nil {
 		telegramMessage.ChatID = update.CallbackQuery.From.ID
 		telegramMessage.Text = update.CallbackQuery.Data
 		telegramMessage.MessageType = "callback_query"
+		telegramMessage.FromUserID = update.CallbackQuery.From.ID
+		telegramMessage.FromUsername = update.CallbackQuery.From.Username
+	} else if update.InlineQuery != nil {
+		telegramMessage.ChatID = update.InlineQuery.From.ID
+		telegramMessage.Text = update.InlineQuery.Query
+		telegramMessage.MessageType = "inline_query"
+		telegramMessage.FromUserID = update.InlineQuery.From.ID
+		telegramMessage.FromUsername = update.InlineQuery.From.Username
+	} else if update.PreCheckoutQuery != nil {
+		telegramMessage.ChatID = update.PreCheckoutQuery.From.ID
+		telegramMessage.Text = update.PreCheckoutQuery.InvoicePayload
+		telegramMessage.MessageType = "pre_checkout_query"
+		telegramMessage.FromUserID = update.PreCheckoutQuery.From.ID
+		telegramMessage.FromUsername = update.PreCheckoutQuery.From.Username
+	}
+
+	if err := s.sm.DB.Create(telegramMessage).Error; err != nil {
+		return err
 	}
 
-	return s.db.DB.Create(telegramMessage).Error
+	if s.bot != nil {
+		s.sm.DB.Model(&models.TelegramBot{}).Where("id = ?", s.bot.ID).
+			UpdateColumn("message_count", gorm.Expr("message_count + 1"))
+	}
+	return nil
+}
+
+// recordOutgoing stores every message the bot sends, so sent and failed
+// messages show up in the analytics.
+func (s *TelegramService) recordOutgoing(sent telegram.SentMessage) {
+	telegramMessage := &models.TelegramMessage{
+		ID:          uuid.New(),
+		BotID:       s.BotID(),
+		ChatID:      sent.ChatID,
+		MessageID:   sent.MessageID,
+		Text:        sent.Text,
+		MessageType: sent.Type,
+		Direction:   "outgoing",
+		Status:      "sent",
+		CreatedAt:   time.Now(),
+	}
+	if sent.Err != nil {
+		telegramMessage.Status = "failed"
+	}
+
+	if err := s.sm.DB.Create(telegramMessage).Error; err != nil {
+		logger.Log.WithError(err).WithField("chat_id", sent.ChatID).Error("Failed to record outgoing Telegram message")
+	}
+}
+
+// recordError keeps an error in the system log, where the analytics
+// rollup counts it for this bot.
+func (s *TelegramService) recordError(message string, err error, context map[string]interface{}) {
+	context["platform"] = PlatformTelegram
+	context["error"] = err.Error()
+	if botID := s.BotID(); botID != nil {
+		context["bot_id"] = botID.String()
+	}
+	details, _ := json.Marshal(context)
+
+	ownerID, _ := s.ownerID()
+	s.sm.DB.Create(&models.SystemLog{
+		UserID:  ownerID,
+		Level:   "error",
+		Message: message,
+		Context: string(details),
+	})
 }
 
 func (s *TelegramService) processUpdate(update *telegram.Update) error {
-	// Handle auto-replies for Telegram
 	if update.Message != nil {
 		return s.handleTelegramMessage(update.Message)
 	}
@@ -113,364 +267,393 @@ func (s *TelegramService) processUpdate(update *telegram.Update) error {
 		return s.handleCallbackQuery(update.CallbackQuery)
 	}
 
+	// Handle inline mode
+	if update.InlineQuery != nil {
+		return s.handleInlineQuery(update.InlineQuery)
+	}
+	if update.ChosenInlineResult != nil {
+		return s.handleChosenInlineResult(update.ChosenInlineResult)
+	}
+
+	// Handle the bot being added to or removed from groups
+	if update.MyChatMember != nil {
+		return s.handleMyChatMember(update.MyChatMember)
+	}
+
+	// Confirm checkouts of order invoices
+	if update.PreCheckoutQuery != nil {
+		return s.handlePreCheckoutQuery(update.PreCheckoutQuery)
+	}
+
 	return nil
 }
 
+// handleTelegramMessage runs a chat message through the same command
+// handlers as WhatsApp messages.
 func (s *TelegramService) handleTelegramMessage(message *telegram.Message) error {
-	logger.Info("Handling Telegram message", map[string]interface{}{
-		"chat_id": message.ChatID,
-		"text":    message.Text,
-	})
+	// Never answer other bots, which could reply in a loop
+	if message.From != nil && message.From.IsBot {
+		return nil
+	}
 
-	// Get auto-replies for Telegram
-	var autoReplies []models.AutoReply
-	if err := s.db.DB.Where("is_active = ? AND platform = ?", true, "telegram").Find(&autoReplies).Error; err != nil {
-		logger.Error("Failed to get Telegram auto-replies", err)
+	// Member changes, /mod and moderation in groups
+	if isGroupChat(message.Chat) {
+		if handled, err := s.handleGroupMessage(message); handled || err != nil {
+			return err
+		}
+	}
+
+	chatID := message.GetChatID()
+	contact, err := s.sm.ContactService.FindOrCreateTelegramContact(s.BotID(), chatID, telegramDisplayName(message.From))
+	if err != nil {
+		logger.Log.WithError(err).Error("Failed to find Telegram contact")
 		return err
 	}
 
-	// Check for matching auto-reply
-	for _, reply := range autoReplies {
-		if s.matchesTrigger(message.Text, reply.Trigger, reply.MatchType) {
-			// Send auto-reply
-			if err := s.SendMessage(message.ChatID, reply.Response); err != nil {
-				logger.Error("Failed to send auto-reply", err)
-				return err
-			}
+	if message.SuccessfulPayment != nil {
+		return s.handleSuccessfulPayment(contact, message.SuccessfulPayment)
+	}
 
-			// Save auto-reply usage
-			s.saveAutoReplyUsage(reply.ID, message.ChatID)
-			return nil
-		}
+	content, messageType := normalizeTelegramCommand(message.Text), "text"
+	media := telegramMessageMedia(message)
+	if media != nil {
+		content, messageType = message.Caption, media.Type
 	}
 
-	// Default response if no auto-reply matches
-	return s.handleDefaultResponse(message)
-}
+	incomingMessage, err := s.saveIncomingMessage(contact, telegramMessageID(chatID, message.MessageID), content, messageType, message.ReplyToMessage)
+	if err != nil {
+		return err
+	}
 
-func (s *TelegramService) handleCallbackQuery(callbackQuery *telegram.CallbackQuery) error {
-	logger.Info("Handling Telegram callback query", map[string]interface{}{
-		"callback_id": callbackQuery.ID,
-		"data":        callbackQuery.Data,
-	})
+	if media != nil {
+		s.ingestMedia(message, incomingMessage, media)
+	}
 
-	// Answer the callback query
-	responseText := fmt.Sprintf("You selected: %s", callbackQuery.Data)
-	if err := s.client.AnswerCallbackQuery(callbackQuery.ID, responseText); err != nil {
-		logger.Error("Failed to answer callback query", err)
+	s.sm.BridgeService.RelayFromTelegram(contact, incomingMessage, message)
+
+	if handled, err := s.dispatchCommand(contact, message); handled {
 		return err
 	}
 
-	// Handle specific callback data
-	switch callbackQuery.Data {
-	case "menu_main":
-		return s.showMainMenu(callbackQuery.From.ID)
-	case "menu_games":
-		return s.showGamesMenu(callbackQuery.From.ID)
-	case "menu_utilities":
-		return s.showUtilitiesMenu(callbackQuery.From.ID)
-	case "menu_business":
-		return s.showBusinessMenu(callbackQuery.From.ID)
-	default:
-		// Handle game or utility callbacks
-		if len(callbackQuery.Data) > 5 && callbackQuery.Data[:5] == "game_" {
-			return s.handleGameCallback(callbackQuery)
-		}
-		if len(callbackQuery.Data) > 5 && callbackQuery.Data[:5] == "util_" {
-			return s.handleUtilityCallback(callbackQuery)
-		}
+	// Answers to a running wizard don't go through the command handlers
+	userID := chatID
+	if message.From != nil {
+		userID = message.From.ID
+	}
+	if handled, err := s.processWizard(contact, userID, incomingMessage, ""); handled || err != nil {
+		return err
 	}
 
-	return nil
-}
-
-func (s *TelegramService) handleDefaultResponse(message *telegram.Message) error {
-	// Show main menu with inline keyboard
-	keyboard := map[string]interface{}{
-		"inline_keyboard": [][]map[string]interface{}{
-			{
-				{"text": "🎮 Games", "callback_data": "menu_games"},
-				{"text": "🛠️ Utilities", "callback_data": "menu_utilities"},
-			},
-			{
-				{"text": "💼 Business", "callback_data": "menu_business"},
-				{"text": "📊 Analytics", "callback_data": "menu_analytics"},
-			},
-			{
-				{"text": "⚙️ Settings", "callback_data": "menu_settings"},
-				{"text": "❓ Help", "callback_data": "menu_help"},
-			},
-		},
+	if handled, err := s.processSettingsCommand(contact, userID, incomingMessage); handled {
+		return err
 	}
 
-	welcomeText := "Welcome to Multi-Platform Bot! 🚀\n\nI can help you with:\n• Games and entertainment\n• Productivity tools\n• Business management\n• WhatsApp integration\n\nChoose an option below:"
-	
-	return s.SendMessageWithMarkup(message.ChatID, welcomeText, keyboard)
-}
+	if handled, err := s.processMediaCommand(contact, incomingMessage, media); handled {
+		return err
+	}
 
-func (s *TelegramService) showMainMenu(chatID int64) error {
-	keyboard := map[string]interface{}{
-		"inline_keyboard": [][]map[string]interface{}{
-			{
-				{"text": "🎮 Games", "callback_data": "menu_games"},
-				{"text": "🛠️ Utilities", "callback_data": "menu_utilities"},
-			},
-			{
-				{"text": "💼 Business", "callback_data": "menu_business"},
-				{"text": "📊 Analytics", "callback_data": "menu_analytics"},
-			},
-			{
-				{"text": "⚙️ Settings", "callback_data": "menu_settings"},
-				{"text": "❓ Help", "callback_data": "menu_help"},
-			},
-		},
+	if handled, err := s.processPaymentCommand(contact, incomingMessage); handled {
+		return err
 	}
 
-	text := "Main Menu 🏠\n\nWhat would you like to do?"
-	return s.SendMessageWithMarkup(chatID, text, keyboard)
+	return s.sm.HandleConversationMessage(contact, incomingMessage, "")
 }
 
-func (s *TelegramService) showGamesMenu(chatID int64) error {
-	keyboard := map[string]interface{}{
-		"inline_keyboard": [][]map[string]interface{}{
-			{
-				{"text": "🧠 Trivia", "callback_data": "game_trivia"},
-				{"text": "🔢 Math Quiz", "callback_data": "game_math"},
-			},
-			{
-				{"text": "📝 Word Game", "callback_data": "game_word"},
-				{"text": "🧩 Memory Game", "callback_data": "game_memory"},
-			},
-			{
-				{"text": "🏆 Leaderboard", "callback_data": "game_leaderboard"},
-				{"text": "📊 Game Stats", "callback_data": "game_stats"},
-			},
-			{
-				{"text": "🔙 Back to Main", "callback_data": "menu_main"},
-			},
-		},
+// handleCallbackQuery treats a tapped inline keyboard button like a tapped
+// WhatsApp button: the callback data is the reply ID.
+func (s *TelegramService) handleCallbackQuery(callbackQuery *telegram.CallbackQuery) error {
+	// Stop the button's loading indicator
+	if err := s.client.AnswerCallbackQuery(callbackQuery.ID, ""); err != nil {
+		logger.Log.WithError(err).Error("Failed to answer callback query")
 	}
 
-	text := "🎮 Games Menu\n\nChoose a game to play:"
-	return s.SendMessageWithMarkup(chatID, text, keyboard)
-}
+	chatID := callbackQuery.From.ID
+	if callbackQuery.Message != nil {
+		chatID = callbackQuery.Message.GetChatID()
+	}
 
-func (s *TelegramService) showUtilitiesMenu(chatID int64) error {
-	keyboard := map[string]interface{}{
-		"inline_keyboard": [][]map[string]interface{}{
-			{
-				{"text": "📱 QR Code", "callback_data": "util_qr"},
-				{"text": "🔗 Short Link", "callback_data": "util_shortlink"},
-			},
-			{
-				{"text": "💱 Currency", "callback_data": "util_currency"},
-				{"text": "🌤️ Weather", "callback_data": "util_weather"},
-			},
-			{
-				{"text": "🌐 Translate", "callback_data": "util_translate"},
-				{"text": "📍 Location", "callback_data": "util_location"},
-			},
-			{
-				{"text": "📊 Poll", "callback_data": "util_poll"},
-				{"text": "⏰ Timer", "callback_data": "util_timer"},
-			},
-			{
-				{"text": "🔙 Back to Main", "callback_data": "menu_main"},
-			},
-		},
+	contact, err := s.sm.ContactService.FindOrCreateTelegramContact(s.BotID(), chatID, telegramDisplayName(&callbackQuery.From))
+	if err != nil {
+		logger.Log.WithError(err).Error("Failed to find Telegram contact")
+		return err
 	}
 
-	text := "🛠️ Utilities Menu\n\nChoose a utility tool:"
-	return s.SendMessageWithMarkup(chatID, text, keyboard)
-}
+	messageID := fmt.Sprintf("telegram:%d:callback:%s", chatID, callbackQuery.ID)
+	incomingMessage, err := s.saveIncomingMessage(contact, messageID, callbackQuery.Data, "interactive", nil)
+	if err != nil {
+		return err
+	}
 
-func (s *TelegramService) showBusinessMenu(chatID int64) error {
-	keyboard := map[string]interface{}{
-		"inline_keyboard": [][]map[string]interface{}{
-			{
-				{"text": "📦 Products", "callback_data": "business_products"},
-				{"text": "📋 Orders", "callback_data": "business_orders"},
-			},
-			{
-				{"text": "💰 Invoices", "callback_data": "business_invoices"},
-				{"text": "👥 Customers", "callback_data": "business_customers"},
-			},
-			{
-				{"text": "📊 Business Stats", "callback_data": "business_stats"},
-				{"text": "📈 Sales Report", "callback_data": "business_report"},
-			},
-			{
-				{"text": "🔙 Back to Main", "callback_data": "menu_main"},
-			},
-		},
+	if payload, ok := telegram.StubPaymentPayload(callbackQuery.Data); ok {
+		return s.payWithStub(contact, callbackQuery.From, payload)
 	}
 
-	text := "💼 Business Menu\n\nManage your business:"
-	return s.SendMessageWithMarkup(chatID, text, keyboard)
+	if handled, err := s.processWizard(contact, callbackQuery.From.ID, incomingMessage, callbackQuery.Data); handled || err != nil {
+		return err
+	}
+
+	return s.sm.HandleConversationMessage(contact, incomingMessage, callbackQuery.Data)
 }
 
-func (s *TelegramService) handleGameCallback(callbackQuery *telegram.CallbackQuery) error {
-	// Handle game-related callbacks
-	gameType := callbackQuery.Data[5:] // Remove "game_" prefix
-	
-	switch gameType {
-	case "trivia":
-		return s.startTriviaGame(callbackQuery.From.ID)
-	case "math":
-		return s.startMathGame(callbackQuery.From.ID)
-	case "word":
-		return s.startWordGame(callbackQuery.From.ID)
-	case "memory":
-		return s.startMemoryGame(callbackQuery.From.ID)
-	case "leaderboard":
-		return s.showGameLeaderboard(callbackQuery.From.ID)
-	case "stats":
-		return s.showGameStats(callbackQuery.From.ID)
-	default:
-		return s.SendMessage(callbackQuery.From.ID, "Game not implemented yet!")
+func (s *TelegramService) saveIncomingMessage(contact *models.Contact, messageID, content, messageType string, replyTo *telegram.Message) (*models.Message, error) {
+	now := time.Now()
+	incomingMessage := &models.Message{
+		UserID:      contact.UserID,
+		ContactID:   contact.ID,
+		MessageID:   messageID,
+		Content:     content,
+		MessageType: messageType,
+		Direction:   "incoming",
+		Status:      "received",
+		Timestamp:   now,
+	}
+	if replyTo != nil {
+		incomingMessage.IsReply = true
+		incomingMessage.ReplyToID = telegramMessageID(contact.TelegramChatID, replyTo.MessageID)
+	}
+	if err := s.sm.DB.Create(incomingMessage).Error; err != nil {
+		logger.Log.WithError(err).Error("Failed to save Telegram message")
+		return nil, err
 	}
-}
 
-func (s *TelegramService) handleUtilityCallback(callbackQuery *telegram.CallbackQuery) error {
-	// Handle utility-related callbacks
-	utilType := callbackQuery.Data[5:] // Remove "util_" prefix
-	
-	switch utilType {
-	case "qr":
-		return s.showQRInstructions(callbackQuery.From.ID)
-	case "shortlink":
-		return s.showShortLinkInstructions(callbackQuery.From.ID)
-	case "currency":
-		return s.showCurrencyInstructions(callbackQuery.From.ID)
-	case "weather":
-		return s.showWeatherInstructions(callbackQuery.From.ID)
-	case "translate":
-		return s.showTranslateInstructions(callbackQuery.From.ID)
-	case "location":
-		return s.showLocationInstructions(callbackQuery.From.ID)
-	case "poll":
-		return s.showPollInstructions(callbackQuery.From.ID)
-	case "timer":
-		return s.showTimerInstructions(callbackQuery.From.ID)
-	default:
-		return s.SendMessage(callbackQuery.From.ID, "Utility not implemented yet!")
+	if err := s.sm.ContactService.UpdateLastMessageTime(contact.ID, now); err != nil {
+		logger.Log.WithError(err).Error("Failed to update contact last message time")
 	}
-}
 
-func (s *TelegramService) startTriviaGame(chatID int64) error {
-	text := "🧠 Trivia Game\n\nStarting trivia game...\n\nPlease wait while I prepare questions for you!"
-	return s.SendMessage(chatID, text)
+	return incomingMessage, nil
 }
 
-func (s *TelegramService) startMathGame(chatID int64) error {
-	text := "🔢 Math Quiz\n\nStarting math quiz...\n\nGet ready for some mathematical challenges!"
-	return s.SendMessage(chatID, text)
+// telegramMessageID builds the message ID stored for a Telegram message.
+// Telegram message IDs are only unique within a chat.
+func telegramMessageID(chatID int64, messageID int) string {
+	return fmt.Sprintf("telegram:%d:%d", chatID, messageID)
 }
 
-func (s *TelegramService) startWordGame(chatID int64) error {
-	text := "📝 Word Game\n\nStarting word game...\n\nLet's test your vocabulary!"
-	return s.SendMessage(chatID, text)
-}
+// normalizeTelegramCommand turns bot commands such as "/start" or
+// "/kuis@MyBot" into the plain keywords the command handlers understand.
+func normalizeTelegramCommand(text string) string {
+	if !strings.HasPrefix(text, "/") {
+		return text
+	}
 
-func (s *TelegramService) startMemoryGame(chatID int64) error {
-	text := "🧩 Memory Game\n\nStarting memory game...\n\nTest your memory skills!"
-	return s.SendMessage(chatID, text)
-}
+	fields := strings.Fields(text)
+	command := strings.TrimPrefix(fields[0], "/")
+	if i := strings.Index(command, "@"); i >= 0 {
+		command = command[:i]
+	}
+	if command == "start" {
+		command = "menu"
+	}
 
-func (s *TelegramService) showGameLeaderboard(chatID int64) error {
-	text := "🏆 Game Leaderboard\n\nTop players:\n1. Player1 - 1000 points\n2. Player2 - 850 points\n3. Player3 - 750 points"
-	return s.SendMessage(chatID, text)
+	fields[0] = command
+	return strings.Join(fields, " ")
 }
 
-func (s *TelegramService) showGameStats(chatID int64) error {
-	text := "📊 Game Statistics\n\nYour stats:\n• Games played: 10\n• Total score: 5000\n• Average score: 500\n• Win rate: 70%"
-	return s.SendMessage(chatID, text)
+func telegramDisplayName(user *telegram.User) string {
+	if user == nil {
+		return ""
+	}
+	name := strings.TrimSpace(user.FirstName + " " + user.LastName)
+	if name == "" {
+		return user.Username
+	}
+	return name
 }
 
-func (s *TelegramService) showQRInstructions(chatID int64) error {
-	text := "📱 QR Code Generator\n\nTo generate a QR code, send me a message like:\n`Generate QR for: https://example.com`"
-	return s.SendMessage(chatID, text)
+func (s *TelegramService) GetStatus() map[string]interface{} {
+	return s.client.GetStatus()
 }
 
-func (s *TelegramService) showShortLinkInstructions(chatID int64) error {
-	text := "🔗 Short Link Generator\n\nTo create a short link, send me a message like:\n`Shorten: https://very-long-url-example.com`"
-	return s.SendMessage(chatID, text)
+// StartReceiving starts receiving updates: through the webhook URL when
+// there is one, otherwise by polling.
+func (s *TelegramService) StartReceiving() error {
+	if url := s.webhookURL(); url != "" {
+		return s.SetWebhook(url)
+	}
+	return s.StartPolling()
 }
 
-func (s *TelegramService) showCurrencyInstructions(chatID int64) error {
-	text := "💱 Currency Converter\n\nTo convert currency, send me a message like:\n`Convert 100 USD to EUR`"
-	return s.SendMessage(chatID, text)
-}
+// webhookURL returns the URL updates should be delivered to. A hosted bot
+// without its own URL gets /webhooks/telegram/:bot_id on the configured
+// bot's host.
+func (s *TelegramService) webhookURL() string {
+	configured := s.sm.Config.Telegram.WebhookURL
+	if s.bot == nil {
+		return configured
+	}
+	if s.bot.WebhookURL != "" || configured == "" {
+		return s.bot.WebhookURL
+	}
 
-func (s *TelegramService) showWeatherInstructions(chatID int64) error {
-	text := "🌤️ Weather Information\n\nTo get weather info, send me a message like:\n`Weather in Jakarta, Indonesia`"
-	return s.SendMessage(chatID, text)
+	derived, err := url.Parse(configured)
+	if err != nil {
+		logger.Log.WithError(err).Warn("Invalid TELEGRAM_WEBHOOK_URL, polling the hosted bot instead")
+		return ""
+	}
+	derived.Path = "/webhooks/telegram/" + s.bot.ID.String()
+	derived.RawQuery = ""
+	return derived.String()
 }
 
-func (s *TelegramService) showTranslateInstructions(chatID int64) error {
-	text := "🌐 Translation Service\n\nTo translate text, send me a message like:\n`Translate \"Hello\" to Indonesian`"
-	return s.SendMessage(chatID, text)
-}
+// StartPolling switches the bot to polling mode. The webhook is removed and
+// updates are fetched in the background, resuming after the last update
+// processed before a restart.
+func (s *TelegramService) StartPolling() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.stopPolling != nil {
+		return ErrTelegramPollingActive
+	}
+
+	// Telegram refuses getUpdates while a webhook is set
+	if err := s.client.DeleteWebhook(); err != nil {
+		return err
+	}
+
+	state, err := s.updateState()
+	if err != nil {
+		return err
+	}
+	if err := s.sm.DB.Model(state).Updates(map[string]interface{}{"url": "", "is_active": false}).Error; err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	s.stopPolling, s.pollingDone = cancel, done
 
-func (s *TelegramService) showLocationInstructions(chatID int64) error {
-	text := "📍 Location Services\n\nTo get location info, send me your location or:\n`Location info for: -6.2088, 106.8456`"
-	return s.SendMessage(chatID, text)
+	go func() {
+		defer close(done)
+		s.client.StartPolling(ctx, telegram.PollOptions{
+			Offset:         state.LastUpdateID + 1,
+			Timeout:        s.sm.Config.Telegram.PollTimeout,
+			AllowedUpdates: telegramAllowedUpdates,
+		}, func(update telegram.Update) error {
+			err := s.handleUpdate(&update)
+
+			// Commit the offset so a restart resumes after this update
+			if dbErr := s.sm.DB.Model(state).Update("last_update_id", update.UpdateID).Error; dbErr != nil {
+				logger.Log.WithError(dbErr).Error("Failed to save Telegram update offset")
+			}
+			return err
+		})
+	}()
+
+	return nil
 }
 
-func (s *TelegramService) showPollInstructions(chatID int64) error {
-	text := "📊 Poll Creator\n\nTo create a poll, send me a message like:\n`Create poll: What's your favorite color? Options: Red, Blue, Green`"
-	return s.SendMessage(chatID, text)
+// StopPolling stops polling and waits for the update being processed, if
+// any, to finish.
+func (s *TelegramService) StopPolling() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.stopPolling == nil {
+		return ErrTelegramPollingInactive
+	}
+
+	s.stopPolling()
+	<-s.pollingDone
+	s.stopPolling, s.pollingDone = nil, nil
+	return nil
 }
 
-func (s *TelegramService) showTimerInstructions(chatID int64) error {
-	text := "⏰ Timer Service\n\nTo set a timer, send me a message like:\n`Timer for 5 minutes: Take a break`"
-	return s.SendMessage(chatID, text)
+func (s *TelegramService) IsPolling() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.stopPolling != nil
 }
 
-func (s *TelegramService) matchesTrigger(text, trigger, matchType string) bool {
-	switch matchType {
-	case "exact":
-		return text == trigger
-	case "contains":
-		return strings.Contains(text, trigger)
-	case "regex":
-		// Simple regex matching (in production, use proper regex library)
-		return strings.Contains(text, trigger)
-	default:
-		return false
+// SetWebhook switches the bot to webhook mode, stopping polling first.
+func (s *TelegramService) SetWebhook(webhookURL string) error {
+	if err := s.StopPolling(); err != nil && err != ErrTelegramPollingInactive {
+		return err
 	}
-}
 
-func (s *TelegramService) saveAutoReplyUsage(replyID uuid.UUID, chatID int64) {
-	usage := &models.AutoReplyUsage{
-		ID:           uuid.New(),
-		AutoReplyID:  replyID,
-		Platform:     "telegram",
-		RecipientID:  fmt.Sprintf("%d", chatID),
-		UsedAt:       time.Now(),
+	state, err := s.updateState()
+	if err != nil {
+		return err
 	}
 
-	if err := s.db.DB.Create(usage).Error; err != nil {
-		logger.Error("Failed to save auto-reply usage", err)
+	// Deliveries must echo the secret, see VerifyWebhookSecret
+	if state.SecretToken == "" {
+		state.SecretToken = utils.GenerateRandomHex(64)
+		if err := s.sm.DB.Model(state).Update("secret_token", state.SecretToken).Error; err != nil {
+			return err
+		}
 	}
-}
 
-func (s *TelegramService) GetStatus() map[string]interface{} {
-	return s.client.GetStatus()
+	if err := s.client.SetWebhook(webhookURL, telegram.WebhookOptions{
+		AllowedUpdates: telegramAllowedUpdates,
+		SecretToken:    state.SecretToken,
+	}); err != nil {
+		return err
+	}
+
+	return s.sm.DB.Model(state).Updates(map[string]interface{}{"url": webhookURL, "is_active": true}).Error
 }
 
-func (s *TelegramService) StartPolling() error {
-	return s.client.StartPolling(func(update telegram.Update) error {
-		return s.processUpdate(&update)
+// VerifyWebhookSecret checks the X-Telegram-Bot-Api-Secret-Token header of a
+// webhook delivery against the secret registered with SetWebhook. Rejected
+// attempts are recorded in the system log.
+func (s *TelegramService) VerifyWebhookSecret(token, ipAddress, userAgent string) bool {
+	state, err := s.updateState()
+	if err != nil {
+		logger.Log.WithError(err).Error("Failed to load Telegram webhook secret")
+		return false
+	}
+
+	if state.SecretToken != "" && subtle.ConstantTimeCompare([]byte(token), []byte(state.SecretToken)) == 1 {
+		return true
+	}
+
+	logger.Log.WithFields(logrus.Fields{
+		"ip_address":    ipAddress,
+		"token_present": token != "",
+	}).Warn("Rejected Telegram webhook with invalid secret token")
+
+	details, _ := json.Marshal(map[string]interface{}{"token_present": token != ""})
+	s.sm.DB.Create(&models.SystemLog{
+		Level:     "warn",
+		Message:   "Rejected Telegram webhook with invalid secret token",
+		Context:   string(details),
+		IPAddress: ipAddress,
+		UserAgent: userAgent,
 	})
+	return false
 }
 
-func (s *TelegramService) SetWebhook(webhookURL string) error {
-	return s.client.SetWebhook(webhookURL)
+func (s *TelegramService) DeleteWebhook() error {
+	if err := s.client.DeleteWebhook(); err != nil {
+		return err
+	}
+
+	state, err := s.updateState()
+	if err != nil {
+		return err
+	}
+	return s.sm.DB.Model(state).Update("is_active", false).Error
 }
 
-func (s *TelegramService) DeleteWebhook() error {
-	return s.client.DeleteWebhook()
+// updateState returns the record holding the bot's webhook registration and
+// last processed update, creating it on first use.
+func (s *TelegramService) updateState() (*models.TelegramWebhook, error) {
+	query := s.sm.DB.Where("bot_id IS NULL")
+	if s.bot != nil {
+		query = s.sm.DB.Where("bot_id = ?", s.bot.ID)
+	}
+
+	state := &models.TelegramWebhook{}
+	err := query.Order("created_at").First(state).Error
+	if gorm.IsRecordNotFoundError(err) {
+		state = &models.TelegramWebhook{ID: uuid.New(), BotID: s.BotID()}
+		err = s.sm.DB.Create(state).Error
+	}
+	if err != nil {
+		return nil, err
+	}
+	return state, nil
 }
 
 func (s *TelegramService) GetWebhookInfo() (map[string]interface{}, error) {
@@ -512,22 +695,33 @@ func (s *TelegramService) SendBroadcast(recipients []int64, message string) erro
 	successCount := 0
 	failureCount := 0
 
+	deferredCount := 0
+	suppressedCount := 0
+
 	for _, chatID := range recipients {
-		if err := s.SendMessage(chatID, message); err != nil {
-			logger.Error("Failed to send broadcast message", err, map[string]interface{}{
+		result, err := s.notify(chatID, NotificationBroadcast, message, nil)
+		switch {
+		case err != nil:
+			logger.Log.WithError(err).WithFields(logrus.Fields{
 				"chat_id": chatID,
-			})
+			}).Error("Failed to send broadcast message")
 			failureCount++
-		} else {
+		case result == deliveryDeferred:
+			deferredCount++
+		case result == deliverySuppressed:
+			suppressedCount++
+		default:
 			successCount++
 		}
 	}
 
-	logger.Info("Telegram broadcast completed", map[string]interface{}{
-		"total":     len(recipients),
-		"success":   successCount,
-		"failure":   failureCount,
-	})
+	logger.Log.WithFields(logrus.Fields{
+		"total":      len(recipients),
+		"success":    successCount,
+		"failure":    failureCount,
+		"deferred":   deferredCount,
+		"suppressed": suppressedCount,
+	}).Info("Telegram broadcast completed")
 
 	return nil
 }
@@ -543,8 +737,8 @@ func (s *TelegramService) CreateTelegramUser(userID int64, username, firstName,
 		UpdatedAt:  time.Now(),
 	}
 
-	if err := s.db.DB.Create(telegramUser).Error; err != nil {
-		logger.Error("Failed to create Telegram user", err)
+	if err := s.sm.DB.Create(telegramUser).Error; err != nil {
+		logger.Log.WithError(err).Error("Failed to create Telegram user")
 		return nil, err
 	}
 
@@ -553,8 +747,8 @@ func (s *TelegramService) CreateTelegramUser(userID int64, username, firstName,
 
 func (s *TelegramService) GetTelegramUser(userID int64) (*models.TelegramUser, error) {
 	var user models.TelegramUser
-	if err := s.db.DB.Where("telegram_id = ?", userID).First(&user).Error; err != nil {
-		logger.Error("Failed to get Telegram user", err)
+	if err := s.sm.DB.Where("telegram_id = ?", userID).First(&user).Error; err != nil {
+		logger.Log.WithError(err).Error("Failed to get Telegram user")
 		return nil, err
 	}
 
@@ -563,8 +757,8 @@ func (s *TelegramService) GetTelegramUser(userID int64) (*models.TelegramUser, e
 
 func (s *TelegramService) UpdateTelegramUser(userID int64, username, firstName, lastName string) (*models.TelegramUser, error) {
 	var user models.TelegramUser
-	if err := s.db.DB.Where("telegram_id = ?", userID).First(&user).Error; err != nil {
-		logger.Error("Failed to get Telegram user for update", err)
+	if err := s.sm.DB.Where("telegram_id = ?", userID).First(&user).Error; err != nil {
+		logger.Log.WithError(err).Error("Failed to get Telegram user for update")
 		return nil, err
 	}
 
@@ -573,8 +767,8 @@ func (s *TelegramService) UpdateTelegramUser(userID int64, username, firstName,
 	user.LastName = lastName
 	user.UpdatedAt = time.Now()
 
-	if err := s.db.DB.Save(&user).Error; err != nil {
-		logger.Error("Failed to update Telegram user", err)
+	if err := s.sm.DB.Save(&user).Error; err != nil {
+		logger.Log.WithError(err).Error("Failed to update Telegram user")
 		return nil, err
 	}
 
@@ -583,34 +777,48 @@ func (s *TelegramService) UpdateTelegramUser(userID int64, username, firstName,
 
 func (s *TelegramService) GetTelegramMessages(chatID int64, limit int) ([]models.TelegramMessage, error) {
 	var messages []models.TelegramMessage
-	if err := s.db.DB.Where("chat_id = ?", chatID).
+	if err := s.sm.DB.Where("chat_id = ?", chatID).
 		Order("created_at desc").
 		Limit(limit).
 		Find(&messages).Error; err != nil {
-		logger.Error("Failed to get Telegram messages", err)
+		logger.Log.WithError(err).Error("Failed to get Telegram messages")
 		return nil, err
 	}
 
 	return messages, nil
 }
 
-func (s *TelegramService) GetTelegramStats() (map[string]interface{}, error) {
+// GetTelegramStats returns message and user counts. With a bot ID only
+// that bot's chats are counted.
+func (s *TelegramService) GetTelegramStats(botID *uuid.UUID) (map[string]interface{}, error) {
 	stats := make(map[string]interface{})
 
+	messages := func() *gorm.DB {
+		query := s.sm.DB.Model(&models.TelegramMessage{})
+		if botID != nil {
+			query = query.Where("bot_id = ?", *botID)
+		}
+		return query
+	}
+
 	// Total messages
 	var totalMessages int64
-	s.db.DB.Model(&models.TelegramMessage{}).Count(&totalMessages)
+	messages().Count(&totalMessages)
 	stats["total_messages"] = totalMessages
 
 	// Total users
 	var totalUsers int64
-	s.db.DB.Model(&models.TelegramUser{}).Count(&totalUsers)
+	if botID != nil {
+		messages().Select("COUNT(DISTINCT chat_id)").Scan(&totalUsers)
+	} else {
+		s.sm.DB.Model(&models.TelegramUser{}).Count(&totalUsers)
+	}
 	stats["total_users"] = totalUsers
 
 	// Messages today
 	var todayMessages int64
 	today := time.Now().Truncate(24 * time.Hour)
-	s.db.DB.Model(&models.TelegramMessage{}).
+	messages().
 		Where("created_at >= ?", today).
 		Count(&todayMessages)
 	stats["today_messages"] = todayMessages
@@ -618,7 +826,7 @@ func (s *TelegramService) GetTelegramStats() (map[string]interface{}, error) {
 	// Active users (last 30 days)
 	var activeUsers int64
 	thirtyDaysAgo := time.Now().AddDate(0, 0, -30)
-	s.db.DB.Model(&models.TelegramMessage{}).
+	messages().
 		Where("created_at >= ?", thirtyDaysAgo).
 		Select("COUNT(DISTINCT chat_id)").
 		Scan(&activeUsers)
@@ -627,39 +835,23 @@ func (s *TelegramService) GetTelegramStats() (map[string]interface{}, error) {
 	return stats, nil
 }
 
+// GetTelegramAnalytics returns the user's daily Telegram counters.
+func (s *TelegramService) GetTelegramAnalytics(userID uuid.UUID, botID *uuid.UUID, from, to time.Time) ([]TelegramAnalyticsPoint, error) {
+	return s.sm.TelegramAnalyticsService.GetSeries(userID, botID, from, to)
+}
+
 func (s *TelegramService) GetTelegramBroadcasts(userID uuid.UUID, status string, page int, limit int) ([]models.TelegramBroadcast, int, error) {
-	// This would be implemented by TelegramBroadcastService
-	// For now, return empty results
-	return []models.TelegramBroadcast{}, 0, nil
+	return s.sm.TelegramBroadcastService.GetTelegramBroadcasts(userID, status, page, limit)
 }
 
-func (s *TelegramService) CreateTelegramBroadcast(name string, message string, recipients []int64, userID uuid.UUID) (*models.TelegramBroadcast, error) {
-	// This would be implemented by TelegramBroadcastService
-	// For now, return a mock broadcast
-	broadcast := &models.TelegramBroadcast{
-		ID:         uuid.New(),
-		Name:       name,
-		Message:    message,
-		Recipients: recipients,
-		Status:     "created",
-		UserID:     userID,
-		CreatedAt:  time.Now(),
-		UpdatedAt:  time.Now(),
-	}
-	return broadcast, nil
+func (s *TelegramService) CreateTelegramBroadcast(name string, message string, recipients []int64, userID uuid.UUID, botID *uuid.UUID) (*models.TelegramBroadcast, error) {
+	return s.sm.TelegramBroadcastService.CreateTelegramBroadcast(name, message, recipients, userID, botID)
 }
 
 func (s *TelegramService) SendTelegramBroadcast(broadcastID uuid.UUID) error {
-	// This would be implemented by TelegramBroadcastService
-	return nil
+	return s.sm.TelegramBroadcastService.SendTelegramBroadcast(broadcastID)
 }
 
 func (s *TelegramService) GetTelegramBroadcastStats(broadcastID uuid.UUID) (map[string]interface{}, error) {
-	// This would be implemented by TelegramBroadcastService
-	return map[string]interface{}{
-		"broadcast_id": broadcastID,
-		"status":        "completed",
-		"total_sent":    100,
-		"success_rate":  95,
-	}, nil
-}
\ No newline at end of file
+	return s.sm.TelegramBroadcastService.GetTelegramBroadcastStats(broadcastID)
+}
@@ -0,0 +1,465 @@
+package services
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"whatsapp-bot/internal/models"
+	"whatsapp-bot/pkg/logger"
+
+	"github.com/go-redis/redis/v8"
+	"github.com/google/uuid"
+	"github.com/jinzhu/gorm"
+)
+
+const (
+	telegramSessionKeyPrefix = "telegram:session:"
+	wizardCallbackPrefix     = "wizard:"
+	wizardCancelID           = wizardCallbackPrefix + "cancel"
+	wizardDoneID             = wizardCallbackPrefix + "done"
+	wizardDefaultTimeout     = 5 * time.Minute
+	wizardMinTimer           = time.Minute
+	wizardMaxTimer           = 24 * time.Hour
+)
+
+// wizardStep asks for one input. Options are offered as buttons, and a step
+// with options only accepts one of them unless Validate says otherwise.
+// A Repeat step keeps collecting answers until the user sends "selesai"
+// (at least Min answers) or Max answers are given.
+type wizardStep struct {
+	Key      string
+	Prompt   string
+	Options  []ChannelOption
+	Repeat   bool
+	Min, Max int
+	// Validate checks the input and returns the value to store. Its error
+	// is shown to the user, who is asked again.
+	Validate func(input string) (string, error)
+}
+
+// wizard collects inputs over several messages and then runs Finish with
+// the answers, keyed by step. The session expires after Timeout without a
+// reply.
+type wizard struct {
+	Name     string
+	Triggers []string
+	Timeout  time.Duration
+	Steps    []wizardStep
+	Finish   func(s *TelegramService, contact *models.Contact, answers map[string][]string) error
+}
+
+// wizardState is the progress of a running wizard, kept in Redis so it
+// expires on its own. Each user in a chat has their own wizard, so group
+// members don't answer each other's prompts.
+type wizardState struct {
+	Wizard  string              `json:"wizard"`
+	Step    int                 `json:"step"`
+	Answers map[string][]string `json:"answers"`
+}
+
+var telegramWizards = []wizard{
+	{
+		Name:     "qr",
+		Triggers: []string{"buat qr", "create qr", "qr"},
+		Steps: []wizardStep{
+			{Key: "data", Prompt: "🔳 Kirim teks atau link yang ingin dijadikan QR code.", Validate: validateWizardText(1000)},
+			{Key: "size", Prompt: "Pilih ukuran QR code:", Options: []ChannelOption{
+				{ID: wizardCallbackPrefix + "256", Title: "Kecil (256px)"},
+				{ID: wizardCallbackPrefix + "512", Title: "Sedang (512px)"},
+				{ID: wizardCallbackPrefix + "1024", Title: "Besar (1024px)"},
+			}},
+		},
+		Finish: (*TelegramService).finishQRWizard,
+	},
+	{
+		Name:     "currency",
+		Triggers: []string{"konversi kurs", "convert currency", "kurs"},
+		Steps: []wizardStep{
+			{Key: "amount", Prompt: "💱 Berapa jumlah yang ingin dikonversi?", Validate: validateWizardAmount},
+			{Key: "from", Prompt: "Dari mata uang apa? (contoh: USD)", Validate: validateWizardCurrency},
+			{Key: "to", Prompt: "Ke mata uang apa? (contoh: IDR)", Validate: validateWizardCurrency},
+		},
+		Finish: (*TelegramService).finishCurrencyWizard,
+	},
+	{
+		Name:     "poll",
+		Triggers: []string{"buat polling", "create poll", "polling"},
+		Timeout:  10 * time.Minute,
+		Steps: []wizardStep{
+			{Key: "question", Prompt: "📊 Apa pertanyaan polling-nya?", Validate: validateWizardText(255)},
+			{Key: "options", Prompt: "Kirim pilihan jawaban satu per satu. Kirim \"selesai\" jika sudah.", Repeat: true, Min: 2, Max: 10, Validate: validateWizardText(100)},
+		},
+		Finish: (*TelegramService).finishPollWizard,
+	},
+	{
+		Name:     "timer",
+		Triggers: []string{"pasang timer", "set timer", "timer"},
+		Steps: []wizardStep{
+			{Key: "name", Prompt: "⏱️ Beri nama timer-nya.", Validate: validateWizardText(100)},
+			{Key: "duration", Prompt: "Berapa lama? (contoh: 10 untuk 10 menit, 45m, 1h30m)", Validate: validateWizardDuration},
+		},
+		Finish: (*TelegramService).finishTimerWizard,
+	},
+}
+
+// processWizard continues the user's wizard in the chat or starts one when
+// the message is a wizard trigger. It reports whether the message was
+// consumed by a wizard. replyID is the callback data of a tapped button.
+func (s *TelegramService) processWizard(contact *models.Contact, userID int64, message *models.Message, replyID string) (bool, error) {
+	input := strings.TrimSpace(message.Content)
+	if strings.HasPrefix(replyID, wizardCallbackPrefix) {
+		input = strings.TrimPrefix(replyID, wizardCallbackPrefix)
+	}
+
+	state, err := s.loadWizardState(contact.TelegramChatID, userID)
+	if err != nil && !errors.Is(err, redis.Nil) {
+		return false, err
+	}
+
+	if state == nil {
+		if s.expireSession(contact.TelegramChatID, userID) {
+			if err := s.sm.Channel(contact).SendText("⌛ Sesi sebelumnya berakhir karena tidak ada balasan."); err != nil {
+				logger.Log.WithError(err).Error("Failed to send session expiry notice")
+			}
+		}
+
+		w := findWizard(input)
+		if w == nil {
+			return false, nil
+		}
+		state = &wizardState{Wizard: w.Name, Answers: map[string][]string{}}
+		if err := s.saveWizardState(contact.TelegramChatID, userID, w, state); err != nil {
+			return true, err
+		}
+		return true, s.sendWizardPrompt(contact, w, state, "")
+	}
+
+	w := wizardByName(state.Wizard)
+	if w == nil || state.Step >= len(w.Steps) {
+		s.endSession(contact.TelegramChatID, userID)
+		return false, nil
+	}
+
+	if replyID == wizardCancelID || isWizardCancel(input) {
+		s.endSession(contact.TelegramChatID, userID)
+		return true, s.sm.Channel(contact).SendText("❌ Dibatalkan.")
+	}
+
+	step := w.Steps[state.Step]
+	answers := state.Answers[step.Key]
+
+	if step.Repeat && (replyID == wizardDoneID || strings.EqualFold(input, "selesai")) {
+		if len(answers) < step.Min {
+			return true, s.sendWizardPrompt(contact, w, state, fmt.Sprintf("⚠️ Minimal %d jawaban.", step.Min))
+		}
+		return true, s.advanceWizard(contact, userID, w, state)
+	}
+
+	value, err := validateWizardInput(step, input)
+	if err != nil {
+		// Keep the session alive while the user corrects the answer
+		if err := s.saveWizardState(contact.TelegramChatID, userID, w, state); err != nil {
+			return true, err
+		}
+		return true, s.sendWizardPrompt(contact, w, state, "⚠️ "+err.Error())
+	}
+
+	state.Answers[step.Key] = append(answers, value)
+	if step.Repeat && len(state.Answers[step.Key]) < step.Max {
+		if err := s.saveWizardState(contact.TelegramChatID, userID, w, state); err != nil {
+			return true, err
+		}
+		return true, s.sendWizardPrompt(contact, w, state, fmt.Sprintf("✅ Pilihan %d disimpan.", len(state.Answers[step.Key])))
+	}
+
+	return true, s.advanceWizard(contact, userID, w, state)
+}
+
+// advanceWizard moves to the next step, or finishes the wizard after the
+// last one.
+func (s *TelegramService) advanceWizard(contact *models.Contact, userID int64, w *wizard, state *wizardState) error {
+	state.Step++
+	if state.Step < len(w.Steps) {
+		if err := s.saveWizardState(contact.TelegramChatID, userID, w, state); err != nil {
+			return err
+		}
+		return s.sendWizardPrompt(contact, w, state, "")
+	}
+
+	s.endSession(contact.TelegramChatID, userID)
+	if err := w.Finish(s, contact, state.Answers); err != nil {
+		logger.Log.WithError(err).WithField("wizard", w.Name).Error("Failed to finish wizard")
+		if sendErr := s.sm.Channel(contact).SendText("❌ Maaf, permintaan gagal diproses. Silakan coba lagi."); sendErr != nil {
+			logger.Log.WithError(sendErr).Error("Failed to send wizard failure notice")
+		}
+		return err
+	}
+	return nil
+}
+
+// sendWizardPrompt asks for the current step, with a cancel button and the
+// step's options. notice is shown above the prompt.
+func (s *TelegramService) sendWizardPrompt(contact *models.Contact, w *wizard, state *wizardState, notice string) error {
+	step := w.Steps[state.Step]
+
+	text := step.Prompt
+	if notice != "" {
+		text = notice + "\n\n" + text
+	}
+
+	options := append([]ChannelOption{}, step.Options...)
+	if step.Repeat && len(state.Answers[step.Key]) >= step.Min {
+		options = append(options, ChannelOption{ID: wizardDoneID, Title: "✅ Selesai"})
+	}
+	options = append(options, ChannelOption{ID: wizardCancelID, Title: "❌ Batal"})
+
+	return s.sm.Channel(contact).SendButtons(text, options)
+}
+
+func (s *TelegramService) loadWizardState(chatID, userID int64) (*wizardState, error) {
+	value, err := s.sm.Redis.Get(s.sm.Redis.Context(), s.sessionKey(chatID, userID)).Result()
+	if err != nil {
+		return nil, err
+	}
+
+	state := &wizardState{}
+	if err := json.Unmarshal([]byte(value), state); err != nil {
+		return nil, err
+	}
+	if state.Answers == nil {
+		state.Answers = map[string][]string{}
+	}
+	return state, nil
+}
+
+// saveWizardState stores the state in Redis, restarting the wizard's
+// timeout, and mirrors it to the user's models.TelegramSession in the chat.
+func (s *TelegramService) saveWizardState(chatID, userID int64, w *wizard, state *wizardState) error {
+	data, err := json.Marshal(state)
+	if err != nil {
+		return err
+	}
+
+	timeout := w.Timeout
+	if timeout == 0 {
+		timeout = wizardDefaultTimeout
+	}
+	if err := s.sm.Redis.Set(s.sm.Redis.Context(), s.sessionKey(chatID, userID), data, timeout).Err(); err != nil {
+		logger.Log.WithError(err).WithField("chat_id", chatID).Error("Failed to save Telegram session")
+		return err
+	}
+
+	session := &models.TelegramSession{}
+	err = s.sessions(chatID, userID).First(session).Error
+	if err != nil && !gorm.IsRecordNotFoundError(err) {
+		return err
+	}
+	if session.ID == uuid.Nil {
+		session.ID = uuid.New()
+		session.ChatID = chatID
+		session.UserID = userID
+		session.BotID = s.BotID()
+	}
+
+	session.SessionData = models.JSONMap{
+		"wizard":  state.Wizard,
+		"step":    state.Step,
+		"answers": state.Answers,
+	}
+	session.LastActivity = time.Now()
+	session.IsActive = true
+
+	if err := s.sm.DB.Save(session).Error; err != nil {
+		logger.Log.WithError(err).WithField("chat_id", chatID).Error("Failed to save Telegram session")
+		return err
+	}
+	return nil
+}
+
+// endSession removes the user's wizard state in the chat.
+func (s *TelegramService) endSession(chatID, userID int64) {
+	s.sm.Redis.Del(s.sm.Redis.Context(), s.sessionKey(chatID, userID))
+	if err := s.sessions(chatID, userID).Model(&models.TelegramSession{}).
+		Updates(map[string]interface{}{"is_active": false, "session_data": nil}).Error; err != nil {
+		logger.Log.WithError(err).WithField("chat_id", chatID).Error("Failed to end Telegram session")
+	}
+}
+
+// expireSession closes a session whose Redis state has expired. It reports
+// whether there was one, so the user can be told.
+func (s *TelegramService) expireSession(chatID, userID int64) bool {
+	result := s.sessions(chatID, userID).Model(&models.TelegramSession{}).Where("is_active = ?", true).
+		Updates(map[string]interface{}{"is_active": false, "session_data": nil})
+	if result.Error != nil {
+		logger.Log.WithError(result.Error).WithField("chat_id", chatID).Error("Failed to expire Telegram session")
+		return false
+	}
+	return result.RowsAffected > 0
+}
+
+func (s *TelegramService) finishQRWizard(contact *models.Contact, answers map[string][]string) error {
+	data := answers["data"][0]
+	size, _ := strconv.Atoi(answers["size"][0])
+
+	png, err := s.sm.UtilityService.CreateQRCode(data, size, "png")
+	if err != nil {
+		return err
+	}
+
+	url, err := s.sm.Storage.Save("qr/"+uuid.New().String()+".png", []byte(png), "image/png")
+	if err != nil {
+		return err
+	}
+
+	return s.sm.Channel(contact).SendImage(url, "🔳 QR code untuk: "+truncateRunes(data, 200))
+}
+
+func (s *TelegramService) finishCurrencyWizard(contact *models.Contact, answers map[string][]string) error {
+	amount, _ := strconv.ParseFloat(answers["amount"][0], 64)
+	from, to := answers["from"][0], answers["to"][0]
+
+	converted, err := s.sm.UtilityService.ConvertCurrency(amount, from, to)
+	if err != nil {
+		return err
+	}
+
+	return s.sm.Channel(contact).SendText(fmt.Sprintf("💱 %s = %s", formatAmount(amount, from), formatAmount(converted, to)))
+}
+
+func (s *TelegramService) finishPollWizard(contact *models.Contact, answers map[string][]string) error {
+	question, options := answers["question"][0], answers["options"]
+
+	if _, err := s.sm.UtilityService.CreatePoll(question, options, contact.UserID); err != nil {
+		return err
+	}
+
+	return s.SendPoll(contact.TelegramChatID, question, options)
+}
+
+// finishTimerWizard stores the timer as a one-off reminder for the contact,
+// so ProcessReminders announces it even if the server restarts meanwhile.
+func (s *TelegramService) finishTimerWizard(contact *models.Contact, answers map[string][]string) error {
+	name := answers["name"][0]
+	duration, _ := time.ParseDuration(answers["duration"][0])
+
+	title := fmt.Sprintf("⏰ Timer \"%s\" selesai!", name)
+	description := fmt.Sprintf("Durasi: %s", duration)
+	if _, err := s.sm.ReminderService.CreateReminder(contact.UserID, contact.ID, title, description, time.Now().Add(duration), false, "none"); err != nil {
+		return err
+	}
+
+	return s.sm.Channel(contact).SendText(fmt.Sprintf("⏱️ Timer \"%s\" dipasang untuk %s.", name, duration))
+}
+
+// sessionKey is the Redis key of the user's wizard state in the chat. A chat
+// talks to each bot separately, so hosted bots add their ID.
+func (s *TelegramService) sessionKey(chatID, userID int64) string {
+	key := telegramSessionKeyPrefix + strconv.FormatInt(chatID, 10) + ":" + strconv.FormatInt(userID, 10)
+	if botID := s.BotID(); botID != nil {
+		key += ":" + botID.String()
+	}
+	return key
+}
+
+// sessions limits a query to the user's models.TelegramSession in the chat
+// with this bot.
+func (s *TelegramService) sessions(chatID, userID int64) *gorm.DB {
+	return whereBot(s.sm.DB.Where("chat_id = ? AND user_id = ?", chatID, userID), "bot_id", s.BotID())
+}
+
+func findWizard(input string) *wizard {
+	input = strings.ToLower(input)
+	for i := range telegramWizards {
+		for _, trigger := range telegramWizards[i].Triggers {
+			if input == trigger {
+				return &telegramWizards[i]
+			}
+		}
+	}
+	return nil
+}
+
+func wizardByName(name string) *wizard {
+	for i := range telegramWizards {
+		if telegramWizards[i].Name == name {
+			return &telegramWizards[i]
+		}
+	}
+	return nil
+}
+
+func isWizardCancel(input string) bool {
+	switch strings.ToLower(input) {
+	case "batal", "cancel", "/cancel":
+		return true
+	}
+	return false
+}
+
+// validateWizardInput runs the step's validation. Steps with options and
+// no validation accept an option ID or title.
+func validateWizardInput(step wizardStep, input string) (string, error) {
+	if step.Validate != nil {
+		return step.Validate(input)
+	}
+	for _, option := range step.Options {
+		value := strings.TrimPrefix(option.ID, wizardCallbackPrefix)
+		if strings.EqualFold(input, value) || strings.EqualFold(input, option.Title) {
+			return value, nil
+		}
+	}
+	if len(step.Options) > 0 {
+		return "", errors.New("Pilih salah satu opsi yang tersedia.")
+	}
+	return input, nil
+}
+
+func validateWizardText(max int) func(string) (string, error) {
+	return func(input string) (string, error) {
+		if input == "" {
+			return "", errors.New("Jawaban tidak boleh kosong.")
+		}
+		if len([]rune(input)) > max {
+			return "", fmt.Errorf("Maksimal %d karakter.", max)
+		}
+		return input, nil
+	}
+}
+
+func validateWizardAmount(input string) (string, error) {
+	amount, err := strconv.ParseFloat(strings.Replace(input, ",", ".", 1), 64)
+	if err != nil || amount <= 0 {
+		return "", errors.New("Masukkan angka lebih dari 0, contoh: 100 atau 12.5")
+	}
+	return strconv.FormatFloat(amount, 'f', -1, 64), nil
+}
+
+func validateWizardCurrency(input string) (string, error) {
+	code := strings.ToUpper(input)
+	if len(code) != 3 || strings.Trim(code, "ABCDEFGHIJKLMNOPQRSTUVWXYZ") != "" {
+		return "", errors.New("Gunakan kode mata uang 3 huruf, contoh: USD")
+	}
+	return code, nil
+}
+
+// validateWizardDuration accepts a Go duration ("45m", "1h30m") or a plain
+// number of minutes.
+func validateWizardDuration(input string) (string, error) {
+	duration, err := time.ParseDuration(strings.ToLower(input))
+	if err != nil {
+		minutes, convErr := strconv.Atoi(input)
+		if convErr != nil {
+			return "", errors.New("Format durasi tidak dikenali, contoh: 10, 45m atau 1h30m")
+		}
+		duration = time.Duration(minutes) * time.Minute
+	}
+	// Timers fire from the reminder check, which runs every minute
+	if duration < wizardMinTimer || duration > wizardMaxTimer {
+		return "", errors.New("Durasi harus antara 1 menit dan 24 jam.")
+	}
+	return duration.String(), nil
+}
@@ -0,0 +1,399 @@
+package services
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"whatsapp-bot/internal/models"
+	"whatsapp-bot/pkg/logger"
+	"whatsapp-bot/pkg/whatsapp"
+
+	"github.com/google/uuid"
+	"github.com/jinzhu/gorm"
+)
+
+var (
+	ErrTemplateNotFound         = errors.New("template not found")
+	ErrInvalidTemplate          = errors.New("invalid template")
+	ErrMissingTemplateVariables = errors.New("missing template variables")
+)
+
+var (
+	templateNameRegex        = regexp.MustCompile(`^[a-z0-9_]+$`)
+	templatePlaceholderRegex = regexp.MustCompile(`\{\{(\d+)\}\}`)
+)
+
+// TemplateDefinition describes a template that has been approved in WhatsApp
+// Manager. Each {{n}} placeholder in the header and body is bound to the
+// variable name at position n-1, so callers can fill templates by name.
+type TemplateDefinition struct {
+	Name            string                  `json:"name" binding:"required"`
+	Language        string                  `json:"language"`
+	Category        string                  `json:"category"`
+	Body            string                  `json:"body" binding:"required"`
+	BodyVariables   []string                `json:"body_variables"`
+	HeaderType      string                  `json:"header_type"`
+	HeaderText      string                  `json:"header_text"`
+	HeaderVariables []string                `json:"header_variables"`
+	Buttons         []models.TemplateButton `json:"buttons"`
+}
+
+type TemplateService struct {
+	sm *ServiceManager
+}
+
+// Validate checks that the placeholders match the declared variables.
+func (d *TemplateDefinition) Validate() error {
+	if !templateNameRegex.MatchString(d.Name) {
+		return fmt.Errorf("%w: name must contain only lowercase letters, digits and underscores", ErrInvalidTemplate)
+	}
+
+	bodyCount, err := countPlaceholders(d.Body)
+	if err != nil {
+		return err
+	}
+	if bodyCount != len(d.BodyVariables) {
+		return fmt.Errorf("%w: body has %d placeholders but %d variables", ErrInvalidTemplate, bodyCount, len(d.BodyVariables))
+	}
+	if err := validateVariableNames(d.BodyVariables); err != nil {
+		return err
+	}
+
+	switch d.HeaderType {
+	case "":
+		if d.HeaderText != "" || len(d.HeaderVariables) > 0 {
+			return fmt.Errorf("%w: header_type is required when a header is given", ErrInvalidTemplate)
+		}
+	case "text":
+		headerCount, err := countPlaceholders(d.HeaderText)
+		if err != nil {
+			return err
+		}
+		if headerCount > 1 {
+			return fmt.Errorf("%w: text header supports at most one placeholder", ErrInvalidTemplate)
+		}
+		if headerCount != len(d.HeaderVariables) {
+			return fmt.Errorf("%w: header has %d placeholders but %d variables", ErrInvalidTemplate, headerCount, len(d.HeaderVariables))
+		}
+	case "image", "video", "document":
+		// The media link is always supplied when sending
+		if len(d.HeaderVariables) != 1 {
+			return fmt.Errorf("%w: %s header needs exactly one variable for the media URL", ErrInvalidTemplate, d.HeaderType)
+		}
+	default:
+		return fmt.Errorf("%w: unsupported header type %q", ErrInvalidTemplate, d.HeaderType)
+	}
+	if err := validateVariableNames(d.HeaderVariables); err != nil {
+		return err
+	}
+
+	if len(d.Buttons) > 10 {
+		return fmt.Errorf("%w: at most 10 buttons are allowed", ErrInvalidTemplate)
+	}
+	for i, button := range d.Buttons {
+		if button.Text == "" {
+			return fmt.Errorf("%w: button %d has no text", ErrInvalidTemplate, i+1)
+		}
+		if button.Type != "quick_reply" && button.Type != "url" {
+			return fmt.Errorf("%w: button %d has unsupported type %q", ErrInvalidTemplate, i+1, button.Type)
+		}
+	}
+
+	return nil
+}
+
+// countPlaceholders returns the number of {{n}} placeholders in text. They
+// must be numbered from 1 without gaps.
+func countPlaceholders(text string) (int, error) {
+	seen := make(map[int]bool)
+	for _, match := range templatePlaceholderRegex.FindAllStringSubmatch(text, -1) {
+		n, _ := strconv.Atoi(match[1])
+		seen[n] = true
+	}
+
+	for i := 1; i <= len(seen); i++ {
+		if !seen[i] {
+			return 0, fmt.Errorf("%w: placeholders must be numbered {{1}} to {{%d}}", ErrInvalidTemplate, len(seen))
+		}
+	}
+
+	return len(seen), nil
+}
+
+func validateVariableNames(names []string) error {
+	for _, name := range names {
+		if strings.TrimSpace(name) == "" {
+			return fmt.Errorf("%w: variable names cannot be empty", ErrInvalidTemplate)
+		}
+	}
+	return nil
+}
+
+func (s *TemplateService) CreateTemplate(userID uuid.UUID, def TemplateDefinition) (*models.Template, error) {
+	if err := def.Validate(); err != nil {
+		return nil, err
+	}
+
+	template := &models.Template{UserID: userID}
+	if err := applyTemplateDefinition(template, def); err != nil {
+		return nil, err
+	}
+
+	if err := s.sm.DB.Create(template).Error; err != nil {
+		return nil, err
+	}
+
+	return template, nil
+}
+
+func (s *TemplateService) GetTemplates(userID uuid.UUID) ([]models.Template, error) {
+	var templates []models.Template
+	err := s.sm.DB.Where("user_id = ?", userID).Order("name").Find(&templates).Error
+	return templates, err
+}
+
+// GetTemplate returns one of the user's templates. Templates of other users
+// are reported as not found.
+func (s *TemplateService) GetTemplate(userID, id uuid.UUID) (*models.Template, error) {
+	template := &models.Template{}
+	if err := s.sm.DB.Where("id = ? AND user_id = ?", id, userID).First(template).Error; err != nil {
+		if gorm.IsRecordNotFoundError(err) {
+			return nil, ErrTemplateNotFound
+		}
+		return nil, err
+	}
+	return template, nil
+}
+
+func (s *TemplateService) UpdateTemplate(userID, id uuid.UUID, def TemplateDefinition) (*models.Template, error) {
+	if err := def.Validate(); err != nil {
+		return nil, err
+	}
+
+	template, err := s.GetTemplate(userID, id)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := applyTemplateDefinition(template, def); err != nil {
+		return nil, err
+	}
+
+	if err := s.sm.DB.Save(template).Error; err != nil {
+		return nil, err
+	}
+
+	return template, nil
+}
+
+func (s *TemplateService) DeleteTemplate(userID, id uuid.UUID) error {
+	result := s.sm.DB.Where("id = ? AND user_id = ?", id, userID).Delete(&models.Template{})
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return ErrTemplateNotFound
+	}
+	return nil
+}
+
+func applyTemplateDefinition(template *models.Template, def TemplateDefinition) error {
+	bodyVariables, err := json.Marshal(def.BodyVariables)
+	if err != nil {
+		return err
+	}
+	headerVariables, err := json.Marshal(def.HeaderVariables)
+	if err != nil {
+		return err
+	}
+	buttons, err := json.Marshal(def.Buttons)
+	if err != nil {
+		return err
+	}
+
+	template.Name = def.Name
+	template.Language = def.Language
+	if template.Language == "" {
+		template.Language = "id"
+	}
+	template.Category = def.Category
+	template.Content = def.Body
+	template.Variables = string(bodyVariables)
+	template.HeaderType = def.HeaderType
+	template.HeaderText = def.HeaderText
+	template.HeaderVariables = string(headerVariables)
+	template.Buttons = string(buttons)
+
+	return nil
+}
+
+// BuildComponents fills the template parameters from values, keyed by
+// variable name. Every variable must have a value.
+func (s *TemplateService) BuildComponents(template *models.Template, values map[string]string) ([]whatsapp.TemplateComponent, error) {
+	var bodyVariables, headerVariables []string
+	var buttons []models.TemplateButton
+	if err := unmarshalTemplateField(template.Variables, &bodyVariables); err != nil {
+		return nil, err
+	}
+	if err := unmarshalTemplateField(template.HeaderVariables, &headerVariables); err != nil {
+		return nil, err
+	}
+	if err := unmarshalTemplateField(template.Buttons, &buttons); err != nil {
+		return nil, err
+	}
+
+	var missing []string
+	lookup := func(name string) string {
+		value, ok := values[name]
+		if !ok || value == "" {
+			missing = append(missing, name)
+		}
+		return value
+	}
+
+	var components []whatsapp.TemplateComponent
+
+	if len(headerVariables) > 0 {
+		header := whatsapp.TemplateComponent{Type: "header"}
+		for _, name := range headerVariables {
+			value := lookup(name)
+			switch template.HeaderType {
+			case "image":
+				header.Parameters = append(header.Parameters, whatsapp.Parameter{Type: "image", Image: &whatsapp.MediaMessage{Link: value}})
+			case "video":
+				header.Parameters = append(header.Parameters, whatsapp.Parameter{Type: "video", Video: &whatsapp.MediaMessage{Link: value}})
+			case "document":
+				header.Parameters = append(header.Parameters, whatsapp.Parameter{Type: "document", Document: &whatsapp.MediaMessage{Link: value}})
+			default:
+				header.Parameters = append(header.Parameters, whatsapp.Parameter{Type: "text", Text: value})
+			}
+		}
+		components = append(components, header)
+	}
+
+	if len(bodyVariables) > 0 {
+		body := whatsapp.TemplateComponent{Type: "body"}
+		for _, name := range bodyVariables {
+			body.Parameters = append(body.Parameters, whatsapp.Parameter{Type: "text", Text: lookup(name)})
+		}
+		components = append(components, body)
+	}
+
+	for i, button := range buttons {
+		if button.Variable == "" {
+			continue
+		}
+
+		component := whatsapp.TemplateComponent{
+			Type:    "button",
+			SubType: button.Type,
+			Index:   strconv.Itoa(i),
+		}
+		if button.Type == "quick_reply" {
+			component.Parameters = []whatsapp.Parameter{{Type: "payload", Payload: lookup(button.Variable)}}
+		} else {
+			component.Parameters = []whatsapp.Parameter{{Type: "text", Text: lookup(button.Variable)}}
+		}
+		components = append(components, component)
+	}
+
+	if len(missing) > 0 {
+		sort.Strings(missing)
+		return nil, fmt.Errorf("%w: %s", ErrMissingTemplateVariables, strings.Join(missing, ", "))
+	}
+
+	return components, nil
+}
+
+func unmarshalTemplateField(data string, v interface{}) error {
+	if data == "" {
+		return nil
+	}
+	if err := json.Unmarshal([]byte(data), v); err != nil {
+		return fmt.Errorf("failed to parse template definition: %v", err)
+	}
+	return nil
+}
+
+// RenderBody returns the body text with the placeholders replaced, used as
+// the stored content of sent template messages.
+func (s *TemplateService) RenderBody(template *models.Template, values map[string]string) string {
+	var bodyVariables []string
+	unmarshalTemplateField(template.Variables, &bodyVariables)
+
+	return templatePlaceholderRegex.ReplaceAllStringFunc(template.Content, func(placeholder string) string {
+		n, _ := strconv.Atoi(templatePlaceholderRegex.FindStringSubmatch(placeholder)[1])
+		if n < 1 || n > len(bodyVariables) {
+			return placeholder
+		}
+		return values[bodyVariables[n-1]]
+	})
+}
+
+// SendTemplate queues a template message for a single recipient.
+func (s *TemplateService) SendTemplate(userID uuid.UUID, to string, templateID uuid.UUID, values map[string]string) (*models.Message, error) {
+	template, err := s.GetTemplate(userID, templateID)
+	if err != nil {
+		return nil, err
+	}
+
+	return s.sendTemplate(userID, to, template, values, nil)
+}
+
+func (s *TemplateService) sendTemplate(userID uuid.UUID, to string, template *models.Template, values map[string]string, recipient *models.BroadcastRecipient) (*models.Message, error) {
+	if !template.IsActive {
+		return nil, fmt.Errorf("%w: template %s is inactive", ErrInvalidTemplate, template.Name)
+	}
+
+	components, err := s.BuildComponents(template, values)
+	if err != nil {
+		logger.Log.WithError(err).WithField("template", template.Name).Error("Failed to build template message")
+		return nil, err
+	}
+
+	waReq := whatsapp.NewTemplateMessageRequest(to, template.Name, template.Language, components)
+	return s.sm.WhatsAppService.QueueMessage(userID, waReq, s.RenderBody(template, values), "template", recipient)
+}
+
+// ContactTemplateValues returns the variables every template can use for a
+// contact without the caller supplying them.
+func ContactTemplateValues(contact *models.Contact) map[string]string {
+	name := contact.DisplayName
+	if name == "" {
+		name = contact.PhoneNumber
+	}
+
+	return map[string]string{
+		"name":  name,
+		"phone": contact.PhoneNumber,
+	}
+}
+
+// mergeTemplateValues combines value maps; later maps take precedence.
+func mergeTemplateValues(maps ...map[string]string) map[string]string {
+	merged := make(map[string]string)
+	for _, m := range maps {
+		for k, v := range m {
+			merged[k] = v
+		}
+	}
+	return merged
+}
+
+// parseTemplateValues decodes a JSON object of template values as stored on
+// broadcasts and reminders.
+func parseTemplateValues(data string) (map[string]string, error) {
+	values := make(map[string]string)
+	if data == "" {
+		return values, nil
+	}
+	if err := json.Unmarshal([]byte(data), &values); err != nil {
+		return nil, fmt.Errorf("failed to parse template values: %v", err)
+	}
+	return values, nil
+}
@@ -0,0 +1,111 @@
+package services
+
+import (
+	"errors"
+	"testing"
+
+	"whatsapp-bot/internal/models"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTemplateDefinitionValidate(t *testing.T) {
+	testCases := []struct {
+		name    string
+		def     TemplateDefinition
+		invalid bool
+	}{
+		{
+			name: "BodyVariables",
+			def:  TemplateDefinition{Name: "order_update", Body: "Halo {{1}}, pesanan {{2}} sudah dikirim", BodyVariables: []string{"name", "order_number"}},
+		},
+		{
+			name: "RepeatedPlaceholder",
+			def:  TemplateDefinition{Name: "greeting", Body: "Halo {{1}}, {{1}}!", BodyVariables: []string{"name"}},
+		},
+		{
+			name: "TextHeader",
+			def:  TemplateDefinition{Name: "promo", Body: "Diskon hari ini", HeaderType: "text", HeaderText: "Halo {{1}}", HeaderVariables: []string{"name"}},
+		},
+		{
+			name: "ImageHeader",
+			def:  TemplateDefinition{Name: "promo", Body: "Diskon hari ini", HeaderType: "image", HeaderVariables: []string{"image_url"}},
+		},
+		{
+			name: "Buttons",
+			def: TemplateDefinition{Name: "promo", Body: "Diskon hari ini", Buttons: []models.TemplateButton{
+				{Type: "quick_reply", Text: "Mau"},
+				{Type: "url", Text: "Lihat", Variable: "link"},
+			}},
+		},
+		{
+			name:    "UppercaseName",
+			def:     TemplateDefinition{Name: "Order_Update", Body: "Halo"},
+			invalid: true,
+		},
+		{
+			name:    "PlaceholderGap",
+			def:     TemplateDefinition{Name: "greeting", Body: "Halo {{1}} {{3}}", BodyVariables: []string{"a", "b"}},
+			invalid: true,
+		},
+		{
+			name:    "VariableCountMismatch",
+			def:     TemplateDefinition{Name: "greeting", Body: "Halo {{1}}"},
+			invalid: true,
+		},
+		{
+			name:    "EmptyVariableName",
+			def:     TemplateDefinition{Name: "greeting", Body: "Halo {{1}}", BodyVariables: []string{" "}},
+			invalid: true,
+		},
+		{
+			name:    "HeaderWithoutType",
+			def:     TemplateDefinition{Name: "promo", Body: "Diskon", HeaderText: "Halo"},
+			invalid: true,
+		},
+		{
+			name:    "TextHeaderTwoPlaceholders",
+			def:     TemplateDefinition{Name: "promo", Body: "Diskon", HeaderType: "text", HeaderText: "{{1}} {{2}}", HeaderVariables: []string{"a", "b"}},
+			invalid: true,
+		},
+		{
+			name:    "MediaHeaderWithoutVariable",
+			def:     TemplateDefinition{Name: "promo", Body: "Diskon", HeaderType: "video"},
+			invalid: true,
+		},
+		{
+			name:    "UnsupportedHeaderType",
+			def:     TemplateDefinition{Name: "promo", Body: "Diskon", HeaderType: "location"},
+			invalid: true,
+		},
+		{
+			name:    "ButtonWithoutText",
+			def:     TemplateDefinition{Name: "promo", Body: "Diskon", Buttons: []models.TemplateButton{{Type: "url"}}},
+			invalid: true,
+		},
+		{
+			name:    "UnsupportedButtonType",
+			def:     TemplateDefinition{Name: "promo", Body: "Diskon", Buttons: []models.TemplateButton{{Type: "call", Text: "Telepon"}}},
+			invalid: true,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			err := tc.def.Validate()
+			if tc.invalid {
+				assert.True(t, errors.Is(err, ErrInvalidTemplate))
+				return
+			}
+			assert.NoError(t, err)
+		})
+	}
+
+	t.Run("TooManyButtons", func(t *testing.T) {
+		def := TemplateDefinition{Name: "promo", Body: "Diskon"}
+		for i := 0; i < 11; i++ {
+			def.Buttons = append(def.Buttons, models.TemplateButton{Type: "quick_reply", Text: "Mau"})
+		}
+		assert.True(t, errors.Is(def.Validate(), ErrInvalidTemplate))
+	})
+}
@@ -168,7 +168,7 @@ func (s *UserService) sendLevelUpNotification(user *models.User, newLevel int) {
 	}
 
 	message := fmt.Sprintf("🎉 LEVEL UP! 🎉\n\nSelamat! Anda naik ke level %d!\nPoin Anda: %d\n\nTerus gunakan bot kami untuk mendapatkan lebih banyak poin dan keuntungan!", newLevel, user.Points)
-	_, err = s.sm.WhatsApp.SendTextMessage(contact.PhoneNumber, message, false)
+	err = s.sm.Channel(contact).SendText(message)
 	if err != nil {
 		logger.Log.WithError(err).Error("Failed to send level up notification")
 	}
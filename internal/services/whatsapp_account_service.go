@@ -0,0 +1,256 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"whatsapp-bot/internal/models"
+	"whatsapp-bot/pkg/encryption"
+	"whatsapp-bot/pkg/logger"
+	"whatsapp-bot/pkg/whatsapp"
+
+	"github.com/google/uuid"
+	"github.com/jinzhu/gorm"
+	"github.com/sirupsen/logrus"
+)
+
+var (
+	ErrWhatsAppAccountNotFound    = errors.New("WhatsApp account not found")
+	ErrWhatsAppAccountExists      = errors.New("WhatsApp number is already connected")
+	ErrInvalidWhatsAppCredentials = errors.New("WhatsApp rejected the access token or phone number ID")
+)
+
+// WhatsAppAccountService manages the business numbers connected by users and
+// resolves which client to use for a user or an incoming webhook.
+type WhatsAppAccountService struct {
+	sm *ServiceManager
+
+	mu          sync.RWMutex
+	clients     map[string]*whatsapp.Client // by phone number ID
+	userNumbers map[uuid.UUID]string        // user ID to primary phone number ID
+}
+
+// CreateAccount connects a business number once the Graph API accepts its
+// credentials. A number that was deleted before is restored for the new
+// owner, as its row still holds the unique phone number ID.
+func (s *WhatsAppAccountService) CreateAccount(userID uuid.UUID, phoneNumberID, displayPhoneNumber, businessAccountID, accessToken string) (*models.WhatsAppAccount, error) {
+	if err := s.sm.requireEncryptionKey(); err != nil {
+		return nil, err
+	}
+
+	deleted := &models.WhatsAppAccount{}
+	err := s.sm.DB.Unscoped().Where("phone_number_id = ?", phoneNumberID).First(deleted).Error
+	if err == nil && deleted.DeletedAt == nil {
+		return nil, ErrWhatsAppAccountExists
+	}
+	if err != nil && !gorm.IsRecordNotFoundError(err) {
+		return nil, err
+	}
+
+	if err := s.verifyCredentials(phoneNumberID, accessToken); err != nil {
+		return nil, err
+	}
+
+	encrypted, err := encryption.Encrypt(s.sm.Config.Security.EncryptionKey, accessToken)
+	if err != nil {
+		return nil, err
+	}
+
+	account := &models.WhatsAppAccount{
+		UserID:             userID,
+		PhoneNumberID:      phoneNumberID,
+		DisplayPhoneNumber: displayPhoneNumber,
+		BusinessAccountID:  businessAccountID,
+		AccessToken:        encrypted,
+		IsActive:           true,
+	}
+
+	if deleted.DeletedAt != nil {
+		account.ID = deleted.ID
+		account.CreatedAt = time.Now()
+		if err := s.sm.DB.Unscoped().Save(account).Error; err != nil {
+			return nil, err
+		}
+		s.invalidate(deleted)
+	} else if err := s.sm.DB.Create(account).Error; err != nil {
+		return nil, err
+	}
+
+	s.invalidate(account)
+	return account, nil
+}
+
+func (s *WhatsAppAccountService) GetAccounts(userID uuid.UUID) ([]models.WhatsAppAccount, error) {
+	var accounts []models.WhatsAppAccount
+	err := s.sm.DB.Where("user_id = ?", userID).Order("created_at").Find(&accounts).Error
+	return accounts, err
+}
+
+func (s *WhatsAppAccountService) UpdateAccessToken(userID, accountID uuid.UUID, accessToken string) error {
+	if err := s.sm.requireEncryptionKey(); err != nil {
+		return err
+	}
+
+	account, err := s.getUserAccount(userID, accountID)
+	if err != nil {
+		return err
+	}
+
+	if err := s.verifyCredentials(account.PhoneNumberID, accessToken); err != nil {
+		return err
+	}
+
+	encrypted, err := encryption.Encrypt(s.sm.Config.Security.EncryptionKey, accessToken)
+	if err != nil {
+		return err
+	}
+
+	if err := s.sm.DB.Model(account).Update("access_token", encrypted).Error; err != nil {
+		return err
+	}
+
+	s.invalidate(account)
+	return nil
+}
+
+func (s *WhatsAppAccountService) DeleteAccount(userID, accountID uuid.UUID) error {
+	account, err := s.getUserAccount(userID, accountID)
+	if err != nil {
+		return err
+	}
+
+	if err := s.sm.DB.Delete(account).Error; err != nil {
+		return err
+	}
+
+	s.invalidate(account)
+	return nil
+}
+
+// verifyCredentials asks the Graph API for the phone number with the token.
+func (s *WhatsAppAccountService) verifyCredentials(phoneNumberID, accessToken string) error {
+	cfg := s.sm.Config.WhatsApp
+	cfg.PhoneNumberID = phoneNumberID
+	cfg.AccessToken = accessToken
+
+	if err := whatsapp.NewClient(cfg).TestConnection(); err != nil {
+		return fmt.Errorf("%w: %v", ErrInvalidWhatsAppCredentials, err)
+	}
+	return nil
+}
+
+func (s *WhatsAppAccountService) getUserAccount(userID, accountID uuid.UUID) (*models.WhatsAppAccount, error) {
+	account := &models.WhatsAppAccount{}
+	err := s.sm.DB.Where("id = ? AND user_id = ?", accountID, userID).First(account).Error
+	if gorm.IsRecordNotFoundError(err) {
+		return nil, ErrWhatsAppAccountNotFound
+	}
+	return account, err
+}
+
+// ResolveByPhoneNumberID returns the account and client for the number that
+// received a webhook. Numbers without an account use the global client and
+// a nil account.
+func (s *WhatsAppAccountService) ResolveByPhoneNumberID(phoneNumberID string) (*models.WhatsAppAccount, *whatsapp.Client) {
+	if phoneNumberID == "" || phoneNumberID == s.sm.Config.WhatsApp.PhoneNumberID {
+		return nil, s.sm.WhatsApp
+	}
+
+	account := &models.WhatsAppAccount{}
+	if err := s.sm.DB.Where("phone_number_id = ? AND is_active = ?", phoneNumberID, true).First(account).Error; err != nil {
+		if !gorm.IsRecordNotFoundError(err) {
+			logger.Log.WithError(err).Error("Failed to look up WhatsApp account")
+		}
+		return nil, s.sm.WhatsApp
+	}
+
+	client, err := s.clientForAccount(account)
+	if err != nil {
+		logger.Log.WithError(err).WithField("phone_number_id", phoneNumberID).Error("Failed to create WhatsApp client for account")
+		return account, s.sm.WhatsApp
+	}
+
+	return account, client
+}
+
+// ClientForUser returns the client for the user's own number, or the global
+// client if the user hasn't connected one.
+func (s *WhatsAppAccountService) ClientForUser(userID uuid.UUID) *whatsapp.Client {
+	s.mu.RLock()
+	phoneNumberID, cached := s.userNumbers[userID]
+	client := s.clients[phoneNumberID]
+	s.mu.RUnlock()
+
+	if cached {
+		if client == nil {
+			return s.sm.WhatsApp
+		}
+		return client
+	}
+
+	account := &models.WhatsAppAccount{}
+	err := s.sm.DB.Where("user_id = ? AND is_active = ?", userID, true).Order("created_at").First(account).Error
+	if err != nil {
+		if !gorm.IsRecordNotFoundError(err) {
+			logger.Log.WithError(err).Error("Failed to look up WhatsApp account")
+			return s.sm.WhatsApp
+		}
+
+		s.mu.Lock()
+		s.userNumbers[userID] = ""
+		s.mu.Unlock()
+		return s.sm.WhatsApp
+	}
+
+	client, err = s.clientForAccount(account)
+	if err != nil {
+		logger.Log.WithError(err).WithField("user_id", userID).Error("Failed to create WhatsApp client for account")
+		return s.sm.WhatsApp
+	}
+
+	s.mu.Lock()
+	s.userNumbers[userID] = account.PhoneNumberID
+	s.mu.Unlock()
+
+	return client
+}
+
+func (s *WhatsAppAccountService) clientForAccount(account *models.WhatsAppAccount) (*whatsapp.Client, error) {
+	s.mu.RLock()
+	client, ok := s.clients[account.PhoneNumberID]
+	s.mu.RUnlock()
+	if ok {
+		return client, nil
+	}
+
+	accessToken, err := encryption.Decrypt(s.sm.Config.Security.EncryptionKey, account.AccessToken)
+	if err != nil {
+		return nil, err
+	}
+
+	cfg := s.sm.Config.WhatsApp
+	cfg.PhoneNumberID = account.PhoneNumberID
+	cfg.AccessToken = accessToken
+	client = whatsapp.NewClient(cfg)
+
+	s.mu.Lock()
+	s.clients[account.PhoneNumberID] = client
+	s.mu.Unlock()
+
+	logger.Log.WithFields(logrus.Fields{
+		"user_id":         account.UserID,
+		"phone_number_id": account.PhoneNumberID,
+	}).Info("WhatsApp client created for account")
+
+	return client, nil
+}
+
+func (s *WhatsAppAccountService) invalidate(account *models.WhatsAppAccount) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.clients, account.PhoneNumberID)
+	delete(s.userNumbers, account.UserID)
+}
@@ -1,13 +1,17 @@
 package services
 
 import (
+	"bytes"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"strconv"
 	"strings"
 	"time"
 
 	"whatsapp-bot/internal/models"
 	"whatsapp-bot/pkg/logger"
+	"whatsapp-bot/pkg/storage"
 	"whatsapp-bot/pkg/whatsapp"
 
 	"github.com/google/uuid"
@@ -19,7 +23,180 @@ type WhatsAppService struct {
 	sm *ServiceManager
 }
 
+var ErrServiceWindowClosed = errors.New("customer service window is closed")
+
+// webhookSeenKeyPrefix keys the Redis set of processed inbound message IDs.
+const webhookSeenKeyPrefix = "whatsapp:seen:"
+
+// ServiceWindowClosedError is returned when a free-form message can't be sent
+// because the contact hasn't written in the last 24 hours and no fallback
+// template is configured.
+type ServiceWindowClosedError struct {
+	PhoneNumber string
+	LastInbound time.Time
+}
+
+func (e *ServiceWindowClosedError) Error() string {
+	if e.LastInbound.IsZero() {
+		return fmt.Sprintf("%s: %s has never messaged us", ErrServiceWindowClosed, e.PhoneNumber)
+	}
+	return fmt.Sprintf("%s: last message from %s was at %s", ErrServiceWindowClosed, e.PhoneNumber, e.LastInbound.Format(time.RFC3339))
+}
+
+func (e *ServiceWindowClosedError) Is(target error) bool {
+	return target == ErrServiceWindowClosed
+}
+
 func (s *WhatsAppService) SendMessage(userID uuid.UUID, to, content, messageType string) (*models.Message, error) {
+	contact, err := s.findSendContact(userID, to)
+	if err != nil {
+		return nil, err
+	}
+
+	if !s.sm.ContactService.IsWindowOpen(contact) {
+		return s.sendWindowFallback(userID, contact, content, nil)
+	}
+
+	waReq := s.buildMessageRequest(to, content, messageType)
+	return s.QueueMessage(userID, waReq, content, messageType, nil)
+}
+
+// findSendContact returns the recipient's contact, or an unsaved one for
+// numbers that have never written to us.
+func (s *WhatsAppService) findSendContact(userID uuid.UUID, to string) (*models.Contact, error) {
+	contact, err := s.sm.ContactService.GetContactByPhone(userID, to)
+	if err != nil {
+		if !gorm.IsRecordNotFoundError(err) {
+			return nil, err
+		}
+		contact = &models.Contact{UserID: userID, PhoneNumber: to}
+	}
+	return contact, nil
+}
+
+// queueFreeFormMessage queues a non-template message, refusing it when the
+// contact's service window is closed.
+func (s *WhatsAppService) queueFreeFormMessage(userID uuid.UUID, waReq whatsapp.MessageRequest, content, messageType string) (*models.Message, error) {
+	contact, err := s.findSendContact(userID, waReq.To)
+	if err != nil {
+		return nil, err
+	}
+
+	if !s.sm.ContactService.IsWindowOpen(contact) {
+		return nil, &ServiceWindowClosedError{
+			PhoneNumber: contact.PhoneNumber,
+			LastInbound: contact.LastMessage,
+		}
+	}
+
+	return s.QueueMessage(userID, waReq, content, messageType, nil)
+}
+
+func (s *WhatsAppService) SendLocation(userID uuid.UUID, to string, location whatsapp.Location) (*models.Message, error) {
+	waReq := whatsapp.MessageRequest{
+		MessagingProduct: "whatsapp",
+		RecipientType:    "individual",
+		To:               to,
+		Type:             "location",
+		Location:         &location,
+	}
+	return s.queueFreeFormMessage(userID, waReq, formatLocation(&location), "location")
+}
+
+func (s *WhatsAppService) SendContacts(userID uuid.UUID, to string, contacts []whatsapp.ContactCard) (*models.Message, error) {
+	waReq := whatsapp.MessageRequest{
+		MessagingProduct: "whatsapp",
+		RecipientType:    "individual",
+		To:               to,
+		Type:             "contacts",
+		Contacts:         contacts,
+	}
+	return s.queueFreeFormMessage(userID, waReq, formatContacts(contacts), "contacts")
+}
+
+// SendImage sends an image by URL with an optional caption.
+func (s *WhatsAppService) SendImage(userID uuid.UUID, to, imageURL, caption string) (*models.Message, error) {
+	waReq := whatsapp.NewImageMessageRequest(to, imageURL, caption)
+	return s.queueFreeFormMessage(userID, waReq, imageURL, "image")
+}
+
+// SendButtons sends a message with up to three reply buttons.
+func (s *WhatsAppService) SendButtons(userID uuid.UUID, to, body string, buttons []whatsapp.ReplyButton) (*models.Message, error) {
+	waReq := whatsapp.NewButtonsMessageRequest(to, body, buttons)
+	return s.queueFreeFormMessage(userID, waReq, body, "interactive")
+}
+
+// SendList sends an interactive list message.
+func (s *WhatsAppService) SendList(userID uuid.UUID, to, header, body, buttonText string, sections []whatsapp.Section) (*models.Message, error) {
+	waReq := whatsapp.NewListMessageRequest(to, header, body, buttonText, sections)
+	return s.queueFreeFormMessage(userID, waReq, body, "interactive")
+}
+
+// SendReaction reacts to a message in the chat with to. An empty emoji
+// removes the reaction.
+func (s *WhatsAppService) SendReaction(userID uuid.UUID, to, messageID, emoji string) (*models.Message, error) {
+	waReq := whatsapp.MessageRequest{
+		MessagingProduct: "whatsapp",
+		RecipientType:    "individual",
+		To:               to,
+		Type:             "reaction",
+		Reaction: &whatsapp.Reaction{
+			MessageID: messageID,
+			Emoji:     emoji,
+		},
+	}
+	return s.queueFreeFormMessage(userID, waReq, emoji, "reaction")
+}
+
+// SendSticker sends a sticker by uploaded media ID or by URL.
+func (s *WhatsAppService) SendSticker(userID uuid.UUID, to, sticker string) (*models.Message, error) {
+	media := &whatsapp.MediaMessage{ID: sticker}
+	if strings.HasPrefix(sticker, "http://") || strings.HasPrefix(sticker, "https://") {
+		media = &whatsapp.MediaMessage{Link: sticker}
+	}
+
+	waReq := whatsapp.MessageRequest{
+		MessagingProduct: "whatsapp",
+		RecipientType:    "individual",
+		To:               to,
+		Type:             "sticker",
+		Sticker:          media,
+	}
+	return s.queueFreeFormMessage(userID, waReq, "Sticker", "sticker")
+}
+
+// SendReply sends a text message quoting replyToID.
+func (s *WhatsAppService) SendReply(userID uuid.UUID, to, replyToID, content string) (*models.Message, error) {
+	waReq := s.buildMessageRequest(to, content, "text")
+	waReq.Context = &whatsapp.MessageContext{MessageID: replyToID}
+	return s.queueFreeFormMessage(userID, waReq, content, "text")
+}
+
+// sendWindowFallback sends the configured fallback template in place of a
+// free-form message. The original text is available as the "message"
+// variable.
+func (s *WhatsAppService) sendWindowFallback(userID uuid.UUID, contact *models.Contact, content string, recipient *models.BroadcastRecipient) (*models.Message, error) {
+	windowErr := &ServiceWindowClosedError{
+		PhoneNumber: contact.PhoneNumber,
+		LastInbound: contact.LastMessage,
+	}
+
+	name := s.sm.Config.WhatsApp.WindowFallbackTemplate
+	if name == "" {
+		return nil, windowErr
+	}
+
+	template := &models.Template{}
+	if err := s.sm.DB.Where("user_id = ? AND name = ? AND is_active = ?", userID, name, true).First(template).Error; err != nil {
+		logger.Log.WithError(err).WithField("template", name).Error("Failed to load service window fallback template")
+		return nil, windowErr
+	}
+
+	values := mergeTemplateValues(ContactTemplateValues(contact), map[string]string{"message": content})
+	return s.sm.TemplateService.sendTemplate(userID, contact.PhoneNumber, template, values, recipient)
+}
+
+func (s *WhatsAppService) buildMessageRequest(to, content, messageType string) whatsapp.MessageRequest {
 	// Create WhatsApp message request
 	var waReq whatsapp.MessageRequest
 	waReq.MessagingProduct = "whatsapp"
@@ -44,22 +221,39 @@ func (s *WhatsAppService) SendMessage(userID uuid.UUID, to, content, messageType
 		}
 	}
 
-	// Send message via WhatsApp API
-	resp, err := s.sm.WhatsApp.SendMessage(waReq)
-	if err != nil {
-		logger.Log.WithError(err).Error("Failed to send WhatsApp message")
-		return nil, err
+	return waReq
+}
+
+// QueueMessage records an outgoing message and hands it to the outbound queue.
+// The message is saved with status "queued" and the job ID as its message ID;
+// both are updated once the Cloud API accepts it.
+func (s *WhatsAppService) QueueMessage(userID uuid.UUID, waReq whatsapp.MessageRequest, content, messageType string, recipient *models.BroadcastRecipient) (*models.Message, error) {
+	job := &OutboundJob{
+		ID:      uuid.New().String(),
+		UserID:  userID,
+		Request: waReq,
+	}
+	if recipient != nil {
+		job.BroadcastID = &recipient.BroadcastID
+		job.RecipientID = &recipient.ID
 	}
 
-	// Save message to database
+	// Save message to database before the worker can pick it up
 	message := &models.Message{
-		UserID:       userID,
-		MessageID:    resp.Messages[0].ID,
-		Content:      content,
-		MessageType:  messageType,
-		Direction:    "outgoing",
-		Status:       "sent",
-		Timestamp:    time.Now(),
+		UserID:      userID,
+		MessageID:   job.ID,
+		Content:     content,
+		MessageType: messageType,
+		Direction:   "outgoing",
+		Status:      "queued",
+		Timestamp:   time.Now(),
+	}
+	if waReq.Context != nil {
+		message.IsReply = true
+		message.ReplyToID = waReq.Context.MessageID
+	}
+	if waReq.Reaction != nil {
+		message.ReplyToID = waReq.Reaction.MessageID
 	}
 
 	if err := s.sm.DB.Create(message).Error; err != nil {
@@ -67,8 +261,11 @@ func (s *WhatsAppService) SendMessage(userID uuid.UUID, to, content, messageType
 		return nil, err
 	}
 
-	// Update contact last message time
-	s.sm.ContactService.UpdateLastMessageTime(to, time.Now())
+	if err := s.sm.OutboundQueue.Enqueue(job); err != nil {
+		logger.Log.WithError(err).Error("Failed to queue WhatsApp message")
+		s.sm.DB.Model(message).Update("status", "failed")
+		return nil, err
+	}
 
 	return message, nil
 }
@@ -87,6 +284,40 @@ func (s *WhatsAppService) BroadcastMessage(userID uuid.UUID, recipients []string
 		return err
 	}
 
+	return s.sendBroadcast(broadcast, recipients)
+}
+
+// BroadcastTemplate sends a message template to every recipient. Values apply
+// to all recipients; each recipient's name and phone are added automatically.
+func (s *WhatsAppService) BroadcastTemplate(userID uuid.UUID, recipients []string, templateID uuid.UUID, values map[string]string) error {
+	template, err := s.sm.TemplateService.GetTemplate(userID, templateID)
+	if err != nil {
+		return err
+	}
+
+	valuesJSON, err := json.Marshal(values)
+	if err != nil {
+		return err
+	}
+
+	broadcast := &models.Broadcast{
+		UserID:         userID,
+		Name:           fmt.Sprintf("Broadcast_%s_%d", template.Name, time.Now().Unix()),
+		Content:        template.Content,
+		MessageType:    "template",
+		Status:         "sending",
+		TemplateID:     &template.ID,
+		TemplateValues: string(valuesJSON),
+	}
+
+	if err := s.sm.DB.Create(broadcast).Error; err != nil {
+		return err
+	}
+
+	return s.sendBroadcast(broadcast, recipients)
+}
+
+func (s *WhatsAppService) sendBroadcast(broadcast *models.Broadcast, recipients []string) error {
 	// Process recipients in batches
 	batchSize := 50
 	for i := 0; i < len(recipients); i += batchSize {
@@ -101,13 +332,27 @@ func (s *WhatsAppService) BroadcastMessage(userID uuid.UUID, recipients []string
 		}
 	}
 
-	// Update broadcast status
-	broadcast.Status = "sent"
-	broadcast.SentAt = &time.Now{}
-	return s.sm.DB.Save(broadcast).Error
+	// Update broadcast status. Totals are maintained by the outbound queue,
+	// so only the status columns are written here.
+	return s.sm.DB.Model(broadcast).Updates(map[string]interface{}{
+		"status":  "sent",
+		"sent_at": time.Now(),
+	}).Error
 }
 
 func (s *WhatsAppService) processBroadcastBatch(broadcast *models.Broadcast, recipients []string) error {
+	var template *models.Template
+	var values map[string]string
+	if broadcast.TemplateID != nil {
+		var err error
+		if template, err = s.sm.TemplateService.GetTemplate(broadcast.UserID, *broadcast.TemplateID); err != nil {
+			return err
+		}
+		if values, err = parseTemplateValues(broadcast.TemplateValues); err != nil {
+			return err
+		}
+	}
+
 	for _, recipient := range recipients {
 		recipientModel := &models.BroadcastRecipient{
 			BroadcastID: broadcast.ID,
@@ -115,7 +360,7 @@ func (s *WhatsAppService) processBroadcastBatch(broadcast *models.Broadcast, rec
 		}
 
 		// Find or create contact
-		contact, err := s.sm.ContactService.FindOrCreateContact(recipient)
+		contact, err := s.sm.ContactService.FindOrCreateContact(broadcast.UserID, recipient)
 		if err != nil {
 			recipientModel.Status = "failed"
 			recipientModel.Error = err.Error()
@@ -125,25 +370,36 @@ func (s *WhatsAppService) processBroadcastBatch(broadcast *models.Broadcast, rec
 
 		recipientModel.ContactID = contact.ID
 
-		// Send message
-		message, err := s.SendMessage(broadcast.UserID, recipient, broadcast.Content, broadcast.MessageType)
-		if err != nil {
-			recipientModel.Status = "failed"
-			recipientModel.Error = err.Error()
-			broadcast.TotalFailed++
-		} else {
-			recipientModel.Status = "sent"
-			recipientModel.SentAt = &time.Now()
-			recipientModel.MessageID = message.ID
-			broadcast.TotalSent++
+		// The recipient row must exist before the job is queued; the queue
+		// worker updates it and the broadcast totals once the send settles.
+		recipientModel.Status = "queued"
+		if err := s.sm.DB.Create(recipientModel).Error; err != nil {
+			logger.Log.WithError(err).Error("Failed to save broadcast recipient")
+			continue
 		}
 
-		s.sm.DB.Create(recipientModel)
+		if _, err := s.queueBroadcastMessage(broadcast, template, values, contact, recipientModel); err != nil {
+			s.sm.DB.Model(recipientModel).Updates(map[string]interface{}{"status": "failed", "error": err.Error()})
+			s.sm.DB.Model(broadcast).UpdateColumn("total_failed", gorm.Expr("total_failed + ?", 1))
+		}
 	}
 
 	return nil
 }
 
+func (s *WhatsAppService) queueBroadcastMessage(broadcast *models.Broadcast, template *models.Template, values map[string]string, contact *models.Contact, recipient *models.BroadcastRecipient) (*models.Message, error) {
+	if template != nil {
+		return s.sm.TemplateService.sendTemplate(broadcast.UserID, contact.PhoneNumber, template, mergeTemplateValues(ContactTemplateValues(contact), values), recipient)
+	}
+
+	if !s.sm.ContactService.IsWindowOpen(contact) {
+		return s.sendWindowFallback(broadcast.UserID, contact, broadcast.Content, recipient)
+	}
+
+	waReq := s.buildMessageRequest(contact.PhoneNumber, broadcast.Content, broadcast.MessageType)
+	return s.QueueMessage(broadcast.UserID, waReq, broadcast.Content, broadcast.MessageType, recipient)
+}
+
 func (s *WhatsAppService) HandleIncomingMessage(payload *whatsapp.WebhookPayload) error {
 	for _, entry := range payload.Entry {
 		for _, change := range entry.Changes {
@@ -151,9 +407,24 @@ func (s *WhatsAppService) HandleIncomingMessage(payload *whatsapp.WebhookPayload
 				continue
 			}
 
+			// Route to the user who owns the receiving number
+			account, client := s.sm.WhatsAppAccountService.ResolveByPhoneNumberID(change.Value.Metadata.PhoneNumberID)
+
 			for _, message := range change.Value.Messages {
-				if err := s.processIncomingMessage(&message, change.Value.Contacts); err != nil {
+				// Meta redelivers webhooks; run each message through once
+				if !s.claimIncomingMessage(&message) {
+					continue
+				}
+
+				if err := s.processIncomingMessage(&message, change.Value.Contacts, account, client); err != nil {
 					logger.Log.WithError(err).Error("Failed to process incoming message")
+					s.releaseIncomingMessage(message.ID)
+				}
+			}
+
+			for _, status := range change.Value.Statuses {
+				if err := s.processStatusUpdate(&status); err != nil {
+					logger.Log.WithError(err).Error("Failed to process message status")
 				}
 			}
 		}
@@ -161,7 +432,50 @@ func (s *WhatsAppService) HandleIncomingMessage(payload *whatsapp.WebhookPayload
 	return nil
 }
 
-func (s *WhatsAppService) processIncomingMessage(message *whatsapp.Message, contacts []whatsapp.Contact) error {
+// VerifyWebhookSignature checks that a webhook delivery was signed by Meta.
+func (s *WhatsAppService) VerifyWebhookSignature(payload []byte, signature string) bool {
+	if !s.sm.WhatsApp.VerifyWebhookSignature(payload, signature) {
+		logger.Log.WithField("signature", signature).Warn("Rejected WhatsApp webhook with invalid signature")
+		return false
+	}
+	return true
+}
+
+// claimIncomingMessage marks an inbound message as seen and reports whether
+// this delivery should be processed. Redeliveries and messages older than
+// the seen-set TTL are rejected.
+func (s *WhatsAppService) claimIncomingMessage(message *whatsapp.Message) bool {
+	maxAge := s.sm.Config.WhatsApp.WebhookMaxAge
+	fields := logrus.Fields{"message_id": message.ID, "from": message.From}
+
+	if sentAt := parseWebhookTimestamp(message.Timestamp); maxAge > 0 && time.Since(sentAt) > maxAge {
+		logger.Log.WithFields(fields).Warn("Rejected stale WhatsApp message")
+		return false
+	}
+
+	ctx := s.sm.Redis.Context()
+	claimed, err := s.sm.Redis.SetNX(ctx, webhookSeenKeyPrefix+message.ID, 1, maxAge).Result()
+	if err != nil {
+		// Fall back to the unique message ID constraint
+		logger.Log.WithError(err).WithFields(fields).Error("Failed to check seen WhatsApp message")
+		return true
+	}
+
+	if !claimed {
+		logger.Log.WithFields(fields).Info("Skipped duplicate WhatsApp message")
+	}
+	return claimed
+}
+
+// releaseIncomingMessage forgets a message that failed processing so a
+// redelivery can retry it.
+func (s *WhatsAppService) releaseIncomingMessage(messageID string) {
+	if err := s.sm.Redis.Del(s.sm.Redis.Context(), webhookSeenKeyPrefix+messageID).Err(); err != nil {
+		logger.Log.WithError(err).WithField("message_id", messageID).Error("Failed to release seen WhatsApp message")
+	}
+}
+
+func (s *WhatsAppService) processIncomingMessage(message *whatsapp.Message, contacts []whatsapp.Contact, account *models.WhatsAppAccount, client *whatsapp.Client) error {
 	// Find sender contact
 	var senderContact *whatsapp.Contact
 	for _, contact := range contacts {
@@ -176,11 +490,22 @@ func (s *WhatsAppService) processIncomingMessage(message *whatsapp.Message, cont
 	}
 
 	// Find or create contact in database
-	contact, err := s.sm.ContactService.FindOrCreateContact(message.From)
+	ownerID := uuid.Nil
+	if account != nil {
+		ownerID = account.UserID
+	}
+	contact, err := s.sm.ContactService.FindOrCreateContact(ownerID, message.From)
 	if err != nil {
 		return err
 	}
 
+	// An inbound message opens the 24-hour service window
+	receivedAt := parseWebhookTimestamp(message.Timestamp)
+	contact.LastMessage = receivedAt
+	if err := s.sm.ContactService.UpdateLastMessageTime(contact.ID, receivedAt); err != nil {
+		logger.Log.WithError(err).Error("Failed to update contact last message time")
+	}
+
 	// Update contact display name if available
 	if senderContact.Profile.Name != "" {
 		contact.DisplayName = senderContact.Profile.Name
@@ -189,6 +514,7 @@ func (s *WhatsAppService) processIncomingMessage(message *whatsapp.Message, cont
 
 	// Save incoming message
 	incomingMessage := &models.Message{
+		UserID:      contact.UserID,
 		MessageID:   message.ID,
 		ContactID:   contact.ID,
 		Content:     getMessageContent(message),
@@ -198,42 +524,42 @@ func (s *WhatsAppService) processIncomingMessage(message *whatsapp.Message, cont
 		Timestamp:   time.Now(),
 	}
 
-	if err := s.sm.DB.Create(incomingMessage).Error; err != nil {
-		return err
-	}
-
-	// Process auto-reply
-	if err := s.sm.AutoReplyService.ProcessAutoReply(contact, incomingMessage); err != nil {
-		logger.Log.WithError(err).Error("Failed to process auto-reply")
+	// Quoted replies and reactions reference another message
+	if message.Context != nil && message.Context.ID != "" {
+		incomingMessage.IsReply = true
+		incomingMessage.ReplyToID = message.Context.ID
 	}
-
-	// Process custom commands
-	if err := s.processCustomCommands(contact, incomingMessage); err != nil {
-		logger.Log.WithError(err).Error("Failed to process custom commands")
+	if message.Reaction != nil {
+		incomingMessage.ReplyToID = message.Reaction.MessageID
 	}
 
-	// Process game commands
-	if err := s.sm.GameService.ProcessGameCommand(contact, incomingMessage); err != nil {
-		logger.Log.WithError(err).Error("Failed to process game command")
+	// Fetch attached media into storage
+	if media := getMessageMedia(message); media != nil {
+		mediaURL, err := s.storeIncomingMedia(client, media)
+		if err != nil {
+			logger.Log.WithError(err).WithField("media_id", media.ID).Error("Failed to store incoming media")
+		} else {
+			incomingMessage.MediaURL = mediaURL
+		}
+		incomingMessage.MediaMimeType = media.MimeType
 	}
 
-	// Process utility commands
-	if err := s.sm.UtilityService.ProcessUtilityCommand(contact, incomingMessage); err != nil {
-		logger.Log.WithError(err).Error("Failed to process utility command")
+	if err := s.sm.DB.Create(incomingMessage).Error; err != nil {
+		return err
 	}
 
-	// Process business commands
-	if err := s.sm.BusinessService.ProcessBusinessCommand(contact, incomingMessage); err != nil {
-		logger.Log.WithError(err).Error("Failed to process business command")
+	// Reactions are recorded but never treated as commands
+	if message.Type == "reaction" {
+		s.sm.AnalyticsService.LogEvent(contact.UserID, "reaction_received", 1, map[string]interface{}{
+			"emoji":      incomingMessage.Content,
+			"message_id": incomingMessage.ReplyToID,
+		})
+		return nil
 	}
 
-	// Log analytics
-	s.sm.AnalyticsService.LogEvent(contact.UserID, "message_received", 1, map[string]interface{}{
-		"message_type": message.Type,
-		"contact_id":   contact.ID,
-	})
+	s.sm.BridgeService.RelayFromWhatsApp(contact, incomingMessage)
 
-	return nil
+	return s.sm.HandleConversationMessage(contact, incomingMessage, getInteractiveReplyID(message))
 }
 
 func (s *WhatsAppService) processCustomCommands(contact *models.Contact, message *models.Message) error {
@@ -246,8 +572,7 @@ func (s *WhatsAppService) processCustomCommands(contact *models.Contact, message
 	for _, command := range commands {
 		if shouldTriggerCommand(message.Content, command.Command, command.TriggerType) {
 			// Send response
-			_, err := s.SendMessage(contact.UserID, contact.PhoneNumber, command.Response, "text")
-			return err
+			return s.sm.SendContactText(contact, command.Response)
 		}
 	}
 
@@ -284,16 +609,185 @@ func getMessageContent(message *whatsapp.Message) string {
 		}
 	case "video":
 		if message.Video != nil {
+			if message.Video.Caption != "" {
+				return message.Video.Caption
+			}
 			return "Video message"
 		}
+	case "interactive":
+		if message.Interactive != nil {
+			if message.Interactive.ButtonReply != nil {
+				return message.Interactive.ButtonReply.Title
+			}
+			if message.Interactive.ListReply != nil {
+				return message.Interactive.ListReply.Title
+			}
+		}
+	case "button":
+		if message.Button != nil {
+			return message.Button.Text
+		}
 	case "document":
 		if message.Document != nil {
+			if message.Document.Caption != "" {
+				return message.Document.Caption
+			}
+			if message.Document.Filename != "" {
+				return message.Document.Filename
+			}
 			return "Document message"
 		}
+	case "sticker":
+		if message.Sticker != nil {
+			return "Sticker"
+		}
+	case "location":
+		if message.Location != nil {
+			return formatLocation(message.Location)
+		}
+	case "contacts":
+		if len(message.Contacts) > 0 {
+			return formatContacts(message.Contacts)
+		}
+	case "reaction":
+		if message.Reaction != nil {
+			return message.Reaction.Emoji
+		}
 	}
 	return ""
 }
 
+func formatLocation(location *whatsapp.Location) string {
+	content := fmt.Sprintf("Location: %f, %f", location.Latitude, location.Longitude)
+	if location.Name != "" {
+		content = fmt.Sprintf("%s (%s)", content, location.Name)
+	}
+	if location.Address != "" {
+		content = fmt.Sprintf("%s - %s", content, location.Address)
+	}
+	return content
+}
+
+func formatContacts(contacts []whatsapp.ContactCard) string {
+	var names []string
+	for _, card := range contacts {
+		name := card.Name.FormattedName
+		if len(card.Phones) > 0 {
+			name = fmt.Sprintf("%s (%s)", name, card.Phones[0].Phone)
+		}
+		names = append(names, name)
+	}
+	return "Contact: " + strings.Join(names, ", ")
+}
+
+// Reply IDs attached to interactive buttons and list rows
+const (
+	replyIDCommandPrefix    = "cmd:"
+	replyIDMenuPrefix       = "menu:"
+	replyIDQuizAnswerPrefix = "quiz_answer:"
+)
+
+func getInteractiveReplyID(message *whatsapp.Message) string {
+	switch message.Type {
+	case "interactive":
+		if message.Interactive == nil {
+			return ""
+		}
+		if message.Interactive.ButtonReply != nil {
+			return message.Interactive.ButtonReply.ID
+		}
+		if message.Interactive.ListReply != nil {
+			return message.Interactive.ListReply.ID
+		}
+	case "button":
+		if message.Button != nil {
+			return message.Button.Payload
+		}
+	}
+	return ""
+}
+
+func isOrderCommand(content string) bool {
+	fields := strings.Fields(strings.ToLower(content))
+	return len(fields) > 1 && fields[0] == "pesan"
+}
+
+func isMenuCommand(content string) bool {
+	content = strings.ToLower(strings.TrimSpace(content))
+	return content == "menu" || content == "help" || content == "bantuan"
+}
+
+func getMessageMedia(message *whatsapp.Message) *whatsapp.Media {
+	switch message.Type {
+	case "image":
+		return message.Image
+	case "audio":
+		return message.Audio
+	case "video":
+		return message.Video
+	case "document":
+		return message.Document
+	case "sticker":
+		return message.Sticker
+	}
+	return nil
+}
+
+// storeIncomingMedia downloads a media attachment from the Cloud API and saves
+// it to the configured storage backend, returning the stored file URL.
+func (s *WhatsAppService) storeIncomingMedia(client *whatsapp.Client, media *whatsapp.Media) (string, error) {
+	data, info, err := client.DownloadMedia(media.ID)
+	if err != nil {
+		return "", err
+	}
+
+	mimeType := media.MimeType
+	if mimeType == "" {
+		mimeType = info.MimeType
+	}
+
+	key := fmt.Sprintf("whatsapp/%s/%s%s", time.Now().Format("2006/01/02"), media.ID, storage.ExtensionForMimeType(mimeType))
+	return s.sm.Storage.Save(key, data, mimeType)
+}
+
+// SendMediaFile uploads a file to WhatsApp and queues it for the recipient.
+// Like other free-form messages it needs an open customer service window.
+func (s *WhatsAppService) SendMediaFile(userID uuid.UUID, to, mediaType, filename, mimeType string, data []byte, caption string) (*models.Message, error) {
+	client := s.sm.WhatsAppClient(userID)
+
+	mediaID, err := client.UploadMedia(filename, mimeType, bytes.NewReader(data))
+	if err != nil {
+		logger.Log.WithError(err).Error("Failed to upload WhatsApp media")
+		return nil, err
+	}
+
+	waReq, err := whatsapp.NewMediaMessageRequest(to, mediaType, mediaID, caption, filename)
+	if err != nil {
+		return nil, err
+	}
+
+	message, err := s.queueFreeFormMessage(userID, waReq, caption, mediaType)
+	if err != nil {
+		return nil, err
+	}
+
+	// Keep a local copy so the message can be displayed in transcripts
+	key := fmt.Sprintf("whatsapp/%s/%s%s", time.Now().Format("2006/01/02"), mediaID, storage.ExtensionForMimeType(mimeType))
+	mediaURL, err := s.sm.Storage.Save(key, data, mimeType)
+	if err != nil {
+		logger.Log.WithError(err).Error("Failed to store outgoing media")
+		return message, nil
+	}
+
+	message.MediaURL = mediaURL
+	message.MediaMimeType = mimeType
+	if err := s.sm.DB.Model(message).Updates(map[string]interface{}{"media_url": mediaURL, "media_mime_type": mimeType}).Error; err != nil {
+		logger.Log.WithError(err).Error("Failed to save outgoing media URL")
+	}
+
+	return message, nil
+}
+
 func (s *WhatsAppService) GetContacts(userID uuid.UUID) ([]models.Contact, error) {
 	var contacts []models.Contact
 	err := s.sm.DB.Where("user_id = ?", userID).Find(&contacts).Error
@@ -313,7 +807,7 @@ func (s *WhatsAppService) CreateGroup(userID uuid.UUID, name string, members []s
 
 	// Add members
 	for _, member := range members {
-		contact, err := s.sm.ContactService.FindOrCreateContact(member)
+		contact, err := s.sm.ContactService.FindOrCreateContact(userID, member)
 		if err != nil {
 			continue
 		}
@@ -337,12 +831,149 @@ func (s *WhatsAppService) GetGroups(userID uuid.UUID) ([]models.Group, error) {
 	return groups, err
 }
 
+// messageStatusOrder lists delivery states in the order they happen. Status
+// callbacks can arrive out of order, so a status never moves backwards.
+var messageStatusOrder = []string{"queued", "sent", "delivered", "read"}
+
+// previousStatuses returns the statuses a message may be in for status to be
+// applied. A failure can replace anything except read.
+func previousStatuses(status string) []string {
+	if status == "failed" {
+		return []string{"queued", "sent", "delivered"}
+	}
+
+	for i, s := range messageStatusOrder {
+		if s == status {
+			return messageStatusOrder[:i]
+		}
+	}
+	return nil
+}
+
 func (s *WhatsAppService) UpdateMessageStatus(messageID string, status string) error {
 	return s.sm.DB.Model(&models.Message{}).
-		Where("message_id = ?", messageID).
+		Where("message_id = ? AND status IN (?)", messageID, previousStatuses(status)).
 		Update("status", status).Error
 }
 
+// parseWebhookTimestamp converts the Unix timestamp strings used in webhooks,
+// falling back to the current time.
+func parseWebhookTimestamp(timestamp string) time.Time {
+	if ts, err := strconv.ParseInt(timestamp, 10, 64); err == nil {
+		return time.Unix(ts, 0)
+	}
+	return time.Now()
+}
+
+func (s *WhatsAppService) processStatusUpdate(status *whatsapp.Status) error {
+	statusTime := parseWebhookTimestamp(status.Timestamp)
+
+	if err := s.UpdateMessageStatus(status.ID, status.Status); err != nil {
+		return err
+	}
+
+	// Record delivery metadata regardless of ordering
+	updates := map[string]interface{}{}
+	recipientUpdates := map[string]interface{}{}
+
+	switch status.Status {
+	case "delivered":
+		updates["delivered_at"] = statusTime
+		recipientUpdates["delivered_at"] = statusTime
+	case "read":
+		updates["read_at"] = statusTime
+		recipientUpdates["read_at"] = statusTime
+	}
+
+	if status.Conversation != nil {
+		updates["conversation_id"] = status.Conversation.ID
+		updates["conversation_category"] = status.Conversation.Origin.Type
+	}
+	if status.Pricing != nil {
+		updates["pricing_category"] = status.Pricing.Category
+		updates["billable"] = status.Pricing.Billable
+	}
+	if len(status.Errors) > 0 {
+		statusErr := status.Errors[0]
+		message := statusErr.Title
+		if statusErr.ErrorData != nil && statusErr.ErrorData.Details != "" {
+			message = fmt.Sprintf("%s: %s", statusErr.Title, statusErr.ErrorData.Details)
+		}
+		updates["error_code"] = statusErr.Code
+		updates["error_message"] = message
+		recipientUpdates["error"] = message
+	}
+
+	if len(updates) > 0 {
+		if err := s.sm.DB.Model(&models.Message{}).
+			Where("message_id = ?", status.ID).
+			Updates(updates).Error; err != nil {
+			return err
+		}
+	}
+
+	// Keep broadcast recipients in step with the message
+	if status.Status == "failed" {
+		if err := s.failBroadcastRecipients(status.ID); err != nil {
+			return err
+		}
+	} else if err := s.sm.DB.Model(&models.BroadcastRecipient{}).
+		Where("message_id = ? AND status IN (?)", status.ID, previousStatuses(status.Status)).
+		Update("status", status.Status).Error; err != nil {
+		return err
+	}
+	if len(recipientUpdates) > 0 {
+		if err := s.sm.DB.Model(&models.BroadcastRecipient{}).
+			Where("message_id = ?", status.ID).
+			Updates(recipientUpdates).Error; err != nil {
+			return err
+		}
+	}
+
+	logger.Log.WithFields(logrus.Fields{
+		"message_id": status.ID,
+		"status":     status.Status,
+		"recipient":  status.RecipientID,
+	}).Debug("Message status updated")
+
+	return nil
+}
+
+// failBroadcastRecipients marks the recipients of a failed message. One that
+// was already counted as sent moves from the broadcast's sent count to its
+// failed count.
+func (s *WhatsAppService) failBroadcastRecipients(messageID string) error {
+	var recipients []models.BroadcastRecipient
+	if err := s.sm.DB.Where("message_id = ? AND status IN (?)", messageID, previousStatuses("failed")).
+		Find(&recipients).Error; err != nil {
+		return err
+	}
+
+	for _, recipient := range recipients {
+		// Only the update that changes the status moves the counts
+		result := s.sm.DB.Model(&models.BroadcastRecipient{}).
+			Where("id = ? AND status = ?", recipient.ID, recipient.Status).
+			Update("status", "failed")
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			continue
+		}
+
+		counts := map[string]interface{}{"total_failed": gorm.Expr("total_failed + ?", 1)}
+		if recipient.Status != "queued" {
+			counts["total_sent"] = gorm.Expr("total_sent - ?", 1)
+		}
+		if err := s.sm.DB.Model(&models.Broadcast{}).
+			Where("id = ?", recipient.BroadcastID).
+			UpdateColumns(counts).Error; err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
 func (s *WhatsAppService) GetMessageStats(userID uuid.UUID) (map[string]interface{}, error) {
 	stats := make(map[string]interface{})
 
@@ -376,4 +1007,103 @@ func (s *WhatsAppService) GetMessageStats(userID uuid.UUID) (map[string]interfac
 	stats["messages_by_direction"] = messagesByDirection
 
 	return stats, nil
-}
\ No newline at end of file
+}
+
+// SendMenu sends one of the bot's tappable menus as a list message (an inline
+// keyboard on Telegram).
+// Rows carry "cmd:" reply IDs so a selection runs the same command handlers as
+// the typed command.
+func (s *WhatsAppService) SendMenu(contact *models.Contact, menu string) error {
+	var header, body string
+	var sections []ChannelSection
+
+	switch menu {
+	case "games":
+		header = "🎮 Games"
+		body = "Pilih permainan yang ingin kamu mainkan:"
+		sections = []ChannelSection{
+			{
+				Title: "Permainan",
+				Options: []ChannelOption{
+					{ID: replyIDCommandPrefix + "kuis", Title: "🧠 Kuis", Description: "Jawab 5 pertanyaan acak"},
+					{ID: replyIDCommandPrefix + "tebak gambar", Title: "🖼️ Tebak Gambar", Description: "Tebak nama benda di gambar"},
+					{ID: replyIDCommandPrefix + "math challenge", Title: "🧮 Tantangan Matematika", Description: "Jawab dalam 60 detik"},
+				},
+			},
+			{
+				Title: "Hiburan",
+				Options: []ChannelOption{
+					{ID: replyIDCommandPrefix + "cek khodam", Title: "✨ Cek Khodam"},
+					{ID: replyIDCommandPrefix + "zodiak", Title: "🔮 Zodiak"},
+					{ID: replyIDCommandPrefix + "joke", Title: "😂 Joke"},
+					{ID: replyIDCommandPrefix + "cerita", Title: "📖 Cerita"},
+				},
+			},
+		}
+	case "utilities":
+		header = "🛠️ Utilitas"
+		body = "Pilih alat yang ingin kamu gunakan:"
+		sections = []ChannelSection{
+			{
+				Title: "Utilitas",
+				Options: []ChannelOption{
+					{ID: replyIDCommandPrefix + "cuaca", Title: "🌤️ Cuaca", Description: "Contoh: cuaca jakarta"},
+					{ID: replyIDCommandPrefix + "kurs", Title: "💱 Kurs Mata Uang", Description: "Contoh: kurs 100 usd idr"},
+					{ID: replyIDCommandPrefix + "translate", Title: "🌐 Terjemahan"},
+					{ID: replyIDCommandPrefix + "qr", Title: "📱 QR Code"},
+					{ID: replyIDCommandPrefix + "reminder list", Title: "🔔 Pengingat Saya"},
+					{ID: replyIDCommandPrefix + "reminder", Title: "❓ Bantuan Pengingat"},
+				},
+			},
+		}
+	case "business":
+		header = "💼 Katalog"
+		body = "Pilih produk untuk langsung memesan 1 item:"
+
+		// Rows use the catalog numbers "pesan" resolves
+		products, err := s.sm.BusinessService.catalogProducts(contact.UserID)
+		if err != nil {
+			return err
+		}
+		if len(products) > 9 {
+			products = products[:9]
+		}
+
+		rows := make([]ChannelOption, 0, len(products)+1)
+		for i, product := range products {
+			rows = append(rows, ChannelOption{
+				ID:          fmt.Sprintf("%spesan %d 1", replyIDCommandPrefix, i+1),
+				Title:       truncateRunes(product.Name, 24),
+				Description: truncateRunes(fmt.Sprintf("%s %.0f - stok %d", product.Currency, product.Price, product.Stock), 72),
+			})
+		}
+		rows = append(rows, ChannelOption{ID: replyIDCommandPrefix + "katalog", Title: "📋 Katalog Lengkap"})
+
+		sections = []ChannelSection{{Title: "Produk", Options: rows}}
+	default:
+		header = "🏠 Menu Utama"
+		body = "Halo! Apa yang ingin kamu lakukan hari ini?"
+		sections = []ChannelSection{
+			{
+				Title: "Menu",
+				Options: []ChannelOption{
+					{ID: replyIDMenuPrefix + "games", Title: "🎮 Games", Description: "Kuis, tebak gambar, dan hiburan"},
+					{ID: replyIDMenuPrefix + "business", Title: "💼 Katalog", Description: "Lihat produk dan pesan"},
+					{ID: replyIDMenuPrefix + "utilities", Title: "🛠️ Utilitas", Description: "Cuaca, kurs, pengingat"},
+				},
+			},
+		}
+	}
+
+	return s.sm.Channel(contact).SendList(header, body, "Pilih", sections)
+}
+
+// truncateRunes shortens s to at most max characters, as WhatsApp limits the
+// length of list titles and descriptions.
+func truncateRunes(s string, max int) string {
+	runes := []rune(s)
+	if len(runes) <= max {
+		return s
+	}
+	return string(runes[:max-1]) + "…"
+}
@@ -13,8 +13,8 @@ import (
 	"whatsapp-bot/internal/handlers"
 	"whatsapp-bot/internal/middleware"
 	"whatsapp-bot/internal/services"
-	"whatsapp-bot/internal/utils"
 	"whatsapp-bot/pkg/logger"
+	"whatsapp-bot/pkg/telegram"
 	"whatsapp-bot/pkg/whatsapp"
 
 	"github.com/gin-gonic/gin"
@@ -58,6 +58,47 @@ func main() {
 	// Initialize services
 	serviceManager := services.NewServiceManager(db, redisClient, waClient, cfg)
 
+	// Stored access tokens and bot tokens can't be read without the key.
+	// Without stored ones the bot runs, but numbers and bots can't be added.
+	if cfg.Security.EncryptionKey == "" {
+		stored, err := serviceManager.HasStoredCredentials()
+		if err != nil {
+			log.Fatal("Failed to check stored credentials:", err)
+		}
+		if stored {
+			log.Fatal("ENCRYPTION_KEY must be set to use the stored WhatsApp numbers and Telegram bots")
+		}
+		log.Println("ENCRYPTION_KEY is not set: WhatsApp numbers and Telegram bots can't be added")
+	}
+
+	// Media URLs are signed with their own key, never the JWT secret
+	if cfg.Storage.SigningKey == "" {
+		log.Fatal("STORAGE_SIGNING_KEY must be set")
+	}
+
+	// Start outbound message queue workers
+	serviceManager.OutboundQueue.Start(context.Background())
+	defer serviceManager.OutboundQueue.Stop()
+
+	// Receive Telegram updates by webhook or long polling
+	if cfg.Telegram.BotToken != "" {
+		if err := serviceManager.TelegramService.StartReceiving(); err != nil {
+			log.Println("Failed to start receiving Telegram updates:", err)
+		}
+		if err := serviceManager.TelegramService.SyncCommands(); err != nil {
+			log.Println("Failed to sync Telegram bot commands:", err)
+		}
+		defer serviceManager.TelegramService.StopPolling()
+	}
+
+	if cfg.Telegram.PaymentProviderToken == telegram.StubProviderToken {
+		log.Println("Telegram Payments use the stub provider: invoices are marked paid without charging anyone")
+	}
+
+	// Run the hosted Telegram bots
+	serviceManager.TelegramBotService.Start()
+	defer serviceManager.TelegramBotService.Stop()
+
 	// Initialize cron jobs
 	cronManager := cron.New()
 	setupCronJobs(cronManager, serviceManager)
@@ -106,95 +147,7 @@ func setupRouter(serviceManager *services.ServiceManager) *gin.Engine {
 	router.Use(middleware.CORS())
 	router.Use(middleware.RateLimiter())
 
-	// Health check
-	router.GET("/health", func(c *gin.Context) {
-		c.JSON(200, gin.H{"status": "healthy"})
-	})
-
-	// API routes
-	api := router.Group("/api/v1")
-	{
-		// Auth routes
-		auth := api.Group("/auth")
-		{
-			authHandler := handlers.NewAuthHandler(serviceManager)
-			auth.POST("/login", authHandler.Login)
-			auth.POST("/register", authHandler.Register)
-			auth.POST("/refresh", authHandler.RefreshToken)
-		}
-
-		// WhatsApp routes
-		whatsapp := api.Group("/whatsapp")
-		whatsapp.Use(middleware.AuthJWT())
-		{
-			whatsappHandler := handlers.NewWhatsAppHandler(serviceManager)
-			whatsapp.POST("/send", whatsappHandler.SendMessage)
-			whatsapp.POST("/broadcast", whatsappHandler.BroadcastMessage)
-			whatsapp.GET("/contacts", whatsappHandler.GetContacts)
-			whatsapp.POST("/groups", whatsappHandler.CreateGroup)
-			whatsapp.GET("/groups", whatsappHandler.GetGroups)
-		}
-
-		// Bot features routes
-		bot := api.Group("/bot")
-		bot.Use(middleware.AuthJWT())
-		{
-			botHandler := handlers.NewBotHandler(serviceManager)
-			bot.GET("/features", botHandler.GetFeatures)
-			bot.POST("/features/:feature/enable", botHandler.EnableFeature)
-			bot.POST("/features/:feature/disable", botHandler.DisableFeature)
-			bot.GET("/analytics", botHandler.GetAnalytics)
-		}
-
-		// Game routes
-		game := api.Group("/game")
-		game.Use(middleware.AuthJWT())
-		{
-			gameHandler := handlers.NewGameHandler(serviceManager)
-			game.GET("/leaderboard", gameHandler.GetLeaderboard)
-			game.POST("/quiz/start", gameHandler.StartQuiz)
-			game.POST("/quiz/answer", gameHandler.SubmitAnswer)
-			game.GET("/khodam/:name", gameHandler.CheckKhodam)
-		}
-
-		// Business routes
-		business := api.Group("/business")
-		business.Use(middleware.AuthJWT())
-		{
-			businessHandler := handlers.NewBusinessHandler(serviceManager)
-			business.GET("/products", businessHandler.GetProducts)
-			business.POST("/products", businessHandler.CreateProduct)
-			business.GET("/orders", businessHandler.GetOrders)
-			business.POST("/orders", businessHandler.CreateOrder)
-			business.GET("/customers", businessHandler.GetCustomers)
-		}
-
-		// Utility routes
-		utils := api.Group("/utils")
-		utils.Use(middleware.AuthJWT())
-		{
-			utilsHandler := handlers.NewUtilsHandler(serviceManager)
-			utils.GET("/weather/:city", utilsHandler.GetWeather)
-			utils.GET("/currency", utilsHandler.ConvertCurrency)
-			utils.POST("/translate", utilsHandler.Translate)
-			utils.GET("/qrcode", utilsHandler.GenerateQRCode)
-		}
-
-		// Admin routes
-		admin := api.Group("/admin")
-		admin.Use(middleware.AuthJWT())
-		admin.Use(middleware.RequireAdmin())
-		{
-			adminHandler := handlers.NewAdminHandler(serviceManager)
-			admin.GET("/users", adminHandler.GetUsers)
-			admin.GET("/stats", adminHandler.GetStats)
-			admin.POST("/broadcast", adminHandler.AdminBroadcast)
-			admin.GET("/logs", adminHandler.GetLogs)
-		}
-	}
-
-	// Webhook for WhatsApp
-	router.POST("/webhook/whatsapp", handlers.NewWhatsAppHandler(serviceManager).HandleWebhook)
+	handlers.SetupRoutes(router, serviceManager)
 
 	return router
 }
@@ -205,11 +158,21 @@ func setupCronJobs(cronManager *cron.Cron, serviceManager *services.ServiceManag
 		serviceManager.CleanupService.CleanupOldMessages()
 	})
 
-	// Hourly reminder check
-	cronManager.AddFunc("0 * * * *", func() {
+	// Reminder check, every minute so wizard timers end on time
+	cronManager.AddFunc("* * * * *", func() {
 		serviceManager.ReminderService.ProcessReminders()
 	})
 
+	// Deliver Telegram notifications held back during quiet hours
+	cronManager.AddFunc("*/5 * * * *", func() {
+		serviceManager.TelegramService.ProcessDeferredNotifications()
+	})
+
+	// Roll Telegram messages and errors up into daily analytics
+	cronManager.AddFunc("5 * * * *", func() {
+		serviceManager.TelegramAnalyticsService.RunRollup()
+	})
+
 	// Daily leaderboard reset
 	cronManager.AddFunc("0 0 * * *", func() {
 		serviceManager.GameService.ResetDailyLeaderboard()
@@ -0,0 +1,187 @@
+package storage
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"whatsapp-bot/internal/config"
+)
+
+// Storage is the backend used to persist media files received from or sent to
+// the messaging platforms.
+type Storage interface {
+	Save(key string, data []byte, contentType string) (string, error)
+	Get(key string) ([]byte, error)
+	Delete(key string) error
+	URL(key string) string
+	// Verify reports whether signature was issued by URL for key and
+	// expires has not passed.
+	Verify(key, signature, expires string) bool
+}
+
+const (
+	// SignatureParam is the query parameter carrying the signature of a
+	// media URL.
+	SignatureParam = "sig"
+	// ExpiresParam is the query parameter carrying the Unix time a media
+	// URL stops working.
+	ExpiresParam = "exp"
+)
+
+// ErrMissingSigningKey is returned when files are saved without a key to
+// sign their URLs with.
+var ErrMissingSigningKey = errors.New("storage signing key is not configured")
+
+// New returns the storage backend selected in the configuration. Unknown
+// drivers fall back to local disk storage.
+func New(cfg config.StorageConfig) Storage {
+	switch cfg.Driver {
+	case "local":
+		return NewLocalStorage(cfg.LocalPath, cfg.PublicURL, cfg.SigningKey, cfg.URLTTL)
+	default:
+		return NewLocalStorage(cfg.LocalPath, cfg.PublicURL, cfg.SigningKey, cfg.URLTTL)
+	}
+}
+
+// LocalStorage stores files on the local filesystem under basePath.
+type LocalStorage struct {
+	basePath   string
+	publicURL  string
+	signingKey []byte
+	urlTTL     time.Duration
+}
+
+func NewLocalStorage(basePath, publicURL, signingKey string, urlTTL time.Duration) *LocalStorage {
+	return &LocalStorage{
+		basePath:   basePath,
+		publicURL:  strings.TrimRight(publicURL, "/"),
+		signingKey: []byte(signingKey),
+		urlTTL:     urlTTL,
+	}
+}
+
+func (s *LocalStorage) Save(key string, data []byte, contentType string) (string, error) {
+	// A file nobody can get a valid link to is not worth keeping
+	if len(s.signingKey) == 0 {
+		return "", ErrMissingSigningKey
+	}
+
+	path, err := s.path(key)
+	if err != nil {
+		return "", err
+	}
+
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return "", fmt.Errorf("failed to create storage directory: %v", err)
+	}
+
+	if err := os.WriteFile(path, data, 0644); err != nil {
+		return "", fmt.Errorf("failed to write file: %v", err)
+	}
+
+	return s.URL(key), nil
+}
+
+func (s *LocalStorage) Get(key string) ([]byte, error) {
+	path, err := s.path(key)
+	if err != nil {
+		return nil, err
+	}
+
+	return os.ReadFile(path)
+}
+
+func (s *LocalStorage) Delete(key string) error {
+	path, err := s.path(key)
+	if err != nil {
+		return err
+	}
+
+	if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+
+	return nil
+}
+
+// URL returns a signed link to the file. The links are stored on messages
+// and handed to the messaging platforms, which fetch them later, so they
+// stay valid for the configured TTL rather than minutes.
+func (s *LocalStorage) URL(key string) string {
+	key = strings.TrimLeft(key, "/")
+	expires := strconv.FormatInt(time.Now().Add(s.urlTTL).Unix(), 10)
+	return fmt.Sprintf("%s/%s?%s=%s&%s=%s", s.publicURL, key, ExpiresParam, expires, SignatureParam, s.sign(key, expires))
+}
+
+func (s *LocalStorage) Verify(key, signature, expires string) bool {
+	if len(s.signingKey) == 0 {
+		return false
+	}
+
+	at, err := strconv.ParseInt(expires, 10, 64)
+	if err != nil || time.Now().Unix() > at {
+		return false
+	}
+
+	return hmac.Equal([]byte(s.sign(strings.TrimLeft(key, "/"), expires)), []byte(signature))
+}
+
+func (s *LocalStorage) sign(key, expires string) string {
+	mac := hmac.New(sha256.New, s.signingKey)
+	mac.Write([]byte(key + "\n" + expires))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+func (s *LocalStorage) path(key string) (string, error) {
+	cleaned := filepath.Clean("/" + key)
+	if cleaned == "/" {
+		return "", fmt.Errorf("invalid storage key: %q", key)
+	}
+
+	return filepath.Join(s.basePath, cleaned), nil
+}
+
+// mediaExtensions are the MIME types stored files may be saved as. Anything
+// else, HTML and SVG in particular, is stored without an extension and
+// served as application/octet-stream.
+var mediaExtensions = map[string]string{
+	"image/jpeg":                    ".jpg",
+	"image/png":                     ".png",
+	"image/gif":                     ".gif",
+	"image/webp":                    ".webp",
+	"audio/ogg":                     ".ogg",
+	"audio/mpeg":                    ".mp3",
+	"audio/mp4":                     ".m4a",
+	"audio/aac":                     ".aac",
+	"audio/amr":                     ".amr",
+	"video/mp4":                     ".mp4",
+	"video/3gpp":                    ".3gp",
+	"application/pdf":               ".pdf",
+	"text/plain":                    ".txt",
+	"application/zip":               ".zip",
+	"application/msword":            ".doc",
+	"application/vnd.ms-excel":      ".xls",
+	"application/vnd.ms-powerpoint": ".ppt",
+	"application/vnd.openxmlformats-officedocument.wordprocessingml.document":   ".docx",
+	"application/vnd.openxmlformats-officedocument.spreadsheetml.sheet":         ".xlsx",
+	"application/vnd.openxmlformats-officedocument.presentationml.presentation": ".pptx",
+}
+
+// ExtensionForMimeType returns a file extension (including the dot) for the
+// given MIME type, or an empty string if it is not an allowed media type.
+func ExtensionForMimeType(mimeType string) string {
+	// Strip parameters such as "; codecs=opus"
+	if idx := strings.Index(mimeType, ";"); idx != -1 {
+		mimeType = mimeType[:idx]
+	}
+
+	return mediaExtensions[strings.ToLower(strings.TrimSpace(mimeType))]
+}
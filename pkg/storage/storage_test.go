@@ -0,0 +1,49 @@
+package storage
+
+import (
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSignedURL(t *testing.T) {
+	signed := func(s *LocalStorage, key string) (string, string) {
+		u, err := url.Parse(s.URL(key))
+		assert.NoError(t, err)
+		return u.Query().Get(SignatureParam), u.Query().Get(ExpiresParam)
+	}
+
+	s := NewLocalStorage(t.TempDir(), "http://localhost:8080/media", "test-key", time.Hour)
+
+	t.Run("Valid", func(t *testing.T) {
+		sig, exp := signed(s, "/whatsapp/a.jpg")
+		assert.True(t, s.Verify("whatsapp/a.jpg", sig, exp))
+	})
+
+	t.Run("OtherKey", func(t *testing.T) {
+		sig, exp := signed(s, "whatsapp/a.jpg")
+		assert.False(t, s.Verify("whatsapp/b.jpg", sig, exp))
+	})
+
+	t.Run("ExtendedExpiry", func(t *testing.T) {
+		sig, exp := signed(s, "whatsapp/a.jpg")
+		assert.False(t, s.Verify("whatsapp/a.jpg", sig, exp+"0"))
+	})
+
+	t.Run("Expired", func(t *testing.T) {
+		expired := NewLocalStorage(t.TempDir(), "http://localhost:8080/media", "test-key", -time.Minute)
+		sig, exp := signed(expired, "whatsapp/a.jpg")
+		assert.False(t, expired.Verify("whatsapp/a.jpg", sig, exp))
+	})
+
+	t.Run("NoSigningKey", func(t *testing.T) {
+		unsigned := NewLocalStorage(t.TempDir(), "http://localhost:8080/media", "", time.Hour)
+		_, err := unsigned.Save("whatsapp/a.jpg", []byte("data"), "image/jpeg")
+		assert.ErrorIs(t, err, ErrMissingSigningKey)
+
+		sig, exp := signed(unsigned, "whatsapp/a.jpg")
+		assert.False(t, unsigned.Verify("whatsapp/a.jpg", sig, exp))
+	})
+}
@@ -2,11 +2,14 @@ package telegram
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 	"fmt"
 	"io"
 	"net/http"
 	"net/url"
+	"strconv"
+	"strings"
 	"time"
 
 	"kilocode.dev/whatsapp-bot/pkg/logger"
@@ -16,32 +19,206 @@ type Client struct {
 	apiKey     string
 	baseURL    string
 	httpClient *http.Client
+	pollClient *http.Client
+	onSent     func(SentMessage)
 }
 
+// SentMessage describes a message the client sent, or failed to send.
+type SentMessage struct {
+	ChatID    int64
+	MessageID int    // 0 if sending failed
+	Type      string // message, photo, document, location, invoice
+	Text      string // text or caption
+	Err       error
+}
+
+// OnSent registers a function called after every message the client sends,
+// whether or not sending succeeded.
+func (c *Client) OnSent(fn func(SentMessage)) {
+	c.onSent = fn
+}
+
+func (c *Client) sent(message SentMessage) {
+	if c.onSent != nil {
+		c.onSent(message)
+	}
+}
+
+// Message is used both for outgoing sendMessage calls and for incoming
+// messages, which identify the chat through Chat rather than ChatID.
 type Message struct {
 	ChatID      int64  `json:"chat_id"`
 	Text        string `json:"text"`
 	ParseMode   string `json:"parse_mode,omitempty"`
 	ReplyMarkup interface{} `json:"reply_markup,omitempty"`
+	MessageID   int    `json:"message_id,omitempty"`
+	From        *User  `json:"from,omitempty"`
+	Chat        *Chat  `json:"chat,omitempty"`
+	Caption     string       `json:"caption,omitempty"`
+	Photo       []PhotoSize  `json:"photo,omitempty"`
+	Document    *Document    `json:"document,omitempty"`
+	Voice       *Voice       `json:"voice,omitempty"`
+	ReplyToMessage *Message  `json:"reply_to_message,omitempty"`
+	Entities       []MessageEntity `json:"entities,omitempty"`
+	// NewChatMembers and LeftChatMember are set on the service messages
+	// Telegram sends to groups when members join or leave.
+	NewChatMembers []User `json:"new_chat_members,omitempty"`
+	LeftChatMember *User  `json:"left_chat_member,omitempty"`
+	// SuccessfulPayment is set on the service message confirming that the
+	// user paid an invoice.
+	SuccessfulPayment *SuccessfulPayment `json:"successful_payment,omitempty"`
+}
+
+// GetChatID returns the chat the message belongs to.
+func (m *Message) GetChatID() int64 {
+	if m.Chat != nil {
+		return m.Chat.ID
+	}
+	return m.ChatID
+}
+
+type Chat struct {
+	ID       int64  `json:"id"`
+	Type     string `json:"type"` // private, group, supergroup, channel
+	Title    string `json:"title,omitempty"`
+	Username string `json:"username,omitempty"`
 }
 
 type Update struct {
 	UpdateID int     `json:"update_id"`
 	Message  *Message `json:"message"`
 	CallbackQuery *CallbackQuery `json:"callback_query"`
+	InlineQuery        *InlineQuery        `json:"inline_query,omitempty"`
+	ChosenInlineResult *ChosenInlineResult `json:"chosen_inline_result,omitempty"`
+	MyChatMember       *ChatMemberUpdated  `json:"my_chat_member,omitempty"`
+	PreCheckoutQuery   *PreCheckoutQuery   `json:"pre_checkout_query,omitempty"`
+}
+
+// ChatMemberUpdated reports a change of a member's status in a chat. As
+// my_chat_member it tells the bot it was added to or removed from a group.
+type ChatMemberUpdated struct {
+	Chat          Chat       `json:"chat"`
+	From          User       `json:"from"`
+	Date          int64      `json:"date"`
+	OldChatMember ChatMember `json:"old_chat_member"`
+	NewChatMember ChatMember `json:"new_chat_member"`
+}
+
+type ChatMember struct {
+	// Status is creator, administrator, member, restricted, left or kicked.
+	Status string `json:"status"`
+	User   User   `json:"user"`
+}
+
+// IsAdmin reports whether the member can administer the chat.
+func (m *ChatMember) IsAdmin() bool {
+	return m.Status == "creator" || m.Status == "administrator"
+}
+
+// ChatPermissions are the actions a restricted member may take.
+type ChatPermissions struct {
+	CanSendMessages       bool `json:"can_send_messages"`
+	CanSendMediaMessages  bool `json:"can_send_media_messages"`
+	CanSendPolls          bool `json:"can_send_polls"`
+	CanSendOtherMessages  bool `json:"can_send_other_messages"`
+	CanAddWebPagePreviews bool `json:"can_add_web_page_previews"`
+}
+
+// InlineQuery is sent when a user types "@bot <query>" in any chat.
+type InlineQuery struct {
+	ID       string `json:"id"`
+	From     User   `json:"from"`
+	Query    string `json:"query"`
+	Offset   string `json:"offset"`
+	ChatType string `json:"chat_type,omitempty"`
+}
+
+// ChosenInlineResult reports which inline result a user sent. Telegram only
+// delivers it when inline feedback is enabled in BotFather.
+type ChosenInlineResult struct {
+	ResultID        string `json:"result_id"`
+	From            User   `json:"from"`
+	Query           string `json:"query"`
+	InlineMessageID string `json:"inline_message_id,omitempty"`
+}
+
+// InlineQueryResult is an article result, sent as a text message when the
+// user picks it.
+type InlineQueryResult struct {
+	Type                string              `json:"type"`
+	ID                  string              `json:"id"`
+	Title               string              `json:"title"`
+	Description         string              `json:"description,omitempty"`
+	ThumbnailURL        string              `json:"thumbnail_url,omitempty"`
+	InputMessageContent InputMessageContent `json:"input_message_content"`
+	ReplyMarkup         interface{}         `json:"reply_markup,omitempty"`
+}
+
+type InputMessageContent struct {
+	MessageText string `json:"message_text"`
+	ParseMode   string `json:"parse_mode,omitempty"`
+}
+
+// InlineQueryOptions configure AnswerInlineQuery.
+type InlineQueryOptions struct {
+	// CacheTime is how long, in seconds, Telegram may cache the results.
+	CacheTime int
+	// IsPersonal stops results from being shared between users.
+	IsPersonal bool
+	// NextOffset is sent back as InlineQuery.Offset when the user scrolls
+	// to the end of the results. Empty means there are no more.
+	NextOffset string
 }
 
 type CallbackQuery struct {
-	ID   string `json:"id"`
-	From User   `json:"from"`
-	Data string `json:"data"`
+	ID      string   `json:"id"`
+	From    User     `json:"from"`
+	Message *Message `json:"message,omitempty"`
+	Data    string   `json:"data"`
 }
 
 type User struct {
-	ID        int64  `json:"id"`
-	FirstName string `json:"first_name"`
-	LastName  string `json:"last_name,omitempty"`
-	Username  string `json:"username,omitempty"`
+	ID           int64  `json:"id"`
+	FirstName    string `json:"first_name"`
+	LastName     string `json:"last_name,omitempty"`
+	Username     string `json:"username,omitempty"`
+	IsBot        bool   `json:"is_bot,omitempty"`
+	LanguageCode string `json:"language_code,omitempty"`
+}
+
+type PhotoSize struct {
+	FileID       string `json:"file_id"`
+	FileUniqueID string `json:"file_unique_id"`
+	Width        int    `json:"width"`
+	Height       int    `json:"height"`
+	FileSize     int    `json:"file_size,omitempty"`
+}
+
+type Document struct {
+	FileID       string `json:"file_id"`
+	FileUniqueID string `json:"file_unique_id"`
+	FileName     string `json:"file_name,omitempty"`
+	MimeType     string `json:"mime_type,omitempty"`
+	FileSize     int    `json:"file_size,omitempty"`
+}
+
+type Voice struct {
+	FileID       string `json:"file_id"`
+	FileUniqueID string `json:"file_unique_id"`
+	Duration     int    `json:"duration"`
+	MimeType     string `json:"mime_type,omitempty"`
+	FileSize     int    `json:"file_size,omitempty"`
+}
+
+// MaxDownloadSize is the largest file the Bot API lets a bot download.
+const MaxDownloadSize = 20 << 20
+
+// File is a file ready to be downloaded with DownloadFile.
+type File struct {
+	FileID       string `json:"file_id"`
+	FileUniqueID string `json:"file_unique_id"`
+	FileSize     int    `json:"file_size,omitempty"`
+	FilePath     string `json:"file_path,omitempty"`
 }
 
 type SendMessageResponse struct {
@@ -54,6 +231,10 @@ type GetUpdatesResponse struct {
 	Result []Update `json:"result"`
 }
 
+// pollTimeoutMargin is how much longer than its timeout a long poll may
+// take before it is abandoned.
+const pollTimeoutMargin = 10 * time.Second
+
 func NewClient(apiKey string) *Client {
 	return &Client{
 		apiKey:  apiKey,
@@ -61,9 +242,17 @@ func NewClient(apiKey string) *Client {
 		httpClient: &http.Client{
 			Timeout: 30 * time.Second,
 		},
+		// Long polls are bounded per request by GetUpdatesContext
+		pollClient: &http.Client{},
 	}
 }
 
+// SetAPIURL points the client at another Bot API server, such as a local
+// telegram-bot-api instance.
+func (c *Client) SetAPIURL(apiURL string) {
+	c.baseURL = strings.TrimRight(apiURL, "/") + "/bot"
+}
+
 func (c *Client) SendMessage(chatID int64, text string, parseMode string) error {
 	message := Message{
 		ChatID:    chatID,
@@ -84,7 +273,39 @@ func (c *Client) SendMessageWithMarkup(chatID int64, text string, markup interfa
 	return c.sendMessage(message)
 }
 
-func (c *Client) sendMessage(message Message) error {
+// SendFormatted sends a message built with a Formatter, split into several
+// messages when it is longer than Telegram allows. The markup is attached
+// to the last one.
+func (c *Client) SendFormatted(chatID int64, f *Formatter, markup interface{}) error {
+	messages := f.Messages(MaxMessageLength)
+	if len(messages) == 0 {
+		return fmt.Errorf("message text is empty")
+	}
+
+	for i, text := range messages {
+		message := Message{
+			ChatID:    chatID,
+			Text:      text.Text,
+			ParseMode: text.ParseMode,
+			Entities:  text.Entities,
+		}
+		if i == len(messages)-1 {
+			message.ReplyMarkup = markup
+		}
+		if err := c.sendMessage(message); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (c *Client) sendMessage(message Message) (err error) {
+	messageID := 0
+	defer func() {
+		c.sent(SentMessage{ChatID: message.ChatID, MessageID: messageID, Type: "message", Text: message.Text, Err: err})
+	}()
+
 	url := fmt.Sprintf("%s%s/sendMessage", c.baseURL, c.apiKey)
 
 	jsonData, err := json.Marshal(message)
@@ -119,14 +340,42 @@ func (c *Client) sendMessage(message Message) error {
 		return err
 	}
 
+	messageID = response.Result.MessageID
 	return nil
 }
 
 func (c *Client) GetUpdates(offset int) ([]Update, error) {
-	url := fmt.Sprintf("%s%s/getUpdates?offset=%d&timeout=30", c.baseURL, c.apiKey, offset)
+	return c.GetUpdatesContext(context.Background(), offset, 0, nil)
+}
 
-	resp, err := c.httpClient.Get(url)
+// GetUpdatesContext long-polls for updates. The request waits up to timeout
+// for new updates and is abandoned as soon as ctx is cancelled. An empty
+// allowedUpdates keeps the types requested last time.
+func (c *Client) GetUpdatesContext(ctx context.Context, offset int, timeout time.Duration, allowedUpdates []string) ([]Update, error) {
+	params := url.Values{}
+	params.Set("offset", strconv.Itoa(offset))
+	params.Set("timeout", strconv.Itoa(int(timeout.Seconds())))
+	if len(allowedUpdates) > 0 {
+		allowed, _ := json.Marshal(allowedUpdates)
+		params.Set("allowed_updates", string(allowed))
+	}
+	url := fmt.Sprintf("%s%s/getUpdates?%s", c.baseURL, c.apiKey, params.Encode())
+
+	// The shared client's timeout is shorter than a long poll, so each poll
+	// gets its own deadline in case the connection stalls
+	reqCtx, cancel := context.WithTimeout(ctx, timeout+pollTimeoutMargin)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(reqCtx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := c.pollClient.Do(req)
 	if err != nil {
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
 		logger.Error("Failed to get updates", err)
 		return nil, err
 	}
@@ -175,7 +424,9 @@ func (c *Client) AnswerCallbackQuery(callbackQueryID string, text string) error
 	return nil
 }
 
-func (c *Client) SendPhoto(chatID int64, photoURL string, caption string) error {
+func (c *Client) SendPhoto(chatID int64, photoURL string, caption string) (err error) {
+	defer func() { c.sent(SentMessage{ChatID: chatID, Type: "photo", Text: caption, Err: err}) }()
+
 	url := fmt.Sprintf("%s%s/sendPhoto?chat_id=%d&photo=%s&caption=%s", 
 		c.baseURL, c.apiKey, chatID, url.QueryEscape(photoURL), url.QueryEscape(caption))
 
@@ -196,7 +447,9 @@ func (c *Client) SendPhoto(chatID int64, photoURL string, caption string) error
 	return nil
 }
 
-func (c *Client) SendDocument(chatID int64, documentURL string, caption string) error {
+func (c *Client) SendDocument(chatID int64, documentURL string, caption string) (err error) {
+	defer func() { c.sent(SentMessage{ChatID: chatID, Type: "document", Text: caption, Err: err}) }()
+
 	url := fmt.Sprintf("%s%s/sendDocument?chat_id=%d&document=%s&caption=%s", 
 		c.baseURL, c.apiKey, chatID, url.QueryEscape(documentURL), url.QueryEscape(caption))
 
@@ -217,7 +470,9 @@ func (c *Client) SendDocument(chatID int64, documentURL string, caption string)
 	return nil
 }
 
-func (c *Client) SendLocation(chatID int64, latitude float64, longitude float64) error {
+func (c *Client) SendLocation(chatID int64, latitude float64, longitude float64) (err error) {
+	defer func() { c.sent(SentMessage{ChatID: chatID, Type: "location", Err: err}) }()
+
 	url := fmt.Sprintf("%s%s/sendLocation?chat_id=%d&latitude=%f&longitude=%f", 
 		c.baseURL, c.apiKey, chatID, latitude, longitude)
 
@@ -238,6 +493,85 @@ func (c *Client) SendLocation(chatID int64, latitude float64, longitude float64)
 	return nil
 }
 
+// SetMessageReaction reacts to a message with an emoji. An empty emoji
+// removes the bot's reaction.
+func (c *Client) SetMessageReaction(chatID int64, messageID int, emoji string) error {
+	url := fmt.Sprintf("%s%s/setMessageReaction", c.baseURL, c.apiKey)
+
+	reaction := []map[string]string{}
+	if emoji != "" {
+		reaction = append(reaction, map[string]string{"type": "emoji", "emoji": emoji})
+	}
+
+	jsonData, err := json.Marshal(map[string]interface{}{
+		"chat_id":    chatID,
+		"message_id": messageID,
+		"reaction":   reaction,
+	})
+	if err != nil {
+		logger.Error("Failed to marshal reaction", err)
+		return err
+	}
+
+	resp, err := c.httpClient.Post(url, "application/json", bytes.NewBuffer(jsonData))
+	if err != nil {
+		logger.Error("Failed to set message reaction", err)
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(resp.Body)
+		err := fmt.Errorf("telegram API error: %s", string(body))
+		logger.Error("Telegram API error", err)
+		return err
+	}
+
+	return nil
+}
+
+// AnswerInlineQuery sends the results for an inline query. At most 50
+// results are allowed per answer.
+func (c *Client) AnswerInlineQuery(inlineQueryID string, results []InlineQueryResult, opts InlineQueryOptions) error {
+	url := fmt.Sprintf("%s%s/answerInlineQuery", c.baseURL, c.apiKey)
+
+	for i := range results {
+		if results[i].Type == "" {
+			results[i].Type = "article"
+		}
+	}
+
+	payload := map[string]interface{}{
+		"inline_query_id": inlineQueryID,
+		"results":         results,
+		"cache_time":      opts.CacheTime,
+		"is_personal":     opts.IsPersonal,
+		"next_offset":     opts.NextOffset,
+	}
+
+	jsonData, err := json.Marshal(payload)
+	if err != nil {
+		logger.Error("Failed to marshal inline query answer", err)
+		return err
+	}
+
+	resp, err := c.httpClient.Post(url, "application/json", bytes.NewBuffer(jsonData))
+	if err != nil {
+		logger.Error("Failed to answer inline query", err)
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(resp.Body)
+		err := fmt.Errorf("telegram API error: %s", string(body))
+		logger.Error("Telegram API error", err)
+		return err
+	}
+
+	return nil
+}
+
 func (c *Client) GetMe() (*User, error) {
 	url := fmt.Sprintf("%s%s/getMe", c.baseURL, c.apiKey)
 
@@ -274,8 +608,221 @@ func (c *Client) GetMe() (*User, error) {
 	return &response.Result, nil
 }
 
-func (c *Client) SetWebhook(webhookURL string) error {
-	url := fmt.Sprintf("%s%s/setWebhook?url=%s", c.baseURL, c.apiKey, url.QueryEscape(webhookURL))
+// GetFile prepares a file for download. The returned FilePath is valid for
+// at least an hour.
+func (c *Client) GetFile(fileID string) (*File, error) {
+	url := fmt.Sprintf("%s%s/getFile?file_id=%s", c.baseURL, c.apiKey, url.QueryEscape(fileID))
+
+	resp, err := c.httpClient.Get(url)
+	if err != nil {
+		logger.Error("Failed to get file", err)
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(resp.Body)
+		err := fmt.Errorf("telegram API error: %s", string(body))
+		logger.Error("Telegram API error", err)
+		return nil, err
+	}
+
+	var response struct {
+		Ok     bool `json:"ok"`
+		Result File `json:"result"`
+	}
+
+	if err := json.NewDecoder(resp.Body).Decode(&response); err != nil {
+		logger.Error("Failed to decode response", err)
+		return nil, err
+	}
+
+	if !response.Ok {
+		err := fmt.Errorf("telegram API returned error")
+		logger.Error("Telegram API error", err)
+		return nil, err
+	}
+
+	return &response.Result, nil
+}
+
+// DownloadFile fetches the contents of a file returned by GetFile. The file
+// URL contains the bot token, so it must never be handed out.
+func (c *Client) DownloadFile(filePath string) ([]byte, error) {
+	url := fmt.Sprintf("%s/file/bot%s/%s", strings.TrimSuffix(c.baseURL, "/bot"), c.apiKey, filePath)
+
+	resp, err := c.httpClient.Get(url)
+	if err != nil {
+		logger.Error("Failed to download file", err)
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(resp.Body)
+		err := fmt.Errorf("telegram API error: %s", string(body))
+		logger.Error("Telegram API error", err)
+		return nil, err
+	}
+
+	return io.ReadAll(resp.Body)
+}
+
+// DeleteMessage deletes a message. In groups the bot must be an admin with
+// the can_delete_messages right.
+func (c *Client) DeleteMessage(chatID int64, messageID int) error {
+	return c.callMethod("deleteMessage", map[string]interface{}{
+		"chat_id":    chatID,
+		"message_id": messageID,
+	}, nil)
+}
+
+// RestrictChatMember changes what a group member may do until the given
+// time. A zero until restricts them forever.
+func (c *Client) RestrictChatMember(chatID, userID int64, permissions ChatPermissions, until time.Time) error {
+	return c.callMethod("restrictChatMember", map[string]interface{}{
+		"chat_id":     chatID,
+		"user_id":     userID,
+		"permissions": permissions,
+		"until_date":  untilDate(until),
+	}, nil)
+}
+
+// BanChatMember removes a user from a group and keeps them out until the
+// given time. A zero until bans them forever.
+func (c *Client) BanChatMember(chatID, userID int64, until time.Time) error {
+	return c.callMethod("banChatMember", map[string]interface{}{
+		"chat_id":    chatID,
+		"user_id":    userID,
+		"until_date": untilDate(until),
+	}, nil)
+}
+
+// UnbanChatMember lets a banned user join the group again.
+func (c *Client) UnbanChatMember(chatID, userID int64) error {
+	return c.callMethod("unbanChatMember", map[string]interface{}{
+		"chat_id":        chatID,
+		"user_id":        userID,
+		"only_if_banned": true,
+	}, nil)
+}
+
+func (c *Client) GetChatMember(chatID, userID int64) (*ChatMember, error) {
+	var member ChatMember
+	err := c.callMethod("getChatMember", map[string]interface{}{
+		"chat_id": chatID,
+		"user_id": userID,
+	}, &member)
+	if err != nil {
+		return nil, err
+	}
+	return &member, nil
+}
+
+// BotCommand is an entry in the "/" menu Telegram shows users.
+type BotCommand struct {
+	Command     string `json:"command"`
+	Description string `json:"description"`
+}
+
+// Bot command scopes, from the most general to the most specific
+const (
+	CommandScopeDefault               = "default"
+	CommandScopeAllPrivateChats       = "all_private_chats"
+	CommandScopeAllGroupChats         = "all_group_chats"
+	CommandScopeAllChatAdministrators = "all_chat_administrators"
+)
+
+// SetMyCommands replaces the bot's command list for a scope and language.
+// An empty languageCode sets the list for users without a dedicated one.
+func (c *Client) SetMyCommands(commands []BotCommand, scope, languageCode string) error {
+	return c.callMethod("setMyCommands", map[string]interface{}{
+		"commands":      commands,
+		"scope":         map[string]string{"type": scope},
+		"language_code": languageCode,
+	}, nil)
+}
+
+// DeleteMyCommands removes the command list for a scope and language, so
+// users fall back to the next more general list.
+func (c *Client) DeleteMyCommands(scope, languageCode string) error {
+	return c.callMethod("deleteMyCommands", map[string]interface{}{
+		"scope":         map[string]string{"type": scope},
+		"language_code": languageCode,
+	}, nil)
+}
+
+// callMethod posts a JSON request to a Bot API method and decodes its result
+// into result, if given.
+func (c *Client) callMethod(method string, payload interface{}, result interface{}) error {
+	url := fmt.Sprintf("%s%s/%s", c.baseURL, c.apiKey, method)
+
+	jsonData, err := json.Marshal(payload)
+	if err != nil {
+		logger.Errorf("Failed to marshal %s request: %v", method, err)
+		return err
+	}
+
+	resp, err := c.httpClient.Post(url, "application/json", bytes.NewBuffer(jsonData))
+	if err != nil {
+		logger.Errorf("Failed to call %s: %v", method, err)
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(resp.Body)
+		err := fmt.Errorf("telegram API error: %s", string(body))
+		logger.Errorf("Telegram API error: %v", err)
+		return err
+	}
+
+	if result == nil {
+		return nil
+	}
+
+	response := struct {
+		Ok     bool        `json:"ok"`
+		Result interface{} `json:"result"`
+	}{Result: result}
+	if err := json.NewDecoder(resp.Body).Decode(&response); err != nil {
+		logger.Errorf("Failed to decode %s response: %v", method, err)
+		return err
+	}
+	if !response.Ok {
+		return fmt.Errorf("telegram API returned error for %s", method)
+	}
+
+	return nil
+}
+
+func untilDate(until time.Time) int64 {
+	if until.IsZero() {
+		return 0
+	}
+	return until.Unix()
+}
+
+// WebhookOptions configure SetWebhook.
+type WebhookOptions struct {
+	// AllowedUpdates limits the update types delivered, e.g. "message".
+	AllowedUpdates []string
+	// SecretToken is sent back in the X-Telegram-Bot-Api-Secret-Token
+	// header of every delivery.
+	SecretToken string
+}
+
+func (c *Client) SetWebhook(webhookURL string, opts WebhookOptions) error {
+	params := url.Values{}
+	params.Set("url", webhookURL)
+	if len(opts.AllowedUpdates) > 0 {
+		allowed, _ := json.Marshal(opts.AllowedUpdates)
+		params.Set("allowed_updates", string(allowed))
+	}
+	if opts.SecretToken != "" {
+		params.Set("secret_token", opts.SecretToken)
+	}
+	url := fmt.Sprintf("%s%s/setWebhook?%s", c.baseURL, c.apiKey, params.Encode())
 
 	resp, err := c.httpClient.Get(url)
 	if err != nil {
@@ -392,15 +939,39 @@ func (c *Client) handleCallbackQuery(callbackQuery *CallbackQuery) error {
 	return c.AnswerCallbackQuery(callbackQuery.ID, responseText)
 }
 
-func (c *Client) StartPolling(handler func(Update) error) error {
-	logger.Info("Starting Telegram polling")
-	
-	offset := 0
+// PollOptions configure StartPolling.
+type PollOptions struct {
+	// Offset is the first update ID to fetch, usually the last processed
+	// update ID plus one.
+	Offset int
+	// Timeout is how long each getUpdates call waits for new updates.
+	Timeout time.Duration
+	// AllowedUpdates limits the update types received, e.g. "message".
+	AllowedUpdates []string
+}
+
+// StartPolling fetches updates and passes them to handler one at a time
+// until ctx is cancelled. An update counts as processed once handler
+// returns, whether or not it failed.
+func (c *Client) StartPolling(ctx context.Context, opts PollOptions, handler func(Update) error) error {
+	logger.Info("Starting Telegram polling", map[string]interface{}{
+		"offset": opts.Offset,
+	})
+
+	offset := opts.Offset
 	for {
-		updates, err := c.GetUpdates(offset)
+		updates, err := c.GetUpdatesContext(ctx, offset, opts.Timeout, opts.AllowedUpdates)
+		if ctx.Err() != nil {
+			logger.Info("Telegram polling stopped", map[string]interface{}{
+				"offset": offset,
+			})
+			return nil
+		}
 		if err != nil {
-			logger.Error("Failed to get updates", err)
-			time.Sleep(5 * time.Second)
+			select {
+			case <-ctx.Done():
+			case <-time.After(5 * time.Second):
+			}
 			continue
 		}
 
@@ -410,10 +981,6 @@ func (c *Client) StartPolling(handler func(Update) error) error {
 			}
 			offset = update.UpdateID + 1
 		}
-
-		if len(updates) == 0 {
-			time.Sleep(1 * time.Second)
-		}
 	}
 }
 
@@ -0,0 +1,325 @@
+package telegram
+
+import (
+	"strconv"
+	"strings"
+	"unicode/utf16"
+	"unicode/utf8"
+)
+
+const (
+	ParseModeMarkdownV2 = "MarkdownV2"
+	ParseModeHTML       = "HTML"
+
+	// MaxMessageLength and MaxCaptionLength are Telegram's limits, counted
+	// in UTF-16 code units of the text after parsing.
+	MaxMessageLength = 4096
+	MaxCaptionLength = 1024
+)
+
+// MessageEntity marks formatting in a plain text message. Offset and Length
+// are in UTF-16 code units.
+type MessageEntity struct {
+	Type     string `json:"type"`
+	Offset   int    `json:"offset"`
+	Length   int    `json:"length"`
+	URL      string `json:"url,omitempty"`
+	User     *User  `json:"user,omitempty"`
+	Language string `json:"language,omitempty"`
+}
+
+// FormattedText is one message ready to send: Text is markup in ParseMode,
+// or plain text formatted by Entities when ParseMode is empty.
+type FormattedText struct {
+	Text      string
+	ParseMode string
+	Entities  []MessageEntity
+}
+
+// Formatter builds a message from literal text and formatted spans. Every
+// string passed in is escaped for the parse mode, so user content can never
+// break the markup. With an empty parse mode the formatting is sent as
+// message entities instead.
+type Formatter struct {
+	parseMode string
+	parts     []formatPart
+}
+
+type formatPart struct {
+	text   string
+	entity *MessageEntity // nil for plain text
+}
+
+func NewFormatter(parseMode string) *Formatter {
+	return &Formatter{parseMode: parseMode}
+}
+
+// PlainText returns a formatter holding text without any formatting.
+func PlainText(text string) *Formatter {
+	return NewFormatter("").Text(text)
+}
+
+func (f *Formatter) Text(text string) *Formatter {
+	return f.add(text, nil)
+}
+
+func (f *Formatter) Bold(text string) *Formatter {
+	return f.add(text, &MessageEntity{Type: "bold"})
+}
+
+func (f *Formatter) Italic(text string) *Formatter {
+	return f.add(text, &MessageEntity{Type: "italic"})
+}
+
+func (f *Formatter) Underline(text string) *Formatter {
+	return f.add(text, &MessageEntity{Type: "underline"})
+}
+
+func (f *Formatter) Strikethrough(text string) *Formatter {
+	return f.add(text, &MessageEntity{Type: "strikethrough"})
+}
+
+func (f *Formatter) Spoiler(text string) *Formatter {
+	return f.add(text, &MessageEntity{Type: "spoiler"})
+}
+
+func (f *Formatter) Code(text string) *Formatter {
+	return f.add(text, &MessageEntity{Type: "code"})
+}
+
+// Pre adds a code block. language may be empty.
+func (f *Formatter) Pre(text, language string) *Formatter {
+	return f.add(text, &MessageEntity{Type: "pre", Language: language})
+}
+
+func (f *Formatter) Link(text, url string) *Formatter {
+	return f.add(text, &MessageEntity{Type: "text_link", URL: url})
+}
+
+// Mention links to a user who may have no username.
+func (f *Formatter) Mention(text string, userID int64) *Formatter {
+	return f.add(text, &MessageEntity{Type: "text_mention", User: &User{ID: userID}})
+}
+
+func (f *Formatter) add(text string, entity *MessageEntity) *Formatter {
+	if text != "" {
+		f.parts = append(f.parts, formatPart{text: text, entity: entity})
+	}
+	return f
+}
+
+// Len returns the length of the visible text in UTF-16 code units.
+func (f *Formatter) Len() int {
+	n := 0
+	for _, part := range f.parts {
+		n += utf16Len(part.text)
+	}
+	return n
+}
+
+// Format renders the whole message, ignoring Telegram's length limit.
+func (f *Formatter) Format() FormattedText {
+	return f.render(f.parts)
+}
+
+// Messages renders the message split into pieces of at most limit UTF-16
+// code units. Plain text is split on paragraph boundaries where possible,
+// then on lines, then on spaces. A formatted span is only split when it is
+// longer than limit on its own.
+func (f *Formatter) Messages(limit int) []FormattedText {
+	var messages []FormattedText
+	var current []formatPart
+	currentLen := 0
+
+	flush := func() {
+		if len(current) > 0 {
+			messages = append(messages, f.render(current))
+		}
+		current, currentLen = nil, 0
+	}
+
+	for _, part := range f.parts {
+		for part.text != "" {
+			room := limit - currentLen
+			length := utf16Len(part.text)
+			if length <= room {
+				current = append(current, part)
+				currentLen += length
+				break
+			}
+
+			cut := 0
+			if part.entity == nil {
+				cut = splitPoint(part.text, room)
+			}
+			if cut == 0 && len(current) > 0 {
+				// Start the part on a fresh message
+				flush()
+				continue
+			}
+			if cut == 0 {
+				cut = unitOffset(part.text, room)
+			}
+			if cut == 0 {
+				// room is smaller than the first character
+				_, cut = utf8.DecodeRuneInString(part.text)
+			}
+
+			head := formatPart{text: strings.TrimRight(part.text[:cut], "\n "), entity: part.entity}
+			if head.text != "" {
+				current = append(current, head)
+			}
+			flush()
+
+			part.text = part.text[cut:]
+			if part.entity == nil {
+				part.text = strings.TrimLeft(part.text, "\n ")
+			}
+		}
+	}
+	flush()
+
+	return messages
+}
+
+func (f *Formatter) render(parts []formatPart) FormattedText {
+	var b strings.Builder
+	var entities []MessageEntity
+	offset := 0
+
+	for _, part := range parts {
+		switch f.parseMode {
+		case ParseModeMarkdownV2:
+			b.WriteString(markdownV2(part))
+		case ParseModeHTML:
+			b.WriteString(html(part))
+		default:
+			b.WriteString(part.text)
+			length := utf16Len(part.text)
+			if part.entity != nil {
+				entity := *part.entity
+				entity.Offset, entity.Length = offset, length
+				entities = append(entities, entity)
+			}
+			offset += length
+		}
+	}
+
+	return FormattedText{Text: b.String(), ParseMode: f.parseMode, Entities: entities}
+}
+
+var (
+	markdownV2Escaper = strings.NewReplacer(
+		`\`, `\\`, "_", `\_`, "*", `\*`, "[", `\[`, "]", `\]`, "(", `\(`, ")", `\)`,
+		"~", `\~`, "`", "\\`", ">", `\>`, "#", `\#`, "+", `\+`, "-", `\-`, "=", `\=`,
+		"|", `\|`, "{", `\{`, "}", `\}`, ".", `\.`, "!", `\!`,
+	)
+	markdownV2CodeEscaper = strings.NewReplacer(`\`, `\\`, "`", "\\`")
+	markdownV2URLEscaper  = strings.NewReplacer(`\`, `\\`, ")", `\)`)
+	htmlEscaper           = strings.NewReplacer("&", "&amp;", "<", "&lt;", ">", "&gt;", `"`, "&quot;")
+)
+
+// EscapeMarkdownV2 escapes every character MarkdownV2 reserves.
+func EscapeMarkdownV2(text string) string {
+	return markdownV2Escaper.Replace(text)
+}
+
+// EscapeHTML escapes text for the HTML parse mode.
+func EscapeHTML(text string) string {
+	return htmlEscaper.Replace(text)
+}
+
+func markdownV2(part formatPart) string {
+	if part.entity == nil {
+		return EscapeMarkdownV2(part.text)
+	}
+
+	text := EscapeMarkdownV2(part.text)
+	switch part.entity.Type {
+	case "bold":
+		return "*" + text + "*"
+	case "italic":
+		return "_" + text + "_"
+	case "underline":
+		return "__" + text + "__"
+	case "strikethrough":
+		return "~" + text + "~"
+	case "spoiler":
+		return "||" + text + "||"
+	case "code":
+		return "`" + markdownV2CodeEscaper.Replace(part.text) + "`"
+	case "pre":
+		return "```" + part.entity.Language + "\n" + markdownV2CodeEscaper.Replace(part.text) + "\n```"
+	case "text_link":
+		return "[" + text + "](" + markdownV2URLEscaper.Replace(part.entity.URL) + ")"
+	case "text_mention":
+		return "[" + text + "](tg://user?id=" + strconv.FormatInt(part.entity.User.ID, 10) + ")"
+	}
+	return text
+}
+
+func html(part formatPart) string {
+	text := EscapeHTML(part.text)
+	if part.entity == nil {
+		return text
+	}
+
+	switch part.entity.Type {
+	case "bold":
+		return "<b>" + text + "</b>"
+	case "italic":
+		return "<i>" + text + "</i>"
+	case "underline":
+		return "<u>" + text + "</u>"
+	case "strikethrough":
+		return "<s>" + text + "</s>"
+	case "spoiler":
+		return "<tg-spoiler>" + text + "</tg-spoiler>"
+	case "code":
+		return "<code>" + text + "</code>"
+	case "pre":
+		if part.entity.Language != "" {
+			return `<pre><code class="language-` + EscapeHTML(part.entity.Language) + `">` + text + "</code></pre>"
+		}
+		return "<pre>" + text + "</pre>"
+	case "text_link":
+		return `<a href="` + EscapeHTML(part.entity.URL) + `">` + text + "</a>"
+	case "text_mention":
+		return `<a href="tg://user?id=` + strconv.FormatInt(part.entity.User.ID, 10) + `">` + text + "</a>"
+	}
+	return text
+}
+
+// splitPoint returns the byte offset to split text at so the head fits in
+// room UTF-16 code units, preferring the last paragraph break, then line
+// break, then space. It returns 0 if there is none.
+func splitPoint(text string, room int) int {
+	head := text[:unitOffset(text, room)]
+	for _, sep := range []string{"\n\n", "\n", " "} {
+		if i := strings.LastIndex(head, sep); i > 0 {
+			return i + len(sep)
+		}
+	}
+	return 0
+}
+
+// unitOffset returns the byte offset of the last whole rune within the
+// first units UTF-16 code units of text.
+func unitOffset(text string, units int) int {
+	n := 0
+	for i, r := range text {
+		size := utf16.RuneLen(r)
+		if size < 0 {
+			size = 1
+		}
+		if n+size > units {
+			return i
+		}
+		n += size
+	}
+	return len(text)
+}
+
+func utf16Len(text string) int {
+	return len(utf16.Encode([]rune(text)))
+}
@@ -0,0 +1,201 @@
+package telegram
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// StubProviderToken stands in for a payment provider token during local
+// testing. SendInvoice never sends it to Telegram: the invoice goes out as
+// a plain message with a pay button, and StubPayment produces the updates
+// Telegram would deliver once the user paid.
+const StubProviderToken = "stub"
+
+// stubPaymentPrefix starts the callback data of a stub invoice's pay
+// button, followed by the invoice payload.
+const stubPaymentPrefix = "stubpay:"
+
+// LabeledPrice is one line of an invoice. Amount is in the currency's
+// smallest unit, see PriceAmount.
+type LabeledPrice struct {
+	Label  string `json:"label"`
+	Amount int    `json:"amount"`
+}
+
+// Invoice is the content of a sendInvoice call. Payload is returned in the
+// pre-checkout query and successful payment, and is never shown to the user.
+type Invoice struct {
+	ChatID              int64          `json:"chat_id"`
+	Title               string         `json:"title"`
+	Description         string         `json:"description"`
+	Payload             string         `json:"payload"`
+	ProviderToken       string         `json:"provider_token"`
+	Currency            string         `json:"currency"`
+	Prices              []LabeledPrice `json:"prices"`
+	PhotoURL            string         `json:"photo_url,omitempty"`
+	NeedName            bool           `json:"need_name,omitempty"`
+	NeedPhoneNumber     bool           `json:"need_phone_number,omitempty"`
+	NeedShippingAddress bool           `json:"need_shipping_address,omitempty"`
+}
+
+// TotalAmount returns the sum of the invoice's prices.
+func (i *Invoice) TotalAmount() int {
+	total := 0
+	for _, price := range i.Prices {
+		total += price.Amount
+	}
+	return total
+}
+
+// PreCheckoutQuery asks the bot to confirm an order before the payment is
+// charged. It must be answered within 10 seconds.
+type PreCheckoutQuery struct {
+	ID             string     `json:"id"`
+	From           User       `json:"from"`
+	Currency       string     `json:"currency"`
+	TotalAmount    int        `json:"total_amount"`
+	InvoicePayload string     `json:"invoice_payload"`
+	OrderInfo      *OrderInfo `json:"order_info,omitempty"`
+}
+
+// SuccessfulPayment is set on the service message Telegram sends after a
+// payment was charged. TelegramPaymentChargeID is needed to refund it.
+type SuccessfulPayment struct {
+	Currency                string     `json:"currency"`
+	TotalAmount             int        `json:"total_amount"`
+	InvoicePayload          string     `json:"invoice_payload"`
+	TelegramPaymentChargeID string     `json:"telegram_payment_charge_id"`
+	ProviderPaymentChargeID string     `json:"provider_payment_charge_id"`
+	OrderInfo               *OrderInfo `json:"order_info,omitempty"`
+}
+
+// OrderInfo holds the details the invoice asked the user for.
+type OrderInfo struct {
+	Name            string           `json:"name,omitempty"`
+	PhoneNumber     string           `json:"phone_number,omitempty"`
+	Email           string           `json:"email,omitempty"`
+	ShippingAddress *ShippingAddress `json:"shipping_address,omitempty"`
+}
+
+type ShippingAddress struct {
+	CountryCode string `json:"country_code"`
+	State       string `json:"state"`
+	City        string `json:"city"`
+	StreetLine1 string `json:"street_line1"`
+	StreetLine2 string `json:"street_line2"`
+	PostCode    string `json:"post_code"`
+}
+
+// String formats the address on one line.
+func (a *ShippingAddress) String() string {
+	var parts []string
+	for _, part := range []string{a.StreetLine1, a.StreetLine2, a.City, a.State, a.PostCode, a.CountryCode} {
+		if part != "" {
+			parts = append(parts, part)
+		}
+	}
+	return strings.Join(parts, ", ")
+}
+
+// zeroDecimalCurrencies have no minor unit in Telegram's currency list.
+var zeroDecimalCurrencies = map[string]bool{
+	"CLP": true, "JPY": true, "KRW": true, "PYG": true, "UGX": true, "VND": true,
+}
+
+// PriceAmount converts an amount to the currency's smallest unit, which is
+// what Telegram expects in prices: 150000 IDR is 15000000.
+func PriceAmount(amount float64, currency string) int {
+	if zeroDecimalCurrencies[strings.ToUpper(currency)] {
+		return int(math.Round(amount))
+	}
+	return int(math.Round(amount * 100))
+}
+
+// SendInvoice sends an invoice the user can pay in the chat. With
+// StubProviderToken it sends a plain message with a pay button instead.
+func (c *Client) SendInvoice(invoice Invoice) error {
+	if invoice.ProviderToken == StubProviderToken {
+		return c.sendStubInvoice(invoice)
+	}
+
+	var message Message
+	err := c.callMethod("sendInvoice", invoice, &message)
+	c.sent(SentMessage{ChatID: invoice.ChatID, MessageID: message.MessageID, Type: "invoice", Text: invoice.Title, Err: err})
+	return err
+}
+
+// AnswerPreCheckoutQuery confirms or rejects a checkout. errorMessage is
+// shown to the user when ok is false.
+func (c *Client) AnswerPreCheckoutQuery(preCheckoutQueryID string, ok bool, errorMessage string) error {
+	payload := map[string]interface{}{
+		"pre_checkout_query_id": preCheckoutQueryID,
+		"ok":                    ok,
+	}
+	if !ok {
+		payload["error_message"] = errorMessage
+	}
+	return c.callMethod("answerPreCheckoutQuery", payload, nil)
+}
+
+func (c *Client) sendStubInvoice(invoice Invoice) error {
+	f := NewFormatter("").Bold(invoice.Title).Text("\n" + invoice.Description + "\n\n")
+	for _, price := range invoice.Prices {
+		f.Text(fmt.Sprintf("%s: %s %s\n", price.Label, invoice.Currency, formatAmount(price.Amount, invoice.Currency)))
+	}
+	f.Bold(fmt.Sprintf("Total: %s %s", invoice.Currency, formatAmount(invoice.TotalAmount(), invoice.Currency))).
+		Italic("\n\nTest invoice, no money is charged.")
+
+	markup := map[string]interface{}{
+		"inline_keyboard": [][]map[string]interface{}{{
+			{"text": "💳 Pay (test)", "callback_data": stubPaymentPrefix + invoice.Payload},
+		}},
+	}
+	return c.SendFormatted(invoice.ChatID, f, markup)
+}
+
+// StubPaymentPayload returns the invoice payload if data is the callback
+// data of a stub invoice's pay button.
+func StubPaymentPayload(data string) (string, bool) {
+	if !strings.HasPrefix(data, stubPaymentPrefix) {
+		return "", false
+	}
+	return strings.TrimPrefix(data, stubPaymentPrefix), true
+}
+
+// StubPayment returns the pre-checkout query and successful payment
+// Telegram would deliver when from pays the invoice. The query's ID is
+// not known to Telegram, so it must not be answered.
+func StubPayment(from User, invoice Invoice) (*PreCheckoutQuery, *SuccessfulPayment) {
+	id := strconv.FormatInt(time.Now().UnixNano(), 36)
+
+	query := &PreCheckoutQuery{
+		ID:             "stub-" + id,
+		From:           from,
+		Currency:       invoice.Currency,
+		TotalAmount:    invoice.TotalAmount(),
+		InvoicePayload: invoice.Payload,
+	}
+	if invoice.NeedName || invoice.NeedPhoneNumber {
+		query.OrderInfo = &OrderInfo{Name: strings.TrimSpace(from.FirstName + " " + from.LastName)}
+	}
+
+	payment := &SuccessfulPayment{
+		Currency:                query.Currency,
+		TotalAmount:             query.TotalAmount,
+		InvoicePayload:          query.InvoicePayload,
+		TelegramPaymentChargeID: "stub-tg-" + id,
+		ProviderPaymentChargeID: "stub-provider-" + id,
+		OrderInfo:               query.OrderInfo,
+	}
+	return query, payment
+}
+
+func formatAmount(amount int, currency string) string {
+	if zeroDecimalCurrencies[strings.ToUpper(currency)] {
+		return strconv.Itoa(amount)
+	}
+	return fmt.Sprintf("%d.%02d", amount/100, amount%100)
+}
@@ -2,10 +2,17 @@ package whatsapp
 
 import (
 	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
 	"encoding/json"
 	"fmt"
 	"io"
+	"mime/multipart"
 	"net/http"
+	"net/textproto"
+	"strconv"
+	"strings"
 	"time"
 
 	"whatsapp-bot/internal/config"
@@ -33,6 +40,63 @@ type MessageRequest struct {
 	Document         *MediaMessage         `json:"document,omitempty"`
 	Template         *TemplateMessage      `json:"template,omitempty"`
 	Interactive      *InteractiveMessage   `json:"interactive,omitempty"`
+	Sticker          *MediaMessage         `json:"sticker,omitempty"`
+	Location         *Location             `json:"location,omitempty"`
+	Contacts         []ContactCard         `json:"contacts,omitempty"`
+	Reaction         *Reaction             `json:"reaction,omitempty"`
+	Context          *MessageContext       `json:"context,omitempty"`
+}
+
+// Location is used both to send a location and in incoming location messages.
+type Location struct {
+	Latitude  float64 `json:"latitude"`
+	Longitude float64 `json:"longitude"`
+	Name      string  `json:"name,omitempty"`
+	Address   string  `json:"address,omitempty"`
+}
+
+// ContactCard is a shared contact, as sent or received in "contacts" messages.
+type ContactCard struct {
+	Name   ContactName    `json:"name"`
+	Phones []ContactPhone `json:"phones,omitempty"`
+	Emails []ContactEmail `json:"emails,omitempty"`
+	Org    *ContactOrg    `json:"org,omitempty"`
+}
+
+type ContactName struct {
+	FormattedName string `json:"formatted_name"`
+	FirstName     string `json:"first_name,omitempty"`
+	LastName      string `json:"last_name,omitempty"`
+}
+
+type ContactPhone struct {
+	Phone string `json:"phone"`
+	Type  string `json:"type,omitempty"`
+	WaID  string `json:"wa_id,omitempty"`
+}
+
+type ContactEmail struct {
+	Email string `json:"email"`
+	Type  string `json:"type,omitempty"`
+}
+
+type ContactOrg struct {
+	Company string `json:"company,omitempty"`
+	Title   string `json:"title,omitempty"`
+}
+
+// Reaction is an emoji reaction to a message. An empty emoji removes it.
+type Reaction struct {
+	MessageID string `json:"message_id"`
+	Emoji     string `json:"emoji"`
+}
+
+// MessageContext links a message to the one it replies to. Outgoing replies
+// set MessageID; incoming replies carry From and ID of the quoted message.
+type MessageContext struct {
+	MessageID string `json:"message_id,omitempty"`
+	From      string `json:"from,omitempty"`
+	ID        string `json:"id,omitempty"`
 }
 
 type TextMessage struct {
@@ -44,6 +108,7 @@ type MediaMessage struct {
 	ID   string `json:"id,omitempty"`
 	Link string `json:"link,omitempty"`
 	Caption string `json:"caption,omitempty"`
+	Filename string `json:"filename,omitempty"`
 }
 
 type TemplateMessage struct {
@@ -57,22 +122,34 @@ type Language struct {
 }
 
 type TemplateComponent struct {
-	Type       string      `json:"type"`
+	Type       string      `json:"type"`               // header, body, button
+	SubType    string      `json:"sub_type,omitempty"` // quick_reply, url (buttons only)
+	Index      string      `json:"index,omitempty"`    // button position (buttons only)
 	Parameters []Parameter `json:"parameters,omitempty"`
 }
 
 type Parameter struct {
-	Type string `json:"type"`
-	Text string `json:"text"`
+	Type     string        `json:"type"` // text, payload, image, video, document
+	Text     string        `json:"text,omitempty"`
+	Payload  string        `json:"payload,omitempty"`
+	Image    *MediaMessage `json:"image,omitempty"`
+	Video    *MediaMessage `json:"video,omitempty"`
+	Document *MediaMessage `json:"document,omitempty"`
 }
 
 type InteractiveMessage struct {
 	Type   string          `json:"type"`
 	Action *InteractiveAction `json:"action"`
+	Header *InteractiveHeader `json:"header,omitempty"`
 	Body   *InteractiveBody   `json:"body,omitempty"`
 	Footer *InteractiveFooter `json:"footer,omitempty"`
 }
 
+type InteractiveHeader struct {
+	Type string `json:"type"`
+	Text string `json:"text,omitempty"`
+}
+
 type InteractiveAction struct {
 	Button string           `json:"button,omitempty"`
 	Buttons []ReplyButton   `json:"buttons,omitempty"`
@@ -118,6 +195,67 @@ type MessageResponse struct {
 type ErrorResponse struct {
 	Code    int    `json:"code"`
 	Message string `json:"message"`
+	Type    string `json:"type,omitempty"`
+	Subcode int    `json:"error_subcode,omitempty"`
+}
+
+// APIError is returned when the Cloud API rejects a request. RetryAfter is set
+// from the Retry-After header when the API asks us to slow down.
+type APIError struct {
+	StatusCode int
+	Code       int
+	Message    string
+	RetryAfter time.Duration
+}
+
+func (e *APIError) Error() string {
+	return fmt.Sprintf("WhatsApp API error %d (code %d): %s", e.StatusCode, e.Code, e.Message)
+}
+
+// Cloud API error codes that indicate a temporary condition
+var retryableErrorCodes = map[int]bool{
+	1:      true, // API unknown
+	2:      true, // API service
+	4:      true, // API too many calls
+	80007:  true, // Rate limit issues
+	130429: true, // Rate limit hit
+	131000: true, // Something went wrong
+	131016: true, // Service unavailable
+	131056: true, // Pair rate limit hit
+	133004: true, // Server temporarily unavailable
+}
+
+// Retryable reports whether the request may succeed if sent again later.
+func (e *APIError) Retryable() bool {
+	if e.StatusCode == http.StatusTooManyRequests || e.StatusCode >= 500 {
+		return true
+	}
+	return retryableErrorCodes[e.Code]
+}
+
+func newAPIError(resp *http.Response, body []byte) *APIError {
+	apiErr := &APIError{
+		StatusCode: resp.StatusCode,
+		Message:    string(body),
+	}
+
+	var parsed struct {
+		Error *ErrorResponse `json:"error"`
+	}
+	if err := json.Unmarshal(body, &parsed); err == nil && parsed.Error != nil {
+		apiErr.Code = parsed.Error.Code
+		apiErr.Message = parsed.Error.Message
+	}
+
+	if retryAfter := resp.Header.Get("Retry-After"); retryAfter != "" {
+		if seconds, err := strconv.Atoi(retryAfter); err == nil {
+			apiErr.RetryAfter = time.Duration(seconds) * time.Second
+		} else if at, err := http.ParseTime(retryAfter); err == nil {
+			apiErr.RetryAfter = time.Until(at)
+		}
+	}
+
+	return apiErr
 }
 
 type WebhookPayload struct {
@@ -140,6 +278,7 @@ type Value struct {
 	Metadata         Metadata   `json:"metadata"`
 	Contacts         []Contact  `json:"contacts"`
 	Messages         []Message  `json:"messages"`
+	Statuses         []Status   `json:"statuses"`
 }
 
 type Metadata struct {
@@ -147,6 +286,42 @@ type Metadata struct {
 	PhoneNumberID      string `json:"phone_number_id"`
 }
 
+// Status is a delivery status callback for a message we sent.
+type Status struct {
+	ID           string        `json:"id"`
+	Status       string        `json:"status"` // sent, delivered, read, failed
+	Timestamp    string        `json:"timestamp"`
+	RecipientID  string        `json:"recipient_id"`
+	Conversation *Conversation `json:"conversation,omitempty"`
+	Pricing      *Pricing      `json:"pricing,omitempty"`
+	Errors       []StatusError `json:"errors,omitempty"`
+}
+
+type Conversation struct {
+	ID                  string             `json:"id"`
+	ExpirationTimestamp string             `json:"expiration_timestamp,omitempty"`
+	Origin              ConversationOrigin `json:"origin"`
+}
+
+type ConversationOrigin struct {
+	Type string `json:"type"` // marketing, utility, authentication, service
+}
+
+type Pricing struct {
+	Billable     bool   `json:"billable"`
+	PricingModel string `json:"pricing_model"`
+	Category     string `json:"category"`
+}
+
+type StatusError struct {
+	Code      int    `json:"code"`
+	Title     string `json:"title"`
+	Message   string `json:"message,omitempty"`
+	ErrorData *struct {
+		Details string `json:"details"`
+	} `json:"error_data,omitempty"`
+}
+
 type Contact struct {
 	Profile Profile `json:"profile"`
 	WaID    string  `json:"wa_id"`
@@ -165,6 +340,13 @@ type Message struct {
 	Audio     *Media    `json:"audio,omitempty"`
 	Video     *Media    `json:"video,omitempty"`
 	Document  *Media    `json:"document,omitempty"`
+	Interactive *InteractiveReply `json:"interactive,omitempty"`
+	Button    *ButtonReply `json:"button,omitempty"`
+	Sticker   *Media    `json:"sticker,omitempty"`
+	Location  *Location `json:"location,omitempty"`
+	Contacts  []ContactCard `json:"contacts,omitempty"`
+	Reaction  *Reaction `json:"reaction,omitempty"`
+	Context   *MessageContext `json:"context,omitempty"`
 	Type      string    `json:"type"`
 }
 
@@ -172,22 +354,63 @@ type Text struct {
 	Body string `json:"body"`
 }
 
+// InteractiveReply is sent when a user taps a reply button or selects a list row.
+type InteractiveReply struct {
+	Type        string     `json:"type"` // button_reply, list_reply
+	ButtonReply *ListReply `json:"button_reply,omitempty"`
+	ListReply   *ListReply `json:"list_reply,omitempty"`
+}
+
+type ListReply struct {
+	ID          string `json:"id"`
+	Title       string `json:"title"`
+	Description string `json:"description,omitempty"`
+}
+
+// ButtonReply is sent when a user taps a quick-reply button on a template message.
+type ButtonReply struct {
+	Payload string `json:"payload"`
+	Text    string `json:"text"`
+}
+
 type Media struct {
 	ID       string `json:"id"`
 	MimeType string `json:"mime_type"`
 	Caption  string `json:"caption"`
+	SHA256   string `json:"sha256,omitempty"`
+	Filename string `json:"filename,omitempty"`
 }
 
-func Initialize(cfg config.WhatsAppConfig) (*Client, error) {
-	client := &Client{
+// MediaInfo is the metadata returned by the Cloud API for an uploaded media ID.
+// URL is short-lived and must be fetched with the access token.
+type MediaInfo struct {
+	ID       string `json:"id"`
+	URL      string `json:"url"`
+	MimeType string `json:"mime_type"`
+	SHA256   string `json:"sha256"`
+	FileSize int64  `json:"file_size"`
+}
+
+type UploadMediaResponse struct {
+	ID    string         `json:"id"`
+	Error *ErrorResponse `json:"error,omitempty"`
+}
+
+// NewClient creates a client without contacting the API.
+func NewClient(cfg config.WhatsAppConfig) *Client {
+	return &Client{
 		config:      cfg,
 		httpClient:  &http.Client{Timeout: 30 * time.Second},
 		baseURL:     fmt.Sprintf("%s/%s", cfg.BaseURL, cfg.APIVersion),
 		accessToken: cfg.AccessToken,
 	}
+}
+
+func Initialize(cfg config.WhatsAppConfig) (*Client, error) {
+	client := NewClient(cfg)
 
 	// Test connection
-	if err := client.testConnection(); err != nil {
+	if err := client.TestConnection(); err != nil {
 		return nil, fmt.Errorf("failed to test WhatsApp connection: %v", err)
 	}
 
@@ -195,7 +418,8 @@ func Initialize(cfg config.WhatsAppConfig) (*Client, error) {
 	return client, nil
 }
 
-func (c *Client) testConnection() error {
+// TestConnection checks that the access token can read the phone number.
+func (c *Client) TestConnection() error {
 	url := fmt.Sprintf("%s/%s", c.baseURL, c.config.PhoneNumberID)
 	
 	req, err := http.NewRequest("GET", url, nil)
@@ -248,7 +472,7 @@ func (c *Client) SendMessage(message MessageRequest) (*MessageResponse, error) {
 	}
 
 	if resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusCreated {
-		return nil, fmt.Errorf("WhatsApp API error: %s", string(body))
+		return nil, newAPIError(resp, body)
 	}
 
 	var result MessageResponse
@@ -257,7 +481,10 @@ func (c *Client) SendMessage(message MessageRequest) (*MessageResponse, error) {
 	}
 
 	if result.Error != nil {
-		return nil, fmt.Errorf("WhatsApp error %d: %s", result.Error.Code, result.Error.Message)
+		return nil, &APIError{StatusCode: resp.StatusCode, Code: result.Error.Code, Message: result.Error.Message}
+	}
+	if len(result.Messages) == 0 {
+		return nil, &APIError{StatusCode: resp.StatusCode, Message: "response did not contain a message ID"}
 	}
 
 	logger.Log.WithFields(logrus.Fields{
@@ -285,7 +512,22 @@ func (c *Client) SendTextMessage(to, text string, previewURL bool) (*MessageResp
 }
 
 func (c *Client) SendImageMessage(to, imageURL, caption string) (*MessageResponse, error) {
-	message := MessageRequest{
+	return c.SendMessage(NewImageMessageRequest(to, imageURL, caption))
+}
+
+func (c *Client) SendInteractiveMessage(to, body string, buttons []ReplyButton) (*MessageResponse, error) {
+	return c.SendMessage(NewButtonsMessageRequest(to, body, buttons))
+}
+
+// SendListMessage sends an interactive list message. buttonText is the label of
+// the button that opens the list; WhatsApp allows at most 10 rows in total.
+func (c *Client) SendListMessage(to, header, body, buttonText string, sections []Section) (*MessageResponse, error) {
+	return c.SendMessage(NewListMessageRequest(to, header, body, buttonText, sections))
+}
+
+// NewImageMessageRequest builds the request for an image sent by URL.
+func NewImageMessageRequest(to, imageURL, caption string) MessageRequest {
+	return MessageRequest{
 		MessagingProduct: "whatsapp",
 		RecipientType:    "individual",
 		To:               to,
@@ -295,12 +537,12 @@ func (c *Client) SendImageMessage(to, imageURL, caption string) (*MessageRespons
 			Caption: caption,
 		},
 	}
-
-	return c.SendMessage(message)
 }
 
-func (c *Client) SendInteractiveMessage(to, body string, buttons []ReplyButton) (*MessageResponse, error) {
-	message := MessageRequest{
+// NewButtonsMessageRequest builds the request for an interactive message
+// with reply buttons.
+func NewButtonsMessageRequest(to, body string, buttons []ReplyButton) MessageRequest {
+	return MessageRequest{
 		MessagingProduct: "whatsapp",
 		RecipientType:    "individual",
 		To:               to,
@@ -315,26 +557,330 @@ func (c *Client) SendInteractiveMessage(to, body string, buttons []ReplyButton)
 			},
 		},
 	}
-
-	return c.SendMessage(message)
 }
 
-func (c *Client) SendTemplateMessage(to, templateName string, components []TemplateComponent) (*MessageResponse, error) {
+// NewListMessageRequest builds the request for an interactive list message.
+func NewListMessageRequest(to, header, body, buttonText string, sections []Section) MessageRequest {
 	message := MessageRequest{
+		MessagingProduct: "whatsapp",
+		RecipientType:    "individual",
+		To:               to,
+		Type:             "interactive",
+		Interactive: &InteractiveMessage{
+			Type: "list",
+			Body: &InteractiveBody{
+				Text: body,
+			},
+			Action: &InteractiveAction{
+				Button:   buttonText,
+				Sections: sections,
+			},
+		},
+	}
+
+	if header != "" {
+		message.Interactive.Header = &InteractiveHeader{
+			Type: "text",
+			Text: header,
+		}
+	}
+
+	return message
+}
+
+func (c *Client) SendLocationMessage(to string, location Location) (*MessageResponse, error) {
+	return c.SendMessage(MessageRequest{
+		MessagingProduct: "whatsapp",
+		RecipientType:    "individual",
+		To:               to,
+		Type:             "location",
+		Location:         &location,
+	})
+}
+
+func (c *Client) SendContactsMessage(to string, contacts []ContactCard) (*MessageResponse, error) {
+	return c.SendMessage(MessageRequest{
+		MessagingProduct: "whatsapp",
+		RecipientType:    "individual",
+		To:               to,
+		Type:             "contacts",
+		Contacts:         contacts,
+	})
+}
+
+// SendReaction reacts to a message with an emoji. Pass an empty emoji to
+// remove a previous reaction.
+func (c *Client) SendReaction(to, messageID, emoji string) (*MessageResponse, error) {
+	return c.SendMessage(MessageRequest{
+		MessagingProduct: "whatsapp",
+		RecipientType:    "individual",
+		To:               to,
+		Type:             "reaction",
+		Reaction: &Reaction{
+			MessageID: messageID,
+			Emoji:     emoji,
+		},
+	})
+}
+
+// SendStickerMessage sends a sticker by uploaded media ID or by URL.
+func (c *Client) SendStickerMessage(to, sticker string) (*MessageResponse, error) {
+	media := &MediaMessage{ID: sticker}
+	if strings.HasPrefix(sticker, "http://") || strings.HasPrefix(sticker, "https://") {
+		media = &MediaMessage{Link: sticker}
+	}
+
+	return c.SendMessage(MessageRequest{
+		MessagingProduct: "whatsapp",
+		RecipientType:    "individual",
+		To:               to,
+		Type:             "sticker",
+		Sticker:          media,
+	})
+}
+
+// SendReplyMessage sends a text message quoting the message being replied to.
+func (c *Client) SendReplyMessage(to, replyToID, text string) (*MessageResponse, error) {
+	return c.SendMessage(MessageRequest{
+		MessagingProduct: "whatsapp",
+		RecipientType:    "individual",
+		To:               to,
+		Type:             "text",
+		Text:             &TextMessage{Body: text},
+		Context:          &MessageContext{MessageID: replyToID},
+	})
+}
+
+func (c *Client) SendTemplateMessage(to, templateName, language string, components []TemplateComponent) (*MessageResponse, error) {
+	return c.SendMessage(NewTemplateMessageRequest(to, templateName, language, components))
+}
+
+// NewTemplateMessageRequest builds the request for an approved message
+// template. The language defaults to Indonesian.
+func NewTemplateMessageRequest(to, templateName, language string, components []TemplateComponent) MessageRequest {
+	if language == "" {
+		language = "id"
+	}
+
+	return MessageRequest{
 		MessagingProduct: "whatsapp",
 		RecipientType:    "individual",
 		To:               to,
 		Type:             "template",
 		Template: &TemplateMessage{
 			Name:       templateName,
-			Language:   Language{Code: "id"},
+			Language:   Language{Code: language},
 			Components: components,
 		},
 	}
+}
+
+// SendMediaMessage sends an image, audio, video or document that was previously
+// uploaded with UploadMedia.
+func (c *Client) SendMediaMessage(to, mediaType, mediaID, caption, filename string) (*MessageResponse, error) {
+	message, err := NewMediaMessageRequest(to, mediaType, mediaID, caption, filename)
+	if err != nil {
+		return nil, err
+	}
 
 	return c.SendMessage(message)
 }
 
+// NewMediaMessageRequest builds the request for media uploaded with
+// UploadMedia.
+func NewMediaMessageRequest(to, mediaType, mediaID, caption, filename string) (MessageRequest, error) {
+	message := MessageRequest{
+		MessagingProduct: "whatsapp",
+		RecipientType:    "individual",
+		To:               to,
+		Type:             mediaType,
+	}
+
+	media := &MediaMessage{
+		ID:      mediaID,
+		Caption: caption,
+	}
+
+	switch mediaType {
+	case "image":
+		message.Image = media
+	case "audio":
+		// Audio messages do not support captions
+		media.Caption = ""
+		message.Audio = media
+	case "video":
+		message.Video = media
+	case "document":
+		media.Filename = filename
+		message.Document = media
+	default:
+		return MessageRequest{}, fmt.Errorf("unsupported media type: %s", mediaType)
+	}
+
+	return message, nil
+}
+
+// UploadMedia uploads a file to the Cloud API and returns its media ID.
+func (c *Client) UploadMedia(filename, mimeType string, data io.Reader) (string, error) {
+	url := fmt.Sprintf("%s/%s/media", c.baseURL, c.config.PhoneNumberID)
+
+	var body bytes.Buffer
+	writer := multipart.NewWriter(&body)
+
+	if err := writer.WriteField("messaging_product", "whatsapp"); err != nil {
+		return "", fmt.Errorf("failed to write form field: %v", err)
+	}
+	if err := writer.WriteField("type", mimeType); err != nil {
+		return "", fmt.Errorf("failed to write form field: %v", err)
+	}
+
+	header := make(textproto.MIMEHeader)
+	header.Set("Content-Disposition", fmt.Sprintf(`form-data; name="file"; filename="%s"`, filename))
+	header.Set("Content-Type", mimeType)
+
+	part, err := writer.CreatePart(header)
+	if err != nil {
+		return "", fmt.Errorf("failed to create form file: %v", err)
+	}
+	if _, err := io.Copy(part, data); err != nil {
+		return "", fmt.Errorf("failed to copy media data: %v", err)
+	}
+	if err := writer.Close(); err != nil {
+		return "", fmt.Errorf("failed to close form: %v", err)
+	}
+
+	req, err := http.NewRequest("POST", url, &body)
+	if err != nil {
+		return "", fmt.Errorf("failed to create request: %v", err)
+	}
+
+	req.Header.Set("Authorization", "Bearer "+c.accessToken)
+	req.Header.Set("Content-Type", writer.FormDataContentType())
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("failed to send request: %v", err)
+	}
+	defer resp.Body.Close()
+
+	respBody, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return "", fmt.Errorf("failed to read response: %v", err)
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("WhatsApp API error: %s", string(respBody))
+	}
+
+	var result UploadMediaResponse
+	if err := json.Unmarshal(respBody, &result); err != nil {
+		return "", fmt.Errorf("failed to unmarshal response: %v", err)
+	}
+
+	if result.Error != nil {
+		return "", fmt.Errorf("WhatsApp error %d: %s", result.Error.Code, result.Error.Message)
+	}
+
+	logger.Log.WithFields(logrus.Fields{
+		"media_id":  result.ID,
+		"mime_type": mimeType,
+	}).Info("Media uploaded successfully")
+
+	return result.ID, nil
+}
+
+// GetMediaInfo resolves a media ID to its download URL and metadata.
+func (c *Client) GetMediaInfo(mediaID string) (*MediaInfo, error) {
+	url := fmt.Sprintf("%s/%s", c.baseURL, mediaID)
+
+	req, err := http.NewRequest("GET", url, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %v", err)
+	}
+
+	req.Header.Set("Authorization", "Bearer "+c.accessToken)
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to send request: %v", err)
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read response: %v", err)
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("WhatsApp API error: %s", string(body))
+	}
+
+	var info MediaInfo
+	if err := json.Unmarshal(body, &info); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal response: %v", err)
+	}
+
+	return &info, nil
+}
+
+// DownloadMedia fetches the binary content of a media ID.
+func (c *Client) DownloadMedia(mediaID string) ([]byte, *MediaInfo, error) {
+	info, err := c.GetMediaInfo(mediaID)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	req, err := http.NewRequest("GET", info.URL, nil)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to create request: %v", err)
+	}
+
+	req.Header.Set("Authorization", "Bearer "+c.accessToken)
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to download media: %v", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(resp.Body)
+		return nil, nil, fmt.Errorf("WhatsApp media download failed: %s", string(body))
+	}
+
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to read media: %v", err)
+	}
+
+	return data, info, nil
+}
+
+// DeleteMedia removes an uploaded media ID from the Cloud API.
+func (c *Client) DeleteMedia(mediaID string) error {
+	url := fmt.Sprintf("%s/%s", c.baseURL, mediaID)
+
+	req, err := http.NewRequest("DELETE", url, nil)
+	if err != nil {
+		return fmt.Errorf("failed to create request: %v", err)
+	}
+
+	req.Header.Set("Authorization", "Bearer "+c.accessToken)
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to send request: %v", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(resp.Body)
+		return fmt.Errorf("WhatsApp API error: %s", string(body))
+	}
+
+	return nil
+}
+
 func (c *Client) Disconnect() error {
 	logger.Log.Info("WhatsApp client disconnected")
 	return nil
@@ -344,8 +890,24 @@ func (c *Client) GetPhoneNumberID() string {
 	return c.config.PhoneNumberID
 }
 
+// VerifyWebhookSignature checks the X-Hub-Signature-256 header, an HMAC-SHA256
+// of the raw request body keyed with the app secret. Deliveries are rejected
+// when no secret is configured.
 func (c *Client) VerifyWebhookSignature(payload []byte, signature string) bool {
-	// Implement webhook signature verification
-	// This is a placeholder - implement actual signature verification
-	return true
+	if c.config.WebhookSecret == "" {
+		return false
+	}
+
+	if !strings.HasPrefix(signature, "sha256=") {
+		return false
+	}
+
+	expected, err := hex.DecodeString(strings.TrimPrefix(signature, "sha256="))
+	if err != nil {
+		return false
+	}
+
+	mac := hmac.New(sha256.New, []byte(c.config.WebhookSecret))
+	mac.Write(payload)
+	return hmac.Equal(mac.Sum(nil), expected)
 }
\ No newline at end of file
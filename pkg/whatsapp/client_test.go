@@ -0,0 +1,110 @@
+package whatsapp
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"testing"
+	"time"
+
+	"whatsapp-bot/internal/config"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNewAPIError(t *testing.T) {
+	response := func(status int, retryAfter string) *http.Response {
+		resp := &http.Response{StatusCode: status, Header: http.Header{}}
+		if retryAfter != "" {
+			resp.Header.Set("Retry-After", retryAfter)
+		}
+		return resp
+	}
+
+	t.Run("ParsesErrorBody", func(t *testing.T) {
+		apiErr := newAPIError(response(http.StatusBadRequest, ""), []byte(`{"error":{"code":131026,"message":"Message undeliverable"}}`))
+		assert.Equal(t, 131026, apiErr.Code)
+		assert.Equal(t, "Message undeliverable", apiErr.Message)
+		assert.False(t, apiErr.Retryable())
+	})
+
+	t.Run("RetryAfterSeconds", func(t *testing.T) {
+		apiErr := newAPIError(response(http.StatusTooManyRequests, "30"), nil)
+		assert.Equal(t, 30*time.Second, apiErr.RetryAfter)
+		assert.True(t, apiErr.Retryable())
+	})
+
+	t.Run("RetryAfterDate", func(t *testing.T) {
+		at := time.Now().Add(time.Minute).UTC().Format(http.TimeFormat)
+		apiErr := newAPIError(response(http.StatusServiceUnavailable, at), nil)
+		assert.InDelta(t, float64(time.Minute), float64(apiErr.RetryAfter), float64(2*time.Second))
+		assert.True(t, apiErr.Retryable())
+	})
+
+	t.Run("InvalidRetryAfter", func(t *testing.T) {
+		apiErr := newAPIError(response(http.StatusTooManyRequests, "soon"), nil)
+		assert.Zero(t, apiErr.RetryAfter)
+	})
+
+	t.Run("RetryableErrorCode", func(t *testing.T) {
+		apiErr := newAPIError(response(http.StatusBadRequest, ""), []byte(`{"error":{"code":130429,"message":"Rate limit hit"}}`))
+		assert.True(t, apiErr.Retryable())
+	})
+}
+
+func TestVerifyWebhookSignature(t *testing.T) {
+	payload := []byte(`{"object":"whatsapp_business_account","entry":[]}`)
+	sign := func(secret string, payload []byte) string {
+		mac := hmac.New(sha256.New, []byte(secret))
+		mac.Write(payload)
+		return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+	}
+
+	client := NewClient(config.WhatsAppConfig{WebhookSecret: "app-secret"})
+
+	testCases := []struct {
+		name      string
+		payload   []byte
+		signature string
+		expected  bool
+	}{
+		{name: "Valid", payload: payload, signature: sign("app-secret", payload), expected: true},
+		{name: "WrongSecret", payload: payload, signature: sign("other-secret", payload), expected: false},
+		{name: "TamperedPayload", payload: []byte(`{"object":"page"}`), signature: sign("app-secret", payload), expected: false},
+		{name: "MissingPrefix", payload: payload, signature: sign("app-secret", payload)[len("sha256="):], expected: false},
+		{name: "InvalidHex", payload: payload, signature: "sha256=not-hex", expected: false},
+		{name: "Empty", payload: payload, signature: "", expected: false},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			assert.Equal(t, tc.expected, client.VerifyWebhookSignature(tc.payload, tc.signature))
+		})
+	}
+
+	t.Run("NoSecretConfigured", func(t *testing.T) {
+		client := NewClient(config.WhatsAppConfig{})
+		assert.False(t, client.VerifyWebhookSignature(payload, sign("", payload)))
+	})
+}
+
+func TestNewMediaMessageRequest(t *testing.T) {
+	t.Run("Document", func(t *testing.T) {
+		req, err := NewMediaMessageRequest("628123", "document", "media-1", "Invoice", "invoice.pdf")
+		assert.NoError(t, err)
+		assert.Equal(t, "document", req.Type)
+		assert.Equal(t, &MediaMessage{ID: "media-1", Caption: "Invoice", Filename: "invoice.pdf"}, req.Document)
+	})
+
+	t.Run("AudioDropsCaption", func(t *testing.T) {
+		req, err := NewMediaMessageRequest("628123", "audio", "media-2", "ignored", "")
+		assert.NoError(t, err)
+		assert.Equal(t, &MediaMessage{ID: "media-2"}, req.Audio)
+	})
+
+	t.Run("UnsupportedType", func(t *testing.T) {
+		_, err := NewMediaMessageRequest("628123", "sticker", "media-3", "", "")
+		assert.Error(t, err)
+	})
+}
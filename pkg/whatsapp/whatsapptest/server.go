@@ -0,0 +1,538 @@
+// Package whatsapptest provides an in-process fake of the WhatsApp Cloud API
+// for tests and local development. Point a client at it through
+// WhatsAppConfig.BaseURL (see Server.Config) and drive the bot by emitting
+// signed webhooks.
+package whatsapptest
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"whatsapp-bot/internal/config"
+	"whatsapp-bot/pkg/whatsapp"
+)
+
+const (
+	DefaultPhoneNumberID = "100000000000001"
+	DefaultAccessToken   = "test-access-token"
+	DefaultAppSecret     = "test-app-secret"
+	DefaultAPIVersion    = "v18.0"
+)
+
+// SentMessage is a message the bot sent through the simulator.
+type SentMessage struct {
+	ID            string
+	PhoneNumberID string
+	Request       whatsapp.MessageRequest
+	SentAt        time.Time
+}
+
+// Text returns the body of a text or reply message.
+func (m SentMessage) Text() string {
+	if m.Request.Text != nil {
+		return m.Request.Text.Body
+	}
+	return ""
+}
+
+// Failure is an error response returned instead of handling a request.
+type Failure struct {
+	StatusCode int
+	Code       int
+	Message    string
+	RetryAfter time.Duration
+}
+
+type media struct {
+	data     []byte
+	mimeType string
+}
+
+// Server is a fake Cloud API. It accepts requests for any phone number ID
+// as long as they carry a known access token.
+type Server struct {
+	*httptest.Server
+
+	PhoneNumberID string
+	AppSecret     string
+	APIVersion    string
+
+	// WebhookURL is where inbound and status webhooks are delivered.
+	WebhookURL string
+
+	mu        sync.Mutex
+	tokens    map[string]bool
+	sent      []SentMessage
+	media     map[string]media
+	failures  []Failure
+	rateLimit int
+	window    int64
+	inWindow  int
+	nextID    int
+	notify    chan struct{}
+}
+
+// NewServer starts a simulator with the default phone number, token and app
+// secret. Call Close when done.
+func NewServer() *Server {
+	s := &Server{
+		PhoneNumberID: DefaultPhoneNumberID,
+		AppSecret:     DefaultAppSecret,
+		APIVersion:    DefaultAPIVersion,
+		tokens:        map[string]bool{DefaultAccessToken: true},
+		media:         make(map[string]media),
+		notify:        make(chan struct{}, 1),
+	}
+	s.Server = httptest.NewServer(http.HandlerFunc(s.handle))
+	return s
+}
+
+// Config returns a WhatsApp configuration that talks to the simulator.
+func (s *Server) Config() config.WhatsAppConfig {
+	return config.WhatsAppConfig{
+		PhoneNumberID: s.PhoneNumberID,
+		AccessToken:   DefaultAccessToken,
+		APIVersion:    s.APIVersion,
+		BaseURL:       s.URL,
+		WebhookSecret: s.AppSecret,
+		WebhookMaxAge: 7 * 24 * time.Hour,
+	}
+}
+
+// AddAccessToken accepts another token, e.g. for a tenant's own number.
+func (s *Server) AddAccessToken(token string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.tokens[token] = true
+}
+
+// SentMessages returns every message sent so far, oldest first.
+func (s *Server) SentMessages() []SentMessage {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]SentMessage(nil), s.sent...)
+}
+
+// MessagesTo returns the messages sent to a recipient, oldest first.
+func (s *Server) MessagesTo(to string) []SentMessage {
+	var messages []SentMessage
+	for _, message := range s.SentMessages() {
+		if message.Request.To == to {
+			messages = append(messages, message)
+		}
+	}
+	return messages
+}
+
+// WaitForMessages blocks until at least n messages were sent to the
+// recipient or the timeout expires, and returns what was sent.
+func (s *Server) WaitForMessages(to string, n int, timeout time.Duration) []SentMessage {
+	deadline := time.After(timeout)
+	for {
+		messages := s.MessagesTo(to)
+		if len(messages) >= n {
+			return messages
+		}
+
+		select {
+		case <-s.notify:
+		case <-time.After(50 * time.Millisecond):
+		case <-deadline:
+			return messages
+		}
+	}
+}
+
+// Reset forgets sent messages, queued failures and the rate limit.
+func (s *Server) Reset() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.sent = nil
+	s.failures = nil
+	s.rateLimit = 0
+}
+
+// FailNext makes the next send requests fail, one failure per request.
+func (s *Server) FailNext(failures ...Failure) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.failures = append(s.failures, failures...)
+}
+
+// SetRateLimit rejects sends beyond limit per second with a 429 and
+// Retry-After, as the Cloud API does. Zero disables the limit.
+func (s *Server) SetRateLimit(limit int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.rateLimit = limit
+}
+
+// AddMedia stores a file that the bot can download by the returned media ID.
+func (s *Server) AddMedia(data []byte, mimeType string) string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	id := s.newID("media")
+	s.media[id] = media{data: data, mimeType: mimeType}
+	return id
+}
+
+func (s *Server) newID(kind string) string {
+	s.nextID++
+	return fmt.Sprintf("sim.%s.%d", kind, s.nextID)
+}
+
+func (s *Server) handle(w http.ResponseWriter, r *http.Request) {
+	parts := strings.Split(strings.Trim(r.URL.Path, "/"), "/")
+
+	// Media downloads use a URL handed out by the media info endpoint
+	if len(parts) == 2 && parts[0] == "download" {
+		if !s.authorized(r) {
+			writeError(w, Failure{StatusCode: http.StatusUnauthorized, Code: 190, Message: "Invalid OAuth access token"})
+			return
+		}
+		s.handleDownload(w, parts[1])
+		return
+	}
+
+	if len(parts) < 2 || parts[0] != s.APIVersion {
+		writeError(w, Failure{StatusCode: http.StatusNotFound, Code: 100, Message: "Unknown path"})
+		return
+	}
+
+	if !s.authorized(r) {
+		writeError(w, Failure{StatusCode: http.StatusUnauthorized, Code: 190, Message: "Invalid OAuth access token"})
+		return
+	}
+
+	switch {
+	case len(parts) == 3 && parts[2] == "messages" && r.Method == http.MethodPost:
+		s.handleSend(w, r, parts[1])
+	case len(parts) == 3 && parts[2] == "media" && r.Method == http.MethodPost:
+		s.handleUpload(w, r)
+	case len(parts) == 2 && r.Method == http.MethodGet:
+		s.handleGetObject(w, parts[1])
+	case len(parts) == 2 && r.Method == http.MethodDelete:
+		s.handleDeleteMedia(w, parts[1])
+	default:
+		writeError(w, Failure{StatusCode: http.StatusNotFound, Code: 100, Message: "Unsupported request"})
+	}
+}
+
+func (s *Server) authorized(r *http.Request) bool {
+	token := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.tokens[token]
+}
+
+func (s *Server) handleSend(w http.ResponseWriter, r *http.Request, phoneNumberID string) {
+	var req whatsapp.MessageRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, Failure{StatusCode: http.StatusBadRequest, Code: 100, Message: "Invalid JSON"})
+		return
+	}
+
+	s.mu.Lock()
+	if failure, ok := s.takeFailure(); ok {
+		s.mu.Unlock()
+		writeError(w, failure)
+		return
+	}
+
+	if !s.allowSend() {
+		s.mu.Unlock()
+		writeError(w, Failure{StatusCode: http.StatusTooManyRequests, Code: 130429, Message: "Rate limit hit", RetryAfter: time.Second})
+		return
+	}
+
+	message := SentMessage{
+		ID:            "wamid." + s.newID("message"),
+		PhoneNumberID: phoneNumberID,
+		Request:       req,
+		SentAt:        time.Now(),
+	}
+	s.sent = append(s.sent, message)
+	s.mu.Unlock()
+
+	// Wake anyone waiting for messages
+	select {
+	case s.notify <- struct{}{}:
+	default:
+	}
+
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"messaging_product": "whatsapp",
+		"contacts":          []map[string]string{{"input": req.To, "wa_id": req.To}},
+		"messages":          []map[string]string{{"id": message.ID}},
+	})
+}
+
+func (s *Server) takeFailure() (Failure, bool) {
+	if len(s.failures) == 0 {
+		return Failure{}, false
+	}
+	failure := s.failures[0]
+	s.failures = s.failures[1:]
+	return failure, true
+}
+
+func (s *Server) allowSend() bool {
+	if s.rateLimit <= 0 {
+		return true
+	}
+
+	now := time.Now().Unix()
+	if now != s.window {
+		s.window = now
+		s.inWindow = 0
+	}
+
+	if s.inWindow >= s.rateLimit {
+		return false
+	}
+	s.inWindow++
+	return true
+}
+
+func (s *Server) handleUpload(w http.ResponseWriter, r *http.Request) {
+	file, header, err := r.FormFile("file")
+	if err != nil {
+		writeError(w, Failure{StatusCode: http.StatusBadRequest, Code: 100, Message: "Missing file"})
+		return
+	}
+	defer file.Close()
+
+	data, err := io.ReadAll(file)
+	if err != nil {
+		writeError(w, Failure{StatusCode: http.StatusBadRequest, Code: 100, Message: "Invalid file"})
+		return
+	}
+
+	id := s.AddMedia(data, header.Header.Get("Content-Type"))
+	writeJSON(w, http.StatusOK, map[string]string{"id": id})
+}
+
+func (s *Server) handleGetObject(w http.ResponseWriter, id string) {
+	s.mu.Lock()
+	m, ok := s.media[id]
+	s.mu.Unlock()
+
+	if ok {
+		sum := sha256.Sum256(m.data)
+		writeJSON(w, http.StatusOK, whatsapp.MediaInfo{
+			ID:       id,
+			URL:      fmt.Sprintf("%s/download/%s", s.URL, id),
+			MimeType: m.mimeType,
+			SHA256:   hex.EncodeToString(sum[:]),
+			FileSize: int64(len(m.data)),
+		})
+		return
+	}
+
+	// Anything else is treated as a phone number lookup
+	writeJSON(w, http.StatusOK, map[string]string{
+		"id":                   id,
+		"display_phone_number": "+1 555-0100",
+		"verified_name":        "Simulator",
+	})
+}
+
+func (s *Server) handleDownload(w http.ResponseWriter, id string) {
+	s.mu.Lock()
+	m, ok := s.media[id]
+	s.mu.Unlock()
+
+	if !ok {
+		writeError(w, Failure{StatusCode: http.StatusNotFound, Code: 100, Message: "Unknown media"})
+		return
+	}
+
+	w.Header().Set("Content-Type", m.mimeType)
+	w.Write(m.data)
+}
+
+func (s *Server) handleDeleteMedia(w http.ResponseWriter, id string) {
+	s.mu.Lock()
+	_, ok := s.media[id]
+	delete(s.media, id)
+	s.mu.Unlock()
+
+	if !ok {
+		writeError(w, Failure{StatusCode: http.StatusNotFound, Code: 100, Message: "Unknown media"})
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]bool{"success": true})
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
+
+func writeError(w http.ResponseWriter, failure Failure) {
+	if failure.StatusCode == 0 {
+		failure.StatusCode = http.StatusBadRequest
+	}
+	if failure.RetryAfter > 0 {
+		w.Header().Set("Retry-After", strconv.Itoa(int(failure.RetryAfter.Seconds())))
+	}
+	writeJSON(w, failure.StatusCode, map[string]interface{}{
+		"error": whatsapp.ErrorResponse{
+			Code:    failure.Code,
+			Message: failure.Message,
+			Type:    "OAuthException",
+		},
+	})
+}
+
+// SendText delivers an inbound text message from a user to the bot and
+// returns the generated message ID.
+func (s *Server) SendText(from, name, body string) (string, error) {
+	return s.SendMessage(from, name, whatsapp.Message{
+		Type: "text",
+		Text: &whatsapp.Text{Body: body},
+	})
+}
+
+// SendListReply delivers a tapped list row from a user to the bot.
+func (s *Server) SendListReply(from, name, rowID, title string) (string, error) {
+	return s.SendMessage(from, name, whatsapp.Message{
+		Type: "interactive",
+		Interactive: &whatsapp.InteractiveReply{
+			Type:      "list_reply",
+			ListReply: &whatsapp.ListReply{ID: rowID, Title: title},
+		},
+	})
+}
+
+// SendButtonReply delivers a tapped reply button from a user to the bot.
+func (s *Server) SendButtonReply(from, name, buttonID, title string) (string, error) {
+	return s.SendMessage(from, name, whatsapp.Message{
+		Type: "interactive",
+		Interactive: &whatsapp.InteractiveReply{
+			Type:        "button_reply",
+			ButtonReply: &whatsapp.ListReply{ID: buttonID, Title: title},
+		},
+	})
+}
+
+// SendMessage delivers an inbound message of any type. From, ID and
+// Timestamp are filled in when empty.
+func (s *Server) SendMessage(from, name string, message whatsapp.Message) (string, error) {
+	if message.ID == "" {
+		s.mu.Lock()
+		message.ID = "wamid." + s.newID("inbound")
+		s.mu.Unlock()
+	}
+	if message.Timestamp == "" {
+		message.Timestamp = strconv.FormatInt(time.Now().Unix(), 10)
+	}
+	message.From = from
+
+	err := s.Deliver(whatsapp.Value{
+		Contacts: []whatsapp.Contact{{Profile: whatsapp.Profile{Name: name}, WaID: from}},
+		Messages: []whatsapp.Message{message},
+	})
+	return message.ID, err
+}
+
+// SendStatus delivers a status callback for a message the bot sent.
+func (s *Server) SendStatus(messageID, status string) error {
+	var recipient string
+	for _, message := range s.SentMessages() {
+		if message.ID == messageID {
+			recipient = message.Request.To
+		}
+	}
+
+	return s.Deliver(whatsapp.Value{
+		Statuses: []whatsapp.Status{{
+			ID:          messageID,
+			Status:      status,
+			Timestamp:   strconv.FormatInt(time.Now().Unix(), 10),
+			RecipientID: recipient,
+		}},
+	})
+}
+
+// Deliver wraps a change value in a webhook payload for the simulator's
+// phone number and posts it, signed, to WebhookURL.
+func (s *Server) Deliver(value whatsapp.Value) error {
+	value.MessagingProduct = "whatsapp"
+	if value.Metadata.PhoneNumberID == "" {
+		value.Metadata = whatsapp.Metadata{
+			DisplayPhoneNumber: "15550100",
+			PhoneNumberID:      s.PhoneNumberID,
+		}
+	}
+
+	return s.DeliverPayload(whatsapp.WebhookPayload{
+		Object: "whatsapp_business_account",
+		Entry: []whatsapp.Entry{{
+			ID:      "sim-waba",
+			Changes: []whatsapp.Change{{Field: "messages", Value: value}},
+		}},
+	})
+}
+
+// DeliverPayload posts a complete webhook payload, signed with AppSecret.
+func (s *Server) DeliverPayload(payload whatsapp.WebhookPayload) error {
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return fmt.Errorf("failed to marshal webhook: %v", err)
+	}
+	return s.DeliverRaw(body, Sign(s.AppSecret, body))
+}
+
+// DeliverRaw posts a webhook body with the given signature header, which
+// lets tests send tampered or unsigned deliveries.
+func (s *Server) DeliverRaw(body []byte, signature string) error {
+	if s.WebhookURL == "" {
+		return fmt.Errorf("webhook URL is not set")
+	}
+
+	req, err := http.NewRequest(http.MethodPost, s.WebhookURL, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("failed to create request: %v", err)
+	}
+
+	req.Header.Set("Content-Type", "application/json")
+	if signature != "" {
+		req.Header.Set("X-Hub-Signature-256", signature)
+	}
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to deliver webhook: %v", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		respBody, _ := io.ReadAll(resp.Body)
+		return fmt.Errorf("webhook rejected with %d: %s", resp.StatusCode, string(respBody))
+	}
+
+	return nil
+}
+
+// Sign returns the X-Hub-Signature-256 header value for a webhook body.
+func Sign(secret string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
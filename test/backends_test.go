@@ -0,0 +1,67 @@
+package test
+
+import (
+	"context"
+	"os"
+	"strconv"
+	"testing"
+
+	"github.com/go-redis/redis/v8"
+	"github.com/jinzhu/gorm"
+	"github.com/stretchr/testify/require"
+	"kilocode.dev/whatsapp-bot/internal/config"
+	"kilocode.dev/whatsapp-bot/internal/database"
+)
+
+// defaultTestRedisDB is the Redis database the tests run on unless
+// TEST_REDIS_DB says otherwise. It is never the bot's own REDIS_DB.
+const defaultTestRedisDB = 15
+
+// testRedisMarker tags a Redis database the tests created. A database
+// holding keys without it belongs to someone else and is never flushed.
+const testRedisMarker = "whatsapp-bot:test-db"
+
+// setupTestDB connects to the test Postgres database, skipping the test
+// when there is none.
+func setupTestDB(t *testing.T, cfg *config.Config) *gorm.DB {
+	cfg.Database.DBName = "whatsapp_bot_test"
+	db, err := database.Initialize(cfg.Database)
+	if err != nil {
+		t.Skipf("Postgres not available: %v", err)
+	}
+	t.Cleanup(func() { db.Close() })
+	return db
+}
+
+// setupTestRedis connects to the dedicated test database and empties it.
+func setupTestRedis(t *testing.T, cfg *config.Config) *redis.Client {
+	testDB := defaultTestRedisDB
+	if value := os.Getenv("TEST_REDIS_DB"); value != "" {
+		n, err := strconv.Atoi(value)
+		require.NoError(t, err, "TEST_REDIS_DB must be a number")
+		testDB = n
+	}
+	if testDB == cfg.Redis.DB {
+		t.Skipf("TEST_REDIS_DB %d is the bot's REDIS_DB; pick another database for the tests", testDB)
+	}
+	cfg.Redis.DB = testDB
+
+	redisClient, err := database.InitializeRedis(cfg.Redis)
+	if err != nil {
+		t.Skipf("Redis not available: %v", err)
+	}
+	t.Cleanup(func() { redisClient.Close() })
+
+	ctx := context.Background()
+	size, err := redisClient.DBSize(ctx).Result()
+	require.NoError(t, err)
+	owned, err := redisClient.Exists(ctx, testRedisMarker).Result()
+	require.NoError(t, err)
+	if size > 0 && owned == 0 {
+		t.Skipf("Redis database %d holds keys the tests didn't create; set TEST_REDIS_DB to an empty database", testDB)
+	}
+
+	require.NoError(t, redisClient.FlushDB(ctx).Err())
+	require.NoError(t, redisClient.Set(ctx, testRedisMarker, 1, 0).Err())
+	return redisClient
+}
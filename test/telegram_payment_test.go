@@ -0,0 +1,151 @@
+package test
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"path"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"kilocode.dev/whatsapp-bot/internal/config"
+	"kilocode.dev/whatsapp-bot/internal/models"
+	"kilocode.dev/whatsapp-bot/internal/services"
+	"kilocode.dev/whatsapp-bot/pkg/telegram"
+)
+
+const telegramCustomerChat = int64(770000001)
+
+// fakeBotAPI answers every Bot API call with success and records the JSON
+// requests, so the bot's replies can be inspected.
+type fakeBotAPI struct {
+	mu       sync.Mutex
+	requests []map[string]interface{}
+}
+
+func (f *fakeBotAPI) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	request := map[string]interface{}{}
+	json.NewDecoder(r.Body).Decode(&request)
+	request["method"] = path.Base(r.URL.Path)
+
+	f.mu.Lock()
+	f.requests = append(f.requests, request)
+	messageID := len(f.requests)
+	f.mu.Unlock()
+
+	w.Header().Set("Content-Type", "application/json")
+	fmt.Fprintf(w, `{"ok":true,"result":{"message_id":%d}}`, messageID)
+}
+
+// payButton returns the callback data of the last stub invoice's pay button.
+func (f *fakeBotAPI) payButton() string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	for i := len(f.requests) - 1; i >= 0; i-- {
+		markup, ok := f.requests[i]["reply_markup"].(map[string]interface{})
+		if !ok {
+			continue
+		}
+		rows, _ := markup["inline_keyboard"].([]interface{})
+		for _, row := range rows {
+			for _, button := range row.([]interface{}) {
+				data, _ := button.(map[string]interface{})["callback_data"].(string)
+				if _, ok := telegram.StubPaymentPayload(data); ok {
+					return data
+				}
+			}
+		}
+	}
+	return ""
+}
+
+func setupTelegramPayments(t *testing.T) (*fakeBotAPI, *services.ServiceManager) {
+	api := &fakeBotAPI{}
+	server := httptest.NewServer(api)
+	t.Cleanup(server.Close)
+
+	cfg := config.LoadConfig()
+	cfg.Telegram.BotToken = "test-token"
+	cfg.Telegram.APIURL = server.URL
+	cfg.Telegram.PaymentProviderToken = telegram.StubProviderToken
+
+	db := setupTestDB(t, cfg)
+	redisClient := setupTestRedis(t, cfg)
+
+	// Telegram contacts of the configured bot belong to the first admin
+	db.Unscoped().Delete(&models.Contact{}, "platform = ? AND telegram_chat_id = ?", services.PlatformTelegram, telegramCustomerChat)
+	admin := &models.User{}
+	db.Where(models.User{Username: "simulator-admin"}).Attrs(models.User{
+		Email:    "simulator-admin@example.com",
+		Password: "unused",
+		IsAdmin:  true,
+	}).FirstOrCreate(admin)
+
+	return api, services.NewServiceManager(db, redisClient, nil, cfg)
+}
+
+// telegramUpdate delivers an update the way the webhook does. Update IDs
+// are unique per run, as saved updates are kept between runs.
+func telegramUpdate(t *testing.T, sm *services.ServiceManager, update map[string]interface{}) {
+	update["update_id"] = time.Now().UnixNano() % 1000000000
+	require.NoError(t, sm.TelegramService.ProcessWebhook(update))
+}
+
+func telegramText(t *testing.T, sm *services.ServiceManager, text string) {
+	telegramUpdate(t, sm, map[string]interface{}{
+		"message": map[string]interface{}{
+			"message_id": time.Now().UnixNano() % 1000000,
+			"date":       time.Now().Unix(),
+			"text":       text,
+			"from":       map[string]interface{}{"id": telegramCustomerChat, "first_name": "Budi"},
+			"chat":       map[string]interface{}{"id": telegramCustomerChat, "type": "private"},
+		},
+	})
+}
+
+func TestTelegramStubPaymentFlow(t *testing.T) {
+	api, sm := setupTelegramPayments(t)
+
+	telegramText(t, sm, "halo")
+
+	contact := &models.Contact{}
+	require.NoError(t, sm.DB.Where("platform = ? AND telegram_chat_id = ?", services.PlatformTelegram, telegramCustomerChat).First(contact).Error)
+
+	sm.DB.Unscoped().Delete(&models.Product{}, "user_id = ? AND name = ?", contact.UserID, "Kopi Susu")
+	product := &models.Product{UserID: contact.UserID, Name: "Kopi Susu", Price: 18000, Currency: "IDR", Stock: 10, IsActive: true}
+	require.NoError(t, sm.DB.Create(product).Error)
+
+	telegramText(t, sm, "pesan kopi susu 2")
+
+	order := &models.Order{}
+	require.NoError(t, sm.DB.Where("contact_id = ? AND created_at > ?", contact.ID, product.CreatedAt).First(order).Error)
+	assert.Equal(t, "pending", order.Status)
+	assert.Equal(t, 36000.0, order.TotalAmount)
+
+	telegramText(t, sm, "bayar "+order.OrderNumber)
+
+	data := api.payButton()
+	require.NotEmpty(t, data)
+	payload, _ := telegram.StubPaymentPayload(data)
+	assert.Equal(t, order.ID.String(), payload)
+
+	telegramUpdate(t, sm, map[string]interface{}{
+		"callback_query": map[string]interface{}{
+			"id":      "stub-pay",
+			"data":    data,
+			"from":    map[string]interface{}{"id": telegramCustomerChat, "first_name": "Budi"},
+			"message": map[string]interface{}{"message_id": 1, "chat": map[string]interface{}{"id": telegramCustomerChat, "type": "private"}},
+		},
+	})
+
+	paid := &models.Order{}
+	require.NoError(t, sm.DB.Where("id = ?", order.ID).First(paid).Error)
+	assert.Equal(t, "confirmed", paid.Status)
+	require.NotNil(t, paid.PaidAt)
+	assert.NotEmpty(t, paid.PaymentChargeID)
+}
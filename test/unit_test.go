@@ -1,12 +1,14 @@
 package test
 
 import (
+	"strings"
 	"testing"
 	"time"
 
 	"github.com/google/uuid"
 	"github.com/stretchr/testify/assert"
 	"kilocode.dev/whatsapp-bot/internal/models"
+	"kilocode.dev/whatsapp-bot/pkg/telegram"
 	"kilocode.dev/whatsapp-bot/pkg/utils"
 )
 
@@ -460,6 +462,26 @@ func TestModels(t *testing.T) {
 		assert.Equal(t, 1024*1024, fileUpload.FileSize)
 		assert.Equal(t, "completed", fileUpload.Status)
 	})
+
+	t.Run("AutoReplyConditions", func(t *testing.T) {
+		conditions := models.AutoReplyConditions{
+			ContactTags:      []string{"vip"},
+			FirstMessageOnly: true,
+			TimeWindow:       "22:00-06:00",
+			Weekdays:         []string{"sat", "sun"},
+		}
+
+		value, err := conditions.Value()
+		assert.NoError(t, err)
+
+		var scanned models.AutoReplyConditions
+		assert.NoError(t, scanned.Scan(value))
+		assert.Equal(t, conditions, scanned)
+
+		assert.NoError(t, scanned.Scan(nil))
+		assert.Equal(t, models.AutoReplyConditions{}, scanned)
+		assert.Error(t, scanned.Scan(42))
+	})
 }
 
 func TestValidation(t *testing.T) {
@@ -719,4 +741,85 @@ func TestContainsFunctions(t *testing.T) {
 		assert.True(t, utils.ContainsInt(slice, 1))
 		assert.True(t, utils.ContainsInt(slice, 5))
 	})
-}
\ No newline at end of file
+}
+
+func TestTelegramFormatter(t *testing.T) {
+	t.Run("EscapeMarkdownV2", func(t *testing.T) {
+		text := telegram.NewFormatter(telegram.ParseModeMarkdownV2).
+			Text("Harga: Rp 1.000 (diskon!) ").
+			Bold("Sepatu_Baru*").
+			Format()
+
+		assert.Equal(t, `Harga: Rp 1\.000 \(diskon\!\) *Sepatu\_Baru\**`, text.Text)
+		assert.Equal(t, telegram.ParseModeMarkdownV2, text.ParseMode)
+	})
+
+	t.Run("EscapeHTML", func(t *testing.T) {
+		text := telegram.NewFormatter(telegram.ParseModeHTML).
+			Text("a<b & c ").
+			Link("toko", "https://example.com/?a=1&b=2").
+			Format()
+
+		assert.Equal(t, `a&lt;b &amp; c <a href="https://example.com/?a=1&amp;b=2">toko</a>`, text.Text)
+	})
+
+	t.Run("EntitiesUseUTF16Offsets", func(t *testing.T) {
+		text := telegram.NewFormatter("").Text("Halo 😀 ").Bold("Budi").Format()
+
+		assert.Equal(t, "Halo 😀 Budi", text.Text)
+		assert.Equal(t, []telegram.MessageEntity{{Type: "bold", Offset: 8, Length: 4}}, text.Entities)
+	})
+
+	t.Run("SplitOnParagraphs", func(t *testing.T) {
+		first := strings.Repeat("a", 60)
+		second := strings.Repeat("b", 60)
+
+		messages := telegram.PlainText(first + "\n\n" + second).Messages(100)
+
+		assert.Len(t, messages, 2)
+		assert.Equal(t, first, messages[0].Text)
+		assert.Equal(t, second, messages[1].Text)
+	})
+
+	t.Run("SplitLongEntity", func(t *testing.T) {
+		messages := telegram.NewFormatter("").Text("Kode: ").Code(strings.Repeat("x", 15)).Messages(10)
+
+		assert.Len(t, messages, 3)
+		assert.Equal(t, "Kode: ", messages[0].Text)
+		assert.Equal(t, []telegram.MessageEntity{{Type: "code", Offset: 0, Length: 10}}, messages[1].Entities)
+		assert.Equal(t, []telegram.MessageEntity{{Type: "code", Offset: 0, Length: 5}}, messages[2].Entities)
+	})
+}
+
+func TestTelegramPayments(t *testing.T) {
+	t.Run("PriceAmountUsesMinorUnits", func(t *testing.T) {
+		assert.Equal(t, 15000000, telegram.PriceAmount(150000, "IDR"))
+		assert.Equal(t, 1999, telegram.PriceAmount(19.99, "usd"))
+		assert.Equal(t, 500, telegram.PriceAmount(500, "JPY"))
+	})
+
+	t.Run("StubPaymentMatchesInvoice", func(t *testing.T) {
+		invoice := telegram.Invoice{
+			Payload:  "order-1",
+			Currency: "IDR",
+			Prices: []telegram.LabeledPrice{
+				{Label: "Kaos x2", Amount: 10000000},
+				{Label: "Topi x1", Amount: 5000000},
+			},
+		}
+
+		query, payment := telegram.StubPayment(telegram.User{ID: 42, FirstName: "Budi"}, invoice)
+
+		assert.Equal(t, int64(42), query.From.ID)
+		assert.Equal(t, 15000000, query.TotalAmount)
+		assert.Equal(t, "order-1", query.InvoicePayload)
+		assert.Equal(t, query.TotalAmount, payment.TotalAmount)
+		assert.Equal(t, "IDR", payment.Currency)
+		assert.NotEmpty(t, payment.TelegramPaymentChargeID)
+	})
+
+	t.Run("StubPaymentPayload", func(t *testing.T) {
+		_, ok := telegram.StubPaymentPayload("menu_main")
+		assert.False(t, ok)
+	})
+}
@@ -0,0 +1,210 @@
+package test
+
+import (
+	"context"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"kilocode.dev/whatsapp-bot/internal/config"
+	"kilocode.dev/whatsapp-bot/internal/handlers"
+	"kilocode.dev/whatsapp-bot/internal/models"
+	"kilocode.dev/whatsapp-bot/internal/services"
+	"kilocode.dev/whatsapp-bot/pkg/whatsapp"
+	"kilocode.dev/whatsapp-bot/pkg/whatsapp/whatsapptest"
+)
+
+const simulatorCustomer = "6281200000001"
+
+// setupSimulator wires the bot to an in-process Cloud API simulator and
+// points the simulator's webhooks at the bot.
+func setupSimulator(t *testing.T) (*whatsapptest.Server, *services.ServiceManager) {
+	sim := whatsapptest.NewServer()
+	t.Cleanup(sim.Close)
+
+	cfg := config.LoadConfig()
+	cfg.WhatsApp = sim.Config()
+	cfg.Outbound.BaseBackoff = 10 * time.Millisecond
+
+	db := setupTestDB(t, cfg)
+	redisClient := setupTestRedis(t, cfg)
+
+	waClient, err := whatsapp.Initialize(cfg.WhatsApp)
+	require.NoError(t, err)
+
+	// Contacts of the default number belong to the first admin
+	db.Unscoped().Delete(&models.Contact{}, "phone_number = ?", simulatorCustomer)
+	admin := &models.User{}
+	db.Where(models.User{Username: "simulator-admin"}).Attrs(models.User{
+		Email:    "simulator-admin@example.com",
+		Password: "unused",
+		IsAdmin:  true,
+	}).FirstOrCreate(admin)
+
+	serviceManager := services.NewServiceManager(db, redisClient, waClient, cfg)
+	ctx, cancel := context.WithCancel(context.Background())
+	serviceManager.OutboundQueue.Start(ctx)
+	t.Cleanup(func() {
+		cancel()
+		serviceManager.OutboundQueue.Stop()
+	})
+
+	// The routes main.go serves
+	router := gin.New()
+	handlers.SetupRoutes(router, serviceManager)
+	bot := httptest.NewServer(router)
+	t.Cleanup(bot.Close)
+
+	sim.WebhookURL = bot.URL + "/webhook/whatsapp"
+	return sim, serviceManager
+}
+
+func TestSimulatorQuizFlow(t *testing.T) {
+	sim, _ := setupSimulator(t)
+
+	_, err := sim.SendText(simulatorCustomer, "Budi", "kuis")
+	require.NoError(t, err)
+
+	sent := sim.WaitForMessages(simulatorCustomer, 1, 5*time.Second)
+	require.NotEmpty(t, sent)
+	question := sent[len(sent)-1].Request
+	require.NotNil(t, question.Interactive)
+	assert.Equal(t, "list", question.Interactive.Type)
+	require.NotEmpty(t, question.Interactive.Action.Sections)
+
+	row := question.Interactive.Action.Sections[0].Rows[0]
+	_, err = sim.SendListReply(simulatorCustomer, "Budi", row.ID, row.Title)
+	require.NoError(t, err)
+
+	sent = sim.WaitForMessages(simulatorCustomer, len(sent)+1, 5*time.Second)
+	verdict := sent[len(sent)-2].Text() + sent[len(sent)-1].Text()
+	assert.True(t, strings.Contains(verdict, "BENAR") || strings.Contains(verdict, "SALAH"))
+}
+
+func TestSimulatorOrderFlow(t *testing.T) {
+	sim, sm := setupSimulator(t)
+
+	_, err := sim.SendText(simulatorCustomer, "Budi", "halo")
+	require.NoError(t, err)
+
+	contact := &models.Contact{}
+	require.Eventually(t, func() bool {
+		return sm.DB.Where("phone_number = ?", simulatorCustomer).First(contact).Error == nil
+	}, 5*time.Second, 50*time.Millisecond)
+
+	sm.DB.Unscoped().Delete(&models.Product{}, "user_id = ? AND name = ?", contact.UserID, "Nasi Goreng")
+	product := &models.Product{UserID: contact.UserID, Name: "Nasi Goreng", Price: 15000, Currency: "IDR", Stock: 5, IsActive: true}
+	require.NoError(t, sm.DB.Create(product).Error)
+
+	inboundID, err := sim.SendText(simulatorCustomer, "Budi", "pesan nasi goreng 2")
+	require.NoError(t, err)
+
+	order := &models.Order{}
+	require.Eventually(t, func() bool {
+		return sm.DB.Where("contact_id = ? AND created_at > ?", contact.ID, product.CreatedAt).First(order).Error == nil
+	}, 5*time.Second, 50*time.Millisecond)
+	assert.Equal(t, contact.UserID, order.UserID)
+	assert.Equal(t, "pending", order.Status)
+	assert.Equal(t, 30000.0, order.TotalAmount)
+
+	var items []models.OrderItem
+	sm.DB.Where("order_id = ?", order.ID).Find(&items)
+	require.Len(t, items, 1)
+	assert.Equal(t, product.ID, items[0].ProductID)
+	assert.Equal(t, 2, items[0].Quantity)
+
+	var reaction *whatsapp.Reaction
+	deadline := time.Now().Add(5 * time.Second)
+	for reaction == nil && time.Now().Before(deadline) {
+		for _, message := range sim.WaitForMessages(simulatorCustomer, 1, time.Second) {
+			if message.Request.Reaction != nil {
+				reaction = message.Request.Reaction
+			}
+		}
+	}
+
+	require.NotNil(t, reaction)
+	assert.Equal(t, inboundID, reaction.MessageID)
+	assert.Equal(t, "✅", reaction.Emoji)
+}
+
+func TestSimulatorReminderFlow(t *testing.T) {
+	sim, sm := setupSimulator(t)
+
+	// Writing in opens the service window for the reminder
+	_, err := sim.SendText(simulatorCustomer, "Budi", "halo")
+	require.NoError(t, err)
+
+	contact := &models.Contact{}
+	require.Eventually(t, func() bool {
+		return sm.DB.Where("phone_number = ?", simulatorCustomer).First(contact).Error == nil
+	}, 5*time.Second, 50*time.Millisecond)
+
+	_, err = sm.ReminderService.CreateReminder(contact.UserID, contact.ID, "Minum obat", "Jangan lupa minum obat", time.Now().Add(-time.Minute), false, "none")
+	require.NoError(t, err)
+	require.NoError(t, sm.ReminderService.ProcessReminders())
+
+	var found bool
+	for _, message := range sim.WaitForMessages(simulatorCustomer, 1, 5*time.Second) {
+		if strings.Contains(message.Text(), "Minum obat") {
+			found = true
+		}
+	}
+	assert.True(t, found)
+}
+
+func TestSimulatorRetriesRateLimitedSend(t *testing.T) {
+	sim, sm := setupSimulator(t)
+
+	_, err := sim.SendText(simulatorCustomer, "Budi", "halo")
+	require.NoError(t, err)
+
+	contact := &models.Contact{}
+	require.Eventually(t, func() bool {
+		return sm.DB.Where("phone_number = ?", simulatorCustomer).First(contact).Error == nil
+	}, 5*time.Second, 50*time.Millisecond)
+
+	sim.Reset()
+	sim.FailNext(whatsapptest.Failure{StatusCode: 429, Code: 130429, Message: "Rate limit hit", RetryAfter: time.Second})
+
+	_, err = sm.WhatsAppService.SendMessage(contact.UserID, simulatorCustomer, "Halo lagi", "text")
+	require.NoError(t, err)
+
+	sent := sim.WaitForMessages(simulatorCustomer, 1, 10*time.Second)
+	require.Len(t, sent, 1)
+	assert.Equal(t, "Halo lagi", sent[0].Text())
+}
+
+func TestSimulatorRejectsUnsignedWebhook(t *testing.T) {
+	sim, _ := setupSimulator(t)
+
+	err := sim.DeliverRaw([]byte(`{"object":"whatsapp_business_account","entry":[]}`), "")
+	assert.Error(t, err)
+
+	err = sim.DeliverRaw([]byte(`{"object":"whatsapp_business_account","entry":[]}`), whatsapptest.Sign("wrong-secret", []byte("{}")))
+	assert.Error(t, err)
+}
+
+func TestSimulatorSkipsRedeliveredMessage(t *testing.T) {
+	sim, sm := setupSimulator(t)
+
+	message := whatsapp.Message{
+		ID:   "wamid.redelivered",
+		Type: "text",
+		Text: &whatsapp.Text{Body: "halo"},
+	}
+	sm.DB.Unscoped().Delete(&models.Message{}, "message_id = ?", message.ID)
+
+	_, err := sim.SendMessage(simulatorCustomer, "Budi", message)
+	require.NoError(t, err)
+	_, err = sim.SendMessage(simulatorCustomer, "Budi", message)
+	require.NoError(t, err)
+
+	var count int
+	sm.DB.Model(&models.Message{}).Where("message_id = ?", message.ID).Count(&count)
+	assert.Equal(t, 1, count)
+}